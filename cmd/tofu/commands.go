@@ -58,6 +58,7 @@ func initCommands(
 	ctx context.Context,
 	originalWorkingDir string,
 	streams *terminal.Streams,
+	diagsFile *views.DiagnosticsFile,
 	config *cliconfig.Config,
 	services *disco.Disco,
 	providerSrc getproviders.Source,
@@ -89,7 +90,7 @@ func initCommands(
 	meta := command.Meta{
 		WorkingDir: wd,
 		Streams:    streams,
-		View:       views.NewView(streams).SetRunningInAutomation(inAutomation),
+		View:       views.NewView(streams).SetRunningInAutomation(inAutomation).SetDiagnosticsFile(diagsFile),
 
 		Color:            true,
 		GlobalPluginDirs: globalPluginDirs(),
@@ -398,6 +399,12 @@ func initCommands(
 			}, nil
 		},
 
+		"state moves": func() (cli.Command, error) {
+			return &command.StateMovesCommand{
+				Meta: meta,
+			}, nil
+		},
+
 		"state mv": func() (cli.Command, error) {
 			return &command.StateMvCommand{
 				StateMeta: command.StateMeta{
@@ -428,6 +435,18 @@ func initCommands(
 			}, nil
 		},
 
+		"state encrypt": func() (cli.Command, error) {
+			return &command.StateEncryptCommand{
+				Meta: meta,
+			}, nil
+		},
+
+		"state decrypt": func() (cli.Command, error) {
+			return &command.StateDecryptCommand{
+				Meta: meta,
+			}, nil
+		},
+
 		"state show": func() (cli.Command, error) {
 			return &command.StateShowCommand{
 				Meta: meta,
@@ -25,6 +25,7 @@ import (
 	"github.com/opentofu/opentofu/internal/addrs"
 	"github.com/opentofu/opentofu/internal/command/cliconfig"
 	"github.com/opentofu/opentofu/internal/command/format"
+	"github.com/opentofu/opentofu/internal/command/views"
 	"github.com/opentofu/opentofu/internal/didyoumean"
 	"github.com/opentofu/opentofu/internal/httpclient"
 	"github.com/opentofu/opentofu/internal/logging"
@@ -226,6 +227,27 @@ func realMain() int {
 		return 1
 	}
 
+	// The arguments can also begin with a -diagnostics-json-file option to
+	// ask OpenTofu to record all of the diagnostics it reports in a file, as
+	// newline-delimited JSON objects. We create the file before handling
+	// -chdir so that a relative path is resolved against the true working
+	// directory.
+	diagsFilePath, args, err := extractDiagnosticsJSONFileOption(args)
+	if err != nil {
+		Ui.Error(fmt.Sprintf("Invalid -diagnostics-json-file option: %s", err))
+		return 1
+	}
+	var diagsFile *views.DiagnosticsFile
+	if diagsFilePath != "" {
+		f, err := os.Create(diagsFilePath)
+		if err != nil {
+			Ui.Error(fmt.Sprintf("Error handling -diagnostics-json-file option: %s", err))
+			return 1
+		}
+		defer f.Close()
+		diagsFile = views.NewDiagnosticsFile(f)
+	}
+
 	// The arguments can begin with a -chdir option to ask OpenTofu to switch
 	// to a different working directory for the rest of its work. If that
 	// option is present then extractChdirOption returns a trimmed args with that option removed.
@@ -248,7 +270,7 @@ func realMain() int {
 		// in case they need to refer back to it for any special reason, though
 		// they should primarily be working with the override working directory
 		// that we've now switched to above.
-		initCommands(ctx, originalWd, streams, config, services, providerSrc, providerDevOverrides, unmanagedProviders)
+		initCommands(ctx, originalWd, streams, diagsFile, config, services, providerSrc, providerDevOverrides, unmanagedProviders)
 	}
 
 	// Attempt to ensure the config directory exists.
@@ -458,24 +480,35 @@ func parseReattachProviders(in string) (map[addrs.Provider]*plugin.ReattachConfi
 }
 
 func extractChdirOption(args []string) (string, []string, error) {
+	return extractGlobalOption(args, "-chdir", "a directory path, like -chdir=example")
+}
+
+func extractDiagnosticsJSONFileOption(args []string) (string, []string, error) {
+	return extractGlobalOption(args, "-diagnostics-json-file", "a file path, like -diagnostics-json-file=diags.json")
+}
+
+// extractGlobalOption looks for the given subcommand-agnostic option at the
+// start of the arguments and returns its value along with the arguments
+// without it. The example describes the expected value in the error returned
+// when the option has no value.
+func extractGlobalOption(args []string, argName, example string) (string, []string, error) {
 	if len(args) == 0 {
 		return "", args, nil
 	}
 
-	const argName = "-chdir"
-	const argPrefix = argName + "="
+	argPrefix := argName + "="
 	var argValue string
 	var argPos int
 
 	for i, arg := range args {
 		if !strings.HasPrefix(arg, "-") {
-			// Because the chdir option is a subcommand-agnostic one, we require
-			// it to appear before any subcommand argument, so if we find a
-			// non-option before we find -chdir then we are finished.
+			// Because global options are subcommand-agnostic, we require
+			// them to appear before any subcommand argument, so if we find a
+			// non-option before we find the option then we are finished.
 			break
 		}
 		if arg == argName || arg == argPrefix {
-			return "", args, fmt.Errorf("must include an equals sign followed by a directory path, like -chdir=example")
+			return "", args, fmt.Errorf("must include an equals sign followed by %s", example)
 		}
 		if strings.HasPrefix(arg, argPrefix) {
 			argPos = i
@@ -484,8 +517,8 @@ func extractChdirOption(args []string) (string, []string, error) {
 	}
 
 	// When we fall out here, we'll have populated argValue with a non-empty
-	// string if the -chdir=... option was present and valid, or left it
-	// empty if it wasn't present.
+	// string if the option was present and valid, or left it empty if it
+	// wasn't present.
 	if argValue == "" {
 		return "", args, nil
 	}
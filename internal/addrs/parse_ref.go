@@ -85,8 +85,8 @@ func ParseRef(traversal hcl.Traversal) (*Reference, tfdiags.Diagnostics) {
 	return ref, diags
 }
 
-// ParseRefFromTestingScope adds check blocks and outputs into the available
-// references returned by ParseRef.
+// ParseRefFromTestingScope adds check blocks, outputs and the summary of the
+// planned changes into the available references returned by ParseRef.
 //
 // The testing files and functionality have a slightly expanded referencing
 // scope and so should use this function to retrieve references.
@@ -113,6 +113,14 @@ func ParseRefFromTestingScope(traversal hcl.Traversal) (*Reference, tfdiags.Diag
 			Remaining:   remain,
 		}
 		diags = checkDiags
+	case "plan":
+		name, rng, remain, planDiags := parseSingleAttrRef(traversal)
+		reference = &Reference{
+			Subject:     PlanAttr{Name: name},
+			SourceRange: tfdiags.SourceRangeFromHCL(rng),
+			Remaining:   remain,
+		}
+		diags = planDiags
 	}
 
 	if reference != nil {
@@ -122,7 +130,7 @@ func ParseRefFromTestingScope(traversal hcl.Traversal) (*Reference, tfdiags.Diag
 		return reference, diags
 	}
 
-	// If it's not an output or a check block, then just parse it as normal.
+	// If it's not an output, a check block or the plan, then just parse it as normal.
 	return ParseRef(traversal)
 }
 
@@ -70,6 +70,25 @@ func TestParseRefInTestingScope(t *testing.T) {
 			`The "check" object does not support this operation.`,
 		},
 
+		{
+			`plan.add`,
+			&Reference{
+				Subject: PlanAttr{
+					Name: "add",
+				},
+				SourceRange: tfdiags.SourceRange{
+					Start: tfdiags.SourcePos{Line: 1, Column: 1, Byte: 0},
+					End:   tfdiags.SourcePos{Line: 1, Column: 9, Byte: 8},
+				},
+			},
+			``,
+		},
+		{
+			`plan`,
+			nil,
+			`The "plan" object cannot be accessed directly. Instead, access one of its attributes.`,
+		},
+
 		// Sanity check at least one of the others works to verify it does
 		// fall through to the core function.
 		{
@@ -0,0 +1,24 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package addrs
+
+// PlanAttr is the address of an attribute of the "plan" object, like
+// "plan.add", which summarizes the planned changes in the assertions of a
+// testing "run" block.
+type PlanAttr struct {
+	referenceable
+	Name string
+}
+
+func (pa PlanAttr) String() string {
+	return "plan." + pa.Name
+}
+
+func (pa PlanAttr) UniqueKey() UniqueKey {
+	return pa // A PlanAttr is its own UniqueKey
+}
+
+func (pa PlanAttr) uniqueKeySigil() {}
@@ -152,6 +152,15 @@ type Enhanced interface {
 	ServiceDiscoveryAliases() ([]HostAlias, error)
 }
 
+// Validator is implemented by backends that can check that their
+// configuration grants the access they need, without reading or writing any
+// state. It's used by "tofu init -backend-validate".
+type Validator interface {
+	// Validate returns an error describing the access that's missing, if
+	// any. It's only called on a configured backend.
+	Validate(context.Context) error
+}
+
 // Local implements additional behavior on a Backend that allows local
 // operations in addition to remote operations.
 //
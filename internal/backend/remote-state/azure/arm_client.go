@@ -9,7 +9,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2017-03-09/resources/mgmt/resources"
@@ -23,23 +25,47 @@ import (
 	"github.com/opentofu/opentofu/version"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
+	"golang.org/x/oauth2"
 )
 
 type ArmClient struct {
 	// These Clients are only initialized if an Access Key isn't provided
 	groupsClient          *resources.GroupsClient
 	storageAccountsClient *armStorage.AccountsClient
+	blobServicesClient    *armStorage.BlobServicesClient
 	containersClient      *containers.Client
 	blobsClient           *blobs.Client
 
 	// azureAdStorageAuth is only here if we're using AzureAD Authentication but is an Authorizer for Storage
 	azureAdStorageAuth *autorest.Authorizer
 
+	// keyVaultAuth is only here if a Key Vault is used, for the Access Key or
+	// for client-side encryption, and is an Authorizer for Key Vault
+	keyVaultAuth autorest.Authorizer
+
 	accessKey          string
 	environment        azure.Environment
 	resourceGroupName  string
 	storageAccountName string
 	sasToken           string
+
+	// sender is used by every client built from this ArmClient to send its
+	// HTTP requests.
+	sender autorest.Sender
+
+	// clientRequestIDPrefix is prepended to the generated client request IDs.
+	clientRequestIDPrefix string
+
+	// throttleRetry controls how the requests Azure throttled are retried.
+	throttleRetry throttleRetryPolicy
+
+	// tokenExpiry is when the Azure AD token the clients authenticate with
+	// expires, or zero when no token is used or its expiry isn't known.
+	tokenExpiry time.Time
+
+	// endpointWarning, when set, warns that the custom Resource Manager
+	// endpoint is used rather than the environment's.
+	endpointWarning string
 }
 
 func buildArmClient(ctx context.Context, config BackendConfig) (*ArmClient, error) {
@@ -48,22 +74,71 @@ func buildArmClient(ctx context.Context, config BackendConfig) (*ArmClient, erro
 		return nil, err
 	}
 
+	proxy, err := buildProxy(config.ProxyURL, config.ProxyFromEnvironment)
+	if err != nil {
+		return nil, err
+	}
+
 	client := ArmClient{
 		environment:        *env,
 		resourceGroupName:  config.ResourceGroupName,
 		storageAccountName: config.StorageAccountName,
+		sender:             buildSender(proxy),
+
+		clientRequestIDPrefix: config.ClientRequestIDPrefix,
+		throttleRetry:         throttleRetryPolicy{MaxRetries: config.MaxRetries},
+	}
+	// storage_endpoint_suffix or a connection string may name the endpoints
+	// of another cloud than the environment's
+	client.environment.StorageEndpointSuffix, err = resolveStorageEndpointSuffix(*env, config.StorageEndpointSuffix, config.StorageAccountName)
+	if err != nil {
+		return nil, err
+	}
+
+	// an Access Key held in a Key Vault is read with the credentials
+	// configured for the other clients
+	accessKeyRef, err := parseKeyVaultReference(config.AccessKey, *env)
+	if err != nil {
+		return nil, fmt.Errorf("access_key: %w", err)
+	}
+
+	// the key is checked before obtaining the credentials to use it with
+	if config.ClientSideEncryptionKeyID != "" {
+		if _, err := parseKeyVaultURI(config.ClientSideEncryptionKeyID, "keys", *env); err != nil {
+			return nil, fmt.Errorf("client_side_encryption_key_id: %w", err)
+		}
 	}
 
+	// the credentials are still needed for Key Vault when it's used
+	useKeyVault := accessKeyRef != nil || config.ClientSideEncryptionKeyID != ""
+
 	// if we have an Access Key - we don't need the other clients
-	if config.AccessKey != "" {
+	if config.AccessKey != "" && accessKeyRef == nil {
 		client.accessKey = config.AccessKey
-		return &client, nil
+		if !useKeyVault {
+			return &client, nil
+		}
 	}
 
 	// likewise with a SAS token
-	if config.SasToken != "" {
-		client.sasToken = config.SasToken
-		return &client, nil
+	if config.AccessKey == "" && config.SasToken != "" {
+		sasToken, err := sasTokenForAccount(config.SasToken, config.StorageAccountName)
+		if err != nil {
+			return nil, err
+		}
+		client.sasToken = sasToken
+		if !useKeyVault {
+			return &client, nil
+		}
+	}
+
+	if err := validateTenantID(config); err != nil {
+		return nil, err
+	}
+
+	oidcRequestURL, err := oidcRequestURLWithAudience(config.OIDCRequestURL, config.OIDCAudience)
+	if err != nil {
+		return nil, err
 	}
 
 	builder := authentication.Builder{
@@ -88,7 +163,7 @@ func buildArmClient(ctx context.Context, config BackendConfig) (*ArmClient, erro
 		// OIDC
 		IDToken:             config.OIDCToken,
 		IDTokenFilePath:     config.OIDCTokenFilePath,
-		IDTokenRequestURL:   config.OIDCRequestURL,
+		IDTokenRequestURL:   oidcRequestURL,
 		IDTokenRequestToken: config.OIDCRequestToken,
 
 		// Feature Toggles
@@ -99,48 +174,148 @@ func buildArmClient(ctx context.Context, config BackendConfig) (*ArmClient, erro
 		SupportsOIDCAuth:               config.UseOIDC,
 		UseMicrosoftGraph:              true,
 	}
+	if err := checkOIDCTokenAudience(config.OIDCToken, config.OIDCAudience); err != nil {
+		return nil, fmt.Errorf("oidc_token: %w", err)
+	}
 	armConfig, err := builder.Build()
 	if err != nil {
 		return nil, fmt.Errorf("Error building ARM Config: %w", err)
 	}
 
-	oauthConfig, err := armConfig.BuildOAuthConfig(env.ActiveDirectoryEndpoint)
+	hamiltonEnv, err := environments.EnvironmentFromString(config.Environment)
 	if err != nil {
 		return nil, err
 	}
 
-	hamiltonEnv, err := environments.EnvironmentFromString(config.Environment)
-	if err != nil {
-		return nil, err
+	// ad_authority_host takes precedence over the environment's authority
+	activeDirectoryEndpoint := env.ActiveDirectoryEndpoint
+	if config.ADAuthorityHost != "" {
+		log.Printf("[DEBUG] Obtaining Azure AD tokens from the authority host %q", config.ADAuthorityHost)
+		activeDirectoryEndpoint = config.ADAuthorityHost + "/"
+		hamiltonEnv.AzureADEndpoint = environments.AzureADEndpoint(config.ADAuthorityHost)
 	}
 
-	sender := sender.BuildSender("backend/remote-state/azure")
-	log.Printf("[DEBUG] Obtaining an MSAL / Microsoft Graph token for Resource Manager..")
-	auth, err := armConfig.GetMSALToken(ctx, hamiltonEnv.ResourceManager, sender, oauthConfig, env.TokenAudience)
+	oauthConfig, err := armConfig.BuildOAuthConfig(activeDirectoryEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	if config.UseAzureADAuthentication {
-		log.Printf("[DEBUG] Obtaining an MSAL / Microsoft Graph token for Storage..")
-		storageAuth, err := armConfig.GetMSALToken(ctx, hamiltonEnv.Storage, sender, oauthConfig, env.ResourceIdentifiers.Storage)
+	sender := sender.BuildSender("backend/remote-state/azure")
+	getMSALToken := func(api environments.Api, tokenAudience string) (autorest.Authorizer, error) {
+		if config.ADAuthorityHost != "" {
+			if auth, ok, err := authorityHostAuth(ctx, config, armConfig, oidcRequestURL, hamiltonEnv, api); ok {
+				return auth, err
+			}
+		}
+		return armConfig.GetMSALToken(ctx, api, sender, oauthConfig, tokenAudience)
+	}
+	var auth autorest.Authorizer
+	if useFederatedTokenFile(config, armConfig) {
+		log.Printf("[DEBUG] Obtaining MSAL / Microsoft Graph tokens with the OIDC token file %q, read on each refresh", config.OIDCTokenFilePath)
+		auth = federatedTokenFileAuth(ctx, config, armConfig, hamiltonEnv, hamiltonEnv.ResourceManager)
+		if config.UseAzureADAuthentication {
+			storageAuth := federatedTokenFileAuth(ctx, config, armConfig, hamiltonEnv, hamiltonEnv.Storage)
+			client.azureAdStorageAuth = &storageAuth
+		}
+	} else {
+		log.Printf("[DEBUG] Obtaining an MSAL / Microsoft Graph token for Resource Manager..")
+		auth, err = getMSALToken(hamiltonEnv.ResourceManager, env.TokenAudience)
 		if err != nil {
 			return nil, err
 		}
-		client.azureAdStorageAuth = &storageAuth
+
+		if config.UseAzureADAuthentication {
+			log.Printf("[DEBUG] Obtaining an MSAL / Microsoft Graph token for Storage..")
+			storageAuth, err := getMSALToken(hamiltonEnv.Storage, env.ResourceIdentifiers.Storage)
+			if err != nil {
+				return nil, err
+			}
+			client.azureAdStorageAuth = &storageAuth
+		}
+	}
+
+	if useKeyVault {
+		if useFederatedTokenFile(config, armConfig) {
+			client.keyVaultAuth = federatedTokenFileAuth(ctx, config, armConfig, hamiltonEnv, hamiltonEnv.KeyVault)
+		} else {
+			log.Printf("[DEBUG] Obtaining an MSAL / Microsoft Graph token for Key Vault..")
+			client.keyVaultAuth, err = getMSALToken(hamiltonEnv.KeyVault, env.ResourceIdentifiers.KeyVault)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if accessKeyRef != nil {
+		log.Printf("[DEBUG] Reading the Access Key from secret %q in Key Vault %q..", accessKeyRef.name, accessKeyRef.vaultBaseURL)
+		client.accessKey, err = client.resolveKeyVaultSecret(ctx, accessKeyRef, client.keyVaultAuth)
+		if err != nil {
+			return nil, fmt.Errorf("access_key: %w", err)
+		}
+	}
+	if client.accessKey != "" || client.sasToken != "" {
+		return &client, nil
 	}
 
-	accountsClient := armStorage.NewAccountsClientWithBaseURI(env.ResourceManagerEndpoint, armConfig.SubscriptionID)
+	resourceManagerEndpoint, endpointWarning := resolveResourceManagerEndpoint(*env, config.CustomResourceManagerEndpoint)
+	client.endpointWarning = endpointWarning
+
+	accountsClient := armStorage.NewAccountsClientWithBaseURI(resourceManagerEndpoint, armConfig.SubscriptionID)
 	client.configureClient(&accountsClient.Client, auth)
 	client.storageAccountsClient = &accountsClient
 
-	groupsClient := resources.NewGroupsClientWithBaseURI(env.ResourceManagerEndpoint, armConfig.SubscriptionID)
+	blobServicesClient := armStorage.NewBlobServicesClientWithBaseURI(resourceManagerEndpoint, armConfig.SubscriptionID)
+	client.configureClient(&blobServicesClient.Client, auth)
+	client.blobServicesClient = &blobServicesClient
+
+	groupsClient := resources.NewGroupsClientWithBaseURI(resourceManagerEndpoint, armConfig.SubscriptionID)
 	client.configureClient(&groupsClient.Client, auth)
 	client.groupsClient = &groupsClient
 
+	// The state is accessed with the Storage token when using Azure AD
+	// authentication for it, and otherwise with the access keys listed using
+	// the Resource Manager token.
+	tokenAuth := auth
+	if client.azureAdStorageAuth != nil {
+		tokenAuth = *client.azureAdStorageAuth
+	}
+	client.tokenExpiry = authorizerTokenExpiry(tokenAuth)
+
 	return &client, nil
 }
 
+// authorizerTokenExpiry returns when the token of the given authorizer
+// expires, obtaining the token if it hasn't been yet. It returns zero for
+// authorizers that don't expose their token, or when the token can't be
+// obtained, in which case the error surfaces with the first request.
+func authorizerTokenExpiry(auth autorest.Authorizer) time.Time {
+	source, ok := auth.(interface{ Token() (*oauth2.Token, error) })
+	if !ok {
+		return time.Time{}
+	}
+	token, err := source.Token()
+	if err != nil {
+		log.Printf("[DEBUG] Unable to determine the expiry of the Azure AD token: %s", err)
+		return time.Time{}
+	}
+	return token.Expiry
+}
+
+// tokenExpiryWarning returns a warning if a token expiring at the given
+// time would expire within the given window from now, or "" otherwise.
+func tokenExpiryWarning(expiry time.Time, window time.Duration, now time.Time) string {
+	if expiry.IsZero() || window <= 0 {
+		return ""
+	}
+	remaining := expiry.Sub(now)
+	if remaining >= window {
+		return ""
+	}
+	if remaining <= 0 {
+		return fmt.Sprintf("The Azure AD token used by the backend expired at %s", expiry.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("The Azure AD token used by the backend expires at %s, in %s, within the token_expiry_warning window of %s; operations outliving it may fail", expiry.Format(time.RFC3339), remaining.Round(time.Second), window)
+}
+
 func (c ArmClient) getBlobClient(ctx context.Context) (*blobs.Client, error) {
 	if c.sasToken != "" {
 		log.Printf("[DEBUG] Building the Blob Client from a SAS Token")
@@ -186,6 +361,22 @@ func (c ArmClient) getBlobClient(ctx context.Context) (*blobs.Client, error) {
 	return &blobsClient, nil
 }
 
+// checkSharedKeyAccessDisabled returns an error unless the Storage Account is
+// configured to reject requests authorized with Shared Key, which includes
+// its access keys and SAS tokens. An account that doesn't report the setting
+// allows Shared Key access, as that's the default.
+func (c ArmClient) checkSharedKeyAccessDisabled(ctx context.Context) error {
+	account, err := c.storageAccountsClient.GetProperties(ctx, c.resourceGroupName, c.storageAccountName, "")
+	if err != nil {
+		return fmt.Errorf("Error retrieving properties of Storage Account %q: %w", c.storageAccountName, err)
+	}
+
+	if props := account.AccountProperties; props == nil || props.AllowSharedKeyAccess == nil || *props.AllowSharedKeyAccess {
+		return fmt.Errorf("Storage Account %q allows Shared Key access, but require_shared_key_disabled is set. Disable Shared Key access on the Storage Account for Azure AD to be the only way to access it", c.storageAccountName)
+	}
+	return nil
+}
+
 func (c ArmClient) getContainersClient(ctx context.Context) (*containers.Client, error) {
 	if c.sasToken != "" {
 		log.Printf("[DEBUG] Building the Container Client from a SAS Token")
@@ -234,7 +425,12 @@ func (c ArmClient) getContainersClient(ctx context.Context) (*containers.Client,
 func (c *ArmClient) configureClient(client *autorest.Client, auth autorest.Authorizer) {
 	client.UserAgent = buildUserAgent()
 	client.Authorizer = auth
-	client.Sender = buildSender()
+	// the request is only signed once the client request ID is set
+	client.Sender = autorest.DecorateSender(c.sender, withAuthorization(auth), withRequestSummaryLogging(), withThrottleRetries(c.throttleRetry), withClientRequestIDHeader(c.clientRequestIDPrefix))
+	unexpectedResponseCheck, blobPermissionCheck := withUnexpectedResponseCheck(), withBlobPermissionCheck()
+	client.ResponseInspector = func(r autorest.Responder) autorest.Responder {
+		return unexpectedResponseCheck(blobPermissionCheck(r))
+	}
 	client.SkipResourceProviderRegistration = false
 	client.PollingDuration = 60 * time.Minute
 }
@@ -249,3 +445,79 @@ func buildUserAgent() string {
 
 	return userAgent
 }
+
+// sasTokenForAccount returns the SAS token to use from the configured value,
+// which may be a full SAS URL rather than just the token. The account of a
+// SAS URL is known from its host name, and must be the configured Storage
+// Account: a token for another account would fail to authorize in confusing
+// ways, or worse, succeed against the wrong container.
+func sasTokenForAccount(value, accountName string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		// just a token, which doesn't name its account
+		return value, nil
+	}
+
+	hostAccount, _, _ := strings.Cut(u.Hostname(), ".")
+	if !strings.EqualFold(hostAccount, accountName) {
+		return "", fmt.Errorf("The SAS Token is a URL for the Storage Account %q, but storage_account_name is %q", hostAccount, accountName)
+	}
+	return u.RawQuery, nil
+}
+
+// resolveResourceManagerEndpoint returns the Resource Manager endpoint to
+// use: an explicitly configured endpoint always wins, and otherwise the
+// endpoint is derived from the environment. It also returns a warning if the
+// endpoint differs from the environment's, or "" otherwise.
+func resolveResourceManagerEndpoint(env azure.Environment, endpoint string) (string, string) {
+	if endpoint == "" {
+		return env.ResourceManagerEndpoint, ""
+	}
+	if !strings.EqualFold(strings.TrimSuffix(endpoint, "/"), strings.TrimSuffix(env.ResourceManagerEndpoint, "/")) {
+		return endpoint, fmt.Sprintf("Both the environment %q and a custom endpoint are set; using the endpoint %q rather than the environment's %q for Resource Manager", env.Name, endpoint, env.ResourceManagerEndpoint)
+	}
+	return endpoint, ""
+}
+
+// resolveStorageEndpointSuffix returns the suffix of the endpoints of the
+// Storage Account, such as core.windows.net for
+// https://<account>.blob.core.windows.net: an explicitly configured suffix
+// always wins, and otherwise the suffix is the environment's. The suffix is
+// checked to make up a valid endpoint before any request is made with it.
+func resolveStorageEndpointSuffix(env azure.Environment, suffix, accountName string) (string, error) {
+	if suffix == "" {
+		return env.StorageEndpointSuffix, nil
+	}
+	endpoint := fmt.Sprintf("https://%s.blob.%s", accountName, suffix)
+	if u, err := url.Parse(endpoint); err != nil || u.Host != fmt.Sprintf("%s.blob.%s", accountName, suffix) || u.Port() != "" {
+		return "", fmt.Errorf("invalid storage_endpoint_suffix %q: expected a DNS suffix such as %s, for the Blob endpoint to be https://<account>.blob.<suffix>", suffix, azure.PublicCloud.StorageEndpointSuffix)
+	}
+	if !strings.EqualFold(suffix, env.StorageEndpointSuffix) {
+		log.Printf("[WARN] Both the environment %q and a custom storage endpoint suffix are set; using the suffix %q rather than the environment's %q for the Storage Account", env.Name, suffix, env.StorageEndpointSuffix)
+	}
+	return suffix, nil
+}
+
+// validateTenantID returns an error when the configured authentication mode
+// needs a tenant but none was given. Unlike the Azure CLI and Managed Service
+// Identity, a Service Principal can't derive its tenant, and leaving it out
+// only surfaces later as an ambiguous token error.
+func validateTenantID(config BackendConfig) error {
+	if config.TenantID != "" || config.ClientID == "" {
+		return nil
+	}
+
+	var mode string
+	switch {
+	case config.ClientSecret != "":
+		mode = "a Service Principal with a Client Secret"
+	case config.ClientCertificatePath != "":
+		mode = "a Service Principal with a Client Certificate"
+	case config.UseOIDC:
+		mode = "a Service Principal with OpenID Connect"
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("tenant_id must be set when authenticating as %s, either in the backend configuration or with the ARM_TENANT_ID environment variable", mode)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-azure-helpers/authentication"
+	authWrapper "github.com/manicminer/hamilton-autorest/auth"
+	"github.com/manicminer/hamilton/auth"
+	"github.com/manicminer/hamilton/environments"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// parseADAuthorityHost validates ad_authority_host, returning it without a
+// trailing slash, as the Azure AD endpoints of the environments are. The
+// authority host is only the scheme and host the tokens are obtained from;
+// the tenant is added to it.
+func parseADAuthorityHost(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid ad_authority_host %q: %w", value, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("invalid ad_authority_host %q: must be an https URL, such as https://login.microsoftonline.com", value)
+	}
+	if u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid ad_authority_host %q: must only have a scheme and host, without the tenant", value)
+	}
+	return "https://" + u.Host, nil
+}
+
+// authorityHostAuth returns an authorizer for the given API, obtaining the
+// tokens from the Azure AD endpoint of env, for the client certificate,
+// client secret and OIDC authentication that armConfig would obtain them
+// with from the endpoint of its own environment, which can't be overridden.
+// It's chosen with the same precedence armConfig's method is. It returns
+// false for the other methods, whose tokens are obtained by the managed
+// identity endpoint or the Azure CLI.
+func authorityHostAuth(ctx context.Context, config BackendConfig, armConfig *authentication.Config, oidcRequestURL string, env environments.Environment, api environments.Api) (autorest.Authorizer, bool, error) {
+	conf := auth.ClientCredentialsConfig{
+		Environment:        env,
+		TenantID:           armConfig.TenantID,
+		AuxiliaryTenantIDs: armConfig.AuxiliaryTenantIDs,
+		ClientID:           armConfig.ClientID,
+		Scopes:             []string{api.DefaultScope()},
+		TokenVersion:       auth.TokenVersion2,
+	}
+
+	switch {
+	case config.ClientCertificatePath != "":
+		certificate, key, err := decodeClientCertificate(config.ClientCertificatePath, config.ClientCertificatePassword)
+		if err != nil {
+			return nil, true, err
+		}
+		conf.PrivateKey = x509.MarshalPKCS1PrivateKey(key)
+		conf.Certificate = certificate.Raw
+		return &authWrapper.Authorizer{Authorizer: conf.TokenSource(ctx, auth.ClientCredentialsAssertionType)}, true, nil
+
+	case config.ClientSecret != "":
+		conf.ClientSecret = config.ClientSecret
+		return &authWrapper.Authorizer{Authorizer: conf.TokenSource(ctx, auth.ClientCredentialsSecretType)}, true, nil
+
+	case config.UseOIDC && config.OIDCToken != "":
+		if config.OIDCTokenFilePath != "" {
+			data, err := os.ReadFile(config.OIDCTokenFilePath)
+			if err != nil {
+				return nil, true, fmt.Errorf("reading OIDC token file %q: %w", config.OIDCTokenFilePath, err)
+			}
+			if strings.TrimSpace(string(data)) != config.OIDCToken {
+				return nil, true, fmt.Errorf("mismatch between supplied OIDC token and supplied OIDC token file contents - please either remove one or ensure they match")
+			}
+		}
+		conf.FederatedAssertion = config.OIDCToken
+		return &authWrapper.Authorizer{Authorizer: conf.TokenSource(ctx, auth.ClientCredentialsAssertionType)}, true, nil
+
+	case config.UseOIDC && oidcRequestURL != "" && config.OIDCRequestToken != "":
+		github := auth.GitHubOIDCConfig{
+			Environment:         env,
+			TenantID:            armConfig.TenantID,
+			AuxiliaryTenantIDs:  armConfig.AuxiliaryTenantIDs,
+			ClientID:            armConfig.ClientID,
+			IDTokenRequestURL:   oidcRequestURL,
+			IDTokenRequestToken: config.OIDCRequestToken,
+			Scopes:              []string{api.DefaultScope()},
+		}
+		return &authWrapper.Authorizer{Authorizer: github.TokenSource(ctx)}, true, nil
+	}
+
+	// the OIDC token file is read by federatedTokenFileAuth, with env
+	return nil, false, nil
+}
+
+// decodeClientCertificate reads the PKCS#12 client certificate, as armConfig
+// does.
+func decodeClientCertificate(path, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading Client Certificate %q: %w", path, err)
+	}
+	key, certificate, err := pkcs12.Decode(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding pkcs12 certificate: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("PKCS#12 certificate must contain an RSA private key")
+	}
+	return certificate, rsaKey, nil
+}
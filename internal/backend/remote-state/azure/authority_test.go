@@ -0,0 +1,99 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-azure-helpers/authentication"
+	authWrapper "github.com/manicminer/hamilton-autorest/auth"
+	"github.com/manicminer/hamilton/environments"
+)
+
+func TestParseADAuthorityHost(t *testing.T) {
+	cases := map[string]struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		"unset":          {value: "", want: ""},
+		"host":           {value: "https://login.example.com", want: "https://login.example.com"},
+		"trailing slash": {value: "https://login.example.com/", want: "https://login.example.com"},
+		"port":           {value: "https://login.example.com:8443", want: "https://login.example.com:8443"},
+		"http":           {value: "http://login.example.com", wantErr: "must be an https URL"},
+		"no scheme":      {value: "login.example.com", wantErr: "must be an https URL"},
+		"tenant":         {value: "https://login.example.com/tenant", wantErr: "without the tenant"},
+		"query":          {value: "https://login.example.com?x=1", wantErr: "without the tenant"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseADAuthorityHost(tc.value)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAuthorityHostAuth(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "access", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	env := environments.Environment{AzureADEndpoint: environments.AzureADEndpoint(server.URL)}
+	api := environments.Api{Endpoint: "https://storage.azure.com"}
+	armConfig := &authentication.Config{TenantID: "tenant", ClientID: "client"}
+
+	cases := map[string]BackendConfig{
+		"client secret": {ClientSecret: "secret"},
+		"oidc token":    {UseOIDC: true, OIDCToken: "token"},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			paths = nil
+			a, ok, err := authorityHostAuth(context.Background(), config, armConfig, "", env, api)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("expected the token to be obtained from the authority host")
+			}
+			token, err := a.(*authWrapper.Authorizer).Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != "access" {
+				t.Fatalf("unexpected token %q", token.AccessToken)
+			}
+			if len(paths) != 1 || paths[0] != "/tenant/oauth2/v2.0/token" {
+				t.Fatalf("expected a token request to the authority host, got %v", paths)
+			}
+		})
+	}
+
+	// managed identity and the Azure CLI don't obtain their tokens from it
+	if _, ok, err := authorityHostAuth(context.Background(), BackendConfig{UseMsi: true}, armConfig, "", env, api); ok || err != nil {
+		t.Fatalf("expected managed identity to be left to armConfig, got %t, %v", ok, err)
+	}
+}
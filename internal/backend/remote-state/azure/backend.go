@@ -6,22 +6,41 @@
 package azure
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-uuid"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/legacy/helper/schema"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/states/statefile"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
+	"github.com/zclconf/go-cty/cty"
 )
 
+// defaultEnvironment is the Azure cloud used when environment isn't set.
+const defaultEnvironment = "public"
+
 // New creates a new backend for Azure remote state.
 func New(enc encryption.StateEncryption) backend.Backend {
 	s := &schema.Backend{
 		Schema: map[string]*schema.Schema{
 			"storage_account_name": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "The name of the storage account.",
+				Optional:    true,
+				Description: "The name of the storage account. Required unless connection_string is set.",
 			},
 
 			"container_name": {
@@ -46,17 +65,38 @@ func New(enc encryption.StateEncryption) backend.Backend {
 			"environment": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				Description: "The Azure cloud environment.",
-				DefaultFunc: schema.EnvDefaultFunc("ARM_ENVIRONMENT", "public"),
+				Description: "The Azure cloud environment. Defaults to \"public\".",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_ENVIRONMENT", ""),
+			},
+
+			"ad_authority_host": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The Azure AD authority host to obtain tokens from, rather than that of the environment.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_AD_AUTHORITY_HOST", ""),
+			},
+
+			"require_explicit_environment": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Fail rather than default to the public Azure cloud when environment isn't set.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_REQUIRE_EXPLICIT_ENVIRONMENT", false),
 			},
 
 			"access_key": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				Description: "The access key.",
+				Description: "The access key, or a reference to the Key Vault secret holding it, written as @Microsoft.KeyVault(SecretUri=<secret URI>).",
 				DefaultFunc: schema.EnvDefaultFunc("ARM_ACCESS_KEY", ""),
 			},
 
+			"connection_string": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "An Azure Storage connection string naming the storage account and holding its access key or a SAS token. Takes precedence over storage_account_name, access_key and sas_token.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_CONNECTION_STRING", ""),
+			},
+
 			"sas_token": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -71,6 +111,97 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				DefaultFunc: schema.EnvDefaultFunc("ARM_SNAPSHOT", false),
 			},
 
+			"snapshot_interval": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The least time between two snapshots taken by this backend, across all workspaces, such as \"500ms\". Defaults to no limit.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_SNAPSHOT_INTERVAL", ""),
+			},
+
+			"read_cache_ttl": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Cache the states read for this long, such as \"30s\", only downloading a state again once its ETag has changed. Defaults to no caching.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_READ_CACHE_TTL", ""),
+			},
+
+			"max_read_bytes": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "The largest state, in bytes, that will be downloaded. Reading a larger state fails. Defaults to no limit.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_MAX_READ_BYTES", 0),
+			},
+
+			"write_manifest": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Maintain a manifest of the checksums of the state in a <key>.manifest.json blob next to it.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_WRITE_MANIFEST", false),
+			},
+
+			"verify_checksum": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Record the SHA-256 of the state in the state blob's metadata when writing it, and verify the state read against it.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_VERIFY_CHECKSUM", false),
+			},
+
+			"incremental_upload": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Write large states by uploading only the blocks of them that changed since the last write.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_INCREMENTAL_UPLOAD", false),
+			},
+
+			"history_count": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "How many of the previous states to keep as history blobs next to each state blob.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_HISTORY_COUNT", 0),
+			},
+
+			"blob_content_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The Content-Type the state blobs are written with.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_BLOB_CONTENT_TYPE", defaultBlobContentType),
+			},
+
+			"blob_cache_control": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The Cache-Control the state blobs are written with.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_BLOB_CACHE_CONTROL", defaultBlobCacheControl),
+			},
+
+			"read_only": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Refuse to write, lock or delete states, only reading them.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_READ_ONLY", false),
+			},
+
+			"min_serial_guard": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Refuse to write a state whose serial is lower than the serial of the stored state.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_MIN_SERIAL_GUARD", false),
+			},
+
+			"allow_serial_rollback": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Allow writing a state with a lower serial than the stored state despite min_serial_guard, for example when deliberately restoring old state.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_ALLOW_SERIAL_ROLLBACK", false),
+			},
+
+			"coalesce_writes": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Buffer state writes made while the state is locked and only write the last one to the blob when unlocking.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_COALESCE_WRITES", false),
+			},
+
 			"resource_group_name": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -91,6 +222,13 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				DefaultFunc: schema.EnvDefaultFunc("ARM_ENDPOINT", ""),
 			},
 
+			"storage_endpoint_suffix": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A custom suffix of the Storage Account's endpoints, such as core.windows.net, overriding the environment's.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_STORAGE_ENDPOINT_SUFFIX", ""),
+			},
+
 			"subscription_id": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -157,8 +295,8 @@ func New(enc encryption.StateEncryption) backend.Backend {
 			"oidc_token_file_path": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("ARM_OIDC_TOKEN_FILE_PATH", ""),
-				Description: "Path to file containing a generic JWT token that can be used for OIDC authentication. Should not be used in conjunction with `oidc_request_token`.",
+				DefaultFunc: schema.MultiEnvDefaultFunc([]string{"ARM_OIDC_TOKEN_FILE_PATH", "AZURE_FEDERATED_TOKEN_FILE"}, ""),
+				Description: "Path to file containing a generic JWT token that can be used for OIDC authentication, read again on each token refresh. Should not be used in conjunction with `oidc_request_token`.",
 			},
 			"oidc_request_url": {
 				Type:        schema.TypeString,
@@ -172,6 +310,12 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				DefaultFunc: schema.MultiEnvDefaultFunc([]string{"ARM_OIDC_REQUEST_TOKEN", "ACTIONS_ID_TOKEN_REQUEST_TOKEN"}, ""),
 				Description: "The bearer token to use for the request to the OIDC providers `oidc_request_url` URL to fetch an ID token. Needs to be used in conjunction with `oidc_request_url`. This is meant to be used for Github Actions.",
 			},
+			"oidc_audience": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ARM_OIDC_AUDIENCE", ""),
+				Description: "The audience of the OIDC token, which must match that of the federated credential. Defaults to api://AzureADTokenExchange.",
+			},
 
 			// Feature Flags
 			"use_azuread_auth": {
@@ -180,6 +324,251 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				Description: "Should OpenTofu use AzureAD Authentication to access the Blob?",
 				DefaultFunc: schema.EnvDefaultFunc("ARM_USE_AZUREAD", false),
 			},
+
+			"require_shared_key_disabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Fail unless the Storage Account has Shared Key access disabled. Requires use_azuread_auth and resource_group_name.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_REQUIRE_SHARED_KEY_DISABLED", false),
+			},
+
+			"relock_on_loss": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Re-acquire a state lock that was lost during an operation, if no other process has locked or modified the state since.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_RELOCK_ON_LOSS", false),
+			},
+
+			"strict_unlock": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Refuse to release a state lock taken by this process once the lock info shows it held by another operation with the same lock ID.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_STRICT_UNLOCK", false),
+			},
+
+			"lock_events_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A file to append a line of JSON to each time a state lock is acquired or released, for external observers.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LOCK_EVENTS_FILE", ""),
+			},
+
+			"audit_failure_mode": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Whether a lock operation proceeds (\"fail-open\") or fails (\"fail-closed\") when its event can't be written to the lock_events_file.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_AUDIT_FAILURE_MODE", auditFailOpen),
+			},
+
+			"lock_method": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How the state is locked: by leasing its blob (\"lease\"), with a lock blob next to it (\"blob\"), or by leasing and falling back to a lock blob when leasing isn't supported (\"auto\").",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LOCK_METHOD", lockMethodLease),
+			},
+
+			"max_retries": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "How many times to retry a request that Azure throttled, with a 429 or 503 response.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_MAX_RETRIES", defaultMaxRetries),
+			},
+
+			"lock_retry_max": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "How many times to retry acquiring the lease on a state blob held by another process.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LOCK_RETRY_MAX", 0),
+			},
+
+			"operation_timeout": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long each read, write, deletion or key layout migration of a state may take, such as \"2m\", retries included.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_OPERATION_TIMEOUT", ""),
+			},
+
+			"lock_timeout": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long each lock or unlock of a state may take, such as \"1m\", retries included.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LOCK_TIMEOUT", ""),
+			},
+
+			"lock_retry_base_delay": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long to wait before the first retry to acquire a lease, such as \"1s\". The delay doubles for each retry.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LOCK_RETRY_BASE_DELAY", ""),
+			},
+
+			"lease_duration": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long to lease a state blob for while it's locked, between \"16s\" and \"59s\", renewing the lease until it's unlocked. Leases are infinite when not set.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LEASE_DURATION", ""),
+			},
+
+			"lease_renewal_interval": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How often to renew a lease of lease_duration, such as \"10s\". Defaults to a third of lease_duration.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LEASE_RENEWAL_INTERVAL", ""),
+			},
+
+			"lease_renewal_retry_max": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "How many times to retry renewing a lease that failed to renew, before the lock is considered lost.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LEASE_RENEWAL_RETRY_MAX", defaultLeaseRenewalPolicy.Attempts-1),
+			},
+
+			"lease_renewal_retry_interval": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long to wait between retries to renew a lease, such as \"5s\".",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_LEASE_RENEWAL_RETRY_INTERVAL", ""),
+			},
+
+			"hns_enabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether the Storage Account has a hierarchical namespace (Data Lake Storage Gen2). Detected from the account's properties when not set.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_HNS_ENABLED", nil),
+			},
+
+			"use_secondary_endpoint_on_read_failure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Read the state from the secondary endpoint of a read-access geo-redundant Storage Account when reading it from the primary endpoint fails.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_USE_SECONDARY_ENDPOINT_ON_READ_FAILURE", false),
+			},
+
+			"metadata": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Metadata to set on the state blob on every write.",
+			},
+
+			"blob_tags": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Blob index tags to set on the state blob on every write.",
+			},
+
+			"client_side_encryption_key_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The ID of a Key Vault key to encrypt the state blobs with on the client, as the Azure Storage SDKs do.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_CLIENT_SIDE_ENCRYPTION_KEY_ID", ""),
+			},
+
+			"obfuscate_workspace_names": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Name the state blobs of workspaces by a hash of the workspace name, keeping the names in a <key>.workspaces.json blob.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_OBFUSCATE_WORKSPACE_NAMES", false),
+			},
+
+			"auto_rehydrate": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Rehydrate a state blob found in the Archive tier when reading it, waiting up to rehydrate_timeout for it.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_AUTO_REHYDRATE", false),
+			},
+
+			"rehydrate_timeout": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "How long to wait for an archived state blob to be rehydrated, such as \"2h\". Defaults to 1h.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_REHYDRATE_TIMEOUT", ""),
+			},
+
+			"verify_encryption": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Verify during initialization that the configured state encryption can encrypt and decrypt a probe state.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_VERIFY_ENCRYPTION", false),
+			},
+
+			"expected_lineage": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Fail unless the state has this lineage. A new state is created with it.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_EXPECTED_LINEAGE", ""),
+			},
+
+			"workspace_key_prefix": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Name the state blobs of workspaces other than default <prefix><separator><workspace><separator><key>, rather than <key>env:<workspace>.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_WORKSPACE_KEY_PREFIX", ""),
+			},
+
+			"workspace_key_separator": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The separator between the parts of the names of the state blobs of workspaces when workspace_key_prefix is set. Defaults to \"/\".",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_WORKSPACE_KEY_SEPARATOR", ""),
+			},
+
+			"workspace_name_pattern": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A regular expression that the names of workspaces other than default must match, such as \"^[a-z0-9-]+$\".",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_WORKSPACE_NAME_PATTERN", ""),
+			},
+
+			"token_expiry_warning": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Warn during initialization if the Azure AD token expires within this duration, such as \"1h\".",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_TOKEN_EXPIRY_WARNING", ""),
+			},
+
+			"create_container_if_missing": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Create the container, with private access, during initialization if it doesn't exist.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_CREATE_CONTAINER_IF_MISSING", false),
+			},
+
+			"probe_write": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Prove during initialization that state can be written and deleted, by creating and removing a probe blob.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_PROBE_WRITE", false),
+			},
+
+			"idempotency_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A key identifying the operation for external audit trails, recorded with the state lock and included in errors.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_IDEMPOTENCY_KEY", ""),
+			},
+
+			"proxy_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The URL of an HTTP proxy to send the requests to Azure through, which can include credentials for the proxy. Hosts listed in NO_PROXY are reached directly.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_PROXY_URL", ""),
+			},
+
+			"proxy_from_environment": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Use the proxy given by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables when proxy_url isn't set.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_PROXY_FROM_ENVIRONMENT", true),
+			},
+
+			"client_request_id_prefix": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A prefix for the x-ms-client-request-id generated for each operation, to ease correlation with Azure support.",
+				DefaultFunc: schema.EnvDefaultFunc("ARM_CLIENT_REQUEST_ID_PREFIX", ""),
+			},
 		},
 	}
 
@@ -192,12 +581,96 @@ type Backend struct {
 	*schema.Backend
 	encryption encryption.StateEncryption
 
+	// sender overrides the HTTP sender of the storage clients when set,
+	// which allows tests to run against an in-memory storage account.
+	sender autorest.Sender
+
 	// The fields below are set from configure
 	armClient     *ArmClient
 	containerName string
 	keyName       string
 	accountName   string
 	snapshot      bool
+
+	// snapshotLimiter, when set, paces the snapshots taken by all of the
+	// backend's clients.
+	snapshotLimiter *snapshotLimiter
+
+	// readCache, when set, caches the states read by all of the backend's
+	// clients.
+	readCache *readCache
+
+	metaData map[string]string
+	blobTags map[string]string
+
+	// clientSideEncryption, when set, encrypts the state blobs on the client.
+	clientSideEncryption *clientSideEncryption
+
+	lockRetry    lockRetryPolicy
+	leaseRenewal leaseRenewalPolicy
+
+	// leaseDuration, when set, is how long the state blobs are leased for,
+	// renewed every leaseRenewalInterval.
+	leaseDuration        time.Duration
+	leaseRenewalInterval time.Duration
+
+	readFromSecondary bool
+
+	// hnsEnabled is set for a Storage Account with a hierarchical namespace,
+	// whose directories are listed along with the blobs.
+	hnsEnabled bool
+
+	coalesceWrites    bool
+	minSerialGuard    bool
+	writeManifest     bool
+	maxReadBytes      int64
+	relockOnLoss      bool
+	strictUnlock      bool
+	verifyChecksum    bool
+	incrementalUpload bool
+	readOnly          bool
+	blobContentType   string
+	blobCacheControl  string
+	historyCount      int
+
+	// operationTimeout and lockTimeout limit each get, put and delete, and
+	// each lock and unlock, of a state.
+	operationTimeout time.Duration
+	lockTimeout      time.Duration
+	lockEventsFile   string
+	idempotencyKey   string
+	lockMethod       string
+
+	// expectedLineage, when set, is the lineage the states must have.
+	expectedLineage string
+
+	auditFailClosed         bool
+	obfuscateWorkspaceNames bool
+
+	autoRehydrate    bool
+	rehydrateTimeout time.Duration
+
+	// workspaceNamePattern, when set, must match the name of every workspace
+	// but the default one.
+	workspaceNamePattern *regexp.Regexp
+
+	// verifyEncryption is set when the encryption of each workspace is to be
+	// verified before its state is first read.
+	verifyEncryption bool
+
+	// workspaceKeyPrefix, when set, changes how the state blobs of the
+	// workspaces other than the default one are named, with the parts of
+	// the name separated by workspaceKeySeparator.
+	workspaceKeyPrefix    string
+	workspaceKeySeparator string
+
+	// warnings are the warnings found while configuring the backend, which
+	// Configure returns along with any error.
+	warnings tfdiags.Diagnostics
+
+	// stateInit controls how StateMgr waits for a state being initialized
+	// by another process.
+	stateInit stateInitPolicy
 }
 
 type BackendConfig struct {
@@ -206,11 +679,15 @@ type BackendConfig struct {
 
 	// Optional
 	AccessKey                     string
+	ADAuthorityHost               string
 	ClientID                      string
+	ClientSideEncryptionKeyID     string
 	ClientCertificatePassword     string
 	ClientCertificatePath         string
+	ClientRequestIDPrefix         string
 	ClientSecret                  string
 	CustomResourceManagerEndpoint string
+	MaxRetries                    int
 	MetadataHost                  string
 	Environment                   string
 	MsiEndpoint                   string
@@ -218,8 +695,12 @@ type BackendConfig struct {
 	OIDCTokenFilePath             string
 	OIDCRequestURL                string
 	OIDCRequestToken              string
+	OIDCAudience                  string
+	ProxyURL                      string
+	ProxyFromEnvironment          bool
 	ResourceGroupName             string
 	SasToken                      string
+	StorageEndpointSuffix         string
 	SubscriptionID                string
 	TenantID                      string
 	UseMsi                        bool
@@ -227,6 +708,14 @@ type BackendConfig struct {
 	UseAzureADAuthentication      bool
 }
 
+// Configure configures the backend as the schema.Backend it's built on does,
+// which has no way to return warnings from configure, adding them.
+func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
+	b.warnings = nil
+	diags := b.Backend.Configure(obj)
+	return diags.Append(b.warnings)
+}
+
 func (b *Backend) configure(ctx context.Context) error {
 	if b.containerName != "" {
 		return nil
@@ -238,24 +727,246 @@ func (b *Backend) configure(ctx context.Context) error {
 	b.accountName = data.Get("storage_account_name").(string)
 	b.keyName = data.Get("key").(string)
 	b.snapshot = data.Get("snapshot").(bool)
+	b.coalesceWrites = data.Get("coalesce_writes").(bool)
+	b.idempotencyKey = data.Get("idempotency_key").(string)
+	b.writeManifest = data.Get("write_manifest").(bool)
+	b.maxReadBytes = int64(data.Get("max_read_bytes").(int))
+	b.relockOnLoss = data.Get("relock_on_loss").(bool)
+	b.strictUnlock = data.Get("strict_unlock").(bool)
+	b.verifyChecksum = data.Get("verify_checksum").(bool)
+	b.incrementalUpload = data.Get("incremental_upload").(bool)
+	b.readOnly = data.Get("read_only").(bool)
+	b.historyCount = data.Get("history_count").(int)
+	if b.historyCount < 0 {
+		return fmt.Errorf("invalid history_count %d: must not be negative", b.historyCount)
+	}
+	b.blobContentType = data.Get("blob_content_type").(string)
+	if _, _, err := mime.ParseMediaType(b.blobContentType); err != nil {
+		return fmt.Errorf("invalid blob_content_type %q: %w", b.blobContentType, err)
+	}
+	b.blobCacheControl = data.Get("blob_cache_control").(string)
+	if strings.ContainsAny(b.blobCacheControl, "\r\n") {
+		return fmt.Errorf("invalid blob_cache_control %q: must be a single line", b.blobCacheControl)
+	}
+	if b.readOnly {
+		for _, name := range []string{"probe_write", "create_container_if_missing", "auto_rehydrate"} {
+			if data.Get(name).(bool) {
+				return fmt.Errorf("read_only can't be used with %s, which writes to the Storage Account", name)
+			}
+		}
+	}
+	b.lockEventsFile = data.Get("lock_events_file").(string)
+	switch mode := data.Get("audit_failure_mode").(string); mode {
+	case auditFailOpen:
+		b.auditFailClosed = false
+	case auditFailClosed:
+		b.auditFailClosed = true
+	default:
+		return fmt.Errorf("invalid audit_failure_mode %q: must be %q or %q", mode, auditFailOpen, auditFailClosed)
+	}
+	switch method := data.Get("lock_method").(string); method {
+	case lockMethodLease, lockMethodBlob, lockMethodAuto:
+		b.lockMethod = method
+	default:
+		return fmt.Errorf("invalid lock_method %q: must be %q, %q or %q", method, lockMethodLease, lockMethodBlob, lockMethodAuto)
+	}
+	b.lockRetry.MaxRetries = data.Get("lock_retry_max").(int)
+	if b.lockRetry.MaxRetries < 0 {
+		return fmt.Errorf("invalid lock_retry_max %d: must not be negative", b.lockRetry.MaxRetries)
+	}
+	if v := data.Get("lock_retry_base_delay").(string); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid lock_retry_base_delay %q: %w", v, err)
+		}
+		b.lockRetry.BaseDelay = delay
+	}
+	if v := data.Get("lease_duration").(string); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid lease_duration %q: %w", v, err)
+		}
+		if duration < minLeaseDuration || duration > maxLeaseDuration || duration%time.Second != 0 {
+			return fmt.Errorf("invalid lease_duration %q: must be a whole number of seconds between %s and %s", v, minLeaseDuration, maxLeaseDuration)
+		}
+		b.leaseDuration = duration
+	}
+	if v := data.Get("lease_renewal_interval").(string); v != "" {
+		if b.leaseDuration == 0 {
+			return fmt.Errorf("lease_renewal_interval can only be set with lease_duration, as infinite leases aren't renewed")
+		}
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid lease_renewal_interval %q: %w", v, err)
+		}
+		if interval <= 0 || interval >= b.leaseDuration {
+			return fmt.Errorf("invalid lease_renewal_interval %q: must be positive and shorter than lease_duration %s", v, b.leaseDuration)
+		}
+		b.leaseRenewalInterval = interval
+	}
+	retries := data.Get("lease_renewal_retry_max").(int)
+	if retries < 0 {
+		return fmt.Errorf("invalid lease_renewal_retry_max %d: must not be negative", retries)
+	}
+	b.leaseRenewal.Attempts = retries + 1
+	if v := data.Get("lease_renewal_retry_interval").(string); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid lease_renewal_retry_interval %q: %w", v, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid lease_renewal_retry_interval %q: must be positive", v)
+		}
+		b.leaseRenewal.Interval = interval
+	}
+	b.obfuscateWorkspaceNames = data.Get("obfuscate_workspace_names").(bool)
+	b.readFromSecondary = data.Get("use_secondary_endpoint_on_read_failure").(bool)
+	b.expectedLineage = data.Get("expected_lineage").(string)
+	b.minSerialGuard = data.Get("min_serial_guard").(bool) && !data.Get("allow_serial_rollback").(bool)
+
+	b.autoRehydrate = data.Get("auto_rehydrate").(bool)
+	if v := data.Get("rehydrate_timeout").(string); v != "" {
+		var err error
+		b.rehydrateTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid rehydrate_timeout %q: %w", v, err)
+		}
+	}
+
+	if v := data.Get("operation_timeout").(string); v != "" {
+		var err error
+		b.operationTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid operation_timeout %q: %w", v, err)
+		}
+	}
+	if v := data.Get("lock_timeout").(string); v != "" {
+		var err error
+		b.lockTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid lock_timeout %q: %w", v, err)
+		}
+	}
+
+	if v := data.Get("snapshot_interval").(string); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot_interval %q: %w", v, err)
+		}
+		if interval > 0 {
+			b.snapshotLimiter = newSnapshotLimiter(interval)
+		}
+	}
+
+	if v := data.Get("read_cache_ttl").(string); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid read_cache_ttl %q: %w", v, err)
+		}
+		if ttl > 0 {
+			b.readCache = newReadCache(ttl)
+		}
+	}
+
+	b.metaData = map[string]string{}
+	for k, v := range data.Get("metadata").(map[string]interface{}) {
+		// Azure stores metadata names case-insensitively, and returns them
+		// in lower case.
+		k = strings.ToLower(k)
+		switch k {
+		case lockInfoMetaKey, managedMetaDataMetaKey, managedTagsMetaKey, encryptionDataMetaKey, checksumMetaKey:
+			return fmt.Errorf("invalid metadata key %q: it's used by the backend", k)
+		}
+		b.metaData[k] = v.(string)
+	}
+	b.blobTags = map[string]string{}
+	for k, v := range data.Get("blob_tags").(map[string]interface{}) {
+		b.blobTags[k] = v.(string)
+	}
+	if len(b.blobTags) > maxBlobTags {
+		return fmt.Errorf("invalid blob_tags: Azure allows at most %d index tags on a blob, got %d", maxBlobTags, len(b.blobTags))
+	}
+
+	b.workspaceKeyPrefix = data.Get("workspace_key_prefix").(string)
+	b.workspaceKeySeparator = data.Get("workspace_key_separator").(string)
+	switch {
+	case b.workspaceKeyPrefix == "" && b.workspaceKeySeparator != "":
+		return fmt.Errorf("workspace_key_separator is only used with workspace_key_prefix, which isn't set")
+	case b.workspaceKeyPrefix != "" && b.workspaceKeySeparator == "":
+		b.workspaceKeySeparator = "/"
+	}
+
+	if v := data.Get("workspace_name_pattern").(string); v != "" {
+		pattern, err := regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("invalid workspace_name_pattern %q: %w", v, err)
+		}
+		b.workspaceNamePattern = pattern
+	}
+
+	var tokenExpiryWindow time.Duration
+	if v := data.Get("token_expiry_warning").(string); v != "" {
+		var err error
+		tokenExpiryWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid token_expiry_warning %q: %w", v, err)
+		}
+	}
+
+	// Key problems are reported before anything is read from or written to
+	// the storage account. This verifies the encryption of the selected
+	// workspace; StateMgr verifies that of any other workspace it opens.
+	b.verifyEncryption = data.Get("verify_encryption").(bool)
+	if b.verifyEncryption {
+		if err := verifyEncryption(b.encryption); err != nil {
+			return err
+		}
+	}
+
+	// The environment only defaults here rather than in the schema, to tell
+	// whether it was set.
+	environment := data.Get("environment").(string)
+	if environment == "" {
+		if data.Get("require_explicit_environment").(bool) {
+			return fmt.Errorf("environment must be set when require_explicit_environment is set, rather than defaulting to %q", defaultEnvironment)
+		}
+		environment = defaultEnvironment
+	}
+
+	if v := data.Get("max_retries").(int); v < 0 {
+		return fmt.Errorf("invalid max_retries %d: must not be negative", v)
+	}
+
+	adAuthorityHost, err := parseADAuthorityHost(data.Get("ad_authority_host").(string))
+	if err != nil {
+		return err
+	}
 
 	config := BackendConfig{
 		AccessKey:                     data.Get("access_key").(string),
+		ADAuthorityHost:               adAuthorityHost,
 		ClientID:                      data.Get("client_id").(string),
+		ClientSideEncryptionKeyID:     data.Get("client_side_encryption_key_id").(string),
 		ClientCertificatePassword:     data.Get("client_certificate_password").(string),
 		ClientCertificatePath:         data.Get("client_certificate_path").(string),
+		ClientRequestIDPrefix:         data.Get("client_request_id_prefix").(string),
+		MaxRetries:                    data.Get("max_retries").(int),
 		ClientSecret:                  data.Get("client_secret").(string),
 		CustomResourceManagerEndpoint: data.Get("endpoint").(string),
 		MetadataHost:                  data.Get("metadata_host").(string),
-		Environment:                   data.Get("environment").(string),
+		Environment:                   environment,
 		MsiEndpoint:                   data.Get("msi_endpoint").(string),
 		OIDCToken:                     data.Get("oidc_token").(string),
 		OIDCTokenFilePath:             data.Get("oidc_token_file_path").(string),
 		OIDCRequestURL:                data.Get("oidc_request_url").(string),
 		OIDCRequestToken:              data.Get("oidc_request_token").(string),
+		OIDCAudience:                  data.Get("oidc_audience").(string),
+		ProxyURL:                      data.Get("proxy_url").(string),
+		ProxyFromEnvironment:          data.Get("proxy_from_environment").(bool),
 		ResourceGroupName:             data.Get("resource_group_name").(string),
 		SasToken:                      data.Get("sas_token").(string),
 		StorageAccountName:            data.Get("storage_account_name").(string),
+		StorageEndpointSuffix:         data.Get("storage_endpoint_suffix").(string),
 		SubscriptionID:                data.Get("subscription_id").(string),
 		TenantID:                      data.Get("tenant_id").(string),
 		UseMsi:                        data.Get("use_msi").(bool),
@@ -263,6 +974,41 @@ func (b *Backend) configure(ctx context.Context) error {
 		UseAzureADAuthentication:      data.Get("use_azuread_auth").(bool),
 	}
 
+	if v := data.Get("connection_string").(string); v != "" {
+		cs, err := parseConnectionString(v)
+		if err != nil {
+			return err
+		}
+		if b.accountName != "" && !strings.EqualFold(b.accountName, cs.accountName) {
+			log.Printf("[WARN] Using the Storage Account %q named by connection_string rather than storage_account_name %q", cs.accountName, b.accountName)
+		}
+		b.accountName = cs.accountName
+		config.StorageAccountName = cs.accountName
+		config.AccessKey = cs.accountKey
+		config.SasToken = cs.sasToken
+		if config.StorageEndpointSuffix == "" {
+			config.StorageEndpointSuffix = cs.endpointSuffix
+		} else if cs.endpointSuffix != "" && !strings.EqualFold(config.StorageEndpointSuffix, cs.endpointSuffix) {
+			log.Printf("[WARN] Using storage_endpoint_suffix %q rather than the EndpointSuffix %q of connection_string", config.StorageEndpointSuffix, cs.endpointSuffix)
+		}
+	}
+	if b.accountName == "" {
+		return fmt.Errorf("storage_account_name must be set, unless connection_string is")
+	}
+
+	requireSharedKeyDisabled := data.Get("require_shared_key_disabled").(bool)
+	if requireSharedKeyDisabled {
+		if !config.UseAzureADAuthentication {
+			return fmt.Errorf("require_shared_key_disabled can only be used with Azure AD Authentication, by setting use_azuread_auth")
+		}
+		if config.AccessKey != "" || config.SasToken != "" {
+			return fmt.Errorf("require_shared_key_disabled can't be used with an Access Key or SAS Token, as both use Shared Key access")
+		}
+		if config.ResourceGroupName == "" {
+			return fmt.Errorf("require_shared_key_disabled needs resource_group_name to be set, to look up the Storage Account")
+		}
+	}
+
 	armClient, err := buildArmClient(context.TODO(), config)
 	if err != nil {
 		return err
@@ -273,6 +1019,174 @@ func (b *Backend) configure(ctx context.Context) error {
 		return fmt.Errorf("Either an Access Key / SAS Token or the Resource Group for the Storage Account must be specified - or Azure AD Authentication must be enabled")
 	}
 
+	if b.sender != nil {
+		armClient.sender = b.sender
+	}
+
 	b.armClient = armClient
+
+	if armClient.endpointWarning != "" {
+		b.warnings = b.warnings.Append(tfdiags.Sourceless(tfdiags.Warning, "Custom Resource Manager endpoint", armClient.endpointWarning))
+	}
+
+	if config.ClientSideEncryptionKeyID != "" {
+		kek, err := armClient.newKeyVaultKey(config.ClientSideEncryptionKeyID)
+		if err != nil {
+			return fmt.Errorf("client_side_encryption_key_id: %w", err)
+		}
+		b.clientSideEncryption = &clientSideEncryption{kek: kek}
+	}
+
+	if warning := tokenExpiryWarning(armClient.tokenExpiry, tokenExpiryWindow, time.Now()); warning != "" {
+		b.warnings = b.warnings.Append(tfdiags.Sourceless(tfdiags.Warning, "Azure AD token expiring", warning))
+	}
+
+	if b.readFromSecondary {
+		if warning := armClient.secondaryReadWarning(context.TODO()); warning != "" {
+			b.warnings = b.warnings.Append(tfdiags.Sourceless(tfdiags.Warning, "Secondary endpoint not readable", warning))
+		}
+	}
+
+	if !b.snapshot && b.historyCount == 0 {
+		if warning := armClient.noHistoryWarning(context.TODO()); warning != "" {
+			b.warnings = b.warnings.Append(tfdiags.Sourceless(tfdiags.Warning, "No previous states are kept", warning))
+		}
+	}
+
+	if v, ok := data.GetOkExists("hns_enabled"); ok {
+		b.hnsEnabled = v.(bool)
+	} else if armClient.storageAccountsClient != nil && config.ResourceGroupName != "" {
+		b.hnsEnabled, err = armClient.isHnsEnabled(context.TODO())
+		if err != nil {
+			log.Printf("[WARN] Couldn't detect whether Storage Account %q has a hierarchical namespace, so its directories may be listed as workspaces; set hns_enabled to say whether it does: %s", config.StorageAccountName, err)
+		}
+	}
+
+	if requireSharedKeyDisabled {
+		if err := armClient.checkSharedKeyAccessDisabled(context.TODO()); err != nil {
+			return err
+		}
+	}
+
+	if data.Get("create_container_if_missing").(bool) {
+		if err := b.createContainerIfMissing(ctx); err != nil {
+			return err
+		}
+	}
+
+	if data.Get("probe_write").(bool) {
+		if err := b.probeWrite(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyEncryption encrypts a probe state with the given state encryption
+// and decrypts it again, so that a misconfigured key surfaces during
+// initialization rather than with the first read or write of a state.
+func verifyEncryption(enc encryption.StateEncryption) error {
+	var probe bytes.Buffer
+	file := statefile.New(states.NewState(), "encryption-probe", 0)
+	if err := statefile.Write(file, &probe, encryption.StateEncryptionDisabled()); err != nil {
+		return fmt.Errorf("failed to build the encryption probe: %w", err)
+	}
+
+	encrypted, err := enc.EncryptState(probe.Bytes())
+	if err != nil {
+		return fmt.Errorf("state encryption verification failed, unable to encrypt: %w", err)
+	}
+	decrypted, err := enc.DecryptState(encrypted)
+	if err != nil {
+		return fmt.Errorf("state encryption verification failed, unable to decrypt what was encrypted: %w", err)
+	}
+	if !bytes.Equal(decrypted, probe.Bytes()) {
+		return fmt.Errorf("state encryption verification failed, decrypting what was encrypted didn't give back the original state")
+	}
+	return nil
+}
+
+// TokenExpiry returns when the Azure AD token the backend authenticates with
+// expires. It returns false when the backend authenticates with an access key
+// or a SAS token, or when the token's expiry isn't known.
+func (b *Backend) TokenExpiry() (time.Time, bool) {
+	if b.armClient == nil || b.armClient.tokenExpiry.IsZero() {
+		return time.Time{}, false
+	}
+	return b.armClient.tokenExpiry, true
+}
+
+// probeWrite proves that the configured credentials can write and delete
+// blobs in the container, by creating a uniquely-named probe blob next to
+// the state and removing it again. The probe is removed even when creating
+// it reported an error, since the write may have partially succeeded.
+func (b *Backend) probeWrite(ctx context.Context) error {
+	client, err := b.armClient.getBlobClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	probeKey := b.keyName + ".probe-" + id
+
+	contentType := "text/plain"
+	content := []byte("OpenTofu write probe")
+	_, putErr := client.PutBlockBlob(ctx, b.accountName, b.containerName, probeKey, blobs.PutBlockBlobInput{
+		Content:     &content,
+		ContentType: &contentType,
+	})
+
+	resp, deleteErr := client.Delete(ctx, b.accountName, b.containerName, probeKey, blobs.DeleteInput{})
+	if deleteErr != nil && putErr != nil && resp.IsHTTPStatus(http.StatusNotFound) {
+		// nothing was written, so there's nothing to clean up
+		deleteErr = nil
+	}
+
+	var result *multierror.Error
+	if putErr != nil {
+		result = multierror.Append(result, fmt.Errorf("failed to write probe blob %q: %w", probeKey, putErr))
+	}
+	if deleteErr != nil {
+		result = multierror.Append(result, fmt.Errorf("failed to delete probe blob %q: %w", probeKey, deleteErr))
+	}
+	if err := result.ErrorOrNil(); err != nil {
+		return fmt.Errorf("Write probe of container %q in Storage Account %q failed: %w", b.containerName, b.accountName, err)
+	}
+
+	log.Printf("[INFO] Write probe of container %q in Storage Account %q succeeded", b.containerName, b.accountName)
+	return nil
+}
+
+// createContainerIfMissing creates the container, with private access, unless
+// it already exists. A container created by another process initializing the
+// backend at the same time counts as existing.
+func (b *Backend) createContainerIfMissing(ctx context.Context) error {
+	client, err := b.armClient.getContainersClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	container, err := client.GetProperties(ctx, b.accountName, b.containerName)
+	if err == nil {
+		return nil
+	}
+	if !container.Response.IsHTTPStatus(http.StatusNotFound) {
+		return fmt.Errorf("Error retrieving Container %q in Storage Account %q: %w", b.containerName, b.accountName, err)
+	}
+
+	log.Printf("[INFO] Creating Container %q in Storage Account %q", b.containerName, b.accountName)
+	created, err := client.Create(ctx, b.accountName, b.containerName, containers.CreateInput{AccessLevel: containers.Private})
+	if err != nil {
+		switch {
+		case created.Response.IsHTTPStatus(http.StatusConflict):
+			return nil
+		case isForbidden(created.Response):
+			return fmt.Errorf("Container %q doesn't exist in Storage Account %q, and the backend's credentials aren't allowed to create it; Azure AD principals need a data role such as Storage Blob Data Contributor, and a SAS token must allow creating containers (srt=c, sp=c): %w", b.containerName, b.accountName, err)
+		}
+		return fmt.Errorf("Error creating Container %q in Storage Account %q: %w", b.containerName, b.accountName, err)
+	}
 	return nil
 }
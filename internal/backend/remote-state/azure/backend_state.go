@@ -6,19 +6,34 @@
 package azure
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-multierror"
 	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/states"
 	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statefile"
 	"github.com/opentofu/opentofu/internal/states/statemgr"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
 )
 
+// ErrContainerNotFound is returned by Workspaces when the configured
+// container doesn't exist, as opposed to existing without any states.
+var ErrContainerNotFound = errors.New("the container does not exist")
+
 const (
 	// This will be used as directory name, the odd looking colon is simply to
 	// reduce the chance of name conflicts with existing objects.
@@ -26,47 +41,289 @@ const (
 )
 
 func (b *Backend) Workspaces() ([]string, error) {
-	prefix := b.keyName + keyEnvPrefix
-	params := containers.ListBlobsInput{
-		Prefix: &prefix,
-	}
-
 	ctx := context.TODO()
-	client, err := b.armClient.getContainersClient(ctx)
+	envs, err := b.workspaceBlobs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.ListBlobs(ctx, b.armClient.storageAccountName, b.containerName, params)
+	names, err := b.workspaceNamesOf(ctx, envs)
 	if err != nil {
 		return nil, err
 	}
 
-	envs := map[string]struct{}{}
-	for _, obj := range resp.Blobs.Blobs {
-		key := obj.Name
-		if strings.HasPrefix(key, prefix) {
-			name := strings.TrimPrefix(key, prefix)
-			// we store the state in a key, not a directory
-			if strings.Contains(name, "/") {
+	// The default workspace comes first and the others are sorted, so the
+	// result doesn't depend on the order of the listing.
+	return append([]string{backend.DefaultStateName}, names...), nil
+}
+
+// WorkspacesPage lists the workspaces a page at a time, so that callers
+// listing a very large set of workspaces can checkpoint and resume across
+// invocations. Listing starts from the given continuation token, or from
+// the beginning if it's empty, and returns at most limit workspaces, or as
+// many as Azure returns in a page if limit is zero. The default workspace is
+// only listed on the first page. The returned token continues the listing,
+// and is empty once there are no more workspaces.
+//
+// A page may list fewer workspaces than limit, even none, without being the
+// last, as the blobs kept next to the states count towards the limit.
+func (b *Backend) WorkspacesPage(token string, limit int) ([]string, string, error) {
+	ctx := context.TODO()
+	envs, next, err := b.listWorkspaceBlobs(ctx, token, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	names, err := b.workspaceNamesOf(ctx, envs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if token == "" {
+		names = append([]string{backend.DefaultStateName}, names...)
+	}
+	return names, next, nil
+}
+
+// workspaceNamesOf returns the sorted names of the workspaces whose state
+// blobs have the given names after the workspace prefix, translating the
+// hashes naming them when obfuscate_workspace_names is set.
+func (b *Backend) workspaceNamesOf(ctx context.Context, envs map[string]struct{}) ([]string, error) {
+	if b.obfuscateWorkspaceNames {
+		blobClient, err := b.armClient.getBlobClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names, err := b.readWorkspaceNames(ctx, blobClient)
+		if err != nil {
+			return nil, err
+		}
+		obfuscated := envs
+		envs = map[string]struct{}{}
+		for hash := range obfuscated {
+			name, ok := names[hash]
+			if !ok {
+				log.Printf("[WARN] Skipping state Blob %q, whose workspace isn't recorded in Blob %q", b.workspacePath(hash), b.workspaceNamesBlob())
 				continue
 			}
-
 			envs[name] = struct{}{}
 		}
 	}
 
-	result := []string{backend.DefaultStateName}
+	result := make([]string, 0, len(envs))
 	for name := range envs {
 		result = append(result, name)
 	}
-	sort.Strings(result[1:])
+	sort.Strings(result)
 	return result, nil
 }
 
-func (b *Backend) DeleteWorkspace(name string, _ bool) error {
+// workspaceListWorkers is how many workspace blob listings are parsed at
+// once by workspaceBlobs.
+const workspaceListWorkers = 4
+
+// workspaceBlobs returns the set of names the state blobs of the workspaces
+// other than the default one have after the workspace prefix, which are the
+// hashes of the workspace names when obfuscate_workspace_names is set.
+//
+// Each page of the listing can only be requested once the previous one has
+// been received, as it starts at the marker the previous one returned, so
+// the pages are fetched one after another while a pool of workers parses
+// the pages already fetched.
+func (b *Backend) workspaceBlobs(ctx context.Context) (map[string]struct{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make(chan []string, workspaceListWorkers)
+	var listErr error
+	go func() {
+		defer close(pages)
+		marker := ""
+		for {
+			names, next, err := b.listBlobNames(ctx, marker, 0)
+			if err != nil {
+				listErr = err
+				return
+			}
+			select {
+			case pages <- names:
+			case <-ctx.Done():
+				return
+			}
+			if next == "" {
+				return
+			}
+			marker = next
+		}
+	}()
+
+	var mu sync.Mutex
+	envs := map[string]struct{}{}
+	var wg sync.WaitGroup
+	for i := 0; i < workspaceListWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for names := range pages {
+				page := b.workspaceBlobsOf(names)
+				mu.Lock()
+				for name := range page {
+					envs[name] = struct{}{}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the listing has ended once the workers are done, as they only stop
+	// once it closes the pages
+	if listErr != nil {
+		return nil, listErr
+	}
+	return envs, nil
+}
+
+// listWorkspaceBlobs is like workspaceBlobs, but only lists the page of at
+// most limit blobs starting at the given marker, returning the marker of the
+// next page, or an empty one after the last page.
+func (b *Backend) listWorkspaceBlobs(ctx context.Context, marker string, limit int) (map[string]struct{}, string, error) {
+	names, next, err := b.listBlobNames(ctx, marker, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return b.workspaceBlobsOf(names), next, nil
+}
+
+// listBlobNames lists the names of the page of at most limit blobs under the
+// workspace prefix starting at the given marker, returning the marker of the
+// next page, or an empty one after the last page. Snapshots of the blobs
+// aren't listed, nor are the directories of a Storage Account with a
+// hierarchical namespace.
+func (b *Backend) listBlobNames(ctx context.Context, marker string, limit int) ([]string, string, error) {
+	prefix := b.workspacePrefix()
+	params := containers.ListBlobsInput{
+		Prefix: &prefix,
+	}
+	if marker != "" {
+		params.Marker = &marker
+	}
+	if limit > 0 {
+		params.MaxResults = &limit
+	}
+	if b.hnsEnabled {
+		// the directories are only told apart from the blobs by their
+		// metadata
+		params.Include = &[]containers.Dataset{containers.MetaData}
+	}
+
+	client, err := b.armClient.getContainersClient(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The storage SDK can't decode the metadata of the listed blobs, so the
+	// response is decoded here.
+	req, err := client.ListBlobsPreparer(ctx, b.armClient.storageAccountName, b.containerName, params)
+	if err != nil {
+		return nil, "", autorest.NewErrorWithError(err, "containers.Client", "ListBlobs", nil, "Failure preparing request")
+	}
+	resp, err := client.ListBlobsSender(req)
+	if err != nil {
+		return nil, "", autorest.NewErrorWithError(err, "containers.Client", "ListBlobs", resp, "Failure sending request")
+	}
+	var result listBlobsResult
+	err = autorest.Respond(
+		resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingXML(&result),
+		autorest.ByClosing())
+	if err != nil {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, "", fmt.Errorf("%w: container %q in storage account %q; create it before using it as a backend", ErrContainerNotFound, b.containerName, b.armClient.storageAccountName)
+		}
+		return nil, "", autorest.NewErrorWithError(err, "containers.Client", "ListBlobs", resp, "Failure responding to request")
+	}
+
+	names := make([]string, 0, len(result.Blobs))
+	for _, obj := range result.Blobs {
+		if isHnsFolder(obj.IsFolder) {
+			continue
+		}
+		names = append(names, obj.Name)
+	}
+	return names, result.NextMarker, nil
+}
+
+// workspaceBlobsOf returns the set of names the state blobs among the given
+// blobs have after the workspace prefix.
+func (b *Backend) workspaceBlobsOf(names []string) map[string]struct{} {
+	envs := map[string]struct{}{}
+	for _, key := range names {
+		if name, ok := b.workspaceOfPath(key); ok {
+			envs[name] = struct{}{}
+		}
+	}
+	return envs
+}
+
+// workspacePrefix returns the prefix of the state blobs of the workspaces
+// other than the default one.
+func (b *Backend) workspacePrefix() string {
+	if b.workspaceKeyPrefix != "" {
+		return b.workspaceKeyPrefix + b.workspaceKeySeparator
+	}
+	return b.keyName + keyEnvPrefix
+}
+
+// workspacePath returns the name of the state blob of a workspace other than
+// the default one, given the name the workspace is stored by, which is the
+// hash of its name when obfuscate_workspace_names is set. With a
+// workspace_key_prefix, the name is
+// <prefix><separator><workspace><separator><key>, and otherwise
+// <key>env:<workspace>.
+func (b *Backend) workspacePath(env string) string {
+	if b.workspaceKeyPrefix != "" {
+		return b.workspacePrefix() + env + b.workspaceKeySeparator + b.keyName
+	}
+	return b.workspacePrefix() + env
+}
+
+// workspaceOfPath is the reverse of workspacePath, returning false for blobs
+// that aren't the state of a workspace.
+func (b *Backend) workspaceOfPath(key string) (string, bool) {
+	name, ok := strings.CutPrefix(key, b.workspacePrefix())
+	if !ok {
+		return "", false
+	}
+	if b.workspaceKeyPrefix != "" {
+		// the blobs kept next to a state, such as its manifest and lock
+		// blob, don't end with the key
+		name, ok = strings.CutSuffix(name, b.workspaceKeySeparator+b.keyName)
+		if !ok || name == "" {
+			return "", false
+		}
+	} else if strings.HasSuffix(name, manifestSuffix) || strings.HasSuffix(name, lockBlobSuffix) {
+		// nor is a state's manifest or lock blob a workspace of its own
+		return "", false
+	}
+	// we store the state in a key, not a directory
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// DeleteWorkspace deletes the state of the workspace, along with its
+// snapshots, manifest, history blobs and lock blob. A workspace whose state
+// is locked may be in use by an operation, so it's only deleted when force
+// is set, which breaks the lock.
+func (b *Backend) DeleteWorkspace(name string, force bool) error {
 	if name == backend.DefaultStateName || name == "" {
 		return fmt.Errorf("can't delete default state")
 	}
+	if err := b.checkWritable(fmt.Sprintf("delete workspace %q", name)); err != nil {
+		return err
+	}
 
 	ctx := context.TODO()
 	client, err := b.armClient.getBlobClient(ctx)
@@ -74,44 +331,136 @@ func (b *Backend) DeleteWorkspace(name string, _ bool) error {
 		return err
 	}
 
-	if resp, err := client.Delete(ctx, b.armClient.storageAccountName, b.containerName, b.path(name), blobs.DeleteInput{}); err != nil {
+	stateClient, err := b.remoteClient(name)
+	if err != nil {
+		return err
+	}
+	info, err := b.LockInfo(name)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		if !force {
+			return fmt.Errorf("can't delete workspace %q, as its state is locked%s, so an operation may be using it; wait for the operation to finish, or force the deletion to break the lock", name, lockHolder(info))
+		}
+		log.Printf("[WARN] Breaking the lock%s on the state of workspace %q to delete it", lockHolder(info), name)
+		if err := stateClient.breakLease(ctx); err != nil {
+			return fmt.Errorf("can't break the lock on the state of workspace %q to delete it: %w", name, err)
+		}
+	}
+
+	if resp, err := client.Delete(ctx, b.armClient.storageAccountName, b.containerName, b.path(name), blobs.DeleteInput{DeleteSnapshots: true}); err != nil {
+		if immutableErr := immutableBlobError(resp, b.path(name)); immutableErr != nil {
+			return fmt.Errorf("can't delete workspace %q: %w", name, immutableErr)
+		}
 		if resp.Response.StatusCode != 404 {
 			return err
 		}
 	}
 
+	if b.writeManifest {
+		if resp, err := client.Delete(ctx, b.armClient.storageAccountName, b.containerName, b.path(name)+manifestSuffix, blobs.DeleteInput{}); err != nil {
+			if resp.Response.StatusCode != 404 {
+				return err
+			}
+		}
+	}
+
+	if b.historyCount > 0 {
+		if err := stateClient.deleteHistory(ctx); err != nil {
+			return err
+		}
+	}
+
+	if stateClient.mayUseLockBlob() {
+		if resp, err := client.Delete(ctx, b.armClient.storageAccountName, b.containerName, stateClient.lockBlobName(), blobs.DeleteInput{}); err != nil {
+			if resp.Response.StatusCode != 404 {
+				return err
+			}
+		}
+	}
+
+	if b.obfuscateWorkspaceNames {
+		if err := b.recordWorkspaceName(ctx, client, name, true); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// lockHolder describes who holds the lock with the given info, for an error
+// message, or returns an empty string when that isn't known.
+func lockHolder(info *statemgr.LockInfo) string {
+	if info.ID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" by %s for %q since %s (lock ID %s)", info.Who, info.Operation, info.Created.Format(time.RFC3339), info.ID)
+}
+
+// immutabilityErrors explains the error codes with which Azure refuses to
+// write, change the metadata of, or delete a blob in a container with
+// immutable storage.
+var immutabilityErrors = map[string]string{
+	"BlobImmutableDueToLegalHold": "the container has a legal hold, which prevents its blobs from being overwritten, modified or deleted until the hold is cleared",
+	"BlobImmutableDueToPolicy":    "the container has a time-based retention policy, which prevents its blobs from being overwritten, modified or deleted until their retention period has passed",
+}
+
+// immutableStateHint suggests how to keep the history of the states without
+// immutable storage, which states can't be kept in as they're overwritten
+// and locked in place.
+const immutableStateHint = "OpenTofu can't update states in a container with immutable storage; keep them in a container without it, and set snapshot to keep a snapshot of every previous state, or enable blob versioning on the Storage Account, to retain their history"
+
+// immutableBlobError returns an error explaining why the named blob couldn't
+// be written, modified or deleted if resp shows that the container's
+// immutable storage prevented it, or nil otherwise.
+func immutableBlobError(resp autorest.Response, blobName string) error {
+	if resp.Response == nil || resp.StatusCode != http.StatusConflict {
+		return nil
+	}
+	explanation, ok := immutabilityErrors[resp.Header.Get("x-ms-error-code")]
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("state Blob %q is immutable: %s", blobName, explanation)
+}
+
 func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
-	ctx := context.TODO()
-	blobClient, err := b.armClient.getBlobClient(ctx)
+	if name != backend.DefaultStateName && b.workspaceNamePattern != nil && !b.workspaceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("workspace name %q doesn't match the workspace_name_pattern %q", name, b.workspaceNamePattern)
+	}
+
+	client, err := b.remoteClient(name)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &RemoteClient{
-		giovanniBlobClient: *blobClient,
-		containerName:      b.containerName,
-		keyName:            b.path(name),
-		accountName:        b.accountName,
-		snapshot:           b.snapshot,
+	enc, err := b.workspaceEncryption(name)
+	if err != nil {
+		return nil, err
 	}
 
-	stateMgr := remote.NewState(client, b.encryption)
+	stateMgr := remote.NewState(client, enc)
 
 	// Grab the value
 	if err := stateMgr.RefreshState(); err != nil {
 		return nil, err
 	}
 	//if this isn't the default state name, we need to create the object so
-	//it's listed by States.
-	if v := stateMgr.State(); v == nil {
+	//it's listed by States. A read-only backend leaves it to be created by
+	//one that isn't, and reads it as empty meanwhile.
+	if v := stateMgr.State(); v == nil && !b.readOnly {
 		// take a lock on this state while we write it
 		lockInfo := statemgr.NewLockInfo()
 		lockInfo.Operation = "init"
 		lockId, err := client.Lock(lockInfo)
 		if err != nil {
+			// Another process initializing the same state holds the lock,
+			// so its state is used once written rather than failing. Any
+			// other failure to lock is reported straight away.
+			if isLockHeld(err) && b.awaitInitializedState(name, stateMgr) {
+				return stateMgr, b.checkLineage(name, stateMgr)
+			}
 			return nil, fmt.Errorf("failed to lock azure state: %w", err)
 		}
 
@@ -132,13 +481,26 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 		//it's listed by States.
 		if v := stateMgr.State(); v == nil {
 			// If we have no state, we have to create an empty state
-			if err := stateMgr.WriteState(states.NewState()); err != nil {
-				err = lockUnlock(err)
-				return nil, err
+			if b.obfuscateWorkspaceNames && name != backend.DefaultStateName {
+				if err := b.recordWorkspaceName(context.TODO(), &client.giovanniBlobClient, name, false); err != nil {
+					err = lockUnlock(err)
+					return nil, err
+				}
 			}
-			if err := stateMgr.PersistState(nil); err != nil {
-				err = lockUnlock(err)
-				return nil, err
+			if b.expectedLineage != "" {
+				if err := b.writeInitialState(client, stateMgr, enc); err != nil {
+					err = lockUnlock(err)
+					return nil, err
+				}
+			} else {
+				if err := stateMgr.WriteState(states.NewState()); err != nil {
+					err = lockUnlock(err)
+					return nil, err
+				}
+				if err := stateMgr.PersistState(nil); err != nil {
+					err = lockUnlock(err)
+					return nil, err
+				}
 			}
 
 			// Unlock, the state should now be initialized
@@ -148,11 +510,330 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 		}
 	}
 
+	if err := b.checkLineage(name, stateMgr); err != nil {
+		return nil, err
+	}
 	return stateMgr, nil
 }
 
-func (b *Backend) client() *RemoteClient {
-	return &RemoteClient{}
+// writeInitialState writes an empty state with the expected lineage through
+// the given client, which holds the lock, so that a new state is tied to
+// the environment from its first write. The state manager would generate a
+// lineage of its own for it. The state is encrypted with enc, the encryption
+// of the workspace.
+func (b *Backend) writeInitialState(client *RemoteClient, stateMgr *remote.State, enc encryption.StateEncryption) error {
+	var buf bytes.Buffer
+	if err := statefile.Write(statefile.New(states.NewState(), b.expectedLineage, 1), &buf, enc); err != nil {
+		return err
+	}
+	if err := client.Put(buf.Bytes()); err != nil {
+		return err
+	}
+	return stateMgr.RefreshState()
+}
+
+// workspaceEncryption returns the state encryption of the named workspace,
+// verifying it first when verify_encryption is set. The encryption of the
+// selected workspace was already verified by configure.
+func (b *Backend) workspaceEncryption(name string) (encryption.StateEncryption, error) {
+	enc, err := encryption.StateEncryptionForWorkspace(b.encryption, name)
+	if err != nil {
+		return nil, err
+	}
+	if b.verifyEncryption && enc != b.encryption {
+		if err := verifyEncryption(enc); err != nil {
+			return nil, fmt.Errorf("workspace %q: %w", name, err)
+		}
+	}
+	return enc, nil
+}
+
+// checkLineage returns an error if expected_lineage is set and the state of
+// the named workspace has a different lineage.
+func (b *Backend) checkLineage(name string, stateMgr *remote.State) error {
+	if b.expectedLineage == "" {
+		return nil
+	}
+	if lineage := stateMgr.StateSnapshotMeta().Lineage; lineage != b.expectedLineage {
+		return fmt.Errorf("the state of workspace %q has lineage %q, but expected_lineage is %q; check that the backend is configured for the right environment", name, lineage, b.expectedLineage)
+	}
+	return nil
+}
+
+// LockInfo returns the info of the lock held on the state of the given
+// workspace, or nil if the state isn't locked, without trying to acquire the
+// lock. A lock held without info, as is briefly the case while it's being
+// acquired, is returned with only its path.
+func (b *Backend) LockInfo(workspace string) (*statemgr.LockInfo, error) {
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return nil, err
+	}
+	ctx, requestID, done := client.operationContext(context.TODO())
+	defer done()
+
+	properties, err := client.giovanniBlobClient.GetProperties(ctx, client.accountName, client.containerName, client.keyName, blobs.GetPropertiesInput{})
+	if err != nil {
+		if properties.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, client.operationError(err, requestID)
+	}
+	if properties.LeaseStatus != blobs.Locked {
+		if !client.mayUseLockBlob() {
+			return nil, nil
+		}
+		info, err := client.getLockBlobInfo(ctx)
+		if err != nil {
+			return nil, client.operationError(err, requestID)
+		}
+		return info, nil
+	}
+
+	path := fmt.Sprintf("%s/%s", client.containerName, client.keyName)
+	if properties.MetaData[lockInfoMetaKey] == "" {
+		return &statemgr.LockInfo{Path: path}, nil
+	}
+	info, err := lockInfoFromMetaData(properties.MetaData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock info on Blob %q: %w", client.keyName, err)
+	}
+	return info, nil
+}
+
+// stateInitPolicy controls how long StateMgr waits for another process that
+// holds the lock on a state which doesn't exist yet to write it, as happens
+// when several processes initialize a fresh backend at once.
+type stateInitPolicy struct {
+	// Attempts is the maximum number of times the state is read again.
+	Attempts int
+
+	// Interval is how long to wait before each read.
+	Interval time.Duration
+
+	// sleep waits for the given duration, returning early with an error if
+	// ctx is cancelled. It defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+var defaultStateInitPolicy = stateInitPolicy{
+	Attempts: 10,
+	Interval: 2 * time.Second,
+}
+
+// awaitInitializedState waits, according to the backend's state
+// initialization policy, for the state of the named workspace to be written
+// by another process, reporting whether it was.
+func (b *Backend) awaitInitializedState(name string, stateMgr *remote.State) bool {
+	policy := b.stateInit
+	if policy.Attempts <= 0 {
+		policy.Attempts = defaultStateInitPolicy.Attempts
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = defaultStateInitPolicy.Interval
+	}
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+
+	for attempt := 1; attempt <= policy.Attempts; attempt++ {
+		log.Printf("[DEBUG] Waiting %s for another process to initialize the state of workspace %q (attempt %d of %d)", policy.Interval, name, attempt, policy.Attempts)
+		if err := policy.sleep(context.TODO(), policy.Interval); err != nil {
+			return false
+		}
+		if err := stateMgr.RefreshState(); err != nil {
+			log.Printf("[DEBUG] Failed to read the state of workspace %q: %s", name, err)
+			continue
+		}
+		if stateMgr.State() != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isLockHeld returns whether the given error from locking a state reports
+// that another process holds the lock, rather than that locking failed.
+func isLockHeld(err error) bool {
+	var lockErr *statemgr.LockError
+	if !errors.As(err, &lockErr) {
+		return false
+	}
+	return lockErr.Info != nil || errors.Is(lockErr.Err, errBlobLocked)
+}
+
+// SwapWorkspaces exchanges the states stored for the two given workspaces,
+// as used for blue/green promotion. Both state blobs are locked for the
+// duration of the swap, and if the second write fails the first workspace is
+// rolled back to its original state so that neither ends up half-swapped.
+// When the workspaces are encrypted differently, each state is re-encrypted
+// for the workspace it's moved to.
+func (b *Backend) SwapWorkspaces(first, second string) (err error) {
+	if first == second {
+		return fmt.Errorf("can't swap workspace %q with itself", first)
+	}
+
+	firstClient, err := b.remoteClient(first)
+	if err != nil {
+		return err
+	}
+	secondClient, err := b.remoteClient(second)
+	if err != nil {
+		return err
+	}
+
+	// The swap relies on seeing each write fail or succeed in order to roll
+	// back, so its writes must not be deferred until the locks are released.
+	// Either state can have the lower serial, and so can the rolled back one.
+	firstClient.coalesceWrites = false
+	secondClient.coalesceWrites = false
+	firstClient.minSerialGuard = false
+	secondClient.minSerialGuard = false
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "swap"
+
+	firstLockID, err := firstClient.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock workspace %q: %w", first, err)
+	}
+	defer func() {
+		if unlockErr := firstClient.Unlock(firstLockID); unlockErr != nil {
+			err = multierror.Append(err, fmt.Errorf("failed to unlock workspace %q: %w", first, unlockErr))
+		}
+	}()
+
+	lockInfo = statemgr.NewLockInfo()
+	lockInfo.Operation = "swap"
+
+	secondLockID, err := secondClient.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock workspace %q: %w", second, err)
+	}
+	defer func() {
+		if unlockErr := secondClient.Unlock(secondLockID); unlockErr != nil {
+			err = multierror.Append(err, fmt.Errorf("failed to unlock workspace %q: %w", second, unlockErr))
+		}
+	}()
+
+	firstPayload, err := firstClient.Get()
+	if err != nil {
+		return fmt.Errorf("failed to read state for workspace %q: %w", first, err)
+	}
+	if firstPayload == nil {
+		return fmt.Errorf("workspace %q has no state to swap", first)
+	}
+	secondPayload, err := secondClient.Get()
+	if err != nil {
+		return fmt.Errorf("failed to read state for workspace %q: %w", second, err)
+	}
+	if secondPayload == nil {
+		return fmt.Errorf("workspace %q has no state to swap", second)
+	}
+
+	// Each workspace can have its own key, so the states are re-encrypted
+	// for the workspace they move to.
+	firstEnc, err := b.workspaceEncryption(first)
+	if err != nil {
+		return err
+	}
+	secondEnc, err := b.workspaceEncryption(second)
+	if err != nil {
+		return err
+	}
+	toFirst, err := reencryptState(secondPayload.Data, secondEnc, firstEnc)
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt the state of workspace %q for workspace %q: %w", second, first, err)
+	}
+	toSecond, err := reencryptState(firstPayload.Data, firstEnc, secondEnc)
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt the state of workspace %q for workspace %q: %w", first, second, err)
+	}
+
+	if err := firstClient.Put(toFirst); err != nil {
+		return fmt.Errorf("failed to write state for workspace %q: %w", first, err)
+	}
+
+	if err := secondClient.Put(toSecond); err != nil {
+		err = fmt.Errorf("failed to write state for workspace %q: %w", second, err)
+		if rollbackErr := firstClient.Put(firstPayload.Data); rollbackErr != nil {
+			return multierror.Append(err, fmt.Errorf("failed to roll back state for workspace %q: %w", first, rollbackErr))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// reencryptState decrypts the given state with from and encrypts it again
+// with to. The state is returned as is when both are the same encryption.
+func reencryptState(data []byte, from, to encryption.StateEncryption) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+	plain, err := from.DecryptState(data)
+	if err != nil {
+		return nil, err
+	}
+	return to.EncryptState(plain)
+}
+
+// remoteClient returns a RemoteClient for the state of the named workspace.
+func (b *Backend) remoteClient(name string) (*RemoteClient, error) {
+	ctx := context.TODO()
+	blobClient, err := b.armClient.getBlobClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var containersClient *containers.Client
+	if b.historyCount > 0 {
+		if containersClient, err = b.armClient.getContainersClient(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RemoteClient{
+		giovanniBlobClient:   *blobClient,
+		containerName:        b.containerName,
+		keyName:              b.path(name),
+		accountName:          b.accountName,
+		snapshot:             b.snapshot,
+		snapshotLimiter:      b.snapshotLimiter,
+		readCache:            b.readCache,
+		lockMethod:           b.lockMethod,
+		metaData:             b.metaData,
+		blobTags:             b.blobTags,
+		clientSideEncryption: b.clientSideEncryption,
+		lockRetry:            b.lockRetry,
+		leaseRenewal:         b.leaseRenewal,
+		leaseDuration:        b.leaseDuration,
+		heartbeatInterval:    b.leaseRenewalInterval,
+		readFromSecondary:    b.readFromSecondary,
+		coalesceWrites:       b.coalesceWrites,
+		minSerialGuard:       b.minSerialGuard,
+		writeManifest:        b.writeManifest,
+		maxReadBytes:         b.maxReadBytes,
+		relockOnLoss:         b.relockOnLoss,
+		strictUnlock:         b.strictUnlock,
+		verifyStateChecksum:  b.verifyChecksum,
+		incrementalUpload:    b.incrementalUpload,
+		readOnly:             b.readOnly,
+		blobContentType:      b.blobContentType,
+		historyCount:         b.historyCount,
+		containersClient:     containersClient,
+		blobCacheControl:     b.blobCacheControl,
+		sasToken:             b.armClient.sasToken,
+		operationTimeout:     b.operationTimeout,
+		lockTimeout:          b.lockTimeout,
+		workspace:            name,
+		lockEventsFile:       b.lockEventsFile,
+		auditFailClosed:      b.auditFailClosed,
+		autoRehydrate:        b.autoRehydrate,
+		rehydration:          rehydratePolicy{Timeout: b.rehydrateTimeout},
+
+		clientRequestIDPrefix: b.armClient.clientRequestIDPrefix,
+		idempotencyKey:        b.idempotencyKey,
+	}, nil
 }
 
 func (b *Backend) path(name string) string {
@@ -160,7 +841,10 @@ func (b *Backend) path(name string) string {
 		return b.keyName
 	}
 
-	return b.keyName + keyEnvPrefix + name
+	if b.obfuscateWorkspaceNames {
+		return b.workspacePath(workspaceNameHash(name))
+	}
+	return b.workspacePath(name)
 }
 
 const errStateUnlock = `
@@ -6,13 +6,38 @@
 package azure
 
 import (
+	"bytes"
 	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	armStorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/addrs"
 	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/configs"
 	"github.com/opentofu/opentofu/internal/encryption"
+	"github.com/opentofu/opentofu/internal/encryption/config"
+	"github.com/opentofu/opentofu/internal/encryption/enctest"
+	"github.com/opentofu/opentofu/internal/encryption/keyprovider/static"
+	"github.com/opentofu/opentofu/internal/encryption/method/aesgcm"
+	"github.com/opentofu/opentofu/internal/encryption/registry/lockingencryptionregistry"
 	"github.com/opentofu/opentofu/internal/legacy/helper/acctest"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statefile"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"golang.org/x/oauth2"
 )
 
 func TestBackend_impl(t *testing.T) {
@@ -342,3 +367,1223 @@ func TestAccBackendServicePrincipalLocked(t *testing.T) {
 	backend.TestBackendStateLocksInWS(t, b1, b2, "foo")
 	backend.TestBackendStateForceUnlockInWS(t, b1, b2, "foo")
 }
+
+func TestBackendSwapWorkspaces(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	blue := []byte(`{"lineage":"blue"}`)
+	green := []byte(`{"lineage":"green"}`)
+	m.putBlob(mockContainerName, b.path("blue"), blue, nil)
+	m.putBlob(mockContainerName, b.path("green"), green, nil)
+
+	if err := b.SwapWorkspaces("blue", "green"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := m.blob(mockContainerName, b.path("blue")).content; string(got) != string(green) {
+		t.Fatalf("wrong content for blue after swap: %s", got)
+	}
+	if got := m.blob(mockContainerName, b.path("green")).content; string(got) != string(blue) {
+		t.Fatalf("wrong content for green after swap: %s", got)
+	}
+	for _, name := range []string{"blue", "green"} {
+		if blob := m.blob(mockContainerName, b.path(name)); blob.leaseID != "" {
+			t.Fatalf("workspace %q is still locked after swap", name)
+		}
+	}
+}
+
+func TestBackendSwapWorkspacesRollback(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	blue := []byte(`{"lineage":"blue"}`)
+	green := []byte(`{"lineage":"green"}`)
+	m.putBlob(mockContainerName, b.path("blue"), blue, nil)
+	m.putBlob(mockContainerName, b.path("green"), green, nil)
+
+	// fail the write of the second workspace, after the first was swapped
+	greenPath := "/" + mockContainerName + "/" + b.path("green")
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.URL.Path == greenPath && r.URL.Query().Get("comp") == "" {
+			return mockError(http.StatusForbidden, "AuthorizationFailure", "This request is not authorized to perform this operation.")
+		}
+		return nil
+	}
+
+	err := b.SwapWorkspaces("blue", "green")
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), `workspace "green"`) {
+		t.Fatalf("error doesn't mention the failed workspace: %s", err)
+	}
+
+	if got := m.blob(mockContainerName, b.path("blue")).content; string(got) != string(blue) {
+		t.Fatalf("blue was not rolled back: %s", got)
+	}
+	if got := m.blob(mockContainerName, b.path("green")).content; string(got) != string(green) {
+		t.Fatalf("green was modified: %s", got)
+	}
+}
+
+func TestBackendSwapWorkspacesMinSerialGuard(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"min_serial_guard": true,
+	})
+
+	blue := []byte(`{"lineage":"blue","serial":1}`)
+	green := []byte(`{"lineage":"green","serial":5}`)
+	m.putBlob(mockContainerName, b.path("blue"), blue, nil)
+	m.putBlob(mockContainerName, b.path("green"), green, nil)
+
+	// green's state goes back from serial 5 to 1
+	if err := b.SwapWorkspaces("blue", "green"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := m.blob(mockContainerName, b.path("green")).content; string(got) != string(blue) {
+		t.Fatalf("wrong content for green after swap: %s", got)
+	}
+
+	// and blue's back from 5 to 1 when the swap is rolled back
+	bluePath := "/" + mockContainerName + "/" + b.path("blue")
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.URL.Path == bluePath && r.URL.Query().Get("comp") == "" {
+			return mockError(http.StatusForbidden, "AuthorizationFailure", "This request is not authorized to perform this operation.")
+		}
+		return nil
+	}
+	err := b.SwapWorkspaces("green", "blue")
+	if err == nil || strings.Contains(err.Error(), "roll back") {
+		t.Fatalf("expected the swap to fail and be rolled back, got %v", err)
+	}
+	if got := m.blob(mockContainerName, b.path("green")).content; string(got) != string(blue) {
+		t.Fatalf("green was not rolled back: %s", got)
+	}
+}
+
+func TestBackendSwapWorkspacesUnlockError(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	m.putBlob(mockContainerName, b.path("blue"), []byte(`{"lineage":"blue"}`), nil)
+	m.putBlob(mockContainerName, b.path("green"), []byte(`{"lineage":"green"}`), nil)
+
+	greenPath := "/" + mockContainerName + "/" + b.path("green")
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.URL.Path == greenPath && r.Header.Get("x-ms-lease-action") == "release" {
+			return mockError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation", "The lease ID specified did not match the lease ID for the blob.")
+		}
+		return nil
+	}
+
+	err := b.SwapWorkspaces("blue", "green")
+	if err == nil || !strings.Contains(err.Error(), `failed to unlock workspace "green"`) {
+		t.Fatalf("expected the unlock error to be reported, got %v", err)
+	}
+	if blob := m.blob(mockContainerName, b.path("blue")); blob.leaseID != "" {
+		t.Fatal("workspace \"blue\" is still locked after swap")
+	}
+}
+
+func TestBackendSwapWorkspacesReencrypts(t *testing.T) {
+	m := newMockStorage()
+	enc := workspaceKeyEncryption(t)
+	b, diags := configureBackendWithEncryption(t, m, enc, nil)
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+
+	workspaceEnc := func(name string) encryption.StateEncryption {
+		wsEnc, err := encryption.StateEncryptionForWorkspace(enc, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wsEnc
+	}
+	for _, name := range []string{"blue", "green"} {
+		data, err := workspaceEnc(name).EncryptState([]byte(`{"lineage":"` + name + `"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.putBlob(mockContainerName, b.path(name), data, nil)
+	}
+
+	if err := b.SwapWorkspaces("blue", "green"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, want := range map[string]string{"blue": "green", "green": "blue"} {
+		got, err := workspaceEnc(name).DecryptState(m.blob(mockContainerName, b.path(name)).content)
+		if err != nil {
+			t.Fatalf("the state of workspace %q doesn't decrypt with its own key after the swap: %s", name, err)
+		}
+		if string(got) != `{"lineage":"`+want+`"}` {
+			t.Fatalf("wrong state for %s after swap: %s", name, got)
+		}
+	}
+}
+
+func TestBackendConfigProbeWrite(t *testing.T) {
+	m := newMockStorage()
+	testBackendWithMockStorage(t, m, map[string]interface{}{
+		"probe_write": true,
+	})
+
+	if got := m.requestCount(http.MethodPut, ""); got != 1 {
+		t.Fatalf("expected 1 probe write, got %d", got)
+	}
+	if got := m.requestCount(http.MethodDelete, ""); got != 1 {
+		t.Fatalf("expected 1 probe delete, got %d", got)
+	}
+	probe := m.requests[0].Blob
+	if !strings.HasPrefix(probe, "test.tfstate.probe-") {
+		t.Fatalf("unexpected probe blob name %q", probe)
+	}
+	if m.requests[1].Blob != probe {
+		t.Fatalf("deleted %q rather than the probe blob %q", m.requests[1].Blob, probe)
+	}
+	if m.blob(mockContainerName, probe) != nil {
+		t.Fatalf("probe blob %q was not cleaned up", probe)
+	}
+}
+
+func TestBackendConfigProbeWriteFailure(t *testing.T) {
+	m := newMockStorage()
+
+	// the write is applied but its response reports a failure, so the probe
+	// must still be cleaned up
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method != http.MethodPut {
+			return nil
+		}
+		m.intercept = nil
+		if _, err := m.Do(r); err != nil {
+			t.Fatal(err)
+		}
+		return mockError(http.StatusForbidden, "AuthorizationFailure", "This request is not authorized to perform this operation.")
+	}
+
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"probe_write": true,
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected error, got none")
+	}
+	if got := diags.Err().Error(); !strings.Contains(got, "failed to write probe blob") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+
+	if got := m.requestCount(http.MethodDelete, ""); got != 1 {
+		t.Fatalf("expected 1 probe delete, got %d", got)
+	}
+	if blobs := m.containers[mockContainerName]; len(blobs) != 0 {
+		t.Fatalf("probe blob was not cleaned up: %v", blobs)
+	}
+}
+
+func TestBackendConfigServicePrincipalWithoutTenantID(t *testing.T) {
+	t.Setenv("ARM_TENANT_ID", "")
+
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"access_key":          "",
+		"resource_group_name": "tofu-rg",
+		"subscription_id":     "00000000-0000-0000-0000-000000000000",
+		"client_id":           "00000000-0000-0000-0000-000000000001",
+		"client_secret":       "secret",
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected error, got none")
+	}
+	if got := diags.Err().Error(); !strings.Contains(got, "tenant_id must be set") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+}
+
+func TestBackendConfigRequireSharedKeyDisabledWithAccessKey(t *testing.T) {
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"use_azuread_auth":            true,
+		"require_shared_key_disabled": true,
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected error, got none")
+	}
+	if got := diags.Err().Error(); !strings.Contains(got, "can't be used with an Access Key") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+}
+
+func TestBackendConfigInvalidBlobContentType(t *testing.T) {
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"blob_content_type": "application/json; =",
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected error, got none")
+	}
+	if got := diags.Err().Error(); !strings.Contains(got, "invalid blob_content_type") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+}
+
+func TestArmClientCheckSharedKeyAccessDisabled(t *testing.T) {
+	cases := map[string]struct {
+		properties string
+		wantErr    bool
+	}{
+		"disabled": {properties: `{"allowSharedKeyAccess": false}`},
+		"enabled":  {properties: `{"allowSharedKeyAccess": true}`, wantErr: true},
+		"unset":    {properties: `{}`, wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			accountsClient := armStorage.NewAccountsClientWithBaseURI("https://management.azure.invalid", "00000000-0000-0000-0000-000000000000")
+			accountsClient.Sender = autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+				header := http.Header{}
+				header.Set("Content-Type", "application/json")
+				resp := mockResponse(http.StatusOK, header, []byte(`{"name": "mockaccount", "properties": `+tc.properties+`}`))
+				resp.Request = r
+				return resp, nil
+			})
+
+			client := ArmClient{
+				resourceGroupName:     "tofu-rg",
+				storageAccountName:    mockAccountName,
+				storageAccountsClient: &accountsClient,
+			}
+			err := client.checkSharedKeyAccessDisabled(context.Background())
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "allows Shared Key access") {
+					t.Fatalf("expected a Shared Key access error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestResolveResourceManagerEndpoint(t *testing.T) {
+	cases := map[string]struct {
+		environment azure.Environment
+		endpoint    string
+		want        string
+		wantWarning bool
+	}{
+		"environment only": {
+			environment: azure.PublicCloud,
+			want:        azure.PublicCloud.ResourceManagerEndpoint,
+		},
+		"environment and its own endpoint": {
+			environment: azure.PublicCloud,
+			endpoint:    "https://management.azure.com",
+			want:        "https://management.azure.com",
+		},
+		"environment and custom endpoint": {
+			environment: azure.PublicCloud,
+			endpoint:    "https://management.example.com/",
+			want:        "https://management.example.com/",
+			wantWarning: true,
+		},
+		"other environment and custom endpoint": {
+			environment: azure.ChinaCloud,
+			endpoint:    "https://management.example.com/",
+			want:        "https://management.example.com/",
+			wantWarning: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, warning := resolveResourceManagerEndpoint(tc.environment, tc.endpoint)
+			if got != tc.want {
+				t.Fatalf("expected endpoint %q, got %q", tc.want, got)
+			}
+			if (warning != "") != tc.wantWarning {
+				t.Fatalf("unexpected warning %q", warning)
+			}
+		})
+	}
+}
+
+func TestResolveStorageEndpointSuffix(t *testing.T) {
+	cases := map[string]struct {
+		environment azure.Environment
+		suffix      string
+		want        string
+		wantErr     bool
+	}{
+		"environment only": {
+			environment: azure.ChinaCloud,
+			want:        azure.ChinaCloud.StorageEndpointSuffix,
+		},
+		"custom suffix": {
+			environment: azure.PublicCloud,
+			suffix:      "local.azurestack.external",
+			want:        "local.azurestack.external",
+		},
+		"url": {
+			environment: azure.PublicCloud,
+			suffix:      "https://local.azurestack.external",
+			wantErr:     true,
+		},
+		"path": {
+			environment: azure.PublicCloud,
+			suffix:      "local.azurestack.external/blob",
+			wantErr:     true,
+		},
+		"port": {
+			environment: azure.PublicCloud,
+			suffix:      "local.azurestack.external:8443",
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := resolveStorageEndpointSuffix(tc.environment, tc.suffix, mockAccountName)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid storage_endpoint_suffix") {
+					t.Fatalf("expected the suffix to be refused, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected suffix %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBackendStorageEndpointSuffix(t *testing.T) {
+	m := newMockStorage()
+	var hosts []string
+	m.intercept = func(r *http.Request) *http.Response {
+		hosts = append(hosts, r.URL.Host)
+		return nil
+	}
+	// the suffix wins over the environment's and the connection string's
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"environment":             "china",
+		"storage_account_name":    "",
+		"access_key":              "",
+		"connection_string":       "AccountName=" + mockAccountName + ";AccountKey=" + mockAccessKey + ";EndpointSuffix=core.windows.net",
+		"storage_endpoint_suffix": "local.azurestack.external",
+	})
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) == 0 {
+		t.Fatal("expected requests to be made")
+	}
+	for _, host := range hosts {
+		if host != mockAccountName+".blob.local.azurestack.external" {
+			t.Fatalf("expected the requests to use the storage endpoint suffix, got %q", host)
+		}
+	}
+}
+
+func TestBackendConfigSASTokenURL(t *testing.T) {
+	cases := map[string]struct {
+		sasToken string
+		wantErr  string
+	}{
+		"token": {
+			sasToken: "sv=2019-12-12&ss=b&srt=sco&sp=rwdlac&sig=c2lnbmF0dXJl",
+		},
+		"url for the configured account": {
+			sasToken: "https://mockaccount.blob.core.windows.net/mockcontainer?sv=2019-12-12&ss=b&srt=sco&sp=rwdlac&sig=c2lnbmF0dXJl",
+		},
+		"url for another account": {
+			sasToken: "https://otheraccount.blob.core.windows.net/mockcontainer?sv=2019-12-12&ss=b&srt=sco&sp=rwdlac&sig=c2lnbmF0dXJl",
+			wantErr:  `SAS Token is a URL for the Storage Account "otheraccount", but storage_account_name is "mockaccount"`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+				"access_key": "",
+				"sas_token":  tc.sasToken,
+			})
+			if tc.wantErr != "" {
+				if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, diags.Err())
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatal(diags.Err())
+			}
+			if want := "sv=2019-12-12&ss=b&srt=sco&sp=rwdlac&sig=c2lnbmF0dXJl"; b.armClient.sasToken != want {
+				t.Fatalf("expected SAS token %q, got %q", want, b.armClient.sasToken)
+			}
+		})
+	}
+}
+
+func TestBackendObfuscateWorkspaceNames(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"obfuscate_workspace_names": true,
+	})
+
+	for _, name := range []string{"customer-acme", "customer-globex"} {
+		if _, err := b.StateMgr(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key := range m.containers[mockContainerName] {
+		if strings.Contains(key, "customer") {
+			t.Fatalf("workspace name is visible in Blob %q", key)
+		}
+	}
+	if blob := m.blob(mockContainerName, "test.tfstateenv:"+workspaceNameHash("customer-acme")); blob == nil {
+		t.Fatal("state blob is not named by the workspace name's hash")
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "customer-acme", "customer-globex"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+
+	if err := b.DeleteWorkspace("customer-acme", false); err != nil {
+		t.Fatal(err)
+	}
+	workspaces, err = b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "customer-globex"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces after delete:\n%s", diff)
+	}
+	if blob := m.blob(mockContainerName, "test.tfstate"+workspaceNamesSuffix); strings.Contains(string(blob.content), "customer-acme") {
+		t.Fatalf("deleted workspace is still recorded: %s", blob.content)
+	}
+}
+
+// stubTokenAuthorizer is an Azure AD authorizer whose token expires at a
+// fixed time.
+type stubTokenAuthorizer struct {
+	expiry time.Time
+}
+
+func (a stubTokenAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	return autorest.WithNothing()
+}
+
+func (a stubTokenAuthorizer) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: "token", Expiry: a.expiry}, nil
+}
+
+func TestBackendTokenExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	expiry := now.Add(20 * time.Minute)
+
+	b := &Backend{armClient: &ArmClient{tokenExpiry: authorizerTokenExpiry(stubTokenAuthorizer{expiry: expiry})}}
+	got, ok := b.TokenExpiry()
+	if !ok || !got.Equal(expiry) {
+		t.Fatalf("expected token expiry %s, got %s (%t)", expiry, got, ok)
+	}
+
+	if warning := tokenExpiryWarning(got, time.Hour, now); !strings.Contains(warning, "expires at 2024-01-02T15:20:00Z, in 20m0s") {
+		t.Fatalf("expected a warning for a token expiring within the window, got %q", warning)
+	}
+	if warning := tokenExpiryWarning(got, 10*time.Minute, now); warning != "" {
+		t.Fatalf("unexpected warning for a token expiring after the window: %q", warning)
+	}
+
+	// an access key has no token to expire
+	b = &Backend{armClient: &ArmClient{accessKey: "key"}}
+	if _, ok := b.TokenExpiry(); ok {
+		t.Fatal("expected no token expiry when authenticating with an access key")
+	}
+}
+
+func TestBackendInvalidTokenExpiryWarning(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"token_expiry_warning": "soon",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), `invalid token_expiry_warning "soon"`) {
+		t.Fatalf("expected an invalid duration error, got %v", diags.Err())
+	}
+}
+
+func TestBackendWorkspacesEmptyContainer(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	// an existing container without states only has the default workspace
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+}
+
+func TestBackendWorkspacesMissingContainer(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"container_name": "missing",
+	})
+
+	_, err := b.Workspaces()
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Fatalf("expected ErrContainerNotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `container "missing" in storage account`) {
+		t.Fatalf("error doesn't name the container: %s", err)
+	}
+}
+
+func TestBackendCreateContainerIfMissing(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"container_name":              "created",
+		"create_container_if_missing": true,
+	})
+	if _, ok := m.containers["created"]; !ok {
+		t.Fatal("expected the container to be created")
+	}
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+
+	// initializing again finds the container there
+	testBackendWithMockStorage(t, m, map[string]interface{}{
+		"container_name":              "created",
+		"create_container_if_missing": true,
+	})
+	if n := m.requestCount(http.MethodPut, ""); n != 1 {
+		t.Fatalf("expected the container to be created once, got %d requests", n)
+	}
+}
+
+func TestBackendCreateContainerIfMissingConcurrently(t *testing.T) {
+	m := newMockStorage()
+	// another init creates the container between this one finding it
+	// missing and creating it
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.URL.Query().Get("restype") == "container" {
+			m.mu.Lock()
+			m.containers["racy"] = map[string]*mockBlob{}
+			m.mu.Unlock()
+		}
+		return nil
+	}
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"container_name":              "racy",
+		"create_container_if_missing": true,
+	})
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+}
+
+func TestBackendCreateContainerIfMissingForbidden(t *testing.T) {
+	m := newMockStorage()
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.URL.Query().Get("restype") == "container" {
+			return mockError(http.StatusForbidden, "AuthorizationPermissionMismatch", "This request is not authorized to perform this operation using this permission.")
+		}
+		return nil
+	}
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"container_name":              "forbidden",
+		"create_container_if_missing": true,
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "aren't allowed to create it") {
+		t.Fatalf("expected a permission error, got %v", diags.Err())
+	}
+}
+
+func TestBackendStateMgrConcurrentInit(t *testing.T) {
+	m := newMockStorage()
+
+	var mu sync.Mutex
+	var creations int
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" && r.ContentLength > 0 {
+			mu.Lock()
+			creations++
+			mu.Unlock()
+		}
+		return nil
+	}
+
+	const runners = 4
+	backends := make([]*Backend, runners)
+	for i := range backends {
+		backends[i] = testBackendWithMockStorage(t, m, nil)
+		backends[i].stateInit = stateInitPolicy{Attempts: 100, Interval: time.Millisecond}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, runners)
+	for i, b := range backends {
+		wg.Add(1)
+		go func(i int, b *Backend) {
+			defer wg.Done()
+			_, errs[i] = b.StateMgr(backend.DefaultStateName)
+		}(i, b)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("runner %d failed to initialize: %s", i, err)
+		}
+	}
+	if creations != 1 {
+		t.Fatalf("expected the state to be created exactly once, got %d", creations)
+	}
+}
+
+func TestBackendStateMgrInitLockError(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	var waits int
+	b.stateInit = stateInitPolicy{
+		Attempts: 3,
+		Interval: time.Second,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			waits++
+			return nil
+		},
+	}
+
+	// the lock can't be taken, but not because anyone holds it
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Header.Get("x-ms-lease-action") == "acquire" {
+			return mockError(http.StatusForbidden, "AuthorizationPermissionMismatch", "This request is not authorized to perform this operation using this permission.")
+		}
+		return nil
+	}
+
+	_, err := b.StateMgr("foo")
+	if err == nil || !strings.Contains(err.Error(), "failed to lock azure state") {
+		t.Fatalf("expected the lock error, got %v", err)
+	}
+	if waits != 0 {
+		t.Fatalf("expected the lock error to be reported without waiting, waited %d times", waits)
+	}
+}
+
+func TestRemoteClientLockKeepsConcurrentlyCreatedState(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	// another process writes the state after the client found it missing
+	state := []byte(`{"version": 4, "serial": 1}`)
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodHead {
+			m.intercept = nil
+			m.putBlob(mockContainerName, "test.tfstate", state, nil)
+			return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		}
+		return nil
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Lock(statemgr.NewLockInfo()); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.blob(mockContainerName, "test.tfstate").content; string(got) != string(state) {
+		t.Fatalf("locking replaced the state with %q", got)
+	}
+}
+
+func TestBackendWorkspaceNamePattern(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"workspace_name_pattern": "^[a-z0-9-]+$",
+	})
+
+	for _, name := range []string{backend.DefaultStateName, "prod-eu-1"} {
+		if _, err := b.StateMgr(name); err != nil {
+			t.Fatalf("unexpected error for workspace %q: %s", name, err)
+		}
+	}
+
+	_, err := b.StateMgr("Prod_EU")
+	if err == nil || !strings.Contains(err.Error(), `workspace name "Prod_EU" doesn't match the workspace_name_pattern "^[a-z0-9-]+$"`) {
+		t.Fatalf("expected the workspace name to be rejected, got %v", err)
+	}
+	if blob := m.blob(mockContainerName, "test.tfstateenv:Prod_EU"); blob != nil {
+		t.Fatal("state was created for a rejected workspace")
+	}
+}
+
+func TestBackendInvalidWorkspaceNamePattern(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"workspace_name_pattern": "[a-z",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), `invalid workspace_name_pattern "[a-z"`) {
+		t.Fatalf("expected an invalid pattern error, got %v", diags.Err())
+	}
+}
+
+func TestBackendLockInfo(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	info, err := b.LockInfo("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		t.Fatalf("expected no lock info for a missing state, got %#v", info)
+	}
+
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "apply"
+	lockInfo.Who = "tester@example"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := m.requestCount(http.MethodPut, "lease")
+
+	info, err = b.LockInfo("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.ID != lockID || info.Who != "tester@example" || info.Operation != "apply" {
+		t.Fatalf("unexpected lock info: %#v", info)
+	}
+	if n := m.requestCount(http.MethodPut, "lease"); n != acquired {
+		t.Fatalf("reading the lock info made %d lease requests", n-acquired)
+	}
+
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+	info, err = b.LockInfo("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		t.Fatalf("expected no lock info once unlocked, got %#v", info)
+	}
+}
+
+func TestBackendWorkspacesOrder(t *testing.T) {
+	names := []string{"zeta", "alpha", "prod-2", "Beta", "prod-10"}
+	want := []string{backend.DefaultStateName, "Beta", "alpha", "prod-10", "prod-2", "zeta"}
+
+	// the order of the listing mustn't matter
+	for _, order := range [][]string{names, {"prod-10", "zeta", "Beta", "prod-2", "alpha"}} {
+		m := newMockStorage()
+		b := testBackendWithMockStorage(t, m, nil)
+
+		result := mockListBlobsResult{Prefix: "test.tfstateenv:"}
+		for _, name := range order {
+			result.Blobs = append(result.Blobs, mockListBlob{Name: "test.tfstateenv:" + name})
+		}
+		body, err := xml.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.intercept = func(r *http.Request) *http.Response {
+			if r.URL.Query().Get("comp") == "list" {
+				return mockResponse(http.StatusOK, http.Header{"Content-Type": {"application/xml"}}, body)
+			}
+			return nil
+		}
+
+		workspaces, err := b.Workspaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, workspaces); diff != "" {
+			t.Fatalf("unexpected workspaces for listing order %q:\n%s", order, diff)
+		}
+	}
+}
+
+func TestBackendDeleteWorkspaceLegalHold(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, b.path("blue"), []byte(`{"version": 4}`), nil)
+
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodDelete {
+			return mockError(http.StatusConflict, "BlobImmutableDueToLegalHold", "This operation is not permitted as the blob is immutable due to one or more legal holds.")
+		}
+		return nil
+	}
+
+	err := b.DeleteWorkspace("blue", false)
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if got := err.Error(); !strings.Contains(got, `can't delete workspace "blue"`) || !strings.Contains(got, "the container has a legal hold") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+	if blob := m.blob(mockContainerName, b.path("blue")); blob == nil {
+		t.Fatal("state was deleted despite the legal hold")
+	}
+}
+
+func TestBackendDeleteWorkspaceLocked(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, b.path("blue"), []byte(`{"version": 4}`), nil)
+	m.putSnapshot(mockContainerName, b.path("blue"), "2024-01-02T15:04:05.0000000Z", []byte(`{"version": 4}`))
+
+	// an operation holds the lock on the state
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := statemgr.NewLockInfo()
+	info.Operation = "apply"
+	lockID, err := client.Lock(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.DeleteWorkspace("blue", false)
+	if err == nil || !strings.Contains(err.Error(), `can't delete workspace "blue", as its state is locked`) || !strings.Contains(err.Error(), lockID) {
+		t.Fatalf("expected the locked workspace not to be deleted, got %v", err)
+	}
+	if m.blob(mockContainerName, b.path("blue")) == nil {
+		t.Fatal("the locked state was deleted")
+	}
+
+	// forcing the deletion breaks the lock, and the snapshots go with the
+	// state
+	if err := b.DeleteWorkspace("blue", true); err != nil {
+		t.Fatal(err)
+	}
+	if m.blob(mockContainerName, b.path("blue")) != nil {
+		t.Fatal("the state wasn't deleted")
+	}
+}
+
+// brokenKeyEncryption encrypts states with one key but tries to decrypt
+// them with another, as a misconfigured key provider would.
+type brokenKeyEncryption struct{}
+
+func (brokenKeyEncryption) EncryptState(data []byte) ([]byte, error) {
+	return []byte(`{"encrypted_data": "c2VjcmV0", "encryption_version": "v0"}`), nil
+}
+
+func (brokenKeyEncryption) DecryptState(data []byte) ([]byte, error) {
+	return nil, errors.New("cipher: message authentication failed")
+}
+
+// workspaceKeyEncryption returns a state encryption that derives its key
+// from the name of the workspace, with "default" selected.
+func workspaceKeyEncryption(t *testing.T) encryption.StateEncryption {
+	t.Helper()
+
+	reg := lockingencryptionregistry.New()
+	if err := reg.RegisterKeyProvider(static.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterMethod(aesgcm.New()); err != nil {
+		t.Fatal(err)
+	}
+	cfg, diags := config.LoadConfigFromString("Test Config Source", `
+		key_provider "static" "workspace" {
+			key = sha256("secret-${terraform.workspace}")
+		}
+		method "aes_gcm" "workspace" {
+			keys = key_provider.static.workspace
+		}
+		state {
+			method = method.aes_gcm.workspace
+		}
+	`)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	staticEval := configs.NewStaticEvaluator(nil, configs.NewStaticModuleCall(addrs.RootModule, nil, "<testing>", "default"))
+	enc, diags := encryption.New(reg, cfg, staticEval)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	return enc.State()
+}
+
+func TestBackendVerifyEncryption(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithEncryption(t, m, brokenKeyEncryption{}, map[string]interface{}{
+		"verify_encryption": true,
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "unable to decrypt what was encrypted: cipher: message authentication failed") {
+		t.Fatalf("expected the encryption verification to fail, got %v", diags.Err())
+	}
+	if len(m.requests) != 0 {
+		t.Fatalf("expected no requests before the encryption was verified, got %d", len(m.requests))
+	}
+
+	// a working configuration passes
+	_, diags = configureBackendWithEncryption(t, m, enctest.EncryptionRequired().State(), map[string]interface{}{
+		"verify_encryption": true,
+	})
+	if diags.HasErrors() {
+		t.Fatal(diags.Err())
+	}
+}
+
+func TestBackendRequireExplicitEnvironment(t *testing.T) {
+	t.Setenv("ARM_ENVIRONMENT", "")
+	m := newMockStorage()
+
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"require_explicit_environment": true,
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "environment must be set") {
+		t.Fatalf("expected an unset environment to be rejected, got %v", diags.Err())
+	}
+
+	// an explicit environment is accepted, even the public one
+	testBackendWithMockStorage(t, m, map[string]interface{}{
+		"require_explicit_environment": true,
+		"environment":                  "public",
+	})
+
+	// without the option the public environment is defaulted to, as before
+	testBackendWithMockStorage(t, m, nil)
+}
+
+func TestBackendWorkspaceKeyPrefix(t *testing.T) {
+	cases := map[string]struct {
+		separator string
+		wantPath  string
+	}{
+		"default separator": {
+			wantPath: "workspaces/blue/test.tfstate",
+		},
+		"custom separator": {
+			separator: "--",
+			wantPath:  "workspaces--blue--test.tfstate",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			config := map[string]interface{}{
+				"workspace_key_prefix": "workspaces",
+				"write_manifest":       true,
+			}
+			if tc.separator != "" {
+				config["workspace_key_separator"] = tc.separator
+			}
+			b := testBackendWithMockStorage(t, m, config)
+
+			s, err := b.StateMgr("blue")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.WriteState(states.NewState()); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.PersistState(nil); err != nil {
+				t.Fatal(err)
+			}
+			if m.blob(mockContainerName, tc.wantPath) == nil {
+				t.Fatalf("expected the state in Blob %q", tc.wantPath)
+			}
+			// the states of other keys under the prefix aren't this
+			// backend's workspaces
+			other := strings.Replace(tc.wantPath, "test.tfstate", "other.tfstate", 1)
+			m.putBlob(mockContainerName, other, []byte(`{"version": 4}`), nil)
+
+			workspaces, err := b.Workspaces()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{backend.DefaultStateName, "blue"}, workspaces); diff != "" {
+				t.Fatalf("unexpected workspaces:\n%s", diff)
+			}
+
+			if err := b.DeleteWorkspace("blue", true); err != nil {
+				t.Fatal(err)
+			}
+			if m.blob(mockContainerName, tc.wantPath) != nil {
+				t.Fatalf("expected Blob %q to be deleted", tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestBackendWorkspaceKeySeparatorWithoutPrefix(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"workspace_key_separator": "--",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "workspace_key_prefix") {
+		t.Fatalf("expected a separator without a prefix to be rejected, got %v", diags.Err())
+	}
+}
+
+func TestBackendWorkspacesManyPages(t *testing.T) {
+	m := newMockStorage()
+	m.pageSize = 7
+	b := testBackendWithMockStorage(t, m, nil)
+
+	want := []string{backend.DefaultStateName}
+	for i := 99; i >= 0; i-- {
+		name := fmt.Sprintf("ws-%02d", i)
+		want = append(want, name)
+		m.putBlob(mockContainerName, b.path(name), []byte(`{"version": 4}`), nil)
+		// the blobs kept next to a state aren't workspaces
+		if i%10 == 0 {
+			m.putBlob(mockContainerName, b.path(name)+lockBlobSuffix, []byte(`{}`), nil)
+			m.putBlob(mockContainerName, b.path(name)+manifestSuffix, []byte(`{}`), nil)
+			m.mu.Lock()
+			blob := m.containers[mockContainerName][b.path(name)]
+			blob.snapshots = append(blob.snapshots, &mockSnapshot{timestamp: "2024-01-02T15:04:05.0000000Z", content: blob.content})
+			m.mu.Unlock()
+		}
+	}
+	sort.Strings(want[1:])
+
+	got, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+
+	// a page failing to list fails the listing
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.URL.Query().Get("comp") == "list" && r.URL.Query().Get("marker") != "" {
+			return mockError(http.StatusForbidden, "AuthorizationFailure", "This request is not authorized to perform this operation.")
+		}
+		return nil
+	}
+	if _, err := b.Workspaces(); err == nil || !strings.Contains(err.Error(), "AuthorizationFailure") {
+		t.Fatalf("expected the failed page to fail the listing, got %v", err)
+	}
+}
+
+func TestBackendWorkspacesPage(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	for _, name := range []string{"alpha", "bravo", "charlie", "delta", "echo"} {
+		m.putBlob(mockContainerName, b.path(name), []byte(`{"version": 4}`), nil)
+	}
+
+	names, token, err := b.WorkspacesPage("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "alpha", "bravo"}, names); diff != "" {
+		t.Fatalf("unexpected first page:\n%s", diff)
+	}
+	if token == "" {
+		t.Fatal("expected a continuation token after the first page")
+	}
+
+	// A workspace created after the checkpoint, sorting after it, is still
+	// found when resuming from the token, and the listing continues from
+	// where it left off rather than starting over.
+	m.putBlob(mockContainerName, b.path("foxtrot"), []byte(`{"version": 4}`), nil)
+	var resumed []string
+	for token != "" {
+		var page []string
+		page, token, err = b.WorkspacesPage(token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed = append(resumed, page...)
+	}
+	if diff := cmp.Diff([]string{"charlie", "delta", "echo", "foxtrot"}, resumed); diff != "" {
+		t.Fatalf("unexpected workspaces after resuming:\n%s", diff)
+	}
+
+	// Workspaces follows every page
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+}
+
+func TestBackendExpectedLineage(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"expected_lineage": "prod-lineage",
+	})
+
+	for lineage, wantErr := range map[string]bool{"prod-lineage": false, "staging-lineage": true} {
+		var buf bytes.Buffer
+		if err := statefile.Write(&statefile.File{Lineage: lineage, Serial: 1, State: states.NewState()}, &buf, b.encryption); err != nil {
+			t.Fatal(err)
+		}
+		m.putBlob(mockContainerName, b.path(backend.DefaultStateName), buf.Bytes(), nil)
+
+		_, err := b.StateMgr(backend.DefaultStateName)
+		if wantErr {
+			if err == nil || !strings.Contains(err.Error(), `has lineage "staging-lineage", but expected_lineage is "prod-lineage"`) {
+				t.Fatalf("expected a lineage mismatch error, got %v", err)
+			}
+		} else if err != nil {
+			t.Fatalf("expected the matching lineage to be accepted, got %s", err)
+		}
+	}
+}
+
+func TestBackendExpectedLineageFirstWrite(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"expected_lineage": "prod-lineage",
+	})
+
+	stateMgr, err := b.StateMgr("blue")
+	if err != nil {
+		t.Fatalf("expected a new state to be created, got %s", err)
+	}
+	if got := stateMgr.(*remote.State).StateSnapshotMeta().Lineage; got != "prod-lineage" {
+		t.Fatalf("expected the new state to have the expected lineage, got %q", got)
+	}
+
+	file, err := statefile.Read(bytes.NewReader(m.blob(mockContainerName, b.path("blue")).content), b.encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Lineage != "prod-lineage" {
+		t.Fatalf("expected the stored state to have the expected lineage, got %q", file.Lineage)
+	}
+}
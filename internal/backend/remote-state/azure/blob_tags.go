@@ -0,0 +1,179 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// The metadata keys below record which metadata keys and index tags of the
+// state blob were set from the backend's configuration, so that the ones
+// removed from the configuration are removed from the blob rather than left
+// behind.
+const (
+	managedMetaDataMetaKey = "opentofumetadatakeys"
+	managedTagsMetaKey     = "opentofutagkeys"
+)
+
+// maxBlobTags is the most index tags Azure allows on a blob.
+const maxBlobTags = 10
+
+// blobTagsAPIVersion is the first version of the Blob service API with blob
+// index tags, which the storage SDK predates. It's the one that added blob
+// versions too.
+const blobTagsAPIVersion = versioningAPIVersion
+
+// blobTagSet is the body of the requests to get and set the index tags of a
+// blob.
+type blobTagSet struct {
+	XMLName xml.Name  `xml:"Tags"`
+	Tags    []blobTag `xml:"TagSet>Tag"`
+}
+
+type blobTag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// managedKeys returns the keys recorded under the given metadata key.
+func managedKeys(metaData map[string]string, key string) []string {
+	if metaData[key] == "" {
+		return nil
+	}
+	return strings.Split(metaData[key], ",")
+}
+
+// recordManagedKeys records the keys of the given map under the given
+// metadata key, or removes the record if there are none.
+func recordManagedKeys(metaData map[string]string, key string, values map[string]string) {
+	if len(values) == 0 {
+		delete(metaData, key)
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	metaData[key] = strings.Join(keys, ",")
+}
+
+// configuredMetaData returns the metadata to write the state blob with,
+// given the metadata it has: the configured metadata is set, and the keys
+// set from an earlier configuration that aren't configured anymore are
+// removed. Any other metadata is kept.
+func (c *RemoteClient) configuredMetaData(existing map[string]string) map[string]string {
+	metaData := make(map[string]string, len(existing)+len(c.metaData)+2)
+	for k, v := range existing {
+		metaData[k] = v
+	}
+
+	for _, k := range managedKeys(existing, managedMetaDataMetaKey) {
+		delete(metaData, k)
+	}
+	for k, v := range c.metaData {
+		metaData[k] = v
+	}
+	recordManagedKeys(metaData, managedMetaDataMetaKey, c.metaData)
+	recordManagedKeys(metaData, managedTagsMetaKey, c.blobTags)
+	return metaData
+}
+
+// updateBlobTags sets the configured index tags on the state blob, removing
+// the given tags set from an earlier configuration that aren't configured
+// anymore. Any other tags are kept.
+func (c *RemoteClient) updateBlobTags(ctx context.Context, previous []string) error {
+	tags, err := c.getBlobTags(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range previous {
+		delete(tags, k)
+	}
+	for k, v := range c.blobTags {
+		tags[k] = v
+	}
+	if len(tags) > maxBlobTags {
+		return fmt.Errorf("Blob %q would have %d index tags, more than the %d Azure allows", c.keyName, len(tags), maxBlobTags)
+	}
+	return c.setBlobTags(ctx, tags)
+}
+
+// getBlobTags returns the index tags of the state blob. The storage SDK has
+// no way to read them, so the request is built here.
+func (c *RemoteClient) getBlobTags(ctx context.Context) (map[string]string, error) {
+	req, err := c.blobTagsPreparer(ctx, autorest.AsGet())
+	if err != nil {
+		return nil, fmt.Errorf("error preparing request for the index tags of Blob %q: %w", c.keyName, err)
+	}
+	resp, err := autorest.SendWithSender(c.giovanniBlobClient, req, azure.DoRetryWithRegistration(c.giovanniBlobClient.Client))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the index tags of Blob %q: %w", c.keyName, err)
+	}
+
+	var tagSet blobTagSet
+	err = autorest.Respond(
+		resp,
+		c.giovanniBlobClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingXML(&tagSet),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the index tags of Blob %q: %w", c.keyName, err)
+	}
+
+	tags := make(map[string]string, len(tagSet.Tags))
+	for _, tag := range tagSet.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+// setBlobTags replaces the index tags of the state blob with the given ones.
+func (c *RemoteClient) setBlobTags(ctx context.Context, tags map[string]string) error {
+	tagSet := blobTagSet{Tags: make([]blobTag, 0, len(tags))}
+	for k, v := range tags {
+		tagSet.Tags = append(tagSet.Tags, blobTag{Key: k, Value: v})
+	}
+	sort.Slice(tagSet.Tags, func(i, j int) bool { return tagSet.Tags[i].Key < tagSet.Tags[j].Key })
+
+	req, err := c.blobTagsPreparer(ctx, autorest.AsPut(), autorest.AsContentType("application/xml; charset=utf-8"), autorest.WithXML(tagSet))
+	if err != nil {
+		return fmt.Errorf("error preparing request to set the index tags of Blob %q: %w", c.keyName, err)
+	}
+	resp, err := autorest.SendWithSender(c.giovanniBlobClient, req, azure.DoRetryWithRegistration(c.giovanniBlobClient.Client))
+	if err != nil {
+		return fmt.Errorf("error setting the index tags of Blob %q: %w", c.keyName, err)
+	}
+	err = autorest.Respond(
+		resp,
+		c.giovanniBlobClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusNoContent),
+		autorest.ByClosing())
+	if err != nil {
+		return fmt.Errorf("error setting the index tags of Blob %q: %w", c.keyName, err)
+	}
+	return nil
+}
+
+// blobTagsPreparer prepares a request for the index tags of the state blob,
+// decorated with the given decorators.
+func (c *RemoteClient) blobTagsPreparer(ctx context.Context, decorators ...autorest.PrepareDecorator) (*http.Request, error) {
+	decorators = append(decorators,
+		autorest.WithBaseURL(c.giovanniBlobClient.GetResourceID(c.accountName, c.containerName, c.keyName)),
+		autorest.WithQueryParameters(map[string]interface{}{"comp": "tags"}),
+		autorest.WithHeader("x-ms-version", blobTagsAPIVersion),
+		c.giovanniBlobClient.WithAuthorization())
+	return autorest.Prepare((&http.Request{}).WithContext(ctx), decorators...)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestRemoteClientMetaDataAndTags(t *testing.T) {
+	m := newMockStorage()
+	put := func(config map[string]interface{}) {
+		t.Helper()
+		b := testBackendWithMockStorage(t, m, config)
+		client, err := b.remoteClient(backend.DefaultStateName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := testBackendWithMockStorage(t, m, nil).path(backend.DefaultStateName)
+	check := func(wantMetaData, wantTags map[string]string) {
+		t.Helper()
+		blob := m.blob(mockContainerName, key)
+		metaData := map[string]string{}
+		for k, v := range blob.metadata {
+			if k != managedMetaDataMetaKey && k != managedTagsMetaKey {
+				metaData[k] = v
+			}
+		}
+		if diff := cmp.Diff(wantMetaData, metaData); diff != "" {
+			t.Errorf("unexpected metadata:\n%s", diff)
+		}
+		tags := blob.tags
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		if diff := cmp.Diff(wantTags, tags); diff != "" {
+			t.Errorf("unexpected tags:\n%s", diff)
+		}
+	}
+
+	put(map[string]interface{}{
+		"metadata":  map[string]interface{}{"Owner": "team-a", "env": "prod"},
+		"blob_tags": map[string]interface{}{"project": "apollo", "env": "prod"},
+	})
+	check(
+		map[string]string{"owner": "team-a", "env": "prod"},
+		map[string]string{"project": "apollo", "env": "prod"},
+	)
+
+	// metadata and tags set by others are kept
+	m.mu.Lock()
+	blob := m.containers[mockContainerName][key]
+	blob.metadata["retention"] = "long"
+	blob.tags["costcenter"] = "42"
+	m.mu.Unlock()
+
+	// a changed configuration updates the blob, removing what's no longer
+	// configured
+	put(map[string]interface{}{
+		"metadata":  map[string]interface{}{"owner": "team-b"},
+		"blob_tags": map[string]interface{}{"project": "gemini"},
+	})
+	check(
+		map[string]string{"owner": "team-b", "retention": "long"},
+		map[string]string{"project": "gemini", "costcenter": "42"},
+	)
+
+	put(nil)
+	check(
+		map[string]string{"retention": "long"},
+		map[string]string{"costcenter": "42"},
+	)
+}
+
+func TestBackendInvalidMetaData(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"metadata": map[string]interface{}{"TerraformLockID": "nope"},
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "used by the backend") {
+		t.Fatalf("expected a reserved metadata key to be rejected, got %v", diags.Err())
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// checksumMetaKey is the metadata key the SHA-256 of the state written to
+// the state blob is recorded under when verify_checksum is set. The state is
+// hashed as the backend was given it, so after any state encryption and
+// before any client-side encryption.
+const checksumMetaKey = "opentofusha256"
+
+func stateChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChecksum checks the contents of the given result of reading the state
+// blob, once decrypted, against the checksum recorded with them. A blob
+// without a checksum, such as one written before verify_checksum was set,
+// isn't checked.
+func (c *RemoteClient) verifyChecksum(result blobs.GetResult) error {
+	if !c.verifyStateChecksum || result.Response.Response == nil {
+		return nil
+	}
+	want := result.Header.Get("x-ms-meta-" + checksumMetaKey)
+	if want == "" {
+		log.Printf("[DEBUG] Blob %q has no checksum to verify", c.keyName)
+		return nil
+	}
+	if got := stateChecksum(result.Contents); got != want {
+		return fmt.Errorf("state Blob %q is corrupt: its SHA-256 is %s, but %s was recorded when it was written; it may have been partially uploaded or modified outside of OpenTofu. Restore it from a snapshot or a previous version", c.keyName, got, want)
+	}
+	return nil
+}
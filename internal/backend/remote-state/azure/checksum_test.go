@@ -0,0 +1,84 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestRemoteClientVerifyChecksum(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"verify_checksum": true,
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "checksum"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatal(err)
+	}
+	blob := m.blob(mockContainerName, "test.tfstate")
+	if got, want := blob.metadata[checksumMetaKey], stateChecksum(state); got != want {
+		t.Fatalf("expected checksum %q, got %q", want, got)
+	}
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected %s, got %s", state, payload.Data)
+	}
+
+	// a partially uploaded state doesn't match its checksum
+	m.putBlob(mockContainerName, "test.tfstate", state[:len(state)/2], blob.metadata)
+	if _, err := client.Get(); err == nil || !strings.Contains(err.Error(), `state Blob "test.tfstate" is corrupt`) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+
+	// a state written without a checksum is read as is
+	m.putBlob(mockContainerName, "test.tfstate", state, nil)
+	if _, err := client.Get(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteClientChecksumRemoved(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"verify_checksum": true,
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// writing without verify_checksum drops the checksum rather than
+	// leaving one that no longer matches
+	b.verifyChecksum = false
+	plain, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Put([]byte(`{"version": 4, "serial": 2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.blob(mockContainerName, "test.tfstate").metadata[checksumMetaKey]; ok {
+		t.Fatal("expected the checksum to be removed")
+	}
+	if _, err := client.Get(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,21 +9,33 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/opentofu/opentofu/internal/states/remote"
 	"github.com/opentofu/opentofu/internal/states/statemgr"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
 )
 
 const (
 	leaseHeader = "x-ms-lease-id"
 	// Must be lower case
 	lockInfoMetaKey = "terraformlockid"
+
+	// defaultBlobContentType and defaultBlobCacheControl are the content
+	// type and cache control of the state blob when blob_content_type and
+	// blob_cache_control aren't set.
+	defaultBlobContentType  = "application/json"
+	defaultBlobCacheControl = "no-cache"
 )
 
 type RemoteClient struct {
@@ -33,21 +45,219 @@ type RemoteClient struct {
 	keyName            string
 	leaseID            string
 	snapshot           bool
+
+	// lockMethod is how the state is locked, one of the lockMethod
+	// constants.
+	lockMethod string
+
+	// snapshotLimiter, when set, paces the snapshots taken before writes.
+	// It's shared with the other clients of the backend.
+	snapshotLimiter *snapshotLimiter
+
+	// readCache, when set, caches the states read, and is shared with the
+	// other clients of the backend.
+	readCache *readCache
+
+	// metaData and blobTags are set on the state blob, as metadata and
+	// index tags, on every write.
+	metaData map[string]string
+	blobTags map[string]string
+
+	// coalesceWrites buffers the state written while a lease is held in
+	// pendingWrite, so that only the last write of a lock session reaches
+	// the blob, when the lease is released.
+	coalesceWrites bool
+	pendingWrite   []byte
+
+	// maxReadBytes is the largest state, in bytes, that Get will download.
+	// Zero means there's no limit.
+	maxReadBytes int64
+
+	// writeManifest maintains a manifest of the checksums of the state next
+	// to it, updated with every write.
+	writeManifest bool
+
+	// minSerialGuard refuses writes of a state with a lower serial than the
+	// stored state.
+	minSerialGuard bool
+
+	// clientRequestIDPrefix is prepended to the client request ID generated
+	// for each operation.
+	clientRequestIDPrefix string
+
+	// idempotencyKey is a caller-supplied key identifying the operation for
+	// external audit trails. It's recorded with the lock and in errors.
+	idempotencyKey string
+
+	// workspace is the name of the workspace whose state the client stores.
+	workspace string
+
+	// lockEventsFile, when set, is the file lock events are appended to.
+	// Unless auditFailClosed is set, failing to append to it is only logged.
+	lockEventsFile  string
+	auditFailClosed bool
+
+	// relockOnLoss re-acquires a lease that was lost, when the blob shows
+	// no sign of another writer since.
+	relockOnLoss bool
+
+	// etag is the ETag of the blob as last read or written by the client.
+	// Writes are conditional on the blob still having it, and relocking on
+	// the blob not having changed since.
+	etag string
+
+	// strictUnlock refuses to release a lock whose lock info no longer
+	// matches heldLock, the lock info the client locked the state with.
+	strictUnlock bool
+	heldLock     *statemgr.LockInfo
+
+	// verifyStateChecksum records the SHA-256 of the state with every
+	// write, and checks the state read against it.
+	verifyStateChecksum bool
+
+	// readOnly refuses every write, lock and unlock of the state.
+	readOnly bool
+
+	// historyCount, when set, is how many of the previous states are kept
+	// as history blobs, listed with containersClient.
+	historyCount     int
+	containersClient *containers.Client
+
+	// blobContentType and blobCacheControl are the Content-Type and
+	// Cache-Control the state blob is written with. An empty content type
+	// is defaultBlobContentType, while an empty cache control isn't set.
+	blobContentType  string
+	blobCacheControl string
+
+	// sasToken is the SAS token the client is authorized with, if any. A
+	// server-side copy of the state blob needs it to read the blob.
+	sasToken string
+
+	// incrementalUpload writes large states by staging only the blocks of
+	// them that changed since the last write.
+	incrementalUpload bool
+
+	// operationTimeout and lockTimeout, when set, limit how long each get,
+	// put and delete, and each lock and unlock, may take.
+	operationTimeout time.Duration
+	lockTimeout      time.Duration
+
+	// leaseRenewal controls how renewals of the held lease are retried.
+	leaseRenewal leaseRenewalPolicy
+
+	// leaseDuration, when set, is the duration the state blob is leased
+	// for, rather than indefinitely. The heartbeat renews the lease every
+	// heartbeatInterval while the lock is held.
+	leaseDuration     time.Duration
+	heartbeatInterval time.Duration
+	heartbeat         *leaseHeartbeat
+
+	// clientSideEncryption, when set, encrypts the state blob on the client.
+	// Client-side encrypted blobs can't be read without it.
+	clientSideEncryption *clientSideEncryption
+
+	// readFromSecondary makes reads that fail on the primary endpoint of
+	// the Storage Account retry on its secondary endpoint.
+	readFromSecondary bool
+
+	// lockRetry controls how acquiring a lease held by another process is
+	// retried.
+	lockRetry lockRetryPolicy
+
+	// autoRehydrate rehydrates a state blob found in the Archive tier when
+	// reading it, waiting according to rehydration.
+	autoRehydrate bool
+	rehydration   rehydratePolicy
+}
+
+// OperationOverrides adjust how a single operation of the client is retried
+// and timed out. Zero values leave the backend configuration in place.
+type OperationOverrides struct {
+	// RetryAttempts is the number of times a request that Azure throttled is
+	// retried, replacing max_retries.
+	RetryAttempts int
+
+	// Timeout limits the duration of the whole operation, retries included.
+	Timeout time.Duration
+}
+
+type operationOverridesKey struct{}
+
+// ContextWithOperationOverrides returns a copy of ctx carrying the given
+// overrides, which are honored by the operations of a RemoteClient made with
+// it, such as GetWithContext.
+func ContextWithOperationOverrides(ctx context.Context, overrides OperationOverrides) context.Context {
+	return context.WithValue(ctx, operationOverridesKey{}, overrides)
+}
+
+// operationContext returns the context for a single operation of the client,
+// along with the client request ID that all requests made as part of it will
+// carry. The timeout of any OperationOverrides in parent applies until the
+// returned function is called, which must happen once the operation is done.
+// Their retry attempts are read from the context by the storage clients'
+// sender, rather than set on the client, whose lease heartbeat sends
+// requests concurrently with the operation.
+func (c *RemoteClient) operationContext(parent context.Context) (context.Context, string, func()) {
+	id := newClientRequestID(c.clientRequestIDPrefix)
+	ctx := contextWithClientRequestID(parent, id)
+
+	overrides, ok := parent.Value(operationOverridesKey{}).(OperationOverrides)
+	if !ok || overrides.Timeout <= 0 {
+		return ctx, id, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, overrides.Timeout)
+	return ctx, id, cancel
+}
+
+// operationError annotates an error from an operation of the client with the
+// given client request ID and the client's idempotency key.
+func (c *RemoteClient) operationError(err error, requestID string) error {
+	return &clientRequestIDError{Err: err, ClientRequestID: requestID, IdempotencyKey: c.idempotencyKey}
 }
 
 func (c *RemoteClient) Get() (*remote.Payload, error) {
+	return c.GetWithContext(context.TODO())
+}
+
+// GetWithContext is like Get, honoring any OperationOverrides in ctx.
+func (c *RemoteClient) GetWithContext(ctx context.Context) (_ *remote.Payload, err error) {
+	ctx, finish := c.withTimeout(ctx, operationGet)
+	defer func() { err = finish(err) }()
+
+	if c.pendingWrite != nil {
+		return &remote.Payload{Data: c.pendingWrite}, nil
+	}
+
 	options := blobs.GetInput{}
 	if c.leaseID != "" {
 		options.LeaseID = &c.leaseID
 	}
 
-	ctx := context.TODO()
-	blob, err := c.giovanniBlobClient.Get(ctx, c.accountName, c.containerName, c.keyName, options)
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
+	blob, err := c.getBlob(ctx, options)
+	// A read made under a lock goes to the primary endpoint only: the lease
+	// isn't replicated, and the state read is about to be written.
+	if err != nil && c.readFromSecondary && c.leaseID == "" && isPrimaryReadFailure(blob.Response, err) {
+		log.Printf("[WARN] Reading Blob %q failed, reading it from the secondary endpoint of Storage Account %q instead: %s", c.keyName, c.accountName, err)
+		blob, err = c.getBlobFrom(ctx, c.accountName+secondaryAccountSuffix, options)
+	}
+	if err != nil && c.autoRehydrate && isBlobArchived(blob.Response) {
+		if err := c.rehydrate(ctx); err != nil {
+			return nil, c.operationError(err, requestID)
+		}
+		blob, err = c.getBlob(ctx, options)
+	}
 	if err != nil {
 		if blob.Response.IsHTTPStatus(http.StatusNotFound) {
 			return nil, nil
 		}
-		return nil, err
+		return nil, c.operationError(err, requestID)
+	}
+
+	if etag := blob.Header.Get("Etag"); etag != "" {
+		c.etag = etag
 	}
 
 	payload := &remote.Payload{
@@ -62,7 +272,155 @@ func (c *RemoteClient) Get() (*remote.Payload, error) {
 	return payload, nil
 }
 
+// getBlob downloads the state blob, refusing to read more than maxReadBytes
+// of it when set. With a read cache, the blob is only downloaded when it
+// has changed since it was cached.
+func (c *RemoteClient) getBlob(ctx context.Context, options blobs.GetInput) (blobs.GetResult, error) {
+	return c.getBlobFrom(ctx, c.accountName, options)
+}
+
+// getBlobFrom is like getBlob, addressing the Storage Account by the given
+// name, which for its secondary endpoint differs from the account's name.
+func (c *RemoteClient) getBlobFrom(ctx context.Context, accountName string, options blobs.GetInput) (blobs.GetResult, error) {
+	var cached readCacheEntry
+	var isCached bool
+	if c.readCache != nil {
+		cached, isCached = c.readCache.get(c.keyName)
+	}
+
+	if c.maxReadBytes <= 0 && !isCached {
+		result, err := c.giovanniBlobClient.Get(ctx, accountName, c.containerName, c.keyName, options)
+		if err == nil {
+			result, err = c.decryptBlob(ctx, result)
+		}
+		if err == nil {
+			err = c.verifyChecksum(result)
+		}
+		if err == nil && c.readCache != nil {
+			c.readCache.put(c.keyName, result.Header.Get("Etag"), result.Contents)
+		}
+		return result, err
+	}
+
+	req, err := c.giovanniBlobClient.GetPreparer(ctx, accountName, c.containerName, c.keyName, options)
+	if err != nil {
+		return blobs.GetResult{}, err
+	}
+	// The storage SDK has no way to make a read conditional, so the
+	// condition is added to the prepared request.
+	if isCached {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := c.giovanniBlobClient.GetSender(req)
+	if err != nil {
+		return blobs.GetResult{Response: autorest.Response{Response: resp}}, err
+	}
+
+	if isCached && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		log.Printf("[DEBUG] Blob %q is unchanged, using the cached state", c.keyName)
+		return blobs.GetResult{Response: autorest.Response{Response: resp}, Contents: cached.contents}, nil
+	}
+
+	tooLarge := fmt.Errorf("state Blob %q is larger than max_read_bytes (%d bytes)", c.keyName, c.maxReadBytes)
+	if c.maxReadBytes > 0 && resp.StatusCode == http.StatusOK {
+		if resp.ContentLength > c.maxReadBytes {
+			resp.Body.Close()
+			return blobs.GetResult{}, tooLarge
+		}
+		// the length isn't always known up front, so the read itself is
+		// limited too
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, c.maxReadBytes+1), resp.Body}
+	}
+
+	result, err := c.giovanniBlobClient.GetResponder(resp)
+	if err != nil {
+		return result, err
+	}
+	if c.maxReadBytes > 0 && int64(len(result.Contents)) > c.maxReadBytes {
+		return blobs.GetResult{}, tooLarge
+	}
+	result, err = c.decryptBlob(ctx, result)
+	if err != nil {
+		return result, err
+	}
+	if err := c.verifyChecksum(result); err != nil {
+		return result, err
+	}
+	if c.readCache != nil {
+		c.readCache.put(c.keyName, result.Header.Get("Etag"), result.Contents)
+	}
+	return result, nil
+}
+
+// decryptBlob decrypts the contents of the given result of reading the state
+// blob, if the blob is client-side encrypted.
+func (c *RemoteClient) decryptBlob(ctx context.Context, result blobs.GetResult) (blobs.GetResult, error) {
+	if result.Response.Response == nil {
+		return result, nil
+	}
+	encryptionData := result.Header.Get("x-ms-meta-" + encryptionDataMetaKey)
+	if encryptionData == "" {
+		return result, nil
+	}
+	if c.clientSideEncryption == nil {
+		return result, fmt.Errorf("Blob %q is client-side encrypted; set client_side_encryption_key_id to the Key Vault key it was encrypted with to read it", c.keyName)
+	}
+
+	data, err := c.clientSideEncryption.decrypt(ctx, result.Contents, encryptionData)
+	if err != nil {
+		return result, fmt.Errorf("failed to decrypt Blob %q: %w", c.keyName, err)
+	}
+	result.Contents = data
+	return result, nil
+}
+
 func (c *RemoteClient) Put(data []byte) error {
+	return c.PutWithContext(context.TODO(), data)
+}
+
+// PutWithContext is like Put, honoring any OperationOverrides in ctx.
+func (c *RemoteClient) PutWithContext(ctx context.Context, data []byte) (err error) {
+	if err := c.checkWritable(operationPut); err != nil {
+		return err
+	}
+	if err := c.checkHeartbeat(ctx); err != nil {
+		return err
+	}
+
+	ctx, finish := c.withTimeout(ctx, operationPut)
+	defer func() { err = finish(err) }()
+	if c.minSerialGuard {
+		if err := c.checkSerial(ctx, data); err != nil {
+			return err
+		}
+	}
+
+	if c.coalesceWrites && c.leaseID != "" {
+		log.Printf("[DEBUG] Buffering write of Blob %q until the lease is released", c.keyName)
+		c.pendingWrite = append([]byte(nil), data...)
+		return nil
+	}
+
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
+	err = c.put(ctx, requestID, data)
+	if err != nil && c.relockOnLoss && c.leaseID != "" && isLeaseLost(err) {
+		log.Printf("[WARN] Lease on Blob %q was lost, attempting to re-acquire it", c.keyName)
+		if relockErr := c.relock(ctx); relockErr != nil {
+			return c.operationError(fmt.Errorf("lease on Blob %q was lost and couldn't be re-acquired: %w", c.keyName, relockErr), requestID)
+		}
+		err = c.put(ctx, requestID, data)
+	}
+	return err
+}
+
+// put writes data to the state blob, snapshotting the previous state first if
+// enabled. Unlike Put, it never buffers the write.
+func (c *RemoteClient) put(ctx context.Context, requestID string, data []byte) error {
 	getOptions := blobs.GetPropertiesInput{}
 	setOptions := blobs.SetPropertiesInput{}
 	putOptions := blobs.PutBlockBlobInput{}
@@ -75,14 +433,17 @@ func (c *RemoteClient) Put(data []byte) error {
 		putOptions.LeaseID = &c.leaseID
 	}
 
-	ctx := context.TODO()
-
 	if c.snapshot {
+		if c.snapshotLimiter != nil {
+			if err := c.snapshotLimiter.wait(ctx); err != nil {
+				return c.operationError(fmt.Errorf("waiting to snapshot Blob %q was interrupted: %w", c.keyName, err), requestID)
+			}
+		}
 		snapshotInput := blobs.SnapshotInput{LeaseID: options.LeaseID}
 
 		log.Printf("[DEBUG] Snapshotting existing Blob %q (Container %q / Account %q)", c.keyName, c.containerName, c.accountName)
 		if _, err := c.giovanniBlobClient.Snapshot(ctx, c.accountName, c.containerName, c.keyName, snapshotInput); err != nil {
-			return fmt.Errorf("error snapshotting Blob %q (Container %q / Account %q): %w", c.keyName, c.containerName, c.accountName, err)
+			return c.operationError(fmt.Errorf("error snapshotting Blob %q (Container %q / Account %q): %w", c.keyName, c.containerName, c.accountName, err), requestID)
 		}
 
 		log.Print("[DEBUG] Created blob snapshot")
@@ -90,41 +451,312 @@ func (c *RemoteClient) Put(data []byte) error {
 
 	blob, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, getOptions)
 	if err != nil {
-		if blob.StatusCode != 404 {
-			return err
+		// without a response, as when the request timed out, there's no
+		// status to check
+		if !blob.Response.IsHTTPStatus(http.StatusNotFound) {
+			return c.operationError(err, requestID)
+		}
+	}
+	// the empty blob created to take the lease on isn't a previous state
+	if c.historyCount > 0 && err == nil && blob.ContentLength > 0 {
+		if err := c.putHistory(ctx, blob.MetaData); err != nil {
+			return c.operationError(fmt.Errorf("error keeping the previous state of Blob %q: %w", c.keyName, err), requestID)
 		}
 	}
 
-	contentType := "application/json"
-	putOptions.Content = &data
-	putOptions.ContentType = &contentType
-	putOptions.MetaData = blob.MetaData
-	_, err = c.giovanniBlobClient.PutBlockBlob(ctx, c.accountName, c.containerName, c.keyName, putOptions)
+	content := data
+	c.setBlobHeaders(&putOptions)
+	putOptions.MetaData = c.configuredMetaData(blob.MetaData)
+	delete(putOptions.MetaData, encryptionDataMetaKey)
+	delete(putOptions.MetaData, checksumMetaKey)
+	if c.verifyStateChecksum {
+		putOptions.MetaData[checksumMetaKey] = stateChecksum(data)
+	}
+	if c.clientSideEncryption != nil {
+		encrypted, encryptionData, err := c.clientSideEncryption.encrypt(ctx, data)
+		if err != nil {
+			return c.operationError(fmt.Errorf("failed to encrypt Blob %q: %w", c.keyName, err), requestID)
+		}
+		content = encrypted
+		putOptions.MetaData[encryptionDataMetaKey] = encryptionData
+	}
+	putOptions.Content = &content
+	previousTags := managedKeys(blob.MetaData, managedTagsMetaKey)
+	resp, err := c.putStateBlob(ctx, putOptions)
+	if err != nil {
+		if immutableErr := immutableBlobError(resp, c.keyName); immutableErr != nil {
+			return c.operationError(fmt.Errorf("%w. %s", immutableErr, immutableStateHint), requestID)
+		}
+		if isConditionNotMet(resp) {
+			return c.operationError(fmt.Errorf("state Blob %q was modified by another process since it was last read by this one (ETag %s), refusing to overwrite it; refresh the state and try again: %w", c.keyName, c.etag, err), requestID)
+		}
+		return c.operationError(err, requestID)
+	}
+	c.etag = resp.Header.Get("Etag")
 
-	return err
+	// Setting the index tags doesn't change the blob's ETag.
+	if len(c.blobTags) > 0 || len(previousTags) > 0 {
+		if err := c.updateBlobTags(ctx, previousTags); err != nil {
+			return c.operationError(err, requestID)
+		}
+	}
+
+	if c.writeManifest {
+		if err := c.putManifest(ctx, content); err != nil {
+			return c.operationError(err, requestID)
+		}
+	}
+
+	if c.historyCount > 0 {
+		c.pruneHistory(ctx)
+	}
+
+	return nil
+}
+
+// putStateBlob writes the state blob, on condition that it still has the
+// ETag it had when the client last read or wrote it. Without a known ETag,
+// such as before the state was first read, the write is unconditional.
+func (c *RemoteClient) putStateBlob(ctx context.Context, input blobs.PutBlockBlobInput) (autorest.Response, error) {
+	if c.incrementalUpload {
+		if resp, ok, err := c.putStateBlocks(ctx, input); ok {
+			return resp, err
+		}
+	}
+
+	if c.etag == "" {
+		return c.giovanniBlobClient.PutBlockBlob(ctx, c.accountName, c.containerName, c.keyName, input)
+	}
+
+	// The storage SDK has no way to make a write conditional, so the
+	// condition is added to the prepared request.
+	req, err := c.giovanniBlobClient.PutBlockBlobPreparer(ctx, c.accountName, c.containerName, c.keyName, input)
+	if err != nil {
+		return autorest.Response{}, fmt.Errorf("error preparing request to write Blob %q: %w", c.keyName, err)
+	}
+	req.Header.Set("If-Match", c.etag)
+
+	// The errors are wrapped as the storage SDK's own are, for them to be
+	// told apart the same way.
+	resp, err := c.giovanniBlobClient.PutBlockBlobSender(req)
+	if err != nil {
+		return autorest.Response{Response: resp}, autorest.NewErrorWithError(err, "blobs.Client", "PutBlockBlob", resp, "Failure sending request")
+	}
+	result, err := c.giovanniBlobClient.PutBlockBlobResponder(resp)
+	if err != nil {
+		return result, autorest.NewErrorWithError(err, "blobs.Client", "PutBlockBlob", resp, "Failure responding to request")
+	}
+	return result, nil
+}
+
+// isConditionNotMet returns whether resp refused a conditional request
+// because the blob no longer matches the condition.
+func isConditionNotMet(resp autorest.Response) bool {
+	return resp.Response != nil && resp.StatusCode == http.StatusPreconditionFailed && resp.Header.Get("x-ms-error-code") == "ConditionNotMet"
+}
+
+// ETag returns the ETag of the state blob as last read or written by the
+// client, or an empty string if it hasn't been yet. The next write of the
+// state is only made if the blob still has this ETag.
+func (c *RemoteClient) ETag() string {
+	return c.etag
+}
+
+// SetETag sets the ETag the next write of the state is conditional on, for
+// callers that read the state blob by other means. An empty ETag makes the
+// next write unconditional.
+func (c *RemoteClient) SetETag(etag string) {
+	c.etag = etag
+}
+
+// checkSerial returns an error if data holds a state with a lower serial than
+// the state currently stored in the blob. The serial is readable without
+// decrypting, as encrypted states carry it in the clear. States without a
+// serial, such as the empty blob created when locking, aren't compared. The
+// current state is read with ctx, the context of the write.
+func (c *RemoteClient) checkSerial(ctx context.Context, data []byte) error {
+	newSerial, ok := stateSerial(data)
+	if !ok {
+		return nil
+	}
+
+	// The write stays conditional on the state this client last read, so
+	// that it still detects a state written since, even with a serial that
+	// passes the check.
+	if etag := c.etag; etag != "" {
+		defer func() { c.etag = etag }()
+	}
+	current, err := c.GetWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	currentSerial, ok := stateSerial(current.Data)
+	if !ok {
+		return nil
+	}
+
+	if newSerial < currentSerial {
+		return fmt.Errorf("refusing to write state with serial %d to Blob %q, which holds a newer state with serial %d; set allow_serial_rollback to write it anyway", newSerial, c.keyName, currentSerial)
+	}
+	return nil
+}
+
+// stateSerial returns the serial of the given state, if it has one.
+func stateSerial(data []byte) (uint64, bool) {
+	var state struct {
+		Serial *uint64 `json:"serial"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.Serial == nil {
+		return 0, false
+	}
+	return *state.Serial, true
 }
 
 func (c *RemoteClient) Delete() error {
-	options := blobs.DeleteInput{}
+	return c.DeleteWithContext(context.TODO())
+}
+
+// DeleteWithContext is like Delete, honoring any OperationOverrides in ctx.
+func (c *RemoteClient) DeleteWithContext(ctx context.Context) (err error) {
+	if err := c.checkWritable(operationDelete); err != nil {
+		return err
+	}
+	ctx, finish := c.withTimeout(ctx, operationDelete)
+	defer func() { err = finish(err) }()
+
+	c.pendingWrite = nil
+	// the snapshots of the state go with it, as Azure can't delete a blob
+	// that has any otherwise
+	options := blobs.DeleteInput{DeleteSnapshots: true}
 
 	if c.leaseID != "" {
 		options.LeaseID = &c.leaseID
 	}
 
-	ctx := context.TODO()
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
 	resp, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, c.keyName, options)
+	c.etag = ""
 	if err != nil {
+		if immutableErr := immutableBlobError(resp, c.keyName); immutableErr != nil {
+			return c.operationError(immutableErr, requestID)
+		}
 		if !resp.IsHTTPStatus(http.StatusNotFound) {
-			return err
+			return c.operationError(err, requestID)
+		}
+	}
+
+	if c.writeManifest {
+		if err := c.deleteManifest(ctx); err != nil {
+			return c.operationError(err, requestID)
 		}
 	}
 	return nil
 }
 
+// setBlobHeaders sets the content type and cache control of the state blob
+// on the input of a write of it, so that they're set along with the content.
+func (c *RemoteClient) setBlobHeaders(input *blobs.PutBlockBlobInput) {
+	contentType := c.blobContentType
+	if contentType == "" {
+		contentType = defaultBlobContentType
+	}
+	input.ContentType = &contentType
+	if c.blobCacheControl != "" {
+		cacheControl := c.blobCacheControl
+		input.CacheControl = &cacheControl
+	}
+}
+
+// createBlob creates an empty state blob to take the lease on. The blob is
+// only created if it still doesn't exist, as another process initializing
+// the same state may have created it, or even locked it and written its
+// state, since the client found it missing.
+func (c *RemoteClient) createBlob(ctx context.Context) error {
+	input := blobs.PutBlockBlobInput{}
+	c.setBlobHeaders(&input)
+
+	created, err := c.createBlobIfMissing(ctx, c.keyName, input)
+	if err != nil {
+		return err
+	}
+	if !created {
+		log.Printf("[DEBUG] Blob %q was created by another process", c.keyName)
+	}
+	return nil
+}
+
+// createBlobIfMissing creates the named blob unless it already exists,
+// reporting whether it did.
+func (c *RemoteClient) createBlobIfMissing(ctx context.Context, name string, input blobs.PutBlockBlobInput) (bool, error) {
+	// The storage SDK has no way to make a write conditional, so the
+	// condition is added to the prepared request.
+	req, err := c.giovanniBlobClient.PutBlockBlobPreparer(ctx, c.accountName, c.containerName, name, input)
+	if err != nil {
+		return false, fmt.Errorf("error preparing request to create Blob %q: %w", name, err)
+	}
+	req.Header.Set("If-None-Match", "*")
+
+	// A conflict fails while sending already, as the sender checks every
+	// conflict for a missing resource provider registration.
+	resp, err := c.giovanniBlobClient.PutBlockBlobSender(req)
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		resp.Body.Close()
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error creating Blob %q: %w", name, err)
+	}
+	if _, err := c.giovanniBlobClient.PutBlockBlobResponder(resp); err != nil {
+		return false, fmt.Errorf("error creating Blob %q: %w", name, err)
+	}
+	return true, nil
+}
+
 func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
+	return c.LockWithContext(context.TODO(), info)
+}
+
+// LockWithContext is like Lock, honoring any OperationOverrides in ctx. A
+// cancelled ctx stops the retries of a lock held by another process.
+func (c *RemoteClient) LockWithContext(ctx context.Context, info *statemgr.LockInfo) (_ string, err error) {
+	if err := c.checkWritable(operationLock); err != nil {
+		return "", err
+	}
+	// the heartbeat outlives the lock timeout, but not the caller's context
+	heartbeatCtx := ctx
+	ctx, finish := c.withTimeout(ctx, operationLock)
+	defer func() { err = finish(err) }()
+
 	stateName := fmt.Sprintf("%s/%s", c.containerName, c.keyName)
 	info.Path = stateName
 
+	// The lock info is all that other processes see of the holder, so the
+	// idempotency key is recorded in it for them to report.
+	if c.idempotencyKey != "" {
+		info.Info = strings.TrimSpace(fmt.Sprintf("%s\nIdempotency key: %s", info.Info, c.idempotencyKey))
+	}
+
+	// The version of the holder helps to make sense of conflicts between
+	// runners on different versions, and who holds the lock since when to
+	// know who to contact, so they're recorded even when the caller didn't
+	// build the info with NewLockInfo.
+	if info.Version == "" || info.Who == "" || info.Created.IsZero() {
+		defaults := statemgr.NewLockInfo()
+		if info.Version == "" {
+			info.Version = defaults.Version
+		}
+		if info.Who == "" {
+			info.Who = defaults.Who
+		}
+		if info.Created.IsZero() {
+			info.Created = defaults.Created
+		}
+	}
+
 	if info.ID == "" {
 		lockID, err := uuid.GenerateUUID()
 		if err != nil {
@@ -134,77 +766,104 @@ func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
 		info.ID = lockID
 	}
 
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
+
+	if c.lockMethod == lockMethodBlob {
+		return c.lockWithBlob(ctx, requestID, info)
+	}
+
 	getLockInfoErr := func(err error) error {
-		lockInfo, infoErr := c.getLockInfo()
+		lockInfo, infoErr := c.getLockInfo(ctx)
 		if infoErr != nil {
 			err = multierror.Append(err, infoErr)
+		} else if errors.Is(err, errBlobLocked) {
+			err = fmt.Errorf("%w%s", err, lockHolder(lockInfo))
 		}
 
 		return &statemgr.LockError{
-			Err:  err,
+			Err:  c.operationError(err, requestID),
 			Info: lockInfo,
 		}
 	}
 
 	leaseOptions := blobs.AcquireLeaseInput{
 		ProposedLeaseID: &info.ID,
-		LeaseDuration:   -1,
+		LeaseDuration:   c.leaseDurationSeconds(),
 	}
-	ctx := context.TODO()
 
-	// obtain properties to see if the blob lease is already in use. If the blob doesn't exist, create it
-	properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{})
+	leaseID, err := c.acquireLease(ctx, leaseOptions)
 	if err != nil {
-		// error if we had issues getting the blob
-		if !properties.Response.IsHTTPStatus(http.StatusNotFound) {
-			return "", getLockInfoErr(err)
+		if c.lockMethod == lockMethodAuto && isLeaseUnsupported(leaseID.Response) {
+			log.Printf("[WARN] Leasing Blob %q isn't supported, locking it with Blob %q instead: %s", c.keyName, c.lockBlobName(), err)
+			return c.lockWithBlob(ctx, requestID, info)
 		}
-		// if we don't find the blob, we need to build it
-
-		contentType := "application/json"
-		putGOptions := blobs.PutBlockBlobInput{
-			ContentType: &contentType,
+		// A lease taken between checking the blob and leasing it is held
+		// by another process just the same.
+		if isLeaseConflict(leaseID, err) && !errors.Is(err, errBlobLocked) {
+			err = fmt.Errorf("%w: %w", errBlobLocked, err)
 		}
-
-		_, err = c.giovanniBlobClient.PutBlockBlob(ctx, c.accountName, c.containerName, c.keyName, putGOptions)
-		if err != nil {
-			return "", getLockInfoErr(err)
-		}
-	}
-
-	// if the blob is already locked then error
-	if properties.LeaseStatus == blobs.Locked {
-		return "", getLockInfoErr(fmt.Errorf("state blob is already locked"))
-	}
-
-	leaseID, err := c.giovanniBlobClient.AcquireLease(ctx, c.accountName, c.containerName, c.keyName, leaseOptions)
-	if err != nil {
 		return "", getLockInfoErr(err)
 	}
 
 	info.ID = leaseID.LeaseID
 	c.leaseID = leaseID.LeaseID
 
-	if err := c.writeLockInfo(info); err != nil {
-		return "", err
+	if err := c.writeLockInfo(ctx, info); err != nil {
+		// the lease is released rather than left without lock info, which
+		// no one could then tell the holder of
+		if _, releaseErr := c.giovanniBlobClient.ReleaseLease(ctx, c.accountName, c.containerName, c.keyName, info.ID); releaseErr != nil {
+			err = multierror.Append(err, fmt.Errorf("failed to release the lock again: %w", releaseErr))
+		} else {
+			c.leaseID = ""
+		}
+		return "", c.operationError(err, requestID)
 	}
+	c.holdLock(info)
+	c.startHeartbeat(heartbeatCtx)
+
+	if err := c.emitLockEvent(lockEventAcquire, info); err != nil {
+		if !c.auditFailClosed {
+			log.Printf("[WARN] %s", err)
+			return info.ID, nil
+		}
 
+		// A lock that wasn't recorded mustn't be used, so it is released.
+		c.stopHeartbeat()
+		var result *multierror.Error
+		result = multierror.Append(result, err)
+		if err := c.writeLockInfo(ctx, nil); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to delete lock info from metadata: %w", err))
+		}
+		if _, err := c.giovanniBlobClient.ReleaseLease(ctx, c.accountName, c.containerName, c.keyName, info.ID); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to release the lock again: %w", err))
+		} else {
+			c.leaseID = ""
+			c.heldLock = nil
+		}
+		return "", &statemgr.LockError{Err: c.operationError(result.ErrorOrNil(), requestID)}
+	}
 	return info.ID, nil
 }
 
-func (c *RemoteClient) getLockInfo() (*statemgr.LockInfo, error) {
+func (c *RemoteClient) getLockInfo(ctx context.Context) (*statemgr.LockInfo, error) {
 	options := blobs.GetPropertiesInput{}
 	if c.leaseID != "" {
 		options.LeaseID = &c.leaseID
 	}
 
-	ctx := context.TODO()
 	blob, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, options)
 	if err != nil {
 		return nil, err
 	}
 
-	raw := blob.MetaData[lockInfoMetaKey]
+	return lockInfoFromMetaData(blob.MetaData)
+}
+
+// lockInfoFromMetaData decodes the lock info stored in the metadata of a
+// state blob.
+func lockInfoFromMetaData(metaData map[string]string) (*statemgr.LockInfo, error) {
+	raw := metaData[lockInfoMetaKey]
 	if raw == "" {
 		return nil, fmt.Errorf("blob metadata %q was empty", lockInfoMetaKey)
 	}
@@ -224,8 +883,7 @@ func (c *RemoteClient) getLockInfo() (*statemgr.LockInfo, error) {
 }
 
 // writes info to blob meta data, deletes metadata entry if info is nil
-func (c *RemoteClient) writeLockInfo(info *statemgr.LockInfo) error {
-	ctx := context.TODO()
+func (c *RemoteClient) writeLockInfo(ctx context.Context, info *statemgr.LockInfo) error {
 	blob, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{LeaseID: &c.leaseID})
 	if err != nil {
 		return err
@@ -243,39 +901,88 @@ func (c *RemoteClient) writeLockInfo(info *statemgr.LockInfo) error {
 		MetaData: blob.MetaData,
 	}
 
-	_, err = c.giovanniBlobClient.SetMetaData(ctx, c.accountName, c.containerName, c.keyName, opts)
-	return err
+	resp, err := c.giovanniBlobClient.SetMetaData(ctx, c.accountName, c.containerName, c.keyName, opts)
+	if err != nil {
+		if immutableErr := immutableBlobError(resp, c.keyName); immutableErr != nil {
+			return fmt.Errorf("%w, so the lock info can't be recorded in its metadata. %s", immutableErr, immutableStateHint)
+		}
+		return err
+	}
+	c.etag = resp.Header.Get("Etag")
+	return nil
 }
 
-func (c *RemoteClient) Unlock(id string) error {
+func (c *RemoteClient) Unlock(id string) (err error) {
+	if err := c.checkWritable(operationUnlock); err != nil {
+		return err
+	}
+	ctx, finish := c.withTimeout(context.TODO(), operationUnlock)
+	defer func() { err = finish(err) }()
+
 	lockErr := &statemgr.LockError{}
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
 
-	lockInfo, err := c.getLockInfo()
+	// The state may be locked with a lock blob rather than a lease, also
+	// when this client didn't take the lock itself.
+	if c.mayUseLockBlob() {
+		lockInfo, err := c.getLockBlobInfo(ctx)
+		if err != nil {
+			lockErr.Err = c.operationError(fmt.Errorf("failed to retrieve lock info: %w", err), requestID)
+			return lockErr
+		}
+		if lockInfo != nil {
+			return c.unlockBlob(ctx, requestID, id, lockInfo)
+		}
+	}
+
+	lockInfo, err := c.getLockInfo(ctx)
 	if err != nil {
-		lockErr.Err = fmt.Errorf("failed to retrieve lock info: %w", err)
+		lockErr.Err = c.operationError(fmt.Errorf("failed to retrieve lock info: %w", err), requestID)
 		return lockErr
 	}
 	lockErr.Info = lockInfo
 
-	if lockInfo.ID != id {
-		lockErr.Err = fmt.Errorf("lock id %q does not match existing lock", id)
+	if err := c.checkUnlock(id, lockInfo); err != nil {
+		lockErr.Err = err
 		return lockErr
 	}
 
 	c.leaseID = lockInfo.ID
-	if err := c.writeLockInfo(nil); err != nil {
-		lockErr.Err = fmt.Errorf("failed to delete lock info from metadata: %w", err)
+
+	// Flush any buffered write while the lease is still held. If it fails the
+	// lease is kept, so that unlocking can be retried without losing it.
+	if c.pendingWrite != nil {
+		if err := c.put(ctx, requestID, c.pendingWrite); err != nil {
+			lockErr.Err = fmt.Errorf("failed to write buffered state: %w", err)
+			return lockErr
+		}
+		c.pendingWrite = nil
+	}
+
+	if err := c.writeLockInfo(ctx, nil); err != nil {
+		lockErr.Err = c.operationError(fmt.Errorf("failed to delete lock info from metadata: %w", err), requestID)
 		return lockErr
 	}
 
-	ctx := context.TODO()
+	c.stopHeartbeat()
 	_, err = c.giovanniBlobClient.ReleaseLease(ctx, c.accountName, c.containerName, c.keyName, id)
 	if err != nil {
-		lockErr.Err = err
+		lockErr.Err = c.operationError(err, requestID)
 		return lockErr
 	}
 
 	c.leaseID = ""
+	c.heldLock = nil
+	if err := c.emitLockEvent(lockEventRelease, lockInfo); err != nil {
+		// The lock is released all the same, as holding on to it would
+		// only block other processes.
+		if c.auditFailClosed {
+			lockErr.Err = err
+			return lockErr
+		}
+		log.Printf("[WARN] %s", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,327 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.1/keyvault"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// encryptionDataMetaKey is the metadata key the Azure Storage SDKs record
+// how a client-side encrypted blob was encrypted under.
+const encryptionDataMetaKey = "encryptiondata"
+
+// The versions of the client-side encryption protocol of the Azure Storage
+// SDKs. Blobs are written with version 2.0, and blobs written with either
+// can be read.
+const (
+	encryptionProtocolV1 = "1.0"
+	encryptionProtocolV2 = "2.0"
+)
+
+const (
+	// encryptionRegionLength is the length of the regions of a blob that are
+	// encrypted separately with version 2.0, each with its own nonce.
+	encryptionRegionLength = 4 * 1024 * 1024
+
+	encryptionNonceLength = 12
+	encryptionTagLength   = 16
+)
+
+// encryptionData is the metadata of a client-side encrypted blob, as recorded
+// by the Azure Storage SDKs.
+type encryptionData struct {
+	EncryptionMode      string               `json:"EncryptionMode,omitempty"`
+	WrappedContentKey   wrappedContentKey    `json:"WrappedContentKey"`
+	EncryptionAgent     encryptionAgent      `json:"EncryptionAgent"`
+	ContentEncryptionIV string               `json:"ContentEncryptionIV,omitempty"`
+	EncryptedRegionInfo *encryptedRegionInfo `json:"EncryptedRegionInfo,omitempty"`
+	KeyWrappingMetadata map[string]string    `json:"KeyWrappingMetadata,omitempty"`
+}
+
+type wrappedContentKey struct {
+	KeyID        string `json:"KeyId"`
+	EncryptedKey string `json:"EncryptedKey"`
+	Algorithm    string `json:"Algorithm"`
+}
+
+type encryptionAgent struct {
+	Protocol            string `json:"Protocol"`
+	EncryptionAlgorithm string `json:"EncryptionAlgorithm"`
+}
+
+type encryptedRegionInfo struct {
+	DataLength  int `json:"DataLength"`
+	NonceLength int `json:"NonceLength"`
+}
+
+// keyEncryptionKey wraps and unwraps the content encryption keys of blobs.
+type keyEncryptionKey interface {
+	// wrapKey wraps key, returning the ID of the key that wrapped it, by
+	// which it's unwrapped again.
+	wrapKey(ctx context.Context, key []byte) (keyID string, wrapped []byte, err error)
+
+	// unwrapKey unwraps a key wrapped by the key with the given ID.
+	unwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+
+	// algorithm is the algorithm keys are wrapped with.
+	algorithm() string
+}
+
+// clientSideEncryption encrypts blobs the way the Azure Storage SDKs do,
+// with a content encryption key generated for each write and wrapped by a
+// key encryption key.
+type clientSideEncryption struct {
+	kek keyEncryptionKey
+}
+
+// encrypt encrypts data, returning the encrypted content and the encryption
+// data to record in the blob's metadata.
+func (e *clientSideEncryption) encrypt(ctx context.Context, data []byte) ([]byte, string, error) {
+	cek := make([]byte, 32)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, "", err
+	}
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var content bytes.Buffer
+	for offset := 0; offset == 0 || offset < len(data); offset += encryptionRegionLength {
+		region := data[offset:min(offset+encryptionRegionLength, len(data))]
+		nonce := make([]byte, encryptionNonceLength)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, "", err
+		}
+		content.Write(nonce)
+		content.Write(gcm.Seal(nil, nonce, region, nil))
+	}
+
+	// The protocol version is wrapped along with the key, padded to 8
+	// bytes, so that it can't be downgraded.
+	keyID, wrapped, err := e.kek.wrapKey(ctx, append(protocolPrefix(encryptionProtocolV2), cek...))
+	if err != nil {
+		return nil, "", err
+	}
+
+	metaData, err := json.Marshal(encryptionData{
+		EncryptionMode: "FullBlob",
+		WrappedContentKey: wrappedContentKey{
+			KeyID:        keyID,
+			EncryptedKey: base64.StdEncoding.EncodeToString(wrapped),
+			Algorithm:    e.kek.algorithm(),
+		},
+		EncryptionAgent: encryptionAgent{
+			Protocol:            encryptionProtocolV2,
+			EncryptionAlgorithm: "AES_GCM_256",
+		},
+		EncryptedRegionInfo: &encryptedRegionInfo{
+			DataLength:  encryptionRegionLength,
+			NonceLength: encryptionNonceLength,
+		},
+		KeyWrappingMetadata: map[string]string{"EncryptionLibrary": "OpenTofu"},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return content.Bytes(), string(metaData), nil
+}
+
+// decrypt decrypts the content of a blob with the given encryption data.
+func (e *clientSideEncryption) decrypt(ctx context.Context, content []byte, metaData string) ([]byte, error) {
+	var data encryptionData
+	if err := json.Unmarshal([]byte(metaData), &data); err != nil {
+		return nil, fmt.Errorf("invalid encryption data: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(data.WrappedContentKey.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped content encryption key: %w", err)
+	}
+	if data.WrappedContentKey.Algorithm != e.kek.algorithm() {
+		return nil, fmt.Errorf("the content encryption key is wrapped with %q, not %q", data.WrappedContentKey.Algorithm, e.kek.algorithm())
+	}
+	cek, err := e.kek.unwrapKey(ctx, data.WrappedContentKey.KeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	switch data.EncryptionAgent.Protocol {
+	case encryptionProtocolV1:
+		if data.EncryptionAgent.EncryptionAlgorithm != "AES_CBC_256" {
+			return nil, fmt.Errorf("unsupported encryption algorithm %q", data.EncryptionAgent.EncryptionAlgorithm)
+		}
+		iv, err := base64.StdEncoding.DecodeString(data.ContentEncryptionIV)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content encryption IV: %w", err)
+		}
+		return decryptCBC(cek, iv, content)
+	case encryptionProtocolV2:
+		if data.EncryptionAgent.EncryptionAlgorithm != "AES_GCM_256" {
+			return nil, fmt.Errorf("unsupported encryption algorithm %q", data.EncryptionAgent.EncryptionAlgorithm)
+		}
+		prefix := protocolPrefix(encryptionProtocolV2)
+		if !bytes.HasPrefix(cek, prefix) {
+			return nil, fmt.Errorf("the content encryption key wasn't wrapped for protocol %s", encryptionProtocolV2)
+		}
+		if data.EncryptedRegionInfo == nil || data.EncryptedRegionInfo.DataLength <= 0 || data.EncryptedRegionInfo.NonceLength != encryptionNonceLength {
+			return nil, fmt.Errorf("invalid encrypted region info")
+		}
+		return decryptGCM(cek[len(prefix):], data.EncryptedRegionInfo.DataLength, content)
+	}
+	return nil, fmt.Errorf("unsupported encryption protocol %q", data.EncryptionAgent.Protocol)
+}
+
+// protocolPrefix returns the prefix wrapped along with the content
+// encryption key for the given protocol version.
+func protocolPrefix(version string) []byte {
+	prefix := make([]byte, 8)
+	copy(prefix, version)
+	return prefix
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptGCM decrypts content made of regions encrypted with AES-256-GCM,
+// each of them starting with its nonce and ending with its tag.
+func decryptGCM(key []byte, regionLength int, content []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	encryptedLength := encryptionNonceLength + regionLength + encryptionTagLength
+	for offset := 0; offset < len(content); offset += encryptedLength {
+		region := content[offset:min(offset+encryptedLength, len(content))]
+		if len(region) < encryptionNonceLength+encryptionTagLength {
+			return nil, fmt.Errorf("truncated encrypted region")
+		}
+		data, err = gcm.Open(data, region[:encryptionNonceLength], region[encryptionNonceLength:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// decryptCBC decrypts content encrypted with AES-256-CBC and padded with
+// PKCS#7, as with version 1.0 of the protocol.
+func decryptCBC(key, iv, content []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(content) == 0 || len(content)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted content")
+	}
+	data := make([]byte, len(content))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, content)
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid padding of encrypted content")
+	}
+	return data[:len(data)-padding], nil
+}
+
+// keyVaultKey is a key encryption key held in a Key Vault, wrapping keys
+// with RSA-OAEP.
+type keyVaultKey struct {
+	client keyvault.BaseClient
+	key    keyVaultObject
+	env    azure.Environment
+}
+
+var _ keyEncryptionKey = (*keyVaultKey)(nil)
+
+// newKeyVaultKey returns the key encryption key with the given key ID, such
+// as https://myvault.vault.azure.net/keys/mykey, used through Key Vault with
+// the client's Key Vault credentials.
+func (c *ArmClient) newKeyVaultKey(keyID string) (*keyVaultKey, error) {
+	key, err := parseKeyVaultURI(keyID, "keys", c.environment)
+	if err != nil {
+		return nil, err
+	}
+	client := keyvault.New()
+	c.configureClient(&client.Client, c.keyVaultAuth)
+	return &keyVaultKey{client: client, key: *key, env: c.environment}, nil
+}
+
+func (k *keyVaultKey) algorithm() string {
+	return string(keyvault.RSAOAEP)
+}
+
+func (k *keyVaultKey) wrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	value := base64.RawURLEncoding.EncodeToString(key)
+	result, err := k.client.WrapKey(ctx, k.key.vaultBaseURL, k.key.name, k.key.version, keyvault.KeyOperationsParameters{
+		Algorithm: keyvault.RSAOAEP,
+		Value:     &value,
+	})
+	if err != nil {
+		return "", nil, k.error("wrap", k.key, isForbidden(result.Response), err)
+	}
+	if result.Kid == nil || result.Result == nil {
+		return "", nil, fmt.Errorf("wrapping the content encryption key with key %q of Key Vault %q returned no result", k.key.name, k.key.vaultBaseURL)
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(*result.Result)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid wrapped key returned by Key Vault %q: %w", k.key.vaultBaseURL, err)
+	}
+	return *result.Kid, wrapped, nil
+}
+
+func (k *keyVaultKey) unwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	// The key ID is read from the blob, so it must name a key of the
+	// configured vault for the credentials to be sent to it.
+	key, err := parseKeyVaultURI(keyID, "keys", k.env)
+	if err != nil {
+		return nil, fmt.Errorf("the content encryption key was wrapped by an unknown key: %w", err)
+	}
+	if key.vaultBaseURL != k.key.vaultBaseURL {
+		return nil, fmt.Errorf("the content encryption key was wrapped by a key of Key Vault %q rather than of the configured Key Vault %q", key.vaultBaseURL, k.key.vaultBaseURL)
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(wrapped)
+	result, err := k.client.UnwrapKey(ctx, key.vaultBaseURL, key.name, key.version, keyvault.KeyOperationsParameters{
+		Algorithm: keyvault.RSAOAEP,
+		Value:     &value,
+	})
+	if err != nil {
+		return nil, k.error("unwrap", *key, isForbidden(result.Response), err)
+	}
+	if result.Result == nil {
+		return nil, fmt.Errorf("unwrapping the content encryption key with key %q of Key Vault %q returned no result", key.name, key.vaultBaseURL)
+	}
+	unwrapped, err := base64.RawURLEncoding.DecodeString(*result.Result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unwrapped key returned by Key Vault %q: %w", key.vaultBaseURL, err)
+	}
+	return unwrapped, nil
+}
+
+// error describes a failure to perform the given operation with a key.
+func (k *keyVaultKey) error(operation string, key keyVaultObject, forbidden bool, err error) error {
+	if forbidden {
+		return fmt.Errorf("the credentials used by the backend aren't allowed to %s keys with key %q of Key Vault %q; they need the Key Vault Crypto User role, or an access policy allowing them to %s keys: %w", operation, key.name, key.vaultBaseURL, operation, err)
+	}
+	return fmt.Errorf("failed to %s the content encryption key with key %q of Key Vault %q: %w", operation, key.name, key.vaultBaseURL, err)
+}
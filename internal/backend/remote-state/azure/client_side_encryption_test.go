@@ -0,0 +1,199 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+// fakeKeyEncryptionKey wraps keys with a local RSA key, as Key Vault does
+// with RSA-OAEP.
+type fakeKeyEncryptionKey struct {
+	t   *testing.T
+	id  string
+	key *rsa.PrivateKey
+}
+
+func newFakeKeyEncryptionKey(t *testing.T) *fakeKeyEncryptionKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeKeyEncryptionKey{t: t, id: "https://myvault.vault.azure.net/keys/state/1", key: key}
+}
+
+func (k *fakeKeyEncryptionKey) algorithm() string {
+	return "RSA-OAEP"
+}
+
+func (k *fakeKeyEncryptionKey) wrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &k.key.PublicKey, key, nil)
+	return k.id, wrapped, err
+}
+
+func (k *fakeKeyEncryptionKey) unwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != k.id {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	return rsa.DecryptOAEP(sha1.New(), rand.Reader, k.key, wrapped, nil)
+}
+
+func TestRemoteClientClientSideEncryption(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"write_manifest": true,
+	})
+	b.clientSideEncryption = &clientSideEncryption{kek: newFakeKeyEncryptionKey(t)}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "encrypted"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob holds the encrypted state, with the encryption data the
+	// Azure Storage SDKs read
+	blob := m.blob(mockContainerName, "test.tfstate")
+	if bytes.Contains(blob.content, []byte("encrypted")) {
+		t.Fatal("expected the state to be encrypted in the blob")
+	}
+	var data encryptionData
+	if err := json.Unmarshal([]byte(blob.metadata[encryptionDataMetaKey]), &data); err != nil {
+		t.Fatalf("invalid encryption data: %s", err)
+	}
+	if data.EncryptionAgent.Protocol != "2.0" || data.EncryptionAgent.EncryptionAlgorithm != "AES_GCM_256" || data.WrappedContentKey.KeyID != "https://myvault.vault.azure.net/keys/state/1" {
+		t.Fatalf("unexpected encryption data: %#v", data)
+	}
+	if err := b.VerifyManifest(backend.DefaultStateName); err != nil {
+		t.Fatalf("expected the manifest to match the encrypted blob: %s", err)
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected the decrypted state %s, got %s", state, payload.Data)
+	}
+
+	// without the key, the state can't be read, nor written without
+	// dropping the encryption data along with the encryption
+	b.clientSideEncryption = nil
+	plain, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(); err == nil || !strings.Contains(err.Error(), "set client_side_encryption_key_id") {
+		t.Fatalf("expected the encrypted state to be refused, got %v", err)
+	}
+	if err := plain.Put(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.blob(mockContainerName, "test.tfstate").metadata[encryptionDataMetaKey]; ok {
+		t.Fatal("expected the encryption data to be removed with the encryption")
+	}
+	if payload, err := plain.Get(); err != nil || !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected the unencrypted state, got %v", err)
+	}
+}
+
+func TestClientSideEncryptionRegions(t *testing.T) {
+	e := &clientSideEncryption{kek: newFakeKeyEncryptionKey(t)}
+
+	for _, size := range []int{0, 1, encryptionRegionLength, 2*encryptionRegionLength + 1} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			data := make([]byte, size)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatal(err)
+			}
+			content, metaData, err := e.encrypt(context.Background(), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			regions := max(1, (size+encryptionRegionLength-1)/encryptionRegionLength)
+			if want := size + regions*(encryptionNonceLength+encryptionTagLength); len(content) != want {
+				t.Fatalf("expected %d bytes of encrypted content, got %d", want, len(content))
+			}
+
+			decrypted, err := e.decrypt(context.Background(), content, metaData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, data) {
+				t.Fatal("expected to decrypt what was encrypted")
+			}
+
+			// tampering with the content is detected
+			content[len(content)-1] ^= 1
+			if _, err := e.decrypt(context.Background(), content, metaData); err == nil {
+				t.Fatal("expected tampered content to fail to decrypt")
+			}
+		})
+	}
+}
+
+func TestClientSideEncryptionProtocolV1(t *testing.T) {
+	kek := newFakeKeyEncryptionKey(t)
+	e := &clientSideEncryption{kek: kek}
+
+	// a blob encrypted by an Azure Storage SDK with version 1.0 of the
+	// protocol, with AES-256-CBC
+	data := []byte(`{"version": 4, "serial": 3}`)
+	cek, iv := make([]byte, 32), make([]byte, aes.BlockSize)
+	if _, err := rand.Read(cek); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	content := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(content, content)
+	keyID, wrapped, err := kek.wrapKey(context.Background(), cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaData := fmt.Sprintf(`{"EncryptionMode": "FullBlob", "WrappedContentKey": {"KeyId": %q, "EncryptedKey": %q, "Algorithm": "RSA-OAEP"}, "EncryptionAgent": {"Protocol": "1.0", "EncryptionAlgorithm": "AES_CBC_256"}, "ContentEncryptionIV": %q, "KeyWrappingMetadata": {"EncryptionLibrary": "Java 5.3.0"}}`,
+		keyID, base64.StdEncoding.EncodeToString(wrapped), base64.StdEncoding.EncodeToString(iv))
+
+	decrypted, err := e.decrypt(context.Background(), content, metaData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatalf("expected %s, got %s", data, decrypted)
+	}
+}
+
+func TestBackendClientSideEncryptionKeyID(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"client_side_encryption_key_id": "https://example.com/keys/state",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "client_side_encryption_key_id: invalid Key Vault URI") {
+		t.Fatalf("expected the key ID to be refused, got %v", diags.Err())
+	}
+}
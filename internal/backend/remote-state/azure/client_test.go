@@ -7,13 +7,19 @@ package azure
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/legacy/helper/acctest"
 	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/version"
 	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
 )
 
@@ -315,3 +321,729 @@ func TestPutMaintainsMetaData(t *testing.T) {
 		t.Fatalf("%q was not set to %q in the MetaData: %+v", headerName, expectedValue, blobReference.MetaData)
 	}
 }
+
+func TestRemoteClientClientRequestID(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"client_request_id_prefix": "tofu-ci-",
+	})
+
+	if _, err := b.StateMgr(backend.DefaultStateName); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.requests) == 0 {
+		t.Fatal("expected requests to be made")
+	}
+	for _, r := range m.requests {
+		if id := r.Header.Get(clientRequestIDHeader); !strings.HasPrefix(id, "tofu-ci-") {
+			t.Fatalf("%s request for %q has client request ID %q, want prefix %q", r.Method, r.Blob, id, "tofu-ci-")
+		}
+	}
+
+	var failedID string
+	m.intercept = func(r *http.Request) *http.Response {
+		failedID = r.Header.Get(clientRequestIDHeader)
+		return mockError(http.StatusForbidden, "AuthorizationFailure", "This request is not authorized to perform this operation.")
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if failedID == "" {
+		t.Fatal("failed request had no client request ID")
+	}
+	if !strings.Contains(err.Error(), failedID) {
+		t.Fatalf("error doesn't contain client request ID %q: %s", failedID, err)
+	}
+}
+
+func TestRemoteClientCoalesceWrites(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"coalesce_writes": true,
+	})
+	m.putBlob(mockContainerName, "test.tfstate", []byte("initial"), nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "test"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"first", "second", "final"} {
+		if err := client.Put([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.requestCount("PUT", ""); n != 0 {
+		t.Fatalf("expected writes to be buffered while locked, got %d blob writes", n)
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload.Data) != "final" {
+		t.Fatalf("expected to read the buffered write, got %q", payload.Data)
+	}
+
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.requestCount("PUT", ""); n != 1 {
+		t.Fatalf("expected exactly one blob write at unlock, got %d", n)
+	}
+	if got := string(m.blob(mockContainerName, "test.tfstate").content); got != "final" {
+		t.Fatalf("expected the final write to be stored, got %q", got)
+	}
+}
+
+func TestRemoteClientMinSerialGuard(t *testing.T) {
+	cases := map[string]struct {
+		serial   int
+		override bool
+		wantErr  bool
+	}{
+		"forward":           {serial: 6},
+		"equal":             {serial: 5},
+		"backward":          {serial: 4, wantErr: true},
+		"backward override": {serial: 4, override: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, map[string]interface{}{
+				"min_serial_guard":      true,
+				"allow_serial_rollback": tc.override,
+			})
+			m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 5, "lineage": "guard"}`), nil)
+
+			client, err := b.remoteClient(backend.DefaultStateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := []byte(fmt.Sprintf(`{"version": 4, "serial": %d, "lineage": "guard"}`, tc.serial))
+			err = client.Put(data)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "refusing to write state with serial 4") {
+					t.Fatalf("expected a rollback error, got %v", err)
+				}
+				if n := m.requestCount("PUT", ""); n != 0 {
+					t.Fatalf("expected the write to be refused, got %d blob writes", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.blob(mockContainerName, "test.tfstate").content; string(got) != string(data) {
+				t.Fatalf("expected the state to be written, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRemoteClientMinSerialGuardKeepsETag(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"min_serial_guard": true,
+	})
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 5, "lineage": "guard"}`), nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process writes a state with the same serial after the read
+	other := []byte(`{"version": 4, "serial": 5, "lineage": "guard", "outputs": {}}`)
+	m.putBlob(mockContainerName, "test.tfstate", other, nil)
+
+	err = client.Put([]byte(`{"version": 4, "serial": 5, "lineage": "guard"}`))
+	if err == nil || !strings.Contains(err.Error(), "was modified by another process") {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if got := m.blob(mockContainerName, "test.tfstate").content; string(got) != string(other) {
+		t.Fatalf("the other process's state was overwritten with %q", got)
+	}
+}
+
+func TestRemoteClientUnexpectedResponse(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4}`), nil)
+
+	// a misconfigured proxy answering with its own error page
+	m.intercept = func(r *http.Request) *http.Response {
+		return mockResponse(http.StatusOK, http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}, []byte("<html><body>Proxy login required</body></html>"))
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if got := err.Error(); !strings.Contains(got, "unexpected response from") || !strings.Contains(got, "Check the proxy and endpoint configuration") {
+		t.Fatalf("unexpected error: %s", got)
+	}
+}
+
+func TestRemoteClientIdempotencyKey(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"idempotency_key": "audit-123",
+	})
+
+	first, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "test"
+	lockInfo.Info = "from the first client"
+	if _, err := first.Lock(lockInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = second.Lock(statemgr.NewLockInfo())
+	if err == nil {
+		t.Fatal("expected the second lock to fail")
+	}
+
+	lockErr, ok := err.(*statemgr.LockError)
+	if !ok {
+		t.Fatalf("expected a LockError, got %T", err)
+	}
+	if lockErr.Info == nil {
+		t.Fatal("expected the lock error to carry the lock info")
+	}
+	if want := "from the first client\nIdempotency key: audit-123"; lockErr.Info.Info != want {
+		t.Fatalf("expected lock info %q, got %q", want, lockErr.Info.Info)
+	}
+	if !strings.Contains(lockErr.Err.Error(), "idempotency key: audit-123") {
+		t.Fatalf("error doesn't contain the idempotency key: %s", lockErr.Err)
+	}
+}
+
+func TestRemoteClientMaxReadBytes(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"max_read_bytes": 32,
+	})
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4}`), nil)
+	if _, err := client.Get(); err != nil {
+		t.Fatalf("unexpected error reading a state within the limit: %s", err)
+	}
+
+	m.putBlob(mockContainerName, "test.tfstate", []byte(strings.Repeat(" ", 33)), nil)
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), "larger than max_read_bytes (32 bytes)") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestRemoteClientOperationOverrides(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	skipThrottleWaits(b)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	m.intercept = func(r *http.Request) *http.Response {
+		requests++
+		return mockResponse(http.StatusServiceUnavailable, nil, nil)
+	}
+
+	ctx := ContextWithOperationOverrides(context.Background(), OperationOverrides{RetryAttempts: 1})
+	if _, err := client.GetWithContext(ctx); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests with the override, got %d", requests)
+	}
+
+	// the override only applies to the operation it was given to
+	requests = 0
+	if _, err := client.Get(); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if want := defaultMaxRetries + 1; requests != want {
+		t.Fatalf("expected %d requests without the override, got %d", want, requests)
+	}
+
+	m.intercept = func(r *http.Request) *http.Response {
+		<-r.Context().Done()
+		return mockResponse(http.StatusServiceUnavailable, nil, nil)
+	}
+	ctx = ContextWithOperationOverrides(context.Background(), OperationOverrides{Timeout: 10 * time.Millisecond})
+	if _, err := client.GetWithContext(ctx); err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("expected the operation to time out, got %v", err)
+	}
+}
+
+func TestRemoteClientMinSerialGuardOperationOverrides(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"min_serial_guard": true,
+	})
+	skipThrottleWaits(b)
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1}`), nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the read of the current serial is part of the write
+	var reads int
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodGet {
+			reads++
+			return mockResponse(http.StatusServiceUnavailable, nil, nil)
+		}
+		return nil
+	}
+	ctx := ContextWithOperationOverrides(context.Background(), OperationOverrides{RetryAttempts: 1})
+	if err := client.PutWithContext(ctx, []byte(`{"version": 4, "serial": 2}`)); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if reads != 2 {
+		t.Fatalf("expected 2 reads with the override, got %d", reads)
+	}
+}
+
+func TestRemoteClientAutoRehydrate(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"auto_rehydrate": true,
+	})
+	state := []byte(`{"version": 4, "serial": 1}`)
+	m.putBlob(mockContainerName, "test.tfstate", state, nil)
+	m.archiveBlob(mockContainerName, "test.tfstate", 3)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slept int
+	client.rehydration.Interval = time.Minute
+	client.rehydration.sleep = func(ctx context.Context, d time.Duration) error {
+		slept++
+		return nil
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload == nil || string(payload.Data) != string(state) {
+		t.Fatalf("unexpected payload after rehydration: %v", payload)
+	}
+	if slept != 3 {
+		t.Fatalf("expected to wait 3 times for the rehydration, waited %d times", slept)
+	}
+	if n := m.requestCount(http.MethodPut, "tier"); n != 1 {
+		t.Fatalf("expected rehydration to be requested once, got %d", n)
+	}
+}
+
+func TestRemoteClientAutoRehydrateTimeout(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"auto_rehydrate":    true,
+		"rehydrate_timeout": "3m",
+	})
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1}`), nil)
+	m.archiveBlob(mockContainerName, "test.tfstate", 100)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.rehydration.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	_, err = client.Get()
+	if err == nil || !strings.Contains(err.Error(), "still being rehydrated from the Archive tier after 3m0s") {
+		t.Fatalf("expected the rehydration to time out, got %v", err)
+	}
+}
+
+func TestRemoteClientArchivedWithoutAutoRehydrate(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1}`), nil)
+	m.archiveBlob(mockContainerName, "test.tfstate", 1)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(); err == nil {
+		t.Fatal("expected reading an archived state to fail")
+	}
+	if n := m.requestCount(http.MethodPut, "tier"); n != 0 {
+		t.Fatalf("expected no rehydration, got %d requests", n)
+	}
+}
+
+func TestRemoteClientLockConflictVersion(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	first, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lock info built by hand records the version all the same
+	if _, err := first.Lock(&statemgr.LockInfo{Operation: "apply", Who: "runner-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = second.Lock(statemgr.NewLockInfo())
+	if err == nil {
+		t.Fatal("expected a lock conflict")
+	}
+	if want := "Version:   " + version.Version; !strings.Contains(err.Error(), want) {
+		t.Fatalf("lock conflict doesn't report the holder's version %q:\n%s", version.Version, err)
+	}
+}
+
+func TestRemoteClientLockConflictHolder(t *testing.T) {
+	for _, method := range []string{lockMethodLease, lockMethodBlob} {
+		t.Run(method, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, map[string]interface{}{
+				"lock_method": method,
+			})
+
+			first, err := b.remoteClient(backend.DefaultStateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// lock info built by hand records who holds the lock since
+			// when all the same
+			lockID, err := first.Lock(&statemgr.LockInfo{Operation: "apply"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			held := first.heldLock
+			if held.Who == "" || held.Created.IsZero() || held.Path != mockContainerName+"/test.tfstate" {
+				t.Fatalf("incomplete lock info: %+v", held)
+			}
+
+			second, err := b.remoteClient(backend.DefaultStateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = second.Lock(statemgr.NewLockInfo())
+			want := fmt.Sprintf(` by %s for "apply" since %s (lock ID %s)`, held.Who, held.Created.Format(time.RFC3339), lockID)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("expected the lock conflict to name the holder, got %v", err)
+			}
+
+			// only the holder's ID unlocks the state
+			if err := second.Unlock("other-id"); err == nil {
+				t.Fatal("expected unlocking with another ID to fail")
+			}
+			if err := first.Unlock(lockID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRemoteClientReadCache(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"read_cache_ttl": "1m",
+	})
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	b.readCache.now = func() time.Time { return now }
+
+	key := b.path(backend.DefaultStateName)
+	m.putBlob(mockContainerName, key, []byte(`{"version": 4, "serial": 1}`), nil)
+
+	// downloads counts the reads of the state that weren't answered from the
+	// cache
+	downloads := 0
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodGet && r.Header.Get("If-None-Match") != m.blob(mockContainerName, key).etag {
+			downloads++
+		}
+		return nil
+	}
+
+	get := func(client *RemoteClient) string {
+		t.Helper()
+		payload, err := client.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(payload.Data)
+	}
+
+	first, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get(first)
+
+	// the cache is shared by the clients of the backend
+	if got := get(second); got != `{"version": 4, "serial": 1}` {
+		t.Fatalf("unexpected cached state: %s", got)
+	}
+	if downloads != 1 {
+		t.Fatalf("expected the unchanged state to be served from the cache, got %d downloads", downloads)
+	}
+
+	// a changed state is downloaded again
+	m.putBlob(mockContainerName, key, []byte(`{"version": 4, "serial": 2}`), nil)
+	if got := get(first); got != `{"version": 4, "serial": 2}` {
+		t.Fatalf("expected the changed state, got %s", got)
+	}
+	if downloads != 2 {
+		t.Fatalf("expected the changed state to be downloaded, got %d downloads", downloads)
+	}
+
+	// as is an unchanged state once it has expired
+	now = now.Add(time.Minute)
+	get(first)
+	if downloads != 3 {
+		t.Fatalf("expected the expired state to be downloaded, got %d downloads", downloads)
+	}
+}
+
+func TestRemoteClientReadFromSecondary(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"use_secondary_endpoint_on_read_failure": true,
+	})
+	skipThrottleWaits(b)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the primary endpoint is down, and the secondary one serves the same
+	// blobs
+	var secondaryRequests []string
+	m.intercept = func(r *http.Request) *http.Response {
+		if strings.HasPrefix(r.URL.Host, mockAccountName+secondaryAccountSuffix+".") {
+			secondaryRequests = append(secondaryRequests, r.Method)
+			return nil
+		}
+		return mockError(http.StatusServiceUnavailable, "ServerBusy", "The server is currently unable to receive requests.")
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("expected the state to be read from the secondary endpoint, got: %s", err)
+	}
+	if got := string(payload.Data); got != `{"version": 4, "serial": 1}` {
+		t.Fatalf("unexpected state: %s", got)
+	}
+	if len(secondaryRequests) != 1 || secondaryRequests[0] != http.MethodGet {
+		t.Fatalf("expected a single read from the secondary endpoint, got %v", secondaryRequests)
+	}
+
+	// writes and locks never fall back
+	secondaryRequests = nil
+	if err := client.Put([]byte(`{"version": 4, "serial": 2}`)); err == nil {
+		t.Fatal("expected the write to the unavailable primary endpoint to fail")
+	}
+	if _, err := client.Lock(statemgr.NewLockInfo()); err == nil {
+		t.Fatal("expected locking on the unavailable primary endpoint to fail")
+	}
+	if len(secondaryRequests) != 0 {
+		t.Fatalf("expected no requests to the secondary endpoint, got %v", secondaryRequests)
+	}
+}
+
+func TestRemoteClientReadFromSecondaryWhileLocked(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"use_secondary_endpoint_on_read_failure": true,
+	})
+	skipThrottleWaits(b)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Lock(statemgr.NewLockInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	m.intercept = func(r *http.Request) *http.Response {
+		if strings.HasPrefix(r.URL.Host, mockAccountName+secondaryAccountSuffix+".") {
+			t.Errorf("unexpected %s request to the secondary endpoint", r.Method)
+			return nil
+		}
+		return mockError(http.StatusServiceUnavailable, "ServerBusy", "The server is currently unable to receive requests.")
+	}
+
+	if _, err := client.Get(); err == nil {
+		t.Fatal("expected the read under the lock to fail")
+	}
+}
+
+func TestRemoteClientPutIfMatch(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1}`), nil)
+
+	newClient := func() *RemoteClient {
+		t.Helper()
+		client, err := b.remoteClient(backend.DefaultStateName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Get(); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	a, other := newClient(), newClient()
+	if a.ETag() == "" || a.ETag() != m.blob(mockContainerName, "test.tfstate").etag {
+		t.Fatalf("expected the ETag of the blob read, got %q", a.ETag())
+	}
+
+	// without locking, another process writes the state in between
+	if err := other.Put([]byte(`{"version": 4, "serial": 2}`)); err != nil {
+		t.Fatal(err)
+	}
+	err := a.Put([]byte(`{"version": 4, "serial": 3}`))
+	if err == nil || !strings.Contains(err.Error(), "was modified by another process since it was last read") {
+		t.Fatalf("expected the write to be refused, got %v", err)
+	}
+	if got := string(m.blob(mockContainerName, "test.tfstate").content); got != `{"version": 4, "serial": 2}` {
+		t.Fatalf("expected the other write to be kept, got %s", got)
+	}
+
+	// once the state is read again, it can be written
+	if _, err := a.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Put([]byte(`{"version": 4, "serial": 3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if a.ETag() != m.blob(mockContainerName, "test.tfstate").etag {
+		t.Fatalf("expected the ETag of the blob written, got %q", a.ETag())
+	}
+}
+
+func TestRemoteClientImmutableStorage(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the container gets a time-based retention policy, under which its
+	// blobs can neither be overwritten nor have their metadata changed
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut {
+			if comp := r.URL.Query().Get("comp"); comp == "" || comp == "metadata" {
+				return mockError(http.StatusConflict, "BlobImmutableDueToPolicy", "This operation is not permitted as the blob is immutable due to a policy.")
+			}
+		}
+		return nil
+	}
+
+	err = client.Put([]byte(`{"version": 4, "serial": 2}`))
+	if err == nil || !strings.Contains(err.Error(), "the container has a time-based retention policy") || !strings.Contains(err.Error(), "set snapshot") {
+		t.Fatalf("expected an immutable storage error, got %v", err)
+	}
+
+	_, err = client.Lock(statemgr.NewLockInfo())
+	if err == nil || !strings.Contains(err.Error(), "so the lock info can't be recorded in its metadata") {
+		t.Fatalf("expected an immutable storage error, got %v", err)
+	}
+	if blob := m.blob(mockContainerName, "test.tfstate"); blob.leaseID != "" {
+		t.Fatal("expected the lease to be released")
+	}
+}
+
+func TestRemoteClientBlobHeaders(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatal(err)
+	}
+	blob := m.blob(mockContainerName, "test.tfstate")
+	if blob.contentType != "application/json" || blob.cacheControl != "no-cache" {
+		t.Fatalf("expected the default headers, got %q and %q", blob.contentType, blob.cacheControl)
+	}
+
+	b = testBackendWithMockStorage(t, m, map[string]interface{}{
+		"blob_content_type":  "application/vnd.opentofu.state+json",
+		"blob_cache_control": "no-store",
+	})
+	client, err = b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatal(err)
+	}
+	blob = m.blob(mockContainerName, "test.tfstate")
+	if blob.contentType != "application/vnd.opentofu.state+json" || blob.cacheControl != "no-store" {
+		t.Fatalf("expected the configured headers, got %q and %q", blob.contentType, blob.cacheControl)
+	}
+}
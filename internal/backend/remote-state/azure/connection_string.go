@@ -0,0 +1,62 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// connectionString holds the parts of an Azure Storage connection string,
+// such as
+// DefaultEndpointsProtocol=https;AccountName=<name>;AccountKey=<key>;EndpointSuffix=core.windows.net,
+// that the backend uses.
+type connectionString struct {
+	accountName string
+
+	// accountKey or sasToken authorizes the requests to the account.
+	accountKey string
+	sasToken   string
+
+	// endpointSuffix is the suffix of the account's endpoints, or empty for
+	// that of the configured environment.
+	endpointSuffix string
+}
+
+// parseConnectionString parses an Azure Storage connection string. Its
+// errors never include the string, which holds a secret.
+func parseConnectionString(raw string) (*connectionString, error) {
+	settings := map[string]string{}
+	for i, part := range strings.Split(raw, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		// the values of keys and signatures may end with "="
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid connection_string: part %d isn't a Name=Value setting", i+1)
+		}
+		settings[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	cs := &connectionString{
+		accountName:    settings["accountname"],
+		accountKey:     settings["accountkey"],
+		sasToken:       settings["sharedaccesssignature"],
+		endpointSuffix: settings["endpointsuffix"],
+	}
+	if cs.accountName == "" {
+		return nil, fmt.Errorf("invalid connection_string: it has no AccountName")
+	}
+	if cs.accountKey == "" && cs.sasToken == "" {
+		return nil, fmt.Errorf("invalid connection_string: it has neither an AccountKey nor a SharedAccessSignature")
+	}
+	if protocol, ok := settings["defaultendpointsprotocol"]; ok && !strings.EqualFold(protocol, "https") {
+		return nil, fmt.Errorf("invalid connection_string: DefaultEndpointsProtocol must be https, as the backend only uses HTTPS")
+	}
+	return cs, nil
+}
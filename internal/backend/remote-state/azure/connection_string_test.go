@@ -0,0 +1,109 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	cases := map[string]struct {
+		value   string
+		want    *connectionString
+		wantErr string
+	}{
+		"access key": {
+			value: "DefaultEndpointsProtocol=https;AccountName=myaccount;AccountKey=c2VjcmV0a2V5==;EndpointSuffix=core.windows.net",
+			want:  &connectionString{accountName: "myaccount", accountKey: "c2VjcmV0a2V5==", endpointSuffix: "core.windows.net"},
+		},
+		"sas token": {
+			value: "BlobEndpoint=https://myaccount.blob.core.windows.net/;AccountName=myaccount;SharedAccessSignature=sv=2022-11-02&ss=b&sig=c2ln%3D",
+			want:  &connectionString{accountName: "myaccount", sasToken: "sv=2022-11-02&ss=b&sig=c2ln%3D"},
+		},
+		"any case and trailing separator": {
+			value: "accountname=myaccount; accountkey=c2VjcmV0a2V5;",
+			want:  &connectionString{accountName: "myaccount", accountKey: "c2VjcmV0a2V5"},
+		},
+		"no account name": {
+			value:   "AccountKey=c2VjcmV0a2V5",
+			wantErr: "it has no AccountName",
+		},
+		"no credentials": {
+			value:   "AccountName=myaccount;EndpointSuffix=core.windows.net",
+			wantErr: "neither an AccountKey nor a SharedAccessSignature",
+		},
+		"malformed": {
+			value:   "AccountName=myaccount;c2VjcmV0a2V5",
+			wantErr: "part 2 isn't a Name=Value setting",
+		},
+		"http": {
+			value:   "DefaultEndpointsProtocol=http;AccountName=myaccount;AccountKey=c2VjcmV0a2V5",
+			wantErr: "DefaultEndpointsProtocol must be https",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseConnectionString(tc.value)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				if strings.Contains(err.Error(), "c2VjcmV0a2V5") {
+					t.Fatalf("error reveals the key: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(connectionString{})); diff != "" {
+				t.Fatalf("unexpected connection string:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBackendConnectionString(t *testing.T) {
+	m := newMockStorage()
+	var hosts []string
+	m.intercept = func(r *http.Request) *http.Response {
+		hosts = append(hosts, r.URL.Host)
+		return nil
+	}
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"storage_account_name": "",
+		"access_key":           "",
+		"connection_string":    "DefaultEndpointsProtocol=https;AccountName=" + mockAccountName + ";AccountKey=" + mockAccessKey + ";EndpointSuffix=core.chinacloudapi.cn",
+	})
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hosts {
+		if host != mockAccountName+".blob.core.chinacloudapi.cn" {
+			t.Fatalf("expected the requests to use the endpoint suffix of the connection string, got %q", host)
+		}
+	}
+}
+
+func TestBackendConfigNoStorageAccount(t *testing.T) {
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"storage_account_name": "",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "storage_account_name must be set") {
+		t.Fatalf("expected the missing storage account to be refused, got %v", diags.Err())
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
+)
+
+// historySuffix is appended to the name of a state blob to name the
+// directory the previous states are kept in with history_count. The names
+// of the history blobs are the times they were taken at, so that they sort
+// from the oldest to the newest.
+const historySuffix = ".history/"
+
+// historyTimeFormat formats the times the history blobs are named after.
+const historyTimeFormat = "20060102T150405.000000000Z"
+
+// historyPrefix returns the prefix of the names of the history blobs of the
+// state.
+func (c *RemoteClient) historyPrefix() string {
+	return c.keyName + historySuffix
+}
+
+// putHistory copies the state blob, whose metadata is given, to a new
+// history blob, before it's overwritten. As with a snapshot, a failure to do
+// so fails the write.
+func (c *RemoteClient) putHistory(ctx context.Context, metadata map[string]string) error {
+	name := c.historyPrefix() + time.Now().UTC().Format(historyTimeFormat)
+	log.Printf("[DEBUG] Copying Blob %q to history Blob %q", c.keyName, name)
+	return c.copyBlob(ctx, name, metadata)
+}
+
+// pruneHistory deletes the history blobs of the state but the newest
+// historyCount. Only the holder of the lease writes the state, and so
+// prunes its history, but a history blob already deleted by another process
+// isn't an error, so that pruning is safe even without a lock. As the state
+// was written already, failing to prune is only logged, and pruning is
+// retried with the next write.
+func (c *RemoteClient) pruneHistory(ctx context.Context) {
+	names, err := c.historyBlobs(ctx)
+	if err != nil {
+		log.Printf("[WARN] Failed to list the history Blobs of state Blob %q to prune them: %s", c.keyName, err)
+		return
+	}
+	if len(names) <= c.historyCount {
+		return
+	}
+	for _, name := range names[:len(names)-c.historyCount] {
+		log.Printf("[DEBUG] Pruning history Blob %q", name)
+		resp, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, name, blobs.DeleteInput{})
+		if err != nil && !resp.IsHTTPStatus(http.StatusNotFound) {
+			log.Printf("[WARN] Failed to prune history Blob %q: %s", name, err)
+		}
+	}
+}
+
+// deleteHistory deletes all of the history blobs of the state, as when its
+// workspace is deleted.
+func (c *RemoteClient) deleteHistory(ctx context.Context) error {
+	names, err := c.historyBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		resp, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, name, blobs.DeleteInput{})
+		if err != nil && !resp.IsHTTPStatus(http.StatusNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyBlobs returns the names of the history blobs of the state, from the
+// oldest to the newest.
+func (c *RemoteClient) historyBlobs(ctx context.Context) ([]string, error) {
+	if c.containersClient == nil {
+		return nil, fmt.Errorf("the client has no containers client to list the history Blobs with")
+	}
+	prefix := c.historyPrefix()
+	params := containers.ListBlobsInput{
+		Prefix: &prefix,
+	}
+	var names []string
+	for {
+		resp, err := c.containersClient.ListBlobs(ctx, c.accountName, c.containerName, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Blobs.Blobs {
+			names = append(names, obj.Name)
+		}
+		if resp.NextMarker == nil || *resp.NextMarker == "" {
+			break
+		}
+		params.Marker = resp.NextMarker
+	}
+	sort.Strings(names)
+	return names, nil
+}
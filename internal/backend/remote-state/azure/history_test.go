@@ -0,0 +1,73 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClientHistory(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"history_count": 2,
+	})
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes are made holding the lease, as during an apply
+	lockID, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := client.Put([]byte(fmt.Sprintf(`{"serial": %d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := client.historyBlobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 history blobs, got %v", names)
+	}
+	for i, name := range names {
+		blob := m.blob(mockContainerName, name)
+		if want := fmt.Sprintf(`{"serial": %d}`, i+2); string(blob.content) != want {
+			t.Fatalf("expected history blob %q to hold %s, got %s", name, want, blob.content)
+		}
+		if _, ok := blob.metadata[lockInfoMetaKey]; ok {
+			t.Fatalf("history blob %q has the lock info", name)
+		}
+	}
+
+	// the history blobs aren't workspaces, and go with the workspace
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workspaces) != 2 {
+		t.Fatalf("expected the default and blue workspaces, got %v", workspaces)
+	}
+	if err := b.DeleteWorkspace("blue", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if m.blob(mockContainerName, name) != nil {
+			t.Fatalf("expected history blob %q to be deleted", name)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// hnsFolderMetaKey is the metadata the Blob service marks the directories of
+// a Storage Account with a hierarchical namespace (Data Lake Storage Gen2)
+// with, as they're listed along with the blobs.
+const hnsFolderMetaKey = "hdi_isfolder"
+
+// listBlobsResult is the part of the response to listing the blobs of a
+// container that's used, which the storage SDK can't decode the metadata of.
+type listBlobsResult struct {
+	Blobs []struct {
+		Name     string `xml:"Name"`
+		IsFolder string `xml:"Metadata>hdi_isfolder"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// isHnsEnabled returns whether the Storage Account has a hierarchical
+// namespace, looking the account up with Resource Manager, which needs the
+// Resource Group and a client built from Azure credentials.
+func (c ArmClient) isHnsEnabled(ctx context.Context) (bool, error) {
+	account, err := c.storageAccountsClient.GetProperties(ctx, c.resourceGroupName, c.storageAccountName, "")
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving properties of Storage Account %q: %w", c.storageAccountName, err)
+	}
+	props := account.AccountProperties
+	return props != nil && props.IsHnsEnabled != nil && *props.IsHnsEnabled, nil
+}
+
+// isHnsFolder returns whether a listed blob's hdi_isfolder metadata marks it
+// as a directory rather than a blob.
+func isHnsFolder(isFolder string) bool {
+	return strings.EqualFold(isFolder, "true")
+}
@@ -0,0 +1,92 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	armStorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackendWorkspacesHnsFolders(t *testing.T) {
+	cases := map[string]struct {
+		hnsEnabled bool
+		want       []string
+	}{
+		"hierarchical namespace": {
+			hnsEnabled: true,
+			want:       []string{backend.DefaultStateName, "blue"},
+		},
+		"flat namespace": {
+			want: []string{backend.DefaultStateName, "blue", "scratch"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, map[string]interface{}{
+				"hns_enabled": tc.hnsEnabled,
+			})
+
+			m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"version": 4}`), nil)
+			// a file written under the workspace prefix leaves a directory
+			// there, which the Blob service lists as an empty blob
+			m.putBlob(mockContainerName, "test.tfstateenv:scratch", nil, map[string]string{hnsFolderMetaKey: "true"})
+			m.putBlob(mockContainerName, "test.tfstateenv:scratch/notes.txt", []byte("notes"), nil)
+
+			workspaces, err := b.Workspaces()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, workspaces); diff != "" {
+				t.Fatalf("unexpected workspaces:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestArmClientIsHnsEnabled(t *testing.T) {
+	cases := map[string]struct {
+		properties string
+		want       bool
+	}{
+		"enabled":  {properties: `{"isHnsEnabled": true}`, want: true},
+		"disabled": {properties: `{"isHnsEnabled": false}`},
+		"unset":    {properties: `{}`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			accountsClient := armStorage.NewAccountsClientWithBaseURI("https://management.azure.invalid", "00000000-0000-0000-0000-000000000000")
+			accountsClient.Sender = autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+				header := http.Header{}
+				header.Set("Content-Type", "application/json")
+				resp := mockResponse(http.StatusOK, header, []byte(`{"name": "mockaccount", "properties": `+tc.properties+`}`))
+				resp.Request = r
+				return resp, nil
+			})
+
+			client := ArmClient{
+				resourceGroupName:     "tofu-rg",
+				storageAccountName:    mockAccountName,
+				storageAccountsClient: &accountsClient,
+			}
+			got, err := client.isHnsEnabled(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+const (
+	// incrementalUploadMinSize is the size from which states are uploaded a
+	// block at a time with incremental_upload. Smaller states are written
+	// in a single request.
+	incrementalUploadMinSize = 1 << 20
+
+	// minStateBlockSize and maxStateBlockSize bound the size of the blocks
+	// a state is split into. Past the minimum, a block ends after a line
+	// whose hash matches stateBlockBoundaryMask, so that the blocks follow
+	// the content rather than offsets in it, and a change to the state only
+	// changes the blocks around it.
+	minStateBlockSize      = 256 << 10
+	maxStateBlockSize      = 4 << 20
+	stateBlockBoundaryMask = 1<<12 - 1
+)
+
+// stateBlock is a block of the state blob, named by the hash of its content
+// so that the blocks already committed can be recognized.
+type stateBlock struct {
+	id   string
+	data []byte
+}
+
+// splitStateBlocks splits the content of the state blob into blocks.
+func splitStateBlocks(content []byte) []stateBlock {
+	var result []stateBlock
+	for len(content) > 0 {
+		end := stateBlockEnd(content)
+		sum := sha256.Sum256(content[:end])
+		result = append(result, stateBlock{
+			id:   base64.StdEncoding.EncodeToString(sum[:]),
+			data: content[:end],
+		})
+		content = content[end:]
+	}
+	return result
+}
+
+// stateBlockEnd returns the length of the block content starts with.
+func stateBlockEnd(content []byte) int {
+	if len(content) <= minStateBlockSize {
+		return len(content)
+	}
+	limit := min(len(content), maxStateBlockSize)
+	for start := 0; start < limit; {
+		newline := bytes.IndexByte(content[start:limit], '\n')
+		if newline < 0 {
+			break
+		}
+		end := start + newline + 1
+		if end >= minStateBlockSize {
+			h := fnv.New32a()
+			h.Write(content[start:end])
+			if h.Sum32()&stateBlockBoundaryMask == 0 {
+				return end
+			}
+		}
+		start = end
+	}
+	return limit
+}
+
+// putStateBlocks writes the state blob as putStateBlob does, by only staging
+// the blocks of the content the blob doesn't have committed yet, and
+// committing the new list of blocks. It returns false, having written
+// nothing, for the state to be written in a single request instead: when
+// it's small, when staging blocks fails, or when most of it changed, as
+// then there's little to save. A blob without committed blocks, such as one
+// written in a single request, has them all staged.
+func (c *RemoteClient) putStateBlocks(ctx context.Context, input blobs.PutBlockBlobInput) (autorest.Response, bool, error) {
+	content := *input.Content
+	if len(content) < incrementalUploadMinSize {
+		return autorest.Response{}, false, nil
+	}
+
+	list, err := c.giovanniBlobClient.GetBlockList(ctx, c.accountName, c.containerName, c.keyName, blobs.GetBlockListInput{
+		BlockListType: blobs.Committed,
+		LeaseID:       input.LeaseID,
+	})
+	if err != nil {
+		if !list.Response.IsHTTPStatus(http.StatusNotFound) {
+			log.Printf("[DEBUG] Couldn't list the blocks of Blob %q, writing it in a single request: %s", c.keyName, err)
+		}
+		return autorest.Response{}, false, nil
+	}
+	committed := map[string]bool{}
+	for _, block := range list.CommittedBlocks.Blocks {
+		committed[block.Name] = true
+	}
+
+	blocks := splitStateBlocks(content)
+	var staged []stateBlock
+	stagedSize := 0
+	for _, block := range blocks {
+		if !committed[block.id] {
+			// the same block may be there more than once
+			committed[block.id] = true
+			staged = append(staged, block)
+			stagedSize += len(block.data)
+		}
+	}
+	if len(list.CommittedBlocks.Blocks) > 0 && stagedSize*2 > len(content) {
+		log.Printf("[DEBUG] Most of Blob %q changed, writing it in a single request", c.keyName)
+		return autorest.Response{}, false, nil
+	}
+
+	log.Printf("[DEBUG] Staging %d of the %d blocks of Blob %q (%d of %d bytes)", len(staged), len(blocks), c.keyName, stagedSize, len(content))
+	for _, block := range staged {
+		_, err := c.giovanniBlobClient.PutBlock(ctx, c.accountName, c.containerName, c.keyName, blobs.PutBlockInput{
+			BlockID: block.id,
+			Content: block.data,
+			LeaseID: input.LeaseID,
+		})
+		if err != nil {
+			log.Printf("[DEBUG] Couldn't stage a block of Blob %q, writing it in a single request: %s", c.keyName, err)
+			return autorest.Response{}, false, nil
+		}
+	}
+
+	listInput := blobs.PutBlockListInput{
+		ContentType:  input.ContentType,
+		CacheControl: input.CacheControl,
+		MetaData:     input.MetaData,
+		LeaseID:      input.LeaseID,
+	}
+	for _, block := range blocks {
+		listInput.BlockList.LatestBlockIDs = append(listInput.BlockList.LatestBlockIDs, blobs.BlockID{Value: block.id})
+	}
+	req, err := c.giovanniBlobClient.PutBlockListPreparer(ctx, c.accountName, c.containerName, c.keyName, listInput)
+	if err != nil {
+		return autorest.Response{}, true, fmt.Errorf("error preparing request to write Blob %q: %w", c.keyName, err)
+	}
+	// as with writing the blob in a single request, the write is
+	// conditional on the blob not having changed since it was last seen
+	if c.etag != "" {
+		req.Header.Set("If-Match", c.etag)
+	}
+	resp, err := c.giovanniBlobClient.PutBlockListSender(req)
+	if err != nil {
+		return autorest.Response{Response: resp}, true, autorest.NewErrorWithError(err, "blobs.Client", "PutBlockList", resp, "Failure sending request")
+	}
+	result, err := c.giovanniBlobClient.PutBlockListResponder(resp)
+	if err != nil {
+		return result.Response, true, autorest.NewErrorWithError(err, "blobs.Client", "PutBlockList", resp, "Failure responding to request")
+	}
+	return result.Response, true, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+// largeTestState returns a state of about 4 MiB, with resources named after
+// prefix.
+func largeTestState(serial int, prefix string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\n  \"version\": 4,\n  \"serial\": %d,\n  \"resources\": [\n", serial)
+	for i := 0; i < 40000; i++ {
+		fmt.Fprintf(&buf, "    {\"type\": \"null_resource\", \"name\": \"%s_%d\", \"id\": \"%08d\"},\n", prefix, i, i*7919)
+	}
+	buf.WriteString("    {}\n  ]\n}\n")
+	return buf.Bytes()
+}
+
+func TestSplitStateBlocks(t *testing.T) {
+	state := largeTestState(1, "a")
+	blocks := splitStateBlocks(state)
+	var joined []byte
+	for _, block := range blocks {
+		if len(block.data) > maxStateBlockSize {
+			t.Fatalf("block of %d bytes is over the maximum", len(block.data))
+		}
+		joined = append(joined, block.data...)
+	}
+	if !bytes.Equal(joined, state) {
+		t.Fatal("the blocks don't make up the state")
+	}
+	if len(blocks) < 2 {
+		t.Fatalf("expected the state to be split, got %d block", len(blocks))
+	}
+
+	// a change only changes the block it's in
+	changed := bytes.Replace(state, []byte(`"a_20000"`), []byte(`"b_20000"`), 1)
+	ids := map[string]bool{}
+	for _, block := range blocks {
+		ids[block.id] = true
+	}
+	changedBlocks := 0
+	for _, block := range splitStateBlocks(changed) {
+		if !ids[block.id] {
+			changedBlocks++
+		}
+	}
+	if changedBlocks > 2 {
+		t.Fatalf("expected a small change to change at most 2 blocks, got %d", changedBlocks)
+	}
+}
+
+func TestRemoteClientIncrementalUpload(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"incremental_upload": true,
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first write creates the blob, and the second one has all of its
+	// blocks staged
+	state := largeTestState(1, "a")
+	for i := 0; i < 2; i++ {
+		if err := client.Put(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks := len(splitStateBlocks(state))
+	if got := m.requestCount(http.MethodPut, "block"); got != blocks {
+		t.Fatalf("expected %d blocks to be staged, got %d", blocks, got)
+	}
+
+	// a small change only has the blocks it's in staged
+	changed := bytes.Replace(state, []byte(`"a_20000"`), []byte(`"b_20000"`), 1)
+	if err := client.Put(changed); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.requestCount(http.MethodPut, "block") - blocks; got < 1 || got > 2 {
+		t.Fatalf("expected 1 or 2 blocks to be staged, got %d", got)
+	}
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload.Data, changed) {
+		t.Fatal("the state read isn't the one written")
+	}
+
+	// a state that changed entirely is written in a single request
+	singleShot := m.requestCount(http.MethodPut, "")
+	staged := m.requestCount(http.MethodPut, "block")
+	other := largeTestState(2, "c")
+	if err := client.Put(other); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.requestCount(http.MethodPut, ""); got != singleShot+1 {
+		t.Fatal("expected the state to be written in a single request")
+	}
+	if got := m.requestCount(http.MethodPut, "block"); got != staged {
+		t.Fatalf("expected no blocks to be staged, got %d", got-staged)
+	}
+	if !bytes.Equal(m.blob(mockContainerName, "test.tfstate").content, other) {
+		t.Fatal("the state stored isn't the one written")
+	}
+}
+
+func TestRemoteClientIncrementalUploadConflict(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"incremental_upload": true,
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := largeTestState(1, "a")
+	if err := client.Put(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process writes the state meanwhile
+	m.putBlob(mockContainerName, "test.tfstate", largeTestState(2, "a"), nil)
+	if err := client.Put(largeTestState(3, "a")); err == nil || !strings.Contains(err.Error(), "was modified by another process") {
+		t.Fatalf("expected the write to be refused, got %v", err)
+	}
+}
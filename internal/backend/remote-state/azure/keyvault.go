@@ -0,0 +1,95 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.1/keyvault"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// keyVaultReferencePrefix starts a Key Vault reference, which is written as
+// @Microsoft.KeyVault(SecretUri=<secret URI>) as in App Service settings.
+const keyVaultReferencePrefix = "@Microsoft.KeyVault("
+
+// keyVaultObject identifies a secret or a key in a Key Vault.
+type keyVaultObject struct {
+	// vaultBaseURL is the URL of the vault, such as
+	// https://myvault.vault.azure.net.
+	vaultBaseURL string
+	name         string
+
+	// version is the version of the object, or empty for its current
+	// version.
+	version string
+}
+
+// parseKeyVaultReference parses the given value as a Key Vault reference,
+// returning nil if it isn't one.
+func parseKeyVaultReference(value string, env azure.Environment) (*keyVaultObject, error) {
+	if !strings.HasPrefix(value, keyVaultReferencePrefix) {
+		return nil, nil
+	}
+	inner, ok := strings.CutSuffix(strings.TrimPrefix(value, keyVaultReferencePrefix), ")")
+	if !ok {
+		return nil, fmt.Errorf("invalid Key Vault reference: expected %sSecretUri=<secret URI>)", keyVaultReferencePrefix)
+	}
+	key, rawURI, ok := strings.Cut(inner, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "SecretUri") {
+		return nil, fmt.Errorf("invalid Key Vault reference: expected %sSecretUri=<secret URI>)", keyVaultReferencePrefix)
+	}
+	return parseKeyVaultURI(strings.TrimSpace(rawURI), "secrets", env)
+}
+
+// parseKeyVaultURI parses the URI of an object in the given collection of a
+// Key Vault, "secrets" or "keys". The vault must be one of env's, so that
+// the credentials are never sent elsewhere.
+func parseKeyVaultURI(raw, collection string, env azure.Environment) (*keyVaultObject, error) {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Key Vault URI: %w", err)
+	}
+	if uri.Scheme != "https" || !strings.HasSuffix(uri.Hostname(), "."+env.KeyVaultDNSSuffix) {
+		return nil, fmt.Errorf("invalid Key Vault URI %q: expected https://<vault>.%s/%s/<name>", uri.Redacted(), env.KeyVaultDNSSuffix, collection)
+	}
+	segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != collection || segments[1] == "" {
+		return nil, fmt.Errorf("invalid Key Vault URI %q: expected https://<vault>.%s/%s/<name>[/<version>]", uri.Redacted(), env.KeyVaultDNSSuffix, collection)
+	}
+
+	object := &keyVaultObject{
+		vaultBaseURL: "https://" + uri.Host,
+		name:         segments[1],
+	}
+	if len(segments) == 3 {
+		object.version = segments[2]
+	}
+	return object, nil
+}
+
+// resolveKeyVaultSecret reads the referenced secret, authorizing the request
+// with auth. The secret is only returned, and kept out of the logs.
+func (c *ArmClient) resolveKeyVaultSecret(ctx context.Context, ref *keyVaultObject, auth autorest.Authorizer) (string, error) {
+	client := keyvault.New()
+	c.configureClient(&client.Client, auth)
+
+	secret, err := client.GetSecret(contextWithoutBodyLogging(ctx), ref.vaultBaseURL, ref.name, ref.version)
+	if err != nil {
+		if isForbidden(secret.Response) {
+			return "", fmt.Errorf("the credentials used by the backend aren't allowed to read secret %q from Key Vault %q; they need the Key Vault Secrets User role, or an access policy allowing them to get secrets: %w", ref.name, ref.vaultBaseURL, err)
+		}
+		return "", fmt.Errorf("failed to read secret %q from Key Vault %q: %w", ref.name, ref.vaultBaseURL, err)
+	}
+	if secret.Value == nil || *secret.Value == "" {
+		return "", fmt.Errorf("secret %q in Key Vault %q is empty", ref.name, ref.vaultBaseURL)
+	}
+	return *secret.Value, nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseKeyVaultReference(t *testing.T) {
+	cases := map[string]struct {
+		value   string
+		want    *keyVaultObject
+		wantErr string
+	}{
+		"access key": {
+			value: "abcdefghijklmnopqrstuvwxyz0123456789",
+		},
+		"current version": {
+			value: "@Microsoft.KeyVault(SecretUri=https://myvault.vault.azure.net/secrets/storage-key/)",
+			want:  &keyVaultObject{vaultBaseURL: "https://myvault.vault.azure.net", name: "storage-key"},
+		},
+		"version": {
+			value: "@Microsoft.KeyVault(SecretUri=https://myvault.vault.azure.net/secrets/storage-key/0123456789abcdef)",
+			want:  &keyVaultObject{vaultBaseURL: "https://myvault.vault.azure.net", name: "storage-key", version: "0123456789abcdef"},
+		},
+		"unterminated": {
+			value:   "@Microsoft.KeyVault(SecretUri=https://myvault.vault.azure.net/secrets/storage-key",
+			wantErr: "invalid Key Vault reference",
+		},
+		"vault name": {
+			value:   "@Microsoft.KeyVault(VaultName=myvault;SecretName=storage-key)",
+			wantErr: "invalid Key Vault reference",
+		},
+		"other host": {
+			value:   "@Microsoft.KeyVault(SecretUri=https://example.com/secrets/storage-key)",
+			wantErr: "invalid Key Vault URI \"https://example.com/secrets/storage-key\"",
+		},
+		"not a secret": {
+			value:   "@Microsoft.KeyVault(SecretUri=https://myvault.vault.azure.net/keys/storage-key)",
+			wantErr: "expected https://<vault>.vault.azure.net/secrets/<name>[/<version>]",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseKeyVaultReference(tc.value, azure.PublicCloud)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(keyVaultObject{})); diff != "" {
+				t.Fatalf("unexpected reference:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolveKeyVaultSecret(t *testing.T) {
+	ref := &keyVaultObject{vaultBaseURL: "https://myvault.vault.azure.net", name: "storage-key"}
+	cases := map[string]struct {
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		"secret": {
+			status: http.StatusOK,
+			body:   `{"value": "c2VjcmV0"}`,
+			want:   "c2VjcmV0",
+		},
+		"forbidden": {
+			status:  http.StatusForbidden,
+			body:    `{"error": {"code": "Forbidden", "message": "The user does not have secrets get permission."}}`,
+			wantErr: `aren't allowed to read secret "storage-key" from Key Vault "https://myvault.vault.azure.net"`,
+		},
+		"missing": {
+			status:  http.StatusNotFound,
+			body:    `{"error": {"code": "SecretNotFound", "message": "A secret with (name/id) storage-key was not found in this key vault."}}`,
+			wantErr: `failed to read secret "storage-key" from Key Vault "https://myvault.vault.azure.net"`,
+		},
+		"empty": {
+			status:  http.StatusOK,
+			body:    `{"value": ""}`,
+			wantErr: "is empty",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var requested string
+			client := &ArmClient{
+				sender: autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+					requested = r.URL.Host + r.URL.Path
+					return &http.Response{
+						StatusCode: tc.status,
+						Header:     http.Header{"Content-Type": {"application/json"}},
+						Body:       io.NopCloser(strings.NewReader(tc.body)),
+						Request:    r,
+					}, nil
+				}),
+			}
+
+			got, err := client.resolveKeyVaultSecret(context.Background(), ref, autorest.NullAuthorizer{})
+			if requested != "myvault.vault.azure.net/secrets/storage-key/" {
+				t.Fatalf("unexpected request for %q", requested)
+			}
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected secret %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
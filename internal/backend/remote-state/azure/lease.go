@@ -0,0 +1,427 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// leaseRenewalPolicy controls how renewing the lease held on a state blob is
+// retried. It is deliberately separate from the retries the storage clients
+// apply to every request: failing to renew means losing the lock, so renewal
+// keeps trying through a storage blip that outlasts those retries.
+type leaseRenewalPolicy struct {
+	// Attempts is the maximum number of renewal attempts, including the first.
+	Attempts int
+
+	// Interval is how long to wait between attempts.
+	Interval time.Duration
+
+	// sleep waits for the given duration, returning early with an error if
+	// ctx is cancelled. It defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+var defaultLeaseRenewalPolicy = leaseRenewalPolicy{
+	Attempts: 3,
+	Interval: 5 * time.Second,
+}
+
+// renewLease renews the lease currently held by the client, retrying
+// according to the client's lease renewal policy.
+func (c *RemoteClient) renewLease(ctx context.Context) error {
+	return c.renewLeaseWith(ctx, c.giovanniBlobClient, c.leaseID)
+}
+
+// renewLeaseWith is renewLease with the given blob client and lease ID, which
+// the heartbeat copies so as not to share them with the operations made
+// while it runs.
+func (c *RemoteClient) renewLeaseWith(ctx context.Context, client blobs.Client, leaseID string) error {
+	if leaseID == "" {
+		return fmt.Errorf("no lease is held on state blob %q", c.keyName)
+	}
+
+	policy := c.leaseRenewal
+	if policy.Attempts <= 0 {
+		policy.Attempts = defaultLeaseRenewalPolicy.Attempts
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = defaultLeaseRenewalPolicy.Interval
+	}
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+
+	var err error
+	for attempt := 1; attempt <= policy.Attempts; attempt++ {
+		if attempt > 1 {
+			log.Printf("[DEBUG] Retrying renewal of lease on Blob %q in %s (attempt %d of %d): %s", c.keyName, policy.Interval, attempt, policy.Attempts, err)
+			if sleepErr := policy.sleep(ctx, policy.Interval); sleepErr != nil {
+				return fmt.Errorf("renewing lease on Blob %q was interrupted: %w (last error: %s)", c.keyName, sleepErr, err)
+			}
+		}
+
+		_, err = client.RenewLease(ctx, c.accountName, c.containerName, c.keyName, leaseID)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to renew lease on Blob %q after %d attempts: %w", c.keyName, policy.Attempts, err)
+}
+
+const (
+	// minLeaseDuration and maxLeaseDuration bound the duration of a lease
+	// that isn't infinite. Azure allows 15 to 60 seconds, but the storage
+	// SDK refuses either bound.
+	minLeaseDuration = 16 * time.Second
+	maxLeaseDuration = 59 * time.Second
+)
+
+// leaseDurationSeconds returns the duration to lease the state blob for, in
+// the seconds Azure expects, with -1 for an infinite lease.
+func (c *RemoteClient) leaseDurationSeconds() int {
+	if c.leaseDuration <= 0 {
+		return -1
+	}
+	return int(c.leaseDuration / time.Second)
+}
+
+// leaseHeartbeat renews a lease of a fixed duration in the background for as
+// long as the lock is held, which would otherwise expire during an apply
+// that outlasts it. An infinite lease needs no renewal, but is left behind
+// by a process that dies holding it until the lock is forced.
+type leaseHeartbeat struct {
+	// parent is the context the heartbeat was started with, which it's
+	// started again with after the lease is re-acquired.
+	parent context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// startHeartbeat starts renewing the lease just acquired by the client every
+// heartbeatInterval, until stopHeartbeat is called or ctx is cancelled. It
+// does nothing for an infinite lease.
+func (c *RemoteClient) startHeartbeat(ctx context.Context) {
+	if c.leaseDuration <= 0 {
+		return
+	}
+	interval := c.heartbeatInterval
+	if interval <= 0 {
+		interval = c.leaseDuration / 3
+	}
+
+	h := &leaseHeartbeat{parent: ctx, done: make(chan struct{})}
+	ctx, h.cancel = context.WithCancel(ctx)
+	c.heartbeat = h
+	client, leaseID := c.giovanniBlobClient, c.leaseID
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			log.Printf("[TRACE] Renewing lease %q on Blob %q", leaseID, c.keyName)
+			if err := c.renewLeaseWith(ctx, client, leaseID); err != nil {
+				// stopped while renewing
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("[ERROR] Lease on Blob %q couldn't be renewed, so the lock will be lost when it expires: %s", c.keyName, err)
+				h.mu.Lock()
+				h.err = err
+				h.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops renewing the lease, waiting for a renewal in progress
+// to end, as the lease is about to be released or is gone already.
+func (c *RemoteClient) stopHeartbeat() {
+	if c.heartbeat == nil {
+		return
+	}
+	c.heartbeat.cancel()
+	<-c.heartbeat.done
+	c.heartbeat = nil
+}
+
+// restartHeartbeat starts renewing the lease again, as when it was
+// re-acquired after a renewal failed. It does nothing if the lease isn't
+// renewed in the background.
+func (c *RemoteClient) restartHeartbeat() {
+	if c.heartbeat == nil {
+		return
+	}
+	parent := c.heartbeat.parent
+	c.stopHeartbeat()
+	c.startHeartbeat(parent)
+}
+
+// checkHeartbeat returns heartbeatErr, unless relock_on_loss is set and the
+// lease can be re-acquired.
+func (c *RemoteClient) checkHeartbeat(ctx context.Context) error {
+	err := c.heartbeatErr()
+	if err == nil || !c.relockOnLoss || c.leaseID == "" {
+		return err
+	}
+	log.Printf("[WARN] Lease on Blob %q couldn't be renewed, attempting to re-acquire it: %s", c.keyName, err)
+	if relockErr := c.relock(ctx); relockErr != nil {
+		return fmt.Errorf("%w, and it couldn't be re-acquired: %w", err, relockErr)
+	}
+	return nil
+}
+
+// heartbeatErr returns an error if renewing the lease failed, after which
+// the lock is lost once the lease expires, so that the operation holding it
+// fails rather than carrying on without it.
+func (c *RemoteClient) heartbeatErr() error {
+	if c.heartbeat == nil {
+		return nil
+	}
+	c.heartbeat.mu.Lock()
+	defer c.heartbeat.mu.Unlock()
+	if c.heartbeat.err == nil {
+		return nil
+	}
+	return fmt.Errorf("the lock on Blob %q may have been lost: %w", c.keyName, c.heartbeat.err)
+}
+
+// lockRetryPolicy controls how acquiring the lease on a state blob is retried
+// while another process holds it, so that runs contending for a state wait
+// their turn rather than fail at once. The delay between attempts doubles
+// for each retry, with jitter so that the waiting runs don't retry in step.
+type lockRetryPolicy struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	// Zero disables retrying.
+	MaxRetries int
+
+	// BaseDelay is how long to wait before the first retry.
+	BaseDelay time.Duration
+
+	// sleep defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+
+	// jitter returns the delay to wait instead of the given one. It defaults
+	// to a random delay between half of the given one and all of it.
+	jitter func(d time.Duration) time.Duration
+}
+
+const (
+	defaultLockRetryBaseDelay = time.Second
+
+	// maxLockRetryDelay caps the delay between two attempts, which would
+	// otherwise grow beyond any useful wait after a few retries.
+	maxLockRetryDelay = time.Minute
+)
+
+// delay returns how long to wait before the given retry, counting from 1.
+func (p lockRetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < maxLockRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxLockRetryDelay {
+		d = maxLockRetryDelay
+	}
+	return p.jitter(d)
+}
+
+func halfJitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// errBlobLocked is returned by tryAcquireLease for a state blob leased by
+// another process.
+var errBlobLocked = errors.New("state blob is already locked")
+
+// acquireLease leases the state blob, creating it first if it doesn't exist.
+// While another process holds the lease, it retries according to the
+// client's lock retry policy.
+func (c *RemoteClient) acquireLease(ctx context.Context, options blobs.AcquireLeaseInput) (blobs.AcquireLeaseResult, error) {
+	policy := c.lockRetry
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultLockRetryBaseDelay
+	}
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+	if policy.jitter == nil {
+		policy.jitter = halfJitter
+	}
+
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		result, err := c.tryAcquireLease(ctx, options)
+		if err == nil || !isLeaseConflict(result, err) {
+			return result, err
+		}
+		if attempt > policy.MaxRetries {
+			if attempt > 1 {
+				err = fmt.Errorf("failed to lock Blob %q after %d attempts over %s: %w", c.keyName, attempt, waited, err)
+			}
+			return result, err
+		}
+
+		delay := policy.delay(attempt)
+		log.Printf("[DEBUG] Blob %q is locked, retrying in %s (attempt %d of %d): %s", c.keyName, delay, attempt+1, policy.MaxRetries+1, err)
+		if sleepErr := policy.sleep(ctx, delay); sleepErr != nil {
+			return result, fmt.Errorf("waiting to lock Blob %q was interrupted after %d attempts over %s: %w (last error: %s)", c.keyName, attempt, waited, sleepErr, err)
+		}
+		waited += delay
+	}
+}
+
+// tryAcquireLease makes a single attempt to lease the state blob.
+func (c *RemoteClient) tryAcquireLease(ctx context.Context, options blobs.AcquireLeaseInput) (blobs.AcquireLeaseResult, error) {
+	// obtain properties to see if the blob lease is already in use. If the blob doesn't exist, create it
+	properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{})
+	if err != nil {
+		// error if we had issues getting the blob
+		if !properties.Response.IsHTTPStatus(http.StatusNotFound) {
+			return blobs.AcquireLeaseResult{}, err
+		}
+		// if we don't find the blob, we need to build it
+		if err := c.createBlob(ctx); err != nil {
+			return blobs.AcquireLeaseResult{}, err
+		}
+	}
+
+	// if the blob is already locked then error
+	if properties.LeaseStatus == blobs.Locked {
+		return blobs.AcquireLeaseResult{}, errBlobLocked
+	}
+
+	return c.giovanniBlobClient.AcquireLease(ctx, c.accountName, c.containerName, c.keyName, options)
+}
+
+// isLeaseConflict returns whether a failed attempt to lease the state blob
+// failed because another process holds the lease.
+func isLeaseConflict(result blobs.AcquireLeaseResult, err error) bool {
+	if errors.Is(err, errBlobLocked) {
+		return true
+	}
+	return result.Response.Response != nil && result.Response.StatusCode == http.StatusConflict
+}
+
+// leaseLostErrorCodes are the error codes Azure returns for a write made with
+// a lease that is no longer held on the blob.
+var leaseLostErrorCodes = map[string]bool{
+	"LeaseLost":                        true,
+	"LeaseNotPresentWithBlobOperation": true,
+	"LeaseIdMismatchWithBlobOperation": true,
+}
+
+// isLeaseLost returns whether err reports that the lease used for a write is
+// no longer held on the blob.
+func isLeaseLost(err error) bool {
+	var detailed autorest.DetailedError
+	if !errors.As(err, &detailed) || detailed.Response == nil {
+		return false
+	}
+	return detailed.Response.StatusCode == http.StatusPreconditionFailed &&
+		leaseLostErrorCodes[detailed.Response.Header.Get("x-ms-error-code")]
+}
+
+// relock re-acquires the lease the client held on the state blob after it was
+// lost, for example because it was broken during a storage incident, or
+// after renewing it failed. It refuses to if another process holds a lease
+// on the blob or has modified it since the client last wrote to it, as
+// either means the state may no longer be the client's to write. A lease of
+// a fixed duration is renewed in the background again once re-acquired.
+func (c *RemoteClient) relock(ctx context.Context) error {
+	properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{})
+	if err != nil {
+		return err
+	}
+	if properties.LeaseStatus == blobs.Locked {
+		// the lease may still be the client's, if only renewing it failed
+		if _, err := c.giovanniBlobClient.RenewLease(ctx, c.accountName, c.containerName, c.keyName, c.leaseID); err != nil {
+			return fmt.Errorf("state blob %q has been locked by another process", c.keyName)
+		}
+		log.Printf("[INFO] Renewed lease %q on Blob %q, which was still held", c.leaseID, c.keyName)
+		c.restartHeartbeat()
+		return nil
+	}
+	if c.etag != "" && properties.ETag != c.etag {
+		return fmt.Errorf("state blob %q has been modified by another process since the lease was lost", c.keyName)
+	}
+
+	leaseOptions := blobs.AcquireLeaseInput{
+		ProposedLeaseID: &c.leaseID,
+		LeaseDuration:   c.leaseDurationSeconds(),
+	}
+	if _, err := c.giovanniBlobClient.AcquireLease(ctx, c.accountName, c.containerName, c.keyName, leaseOptions); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Re-acquired lease %q on Blob %q", c.leaseID, c.keyName)
+	c.restartHeartbeat()
+	return nil
+}
+
+// sleepContext waits for the given duration or until ctx is cancelled,
+// whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// breakLease breaks the lease held on the state blob by any process, ending
+// it at once. The storage SDK asks for the ID of the lease, which Azure
+// doesn't need to break it and which isn't known for a lease held by another
+// process, so it's left out of the request. A blob that isn't
+// leased is left as is.
+func (c *RemoteClient) breakLease(ctx context.Context) error {
+	breakPeriod := 0
+	req, err := c.giovanniBlobClient.BreakLeasePreparer(ctx, c.accountName, c.containerName, c.keyName, blobs.BreakLeaseInput{
+		BreakPeriod: &breakPeriod,
+	})
+	if err != nil {
+		return fmt.Errorf("error preparing request to break the lease on Blob %q: %w", c.keyName, err)
+	}
+	req.Header.Del(leaseHeader)
+
+	resp, err := c.giovanniBlobClient.BreakLeaseSender(req)
+	if err != nil {
+		return autorest.NewErrorWithError(err, "blobs.Client", "BreakLease", resp, "Failure sending request")
+	}
+	result, err := c.giovanniBlobClient.BreakLeaseResponder(resp)
+	if err != nil {
+		if result.IsHTTPStatus(http.StatusNotFound) || (result.IsHTTPStatus(http.StatusConflict) && result.Header.Get("x-ms-error-code") == "LeaseNotPresentWithLeaseOperation") {
+			return nil
+		}
+		return autorest.NewErrorWithError(err, "blobs.Client", "BreakLease", resp, "Failure responding to request")
+	}
+	return nil
+}
@@ -0,0 +1,495 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// fakeClock records the sleeps requested of it without actually waiting.
+type fakeClock struct {
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	return ctx.Err()
+}
+
+func TestRemoteClientRenewLeaseRetries(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	skipThrottleWaits(b)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{}
+	client.leaseRenewal = leaseRenewalPolicy{
+		Attempts: 3,
+		Interval: 10 * time.Second,
+		sleep:    clock.sleep,
+	}
+
+	lockID, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail every request of the first renewal attempt, including the
+	// storage client's own retries, as a storage blip would.
+	failures := defaultMaxRetries + 1
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Header.Get("x-ms-lease-action") != "renew" || failures == 0 {
+			return nil
+		}
+		failures--
+		return mockError(http.StatusServiceUnavailable, "ServerBusy", "The server is currently unable to receive requests.")
+	}
+
+	if err := client.renewLease(context.Background()); err != nil {
+		t.Fatalf("expected renewal to succeed on retry, got: %s", err)
+	}
+
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 10*time.Second {
+		t.Fatalf("expected a single 10s wait between attempts, got %v", clock.sleeps)
+	}
+	if got := m.blob(mockContainerName, client.keyName).leaseID; got != lockID {
+		t.Fatalf("lock was lost: blob lease is %q, want %q", got, lockID)
+	}
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteClientRenewLeaseExhausted(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{}
+	client.leaseRenewal = leaseRenewalPolicy{
+		Attempts: 2,
+		Interval: time.Second,
+		sleep:    clock.sleep,
+	}
+
+	if _, err := client.Lock(statemgr.NewLockInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Header.Get("x-ms-lease-action") != "renew" {
+			return nil
+		}
+		return mockError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation", "The lease ID specified did not match the lease ID for the blob.")
+	}
+
+	if err := client.renewLease(context.Background()); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if len(clock.sleeps) != 1 {
+		t.Fatalf("expected 1 wait between 2 attempts, got %v", clock.sleeps)
+	}
+}
+
+func TestRemoteClientLockRetries(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lock_retry_max":        3,
+		"lock_retry_base_delay": "1s",
+	})
+
+	holder, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holderID, err := holder.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the holder releases the lock during the second wait
+	var sleeps []time.Duration
+	client.lockRetry.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		if len(sleeps) == 2 {
+			return holder.Unlock(holderID)
+		}
+		return nil
+	}
+	client.lockRetry.jitter = func(d time.Duration) time.Duration { return d }
+
+	if _, err := client.Lock(statemgr.NewLockInfo()); err != nil {
+		t.Fatalf("expected the lock to be acquired on retry, got: %s", err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; len(sleeps) != 2 || sleeps[0] != want[0] || sleeps[1] != want[1] {
+		t.Fatalf("expected waits of %v, got %v", want, sleeps)
+	}
+}
+
+func TestRemoteClientLockRetriesExhausted(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	holder, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := holder.Lock(statemgr.NewLockInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{}
+	client.lockRetry = lockRetryPolicy{
+		MaxRetries: 2,
+		BaseDelay:  time.Second,
+		sleep:      clock.sleep,
+		jitter:     func(d time.Duration) time.Duration { return d },
+	}
+
+	_, err = client.Lock(statemgr.NewLockInfo())
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts over 3s") {
+		t.Fatalf("expected the attempts and wait to be reported, got %v", err)
+	}
+	if _, ok := err.(*statemgr.LockError); !ok {
+		t.Fatalf("expected a LockError, got %T", err)
+	}
+
+	// a cancelled context stops the waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.LockWithContext(ctx, statemgr.NewLockInfo())
+	if err == nil || !strings.Contains(err.Error(), "interrupted after 1 attempts") {
+		t.Fatalf("expected the wait to be interrupted, got %v", err)
+	}
+}
+
+func TestRemoteClientRelockOnLoss(t *testing.T) {
+	cases := map[string]struct {
+		relock bool
+		// compete is run after the lease is lost, as another process
+		compete func(t *testing.T, m *mockStorage, b *Backend)
+		wantErr string
+	}{
+		"disabled": {
+			wantErr: "LeaseNotPresentWithBlobOperation",
+		},
+		"no competing writer": {
+			relock: true,
+		},
+		"competing lock": {
+			relock: true,
+			compete: func(t *testing.T, m *mockStorage, b *Backend) {
+				other, err := b.remoteClient(backend.DefaultStateName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := other.Lock(statemgr.NewLockInfo()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "has been locked by another process",
+		},
+		"competing write": {
+			relock: true,
+			compete: func(t *testing.T, m *mockStorage, b *Backend) {
+				m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 9}`), nil)
+			},
+			wantErr: "has been modified by another process",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, map[string]interface{}{
+				"relock_on_loss": tc.relock,
+			})
+
+			client, err := b.remoteClient(backend.DefaultStateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lockID, err := client.Lock(statemgr.NewLockInfo())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			m.breakLease(mockContainerName, "test.tfstate")
+			if tc.compete != nil {
+				tc.compete(t, m, b)
+			}
+
+			err = client.Put([]byte(`{"version": 4, "serial": 2}`))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blob := m.blob(mockContainerName, "test.tfstate")
+			if blob.leaseID != lockID {
+				t.Fatalf("expected the lease %q to be re-acquired, got %q", lockID, blob.leaseID)
+			}
+			if string(blob.content) != `{"version": 4, "serial": 2}` {
+				t.Fatalf("expected the state to be written, got %q", blob.content)
+			}
+			if err := client.Unlock(lockID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemoteClientLeaseHeartbeat(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lease_duration": "20s",
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.heartbeatInterval = 10 * time.Millisecond
+
+	var renewals atomic.Int32
+	var acquiredFor atomic.Value
+	m.intercept = func(r *http.Request) *http.Response {
+		switch r.Header.Get("x-ms-lease-action") {
+		case "acquire":
+			acquiredFor.Store(r.Header.Get("x-ms-lease-duration"))
+		case "renew":
+			renewals.Add(1)
+		}
+		return nil
+	}
+
+	lockID, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := acquiredFor.Load(); got != "20" {
+		t.Fatalf("expected a 20 second lease, got %v", got)
+	}
+	waitFor(t, "the lease to be renewed", func() bool { return renewals.Load() >= 2 })
+	if err := client.Put([]byte(`{"serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the renewals stop with the lock
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+	stopped := renewals.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := renewals.Load(); got != stopped {
+		t.Fatalf("expected no renewals after unlocking, got %d more", got-stopped)
+	}
+}
+
+func TestRemoteClientLeaseHeartbeatFailure(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lease_duration": "20s",
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.heartbeatInterval = 10 * time.Millisecond
+	client.leaseRenewal = leaseRenewalPolicy{
+		Attempts: 2,
+		Interval: time.Second,
+		sleep:    (&fakeClock{}).sleep,
+	}
+
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Header.Get("x-ms-lease-action") != "renew" {
+			return nil
+		}
+		return mockError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation", "The lease ID specified did not match the lease ID for the blob.")
+	}
+	lockID, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the renewal to fail", func() bool { return client.heartbeatErr() != nil })
+
+	// the operation holding the lock fails rather than writing without it
+	err = client.Put([]byte(`{"serial": 1}`))
+	if err == nil || !strings.Contains(err.Error(), "may have been lost") {
+		t.Fatalf("expected the write to fail, got %v", err)
+	}
+	if blob := m.blob(mockContainerName, client.keyName); len(blob.content) != 0 {
+		t.Fatalf("the state was written: %s", blob.content)
+	}
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteClientLeaseHeartbeatFailureRelock(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lease_duration": "20s",
+		"relock_on_loss": true,
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.heartbeatInterval = 10 * time.Millisecond
+	client.leaseRenewal = leaseRenewalPolicy{
+		Attempts: 1,
+		sleep:    (&fakeClock{}).sleep,
+	}
+
+	var renewals atomic.Int32
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Header.Get("x-ms-lease-action") == "renew" {
+			renewals.Add(1)
+		}
+		return nil
+	}
+	lockID, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.breakLease(mockContainerName, client.keyName)
+	waitFor(t, "the renewal to fail", func() bool { return client.heartbeatErr() != nil })
+
+	// the lease is re-acquired rather than the write failing
+	if err := client.Put([]byte(`{"serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	blob := m.blob(mockContainerName, client.keyName)
+	if blob.leaseID != lockID {
+		t.Fatalf("expected the lease %q to be re-acquired, got %q", lockID, blob.leaseID)
+	}
+	if string(blob.content) != `{"serial": 1}` {
+		t.Fatalf("expected the state to be written, got %q", blob.content)
+	}
+
+	// and renewed again
+	renewed := renewals.Load()
+	waitFor(t, "the lease to be renewed again", func() bool { return renewals.Load() >= renewed+2 })
+	if err := client.heartbeatErr(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackendConfigLeaseRenewalRetries(t *testing.T) {
+	b := testBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"lease_renewal_retry_max":      5,
+		"lease_renewal_retry_interval": "2s",
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.leaseRenewal; got.Attempts != 6 || got.Interval != 2*time.Second {
+		t.Fatalf("wrong lease renewal policy %+v, want 6 attempts 2s apart", got)
+	}
+
+	b = testBackendWithMockStorage(t, newMockStorage(), nil)
+	client, err = b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.leaseRenewal; got.Attempts != defaultLeaseRenewalPolicy.Attempts {
+		t.Fatalf("wrong default lease renewal attempts %d, want %d", got.Attempts, defaultLeaseRenewalPolicy.Attempts)
+	}
+}
+
+func TestBackendConfigInvalidLeaseDuration(t *testing.T) {
+	cases := map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"too short": {
+			config:  map[string]interface{}{"lease_duration": "5s"},
+			wantErr: "invalid lease_duration",
+		},
+		"too long": {
+			config:  map[string]interface{}{"lease_duration": "2m"},
+			wantErr: "invalid lease_duration",
+		},
+		"fractional": {
+			config:  map[string]interface{}{"lease_duration": "20.5s"},
+			wantErr: "invalid lease_duration",
+		},
+		"interval too long": {
+			config:  map[string]interface{}{"lease_duration": "30s", "lease_renewal_interval": "30s"},
+			wantErr: "invalid lease_renewal_interval",
+		},
+		"interval without duration": {
+			config:  map[string]interface{}{"lease_renewal_interval": "10s"},
+			wantErr: "can only be set with lease_duration",
+		},
+		"negative renewal retries": {
+			config:  map[string]interface{}{"lease_renewal_retry_max": -1},
+			wantErr: "invalid lease_renewal_retry_max",
+		},
+		"zero renewal retry interval": {
+			config:  map[string]interface{}{"lease_renewal_retry_interval": "0s"},
+			wantErr: "invalid lease_renewal_retry_interval",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, diags := configureBackendWithMockStorage(t, newMockStorage(), tc.config)
+			if !diags.HasErrors() {
+				t.Fatal("expected error, got none")
+			}
+			if got := diags.Err().Error(); !strings.Contains(got, tc.wantErr) {
+				t.Fatalf("unexpected error: %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// The values of lock_method.
+const (
+	// lockMethodLease locks the state by leasing its blob.
+	lockMethodLease = "lease"
+
+	// lockMethodBlob locks the state by creating a lock blob next to it.
+	lockMethodBlob = "blob"
+
+	// lockMethodAuto leases the state blob, falling back to a lock blob when
+	// leasing isn't supported.
+	lockMethodAuto = "auto"
+)
+
+// lockBlobSuffix is appended to the key of a state to name the blob locking
+// it when the state can't be locked by leasing its blob.
+const lockBlobSuffix = ".lock.json"
+
+// leaseUnsupportedErrors are the error codes Azure answers a lease request
+// with when the account or the credentials don't allow leasing blobs.
+var leaseUnsupportedErrors = map[string]bool{
+	"FeatureNotSupportedForAccount":   true,
+	"AuthorizationPermissionMismatch": true,
+}
+
+// isLeaseUnsupported reports whether the given response to a lease request
+// refused it because leasing isn't available, rather than because of the
+// state of the lease.
+func isLeaseUnsupported(resp autorest.Response) bool {
+	if resp.Response == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return leaseUnsupportedErrors[resp.Header.Get("x-ms-error-code")]
+}
+
+// mayUseLockBlob reports whether the state may be locked with a lock blob
+// rather than a lease.
+func (c *RemoteClient) mayUseLockBlob() bool {
+	return c.lockMethod == lockMethodBlob || c.lockMethod == lockMethodAuto
+}
+
+func (c *RemoteClient) lockBlobName() string {
+	return c.keyName + lockBlobSuffix
+}
+
+// lockWithBlob locks the state by creating its lock blob, holding the given
+// lock info. Creating the blob is conditional on it not existing, so only
+// one process can hold the lock at a time.
+func (c *RemoteClient) lockWithBlob(ctx context.Context, requestID string, info *statemgr.LockInfo) (string, error) {
+	data := info.Marshal()
+	contentType := "application/json"
+	input := blobs.PutBlockBlobInput{
+		Content:     &data,
+		ContentType: &contentType,
+	}
+
+	created, err := c.createBlobIfMissing(ctx, c.lockBlobName(), input)
+	if err != nil {
+		return "", &statemgr.LockError{Err: c.operationError(err, requestID)}
+	}
+	if !created {
+		lockErr := &statemgr.LockError{Err: fmt.Errorf("%w with Blob %q", errBlobLocked, c.lockBlobName())}
+		lockInfo, err := c.getLockBlobInfo(ctx)
+		if err != nil {
+			lockErr.Err = multierror.Append(lockErr.Err, err)
+		} else if lockInfo != nil {
+			lockErr.Err = fmt.Errorf("%w%s, with Blob %q", errBlobLocked, lockHolder(lockInfo), c.lockBlobName())
+		}
+		lockErr.Info = lockInfo
+		lockErr.Err = c.operationError(lockErr.Err, requestID)
+		return "", lockErr
+	}
+	log.Printf("[DEBUG] Locked state Blob %q with Blob %q", c.keyName, c.lockBlobName())
+	c.holdLock(info)
+
+	if err := c.emitLockEvent(lockEventAcquire, info); err != nil {
+		if !c.auditFailClosed {
+			log.Printf("[WARN] %s", err)
+			return info.ID, nil
+		}
+
+		// A lock that wasn't recorded mustn't be used, so it is released.
+		var result *multierror.Error
+		result = multierror.Append(result, err)
+		if _, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, c.lockBlobName(), blobs.DeleteInput{}); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to release the lock again: %w", err))
+		} else {
+			c.heldLock = nil
+		}
+		return "", &statemgr.LockError{Err: c.operationError(result.ErrorOrNil(), requestID)}
+	}
+	return info.ID, nil
+}
+
+// getLockBlobInfo returns the lock info held by the state's lock blob, or
+// nil if there's no lock blob.
+func (c *RemoteClient) getLockBlobInfo(ctx context.Context) (*statemgr.LockInfo, error) {
+	blob, err := c.giovanniBlobClient.Get(ctx, c.accountName, c.containerName, c.lockBlobName(), blobs.GetInput{})
+	if err != nil {
+		if blob.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading lock Blob %q: %w", c.lockBlobName(), err)
+	}
+
+	info := &statemgr.LockInfo{}
+	if err := json.Unmarshal(blob.Contents, info); err != nil {
+		return nil, fmt.Errorf("invalid lock info in Blob %q: %w", c.lockBlobName(), err)
+	}
+	return info, nil
+}
+
+// unlockBlob releases the lock held by the state's lock blob, which holds
+// the given lock info, if its ID matches the given one.
+func (c *RemoteClient) unlockBlob(ctx context.Context, requestID, id string, lockInfo *statemgr.LockInfo) error {
+	lockErr := &statemgr.LockError{Info: lockInfo}
+	if err := c.checkUnlock(id, lockInfo); err != nil {
+		lockErr.Err = err
+		return lockErr
+	}
+
+	if resp, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, c.lockBlobName(), blobs.DeleteInput{}); err != nil {
+		if immutableErr := immutableBlobError(resp, c.lockBlobName()); immutableErr != nil {
+			err = fmt.Errorf("%w. %s", immutableErr, immutableStateHint)
+		}
+		lockErr.Err = c.operationError(fmt.Errorf("failed to delete lock Blob %q: %w", c.lockBlobName(), err), requestID)
+		return lockErr
+	}
+	c.heldLock = nil
+
+	if err := c.emitLockEvent(lockEventRelease, lockInfo); err != nil {
+		// The lock is released all the same, as holding on to it would
+		// only block other processes.
+		if c.auditFailClosed {
+			lockErr.Err = err
+			return lockErr
+		}
+		log.Printf("[WARN] %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// refuseLeases makes the mock storage refuse every lease request, as an
+// account that doesn't support leasing does.
+func refuseLeases(m *mockStorage) {
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.URL.Query().Get("comp") != "lease" {
+			return nil
+		}
+		return mockError(http.StatusBadRequest, "FeatureNotSupportedForAccount", "This feature is not supported for this account.")
+	}
+}
+
+func TestRemoteClientLockBlobFallback(t *testing.T) {
+	m := newMockStorage()
+	refuseLeases(m)
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lock_method": "auto",
+	})
+
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "apply"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		t.Fatalf("expected locking to fall back to a lock blob, got: %s", err)
+	}
+
+	lockBlob := m.blob(mockContainerName, b.path("blue")+lockBlobSuffix)
+	if lockBlob == nil {
+		t.Fatal("expected the state to be locked with a lock blob")
+	}
+	if client.leaseID != "" {
+		t.Fatalf("expected no lease to be held, got %q", client.leaseID)
+	}
+
+	// another client sees the lock for what it is
+	other, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.Lock(statemgr.NewLockInfo())
+	lockErr, ok := err.(*statemgr.LockError)
+	if !ok {
+		t.Fatalf("expected a LockError, got %#v", err)
+	}
+	if lockErr.Info == nil || lockErr.Info.ID != lockID || lockErr.Info.Operation != "apply" {
+		t.Fatalf("expected the conflict to report the holder, got %#v", lockErr.Info)
+	}
+
+	info, err := b.LockInfo("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.ID != lockID {
+		t.Fatalf("expected LockInfo to report the lock blob, got %#v", info)
+	}
+
+	// the lock blob isn't taken for a workspace
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "blue"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+	if m.blob(mockContainerName, b.path("blue")+lockBlobSuffix) != nil {
+		t.Fatal("expected the lock blob to be deleted on unlock")
+	}
+}
+
+func TestRemoteClientLockBlobLocks(t *testing.T) {
+	m := newMockStorage()
+	refuseLeases(m)
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lock_method": "blob",
+	})
+
+	s1, err := b.StateMgr(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := b.StateMgr(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote.TestRemoteLocks(t, s1.(*remote.State).Client, s2.(*remote.State).Client)
+}
+
+func TestRemoteClientLeaseUnsupported(t *testing.T) {
+	m := newMockStorage()
+	refuseLeases(m)
+	b := testBackendWithMockStorage(t, m, nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without opting in, the state isn't locked any other way
+	if _, err := client.Lock(statemgr.NewLockInfo()); err == nil || !strings.Contains(err.Error(), "FeatureNotSupportedForAccount") {
+		t.Fatalf("expected the lease to be refused, got %v", err)
+	}
+	if m.blob(mockContainerName, b.path(backend.DefaultStateName)+lockBlobSuffix) != nil {
+		t.Fatal("expected no lock blob to be created")
+	}
+}
+
+func TestBackendInvalidLockMethod(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"lock_method": "mutex",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), `invalid lock_method "mutex"`) {
+		t.Fatalf("expected an invalid lock_method to be rejected, got %v", diags.Err())
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+const (
+	lockEventAcquire = "acquire"
+	lockEventRelease = "release"
+)
+
+const (
+	// auditFailOpen logs a failure to record a lock event and carries on
+	// with the lock operation.
+	auditFailOpen = "fail-open"
+
+	// auditFailClosed fails the lock operation when its event can't be
+	// recorded.
+	auditFailClosed = "fail-closed"
+)
+
+// lockEvent is written as a line of JSON to the lock events file each time
+// the client acquires or releases the lock on a state.
+type lockEvent struct {
+	Event     string    `json:"event"`
+	Workspace string    `json:"workspace"`
+	Path      string    `json:"path"`
+	Who       string    `json:"who"`
+	Operation string    `json:"operation"`
+	LeaseID   string    `json:"lease_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// emitLockEvent appends an event for the given lock to the lock events file,
+// if one is configured. Whether failing to do so fails the lock operation
+// is up to the caller, according to audit_failure_mode.
+func (c *RemoteClient) emitLockEvent(event string, info *statemgr.LockInfo) error {
+	if c.lockEventsFile == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(lockEvent{
+		Event:     event,
+		Workspace: c.workspace,
+		Path:      info.Path,
+		Who:       info.Who,
+		Operation: info.Operation,
+		LeaseID:   info.ID,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s lock event: %w", event, err)
+	}
+
+	f, err := os.OpenFile(c.lockEventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock events file %q: %w", c.lockEventsFile, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s lock event to %q: %w", event, c.lockEventsFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClientLockEvents(t *testing.T) {
+	eventsFile := filepath.Join(t.TempDir(), "lock-events.jsonl")
+
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"lock_events_file": eventsFile,
+	})
+
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "apply"
+	lockInfo.Who = "tester@example"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Unlock(lockID); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(eventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []lockEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event lockEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid event %q: %s", scanner.Text(), err)
+		}
+		if event.Timestamp.IsZero() {
+			t.Fatalf("event %q has no timestamp", scanner.Text())
+		}
+		got = append(got, event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	event := lockEvent{
+		Workspace: "blue",
+		Path:      mockContainerName + "/test.tfstateenv:blue",
+		Who:       "tester@example",
+		Operation: "apply",
+		LeaseID:   lockID,
+	}
+	acquire, release := event, event
+	acquire.Event = lockEventAcquire
+	release.Event = lockEventRelease
+
+	if diff := cmp.Diff([]lockEvent{acquire, release}, got, cmpopts.IgnoreTypes(time.Time{})); diff != "" {
+		t.Fatalf("unexpected lock events:\n%s", diff)
+	}
+}
+
+func TestRemoteClientLockEventsFailureMode(t *testing.T) {
+	// the events file can't be created in a directory that doesn't exist
+	eventsFile := filepath.Join(t.TempDir(), "missing", "lock-events.jsonl")
+
+	t.Run("fail-open", func(t *testing.T) {
+		m := newMockStorage()
+		b := testBackendWithMockStorage(t, m, map[string]interface{}{
+			"lock_events_file": eventsFile,
+		})
+		client, err := b.remoteClient("blue")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lockID, err := client.Lock(statemgr.NewLockInfo())
+		if err != nil {
+			t.Fatalf("expected the lock to be acquired despite the failed event, got %s", err)
+		}
+		if err := client.Unlock(lockID); err != nil {
+			t.Fatalf("expected the lock to be released despite the failed event, got %s", err)
+		}
+	})
+
+	t.Run("fail-closed", func(t *testing.T) {
+		m := newMockStorage()
+		b := testBackendWithMockStorage(t, m, map[string]interface{}{
+			"lock_events_file":   eventsFile,
+			"audit_failure_mode": "fail-closed",
+		})
+		client, err := b.remoteClient("blue")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Lock(statemgr.NewLockInfo())
+		if err == nil || !strings.Contains(err.Error(), "failed to open lock events file") {
+			t.Fatalf("expected the lock to fail, got %v", err)
+		}
+		if blob := m.blob(mockContainerName, "test.tfstateenv:blue"); blob.leaseID != "" {
+			t.Fatal("the unrecorded lock is still held")
+		}
+	})
+}
+
+func TestBackendInvalidAuditFailureMode(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"audit_failure_mode": "fail-sometimes",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), `invalid audit_failure_mode "fail-sometimes"`) {
+		t.Fatalf("expected an invalid mode error, got %v", diags.Err())
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// manifestSuffix is appended to the name of a state blob to name the blob
+// holding its manifest.
+const manifestSuffix = ".manifest.json"
+
+// stateManifest records the checksums of the artifacts stored for a state,
+// so that their integrity can be verified together.
+type stateManifest struct {
+	Version int `json:"version"`
+
+	// Artifacts maps the name of each artifact blob to its checksum.
+	Artifacts map[string]manifestArtifact `json:"artifacts"`
+}
+
+type manifestArtifact struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+func newManifestArtifact(data []byte) manifestArtifact {
+	sum := sha256.Sum256(data)
+	return manifestArtifact{
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   len(data),
+	}
+}
+
+// manifestName returns the name of the blob holding the manifest of the
+// client's state.
+func (c *RemoteClient) manifestName() string {
+	return c.keyName + manifestSuffix
+}
+
+// putManifest records the checksums of the state that was just written,
+// given as data.
+func (c *RemoteClient) putManifest(ctx context.Context, data []byte) error {
+	manifest := stateManifest{
+		Version: 1,
+		Artifacts: map[string]manifestArtifact{
+			c.keyName: newManifestArtifact(data),
+		},
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/json"
+	input := blobs.PutBlockBlobInput{
+		Content:     &content,
+		ContentType: &contentType,
+	}
+	if _, err := c.giovanniBlobClient.PutBlockBlob(ctx, c.accountName, c.containerName, c.manifestName(), input); err != nil {
+		return fmt.Errorf("error writing manifest Blob %q: %w", c.manifestName(), err)
+	}
+	return nil
+}
+
+// deleteManifest removes the manifest of the client's state, if any.
+func (c *RemoteClient) deleteManifest(ctx context.Context) error {
+	resp, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, c.manifestName(), blobs.DeleteInput{})
+	if err != nil && !resp.IsHTTPStatus(http.StatusNotFound) {
+		return fmt.Errorf("error deleting manifest Blob %q: %w", c.manifestName(), err)
+	}
+	return nil
+}
+
+// VerifyManifest checks the artifacts stored for the given workspace against
+// the checksums recorded in its manifest, as written when write_manifest is
+// enabled. It returns an error naming every artifact that is missing or
+// doesn't match.
+func (b *Backend) VerifyManifest(workspace string) error {
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return err
+	}
+	ctx, requestID, done := client.operationContext(context.TODO())
+	defer done()
+
+	manifestBlob, err := client.giovanniBlobClient.Get(ctx, client.accountName, client.containerName, client.manifestName(), blobs.GetInput{})
+	if err != nil {
+		if manifestBlob.Response.IsHTTPStatus(http.StatusNotFound) {
+			return fmt.Errorf("workspace %q has no manifest", workspace)
+		}
+		return client.operationError(err, requestID)
+	}
+
+	var manifest stateManifest
+	if err := json.Unmarshal(manifestBlob.Contents, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest Blob %q: %w", client.manifestName(), err)
+	}
+
+	names := make([]string, 0, len(manifest.Artifacts))
+	for name := range manifest.Artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mismatched []string
+	for _, name := range names {
+		blob, err := client.giovanniBlobClient.Get(ctx, client.accountName, client.containerName, name, blobs.GetInput{})
+		if err != nil {
+			if blob.Response.IsHTTPStatus(http.StatusNotFound) {
+				mismatched = append(mismatched, fmt.Sprintf("%s (missing)", name))
+				continue
+			}
+			return client.operationError(err, requestID)
+		}
+		if newManifestArtifact(blob.Contents) != manifest.Artifacts[name] {
+			mismatched = append(mismatched, fmt.Sprintf("%s (checksum mismatch)", name))
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("artifacts of workspace %q don't match its manifest: %v", workspace, mismatched)
+	}
+	return nil
+}
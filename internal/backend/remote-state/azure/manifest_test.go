@@ -0,0 +1,68 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackendWriteManifest(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"write_manifest": true,
+	})
+
+	client, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"version": 4, "serial": 1}`)
+	if err := client.Put(data); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := m.blob(mockContainerName, "test.tfstateenv:blue"+manifestSuffix)
+	if blob == nil {
+		t.Fatal("manifest was not written")
+	}
+	var manifest stateManifest
+	if err := json.Unmarshal(blob.content, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	want := map[string]manifestArtifact{
+		"test.tfstateenv:blue": {SHA256: hex.EncodeToString(sum[:]), Size: len(data)},
+	}
+	if diff := cmp.Diff(want, manifest.Artifacts); diff != "" {
+		t.Fatalf("unexpected manifest artifacts:\n%s", diff)
+	}
+
+	if err := b.VerifyManifest("blue"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifest must not be mistaken for a workspace
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "blue"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces:\n%s", diff)
+	}
+
+	// a state changed behind the manifest's back fails verification
+	m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"version": 4, "serial": 2}`), nil)
+	if err := b.VerifyManifest("blue"); err == nil || !strings.Contains(err.Error(), "test.tfstateenv:blue (checksum mismatch)") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
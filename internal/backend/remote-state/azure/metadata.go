@@ -0,0 +1,121 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// applyMetadataWorkers is how many workspaces ApplyMetadataToAll updates at
+// once.
+const applyMetadataWorkers = 8
+
+// ApplyMetadataToAll sets the given metadata on the state blob of every
+// workspace, keeping any other metadata the blobs have, for example when
+// governance requirements change. Each state is locked while it's updated,
+// and workspaces whose state doesn't exist yet are skipped. When updating a
+// workspace fails the others are still attempted, and the errors are
+// returned together.
+func (b *Backend) ApplyMetadataToAll(meta map[string]string) error {
+	if err := b.checkWritable("set the metadata of states"); err != nil {
+		return err
+	}
+	for key := range meta {
+		if strings.ToLower(key) == lockInfoMetaKey {
+			return fmt.Errorf("metadata key %q is reserved for the state lock", key)
+		}
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var result *multierror.Error
+	var wg sync.WaitGroup
+	names := make(chan string)
+	for i := 0; i < applyMetadataWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := b.applyMetadata(name, meta); err != nil {
+					mu.Lock()
+					result = multierror.Append(result, fmt.Errorf("failed to apply metadata to workspace %q: %w", name, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, name := range workspaces {
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+
+	return result.ErrorOrNil()
+}
+
+// applyMetadata sets the given metadata on the state blob of the named
+// workspace while holding its lock.
+func (b *Backend) applyMetadata(name string, meta map[string]string) error {
+	client, err := b.remoteClient(name)
+	if err != nil {
+		return err
+	}
+	ctx, requestID, done := client.operationContext(context.TODO())
+	defer done()
+
+	// locking creates the blob, so the state is checked for first
+	properties, err := client.giovanniBlobClient.GetProperties(ctx, client.accountName, client.containerName, client.keyName, blobs.GetPropertiesInput{})
+	if err != nil {
+		if properties.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil
+		}
+		return client.operationError(err, requestID)
+	}
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "metadata"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer client.Unlock(lockID)
+
+	properties, err = client.giovanniBlobClient.GetProperties(ctx, client.accountName, client.containerName, client.keyName, blobs.GetPropertiesInput{LeaseID: &client.leaseID})
+	if err != nil {
+		return client.operationError(err, requestID)
+	}
+	metaData := properties.MetaData
+	if metaData == nil {
+		metaData = map[string]string{}
+	}
+	for key, value := range meta {
+		metaData[strings.ToLower(key)] = value
+	}
+
+	input := blobs.SetMetaDataInput{
+		LeaseID:  &client.leaseID,
+		MetaData: metaData,
+	}
+	if resp, err := client.giovanniBlobClient.SetMetaData(ctx, client.accountName, client.containerName, client.keyName, input); err != nil {
+		if immutableErr := immutableBlobError(resp, client.keyName); immutableErr != nil {
+			return client.operationError(immutableErr, requestID)
+		}
+		return client.operationError(err, requestID)
+	}
+	return nil
+}
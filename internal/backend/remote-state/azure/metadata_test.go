@@ -0,0 +1,55 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackendApplyMetadataToAll(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	// more workspaces than workers, so that workers update several each
+	workspaces := []string{backend.DefaultStateName}
+	for i := 0; i < 2*applyMetadataWorkers; i++ {
+		workspaces = append(workspaces, fmt.Sprintf("ws%d", i))
+	}
+	for _, name := range workspaces {
+		m.putBlob(mockContainerName, b.path(name), []byte(`{"version": 4}`), map[string]string{"team": "infra"})
+	}
+
+	if err := b.ApplyMetadataToAll(map[string]string{"CostCenter": "1234"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range workspaces {
+		blob := m.blob(mockContainerName, b.path(name))
+		if got := blob.metadata["costcenter"]; got != "1234" {
+			t.Errorf("workspace %q has costcenter %q, want %q", name, got, "1234")
+		}
+		if got := blob.metadata["team"]; got != "infra" {
+			t.Errorf("workspace %q lost its existing metadata, team is %q", name, got)
+		}
+		if _, ok := blob.metadata[lockInfoMetaKey]; ok || blob.leaseID != "" {
+			t.Errorf("workspace %q is still locked", name)
+		}
+	}
+}
+
+func TestBackendApplyMetadataToAllReservedKey(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	err := b.ApplyMetadataToAll(map[string]string{"TerraformLockID": "x"})
+	if err == nil || !strings.Contains(err.Error(), "reserved for the state lock") {
+		t.Fatalf("expected the lock metadata key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// copyPollInterval is how often a server-side copy that's still pending is
+// checked on.
+const copyPollInterval = time.Second
+
+// KeyLayout describes how the state blobs of the workspaces are named, as
+// set by the key, workspace_key_prefix and workspace_key_separator options:
+// <Key>env:<workspace> without a WorkspaceKeyPrefix, and otherwise
+// <WorkspaceKeyPrefix><WorkspaceKeySeparator><workspace><WorkspaceKeySeparator><Key>.
+// The default workspace's state is named Key either way.
+type KeyLayout struct {
+	Key                   string
+	WorkspaceKeyPrefix    string
+	WorkspaceKeySeparator string
+}
+
+// KeyLayoutMigration reports the workspaces whose states MigrateKeyLayout
+// copied to their new names, and those it skipped as they were there
+// already, as they are when a migration is run again.
+type KeyLayoutMigration struct {
+	Migrated []string
+	Skipped  []string
+}
+
+// withKeyLayout returns a copy of the backend naming the state blobs of the
+// workspaces according to the given layout.
+func (b *Backend) withKeyLayout(layout KeyLayout) *Backend {
+	result := *b
+	result.keyName = layout.Key
+	result.workspaceKeyPrefix = layout.WorkspaceKeyPrefix
+	result.workspaceKeySeparator = layout.WorkspaceKeySeparator
+	if result.workspaceKeyPrefix != "" && result.workspaceKeySeparator == "" {
+		result.workspaceKeySeparator = "/"
+	}
+	return &result
+}
+
+// MigrateKeyLayout copies the state of each workspace stored with the from
+// layout to its name in the to layout, deleting the state it was copied from
+// when deleteOld is set. Each state is locked while it's copied, and the
+// copy is verified against it. States already copied are skipped, so a
+// migration that failed part of the way can be run again.
+func (b *Backend) MigrateKeyLayout(from, to KeyLayout, deleteOld bool) (*KeyLayoutMigration, error) {
+	if err := b.checkWritable("migrate states"); err != nil {
+		return nil, err
+	}
+	if from.Key == "" || to.Key == "" {
+		return nil, fmt.Errorf("the key of both layouts must be set")
+	}
+
+	source, destination := b.withKeyLayout(from), b.withKeyLayout(to)
+	workspaces, err := source.Workspaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the workspaces to migrate: %w", err)
+	}
+
+	result := &KeyLayoutMigration{}
+	for _, name := range workspaces {
+		client, err := source.remoteClient(name)
+		if err != nil {
+			return result, err
+		}
+		key := destination.path(name)
+		if key == client.keyName {
+			result.Skipped = append(result.Skipped, name)
+			continue
+		}
+		// the default workspace's state is listed whether it exists or not
+		if name == backend.DefaultStateName {
+			if _, err := client.giovanniBlobClient.GetProperties(context.TODO(), client.accountName, client.containerName, client.keyName, blobs.GetPropertiesInput{}); err != nil {
+				if !strings.Contains(err.Error(), "StatusCode=404") {
+					return result, fmt.Errorf("failed to read the state of workspace %q: %w", name, err)
+				}
+				result.Skipped = append(result.Skipped, name)
+				continue
+			}
+		}
+
+		migrated, err := client.MigrateTo(key, deleteOld)
+		if err != nil {
+			return result, fmt.Errorf("failed to migrate the state of workspace %q: %w", name, err)
+		}
+		if migrated {
+			result.Migrated = append(result.Migrated, name)
+		} else {
+			result.Skipped = append(result.Skipped, name)
+		}
+	}
+	return result, nil
+}
+
+// MigrateTo copies the state blob to the blob with the given name in the
+// same container, with a server-side copy, and verifies the copy. The state
+// is locked while it's copied. A blob already holding the same state is
+// left as is, and false returned, while one holding another state isn't
+// overwritten. When deleteSource is set, the state blob is deleted once the
+// copy is verified, along with its snapshots. The copy is only made if the
+// blob still doesn't exist, so one created meanwhile isn't overwritten.
+func (c *RemoteClient) MigrateTo(key string, deleteSource bool) (_ bool, err error) {
+	info := statemgr.NewLockInfo()
+	info.Operation = "migrate"
+	lockID, err := c.Lock(info)
+	if err != nil {
+		return false, err
+	}
+	locked := true
+	defer func() {
+		if locked {
+			if err := c.Unlock(lockID); err != nil {
+				log.Printf("[WARN] Failed to unlock state Blob %q after migrating it: %s", c.keyName, err)
+			}
+		}
+	}()
+
+	ctx, finish := c.withTimeout(context.TODO(), operationMigrate)
+	defer func() { err = finish(err) }()
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
+	defer func() {
+		if err != nil {
+			err = c.operationError(err, requestID)
+		}
+	}()
+
+	source, err := c.giovanniBlobClient.Get(ctx, c.accountName, c.containerName, c.keyName, blobs.GetInput{})
+	if err != nil {
+		return false, fmt.Errorf("error reading state Blob %q: %w", c.keyName, err)
+	}
+	properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{})
+	if err != nil {
+		return false, fmt.Errorf("error reading the properties of state Blob %q: %w", c.keyName, err)
+	}
+
+	migrated := false
+	existing, err := c.giovanniBlobClient.Get(ctx, c.accountName, c.containerName, key, blobs.GetInput{})
+	switch {
+	case err == nil && bytes.Equal(existing.Contents, source.Contents):
+		log.Printf("[DEBUG] Blob %q already holds state Blob %q, skipping it", key, c.keyName)
+	case err == nil:
+		return false, fmt.Errorf("Blob %q already exists and holds another state than Blob %q, refusing to overwrite it", key, c.keyName)
+	case !existing.Response.IsHTTPStatus(http.StatusNotFound):
+		return false, fmt.Errorf("error reading Blob %q: %w", key, err)
+	default:
+		if err := c.copyBlob(ctx, key, properties.MetaData); err != nil {
+			return false, err
+		}
+		copied, err := c.giovanniBlobClient.Get(ctx, c.accountName, c.containerName, key, blobs.GetInput{})
+		if err != nil {
+			return false, fmt.Errorf("error reading Blob %q to verify the copy of state Blob %q: %w", key, c.keyName, err)
+		}
+		if !bytes.Equal(copied.Contents, source.Contents) {
+			if _, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, key, blobs.DeleteInput{}); err != nil {
+				log.Printf("[WARN] Failed to delete the faulty copy %q of state Blob %q: %s", key, c.keyName, err)
+			}
+			return false, fmt.Errorf("the copy %q of state Blob %q doesn't match it", key, c.keyName)
+		}
+		migrated = true
+	}
+
+	if deleteSource {
+		options := blobs.DeleteInput{DeleteSnapshots: true}
+		if c.leaseID != "" {
+			options.LeaseID = &c.leaseID
+			c.stopHeartbeat()
+		}
+		if _, err := c.giovanniBlobClient.Delete(ctx, c.accountName, c.containerName, c.keyName, options); err != nil {
+			return migrated, fmt.Errorf("state Blob %q was copied to %q, but couldn't be deleted: %w", c.keyName, key, err)
+		}
+		// the lease went with the blob, while a lock blob is still to be
+		// removed
+		if c.leaseID != "" {
+			c.leaseID = ""
+			locked = false
+		}
+	}
+	return migrated, nil
+}
+
+// copyBlob copies the state blob to the blob with the given name with a
+// server-side copy, waiting for it to complete, unless that blob exists. The
+// copy gets the given metadata, without the lock info of the lock held while
+// copying.
+func (c *RemoteClient) copyBlob(ctx context.Context, key string, metadata map[string]string) error {
+	input := blobs.CopyInput{
+		CopySource: c.giovanniBlobClient.GetResourceID(c.accountName, c.containerName, c.keyName),
+		MetaData:   map[string]string{},
+	}
+	if c.sasToken != "" {
+		// the source isn't authorized by the token of the request itself
+		input.CopySource += "?" + c.sasToken
+	}
+	if c.leaseID != "" {
+		input.SourceLeaseID = &c.leaseID
+	}
+	for k, v := range metadata {
+		if k != lockInfoMetaKey {
+			input.MetaData[k] = v
+		}
+	}
+
+	// The storage SDK has no way to make a copy conditional, so the
+	// condition is added to the prepared request.
+	req, err := c.giovanniBlobClient.CopyPreparer(ctx, c.accountName, c.containerName, key, input)
+	if err != nil {
+		return fmt.Errorf("error preparing request to copy state Blob %q to %q: %w", c.keyName, key, err)
+	}
+	req.Header.Set("If-None-Match", "*")
+
+	// A conflict fails while sending already, as the sender checks every
+	// conflict for a missing resource provider registration.
+	resp, err := c.giovanniBlobClient.CopySender(req)
+	if resp != nil && (resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed) {
+		resp.Body.Close()
+		return fmt.Errorf("Blob %q was created while state Blob %q was being copied to it, refusing to overwrite it", key, c.keyName)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying state Blob %q to %q: %w", c.keyName, key, err)
+	}
+	if _, err := c.giovanniBlobClient.CopyResponder(resp); err != nil {
+		return fmt.Errorf("error copying state Blob %q to %q: %w", c.keyName, key, err)
+	}
+	// the response to the copy request doesn't tell how it went, so it's
+	// read from the properties of the copy
+	var status blobs.CopyStatus
+	for {
+		properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, key, blobs.GetPropertiesInput{})
+		if err != nil {
+			return fmt.Errorf("error checking on the copy of state Blob %q to %q: %w", c.keyName, key, err)
+		}
+		if status = properties.CopyStatus; status != blobs.Pending {
+			break
+		}
+		if err := sleepContext(ctx, copyPollInterval); err != nil {
+			return err
+		}
+	}
+	if status != blobs.Success {
+		return fmt.Errorf("copying state Blob %q to %q ended with status %q", c.keyName, key, status)
+	}
+	// without metadata of its own, the copy has the metadata of the blob,
+	// lock info included, which is removed
+	if len(input.MetaData) == 0 && len(metadata) > 0 {
+		if _, err := c.giovanniBlobClient.SetMetaData(ctx, c.accountName, c.containerName, key, blobs.SetMetaDataInput{}); err != nil {
+			return fmt.Errorf("error removing the lock info from the copy %q of state Blob %q: %w", key, c.keyName, err)
+		}
+	}
+	return nil
+}
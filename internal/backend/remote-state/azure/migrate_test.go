@@ -0,0 +1,128 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBackendMigrateKeyLayout(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	from := KeyLayout{Key: "test.tfstate"}
+	to := KeyLayout{Key: "test.tfstate", WorkspaceKeyPrefix: "envs"}
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"serial": 1}`), map[string]string{"team": "blue"})
+	m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"serial": 2}`), map[string]string{"team": "blue"})
+	m.putBlob(mockContainerName, "test.tfstateenv:green", []byte(`{"serial": 3}`), nil)
+
+	result, err := b.MigrateKeyLayout(from, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result.Migrated)
+	if want := []string{"blue", "green"}; !reflect.DeepEqual(result.Migrated, want) {
+		t.Fatalf("expected %v to be migrated, got %v", want, result.Migrated)
+	}
+	copied := m.blob(mockContainerName, "envs/blue/test.tfstate")
+	if copied == nil || string(copied.content) != `{"serial": 2}` {
+		t.Fatal("the state of blue wasn't copied")
+	}
+	if copied.metadata["team"] != "blue" {
+		t.Fatalf("expected the metadata to be copied, got %v", copied.metadata)
+	}
+	if _, ok := copied.metadata[lockInfoMetaKey]; ok {
+		t.Fatal("the lock info was copied")
+	}
+	for _, name := range []string{"test.tfstateenv:blue", "test.tfstateenv:green"} {
+		if blob := m.blob(mockContainerName, name); blob == nil || blob.leaseID != "" {
+			t.Fatalf("expected %q to be kept and unlocked", name)
+		}
+	}
+
+	// running it again skips what was migrated, and deletes the old states
+	result, err = b.MigrateKeyLayout(from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Migrated) != 0 || len(result.Skipped) != 3 {
+		t.Fatalf("expected everything to be skipped, got %+v", result)
+	}
+	for _, name := range []string{"test.tfstateenv:blue", "test.tfstateenv:green"} {
+		if m.blob(mockContainerName, name) != nil {
+			t.Fatalf("expected %q to be deleted", name)
+		}
+	}
+	if m.blob(mockContainerName, "test.tfstate") == nil {
+		t.Fatal("the state of the default workspace was deleted")
+	}
+}
+
+func TestBackendMigrateKeyLayoutConflict(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"serial": 2}`), nil)
+	m.putBlob(mockContainerName, "envs/blue/test.tfstate", []byte(`{"serial": 5}`), nil)
+
+	_, err := b.MigrateKeyLayout(KeyLayout{Key: "test.tfstate"}, KeyLayout{Key: "test.tfstate", WorkspaceKeyPrefix: "envs"}, true)
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite it") {
+		t.Fatalf("expected the migration to be refused, got %v", err)
+	}
+	if string(m.blob(mockContainerName, "envs/blue/test.tfstate").content) != `{"serial": 5}` {
+		t.Fatal("the existing state was overwritten")
+	}
+	if blob := m.blob(mockContainerName, "test.tfstateenv:blue"); blob == nil || blob.leaseID != "" {
+		t.Fatal("expected the old state to be kept and unlocked")
+	}
+}
+
+func TestBackendMigrateKeyLayoutDestinationCreated(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"serial": 2}`), nil)
+	// another process writes the destination after it was found missing,
+	// just before the copy is made
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodPut && r.Header.Get("x-ms-copy-source") != "" {
+			m.putBlob(mockContainerName, "envs/blue/test.tfstate", []byte(`{"serial": 5}`), nil)
+		}
+		return nil
+	}
+
+	_, err := b.MigrateKeyLayout(KeyLayout{Key: "test.tfstate"}, KeyLayout{Key: "test.tfstate", WorkspaceKeyPrefix: "envs"}, true)
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite it") {
+		t.Fatalf("expected the migration to be refused, got %v", err)
+	}
+	if string(m.blob(mockContainerName, "envs/blue/test.tfstate").content) != `{"serial": 5}` {
+		t.Fatal("the state written meanwhile was overwritten")
+	}
+	if blob := m.blob(mockContainerName, "test.tfstateenv:blue"); blob == nil || blob.leaseID != "" {
+		t.Fatal("expected the old state to be kept and unlocked")
+	}
+}
+
+func TestBackendMigrateKeyLayoutOperationTimeout(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"operation_timeout": "50ms",
+	})
+	m.putBlob(mockContainerName, "test.tfstateenv:blue", []byte(`{"serial": 2}`), nil)
+	// the copy never completes
+	m.intercept = func(r *http.Request) *http.Response {
+		if r.Method == http.MethodHead && strings.HasSuffix(r.URL.Path, "/envs/blue/test.tfstate") {
+			return mockResponse(http.StatusOK, http.Header{"X-Ms-Copy-Status": []string{"pending"}}, nil)
+		}
+		return nil
+	}
+
+	_, err := b.MigrateKeyLayout(KeyLayout{Key: "test.tfstate"}, KeyLayout{Key: "test.tfstate", WorkspaceKeyPrefix: "envs"}, false)
+	if err == nil || !strings.Contains(err.Error(), "exceeded operation_timeout") {
+		t.Fatalf("expected the migration to time out, got %v", err)
+	}
+}
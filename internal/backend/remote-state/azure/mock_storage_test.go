@@ -0,0 +1,975 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/encryption"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+const (
+	mockAccountName   = "mockaccount"
+	mockContainerName = "mockcontainer"
+	// Access Key must be Base64
+	mockAccessKey = "QUNDRVNTX0tFWQ0K"
+)
+
+// mockStorage is an in-memory fake of the subset of the Azure Blob Storage
+// REST API used by this backend. It is installed as the autorest.Sender of
+// the storage clients so that tests can run without an Azure account.
+type mockStorage struct {
+	mu sync.Mutex
+
+	containers map[string]map[string]*mockBlob
+	requests   []mockRequest
+	etag       int
+
+	// intercept, when set, is called for every request before it is
+	// handled. A non-nil response is returned to the client as is.
+	intercept func(r *http.Request) *http.Response
+
+	// pageSize, when set, is how many blobs a listing returns at most when
+	// the request doesn't say.
+	pageSize int
+
+	// versioning enables blob versioning, keeping a version of every write
+	// of a blob.
+	versioning bool
+
+	// softDelete enables blob soft delete, keeping the blobs and snapshots
+	// deleted, which are only listed when asked for.
+	softDelete bool
+}
+
+type mockBlob struct {
+	content      []byte
+	contentType  string
+	cacheControl string
+	metadata     map[string]string
+	leaseID      string
+	etag         string
+	lastModified time.Time
+	snapshots    []*mockSnapshot
+	versions     []*mockVersion
+	tags         map[string]string
+
+	// blocks lists the IDs of the committed blocks the content is made of,
+	// when it was written a block at a time, and uncommitted holds the
+	// blocks staged since.
+	blocks      []string
+	committed   map[string][]byte
+	uncommitted map[string][]byte
+
+	// deleted marks a blob that was soft deleted, which only remains to be
+	// listed along with its snapshots.
+	deleted bool
+
+	// archived marks a blob in the Archive tier, which can't be read until
+	// it's rehydrated. Once rehydration is requested, the blob is moved out
+	// of the tier after rehydrateChecks more property requests.
+	archived        bool
+	rehydrating     bool
+	rehydrateChecks int
+
+	// copyID is set on a blob written by a server-side copy, which the mock
+	// completes right away.
+	copyID string
+}
+
+type mockSnapshot struct {
+	timestamp string
+	content   []byte
+	metadata  map[string]string
+	deleted   bool
+}
+
+type mockVersion struct {
+	id           string
+	content      []byte
+	lastModified time.Time
+}
+
+// mockRequest records the interesting parts of a request the mock received.
+type mockRequest struct {
+	Method string
+	Blob   string
+	Comp   string
+	Header http.Header
+}
+
+func newMockStorage() *mockStorage {
+	return &mockStorage{
+		containers: map[string]map[string]*mockBlob{
+			mockContainerName: {},
+		},
+	}
+}
+
+// testBackendWithMockStorage configures a Backend that talks to the given
+// mockStorage, merging extra into the default configuration.
+func testBackendWithMockStorage(t *testing.T, m *mockStorage, extra map[string]interface{}) *Backend {
+	t.Helper()
+
+	b, diags := configureBackendWithMockStorage(t, m, extra)
+	if diags.HasErrors() {
+		t.Fatal(diags.ErrWithWarnings())
+	}
+	return b
+}
+
+// skipThrottleWaits makes the clients the backend builds from then on retry
+// the requests the mock throttles without waiting.
+func skipThrottleWaits(b *Backend) {
+	b.armClient.throttleRetry.sleep = func(ctx context.Context, d time.Duration) error {
+		return ctx.Err()
+	}
+}
+
+// configureBackendWithMockStorage is like testBackendWithMockStorage, but
+// returns the diagnostics from configuring the backend rather than failing
+// the test, for tests that expect configuration to fail.
+func configureBackendWithMockStorage(t *testing.T, m *mockStorage, extra map[string]interface{}) (*Backend, tfdiags.Diagnostics) {
+	t.Helper()
+	return configureBackendWithEncryption(t, m, encryption.StateEncryptionDisabled(), extra)
+}
+
+// configureBackendWithEncryption is like configureBackendWithMockStorage,
+// with the given state encryption.
+func configureBackendWithEncryption(t *testing.T, m *mockStorage, enc encryption.StateEncryption, extra map[string]interface{}) (*Backend, tfdiags.Diagnostics) {
+	t.Helper()
+
+	config := map[string]interface{}{
+		"storage_account_name": mockAccountName,
+		"container_name":       mockContainerName,
+		"key":                  "test.tfstate",
+		"access_key":           mockAccessKey,
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+
+	b := New(enc).(*Backend)
+	b.sender = m
+
+	body := backend.TestWrapConfig(config)
+	obj, decDiags := hcldec.Decode(body, b.ConfigSchema().DecoderSpec(), nil)
+	if decDiags.HasErrors() {
+		t.Fatal(decDiags.Error())
+	}
+
+	obj, diags := b.PrepareConfig(obj)
+	if diags.HasErrors() {
+		return b, diags
+	}
+	return b, diags.Append(b.Configure(obj))
+}
+
+// putBlob seeds the mock with a blob, bypassing the client.
+func (m *mockStorage) putBlob(container, name string, content []byte, metadata map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	m.containers[container][name] = &mockBlob{
+		content:      content,
+		contentType:  "application/json",
+		metadata:     metadata,
+		etag:         m.nextETag(),
+		lastModified: time.Now().UTC(),
+	}
+}
+
+// putSnapshot seeds an existing blob in the mock with a snapshot taken at
+// the given timestamp, bypassing the client.
+func (m *mockStorage) putSnapshot(container, name, timestamp string, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blob := m.containers[container][name]
+	blob.snapshots = append(blob.snapshots, &mockSnapshot{
+		timestamp: timestamp,
+		content:   content,
+		metadata:  map[string]string{},
+	})
+}
+
+// deleteBlob deletes an existing blob in the mock along with its snapshots,
+// as happens when it's deleted outside of OpenTofu, bypassing the client.
+func (m *mockStorage) deleteBlob(container, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeBlob(m.containers[container], name)
+}
+
+// removeBlob deletes a blob along with its snapshots, which are kept as
+// soft deleted if soft delete is enabled.
+func (m *mockStorage) removeBlob(container map[string]*mockBlob, name string) {
+	if !m.softDelete {
+		delete(container, name)
+		return
+	}
+	blob := container[name]
+	blob.deleted = true
+	for _, snapshot := range blob.snapshots {
+		snapshot.deleted = true
+	}
+}
+
+// archiveBlob moves an existing blob in the mock to the Archive tier, from
+// which it's rehydrated after the given number of property requests once
+// rehydration is requested.
+func (m *mockStorage) archiveBlob(container, name string, rehydrateChecks int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blob := m.containers[container][name]
+	blob.archived = true
+	blob.rehydrateChecks = rehydrateChecks
+}
+
+// breakLease removes the lease held on a blob in the mock, as happens when
+// it's broken by another process or lost in a storage incident.
+func (m *mockStorage) breakLease(container, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.containers[container][name].leaseID = ""
+}
+
+// blob returns the named blob from the mock, or nil if it doesn't exist.
+func (m *mockStorage) blob(container, name string) *mockBlob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.containers[container][name]
+}
+
+// requestCount returns how many requests matched the given method and comp
+// query parameter. An empty comp only matches requests without one.
+func (m *mockStorage) requestCount(method, comp string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, r := range m.requests {
+		if r.Method == method && r.Comp == comp {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *mockStorage) nextETag() string {
+	m.etag++
+	return fmt.Sprintf("\"0x%X\"", m.etag)
+}
+
+func (m *mockStorage) Do(r *http.Request) (*http.Response, error) {
+	if resp := checkSharedKey(r); resp != nil {
+		resp.Request = r
+		return resp, nil
+	}
+	if m.intercept != nil {
+		if resp := m.intercept(r); resp != nil {
+			// as a real transport does, a request whose context ended
+			// while it was in flight fails rather than being answered
+			if err := r.Context().Err(); err != nil {
+				return nil, err
+			}
+			resp.Request = r
+			return resp, nil
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Paths are /{container} or /{container}/{blob}; blob names may
+	// themselves contain slashes.
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	containerName, blobName, _ := strings.Cut(path, "/")
+	query := r.URL.Query()
+
+	m.requests = append(m.requests, mockRequest{
+		Method: r.Method,
+		Blob:   blobName,
+		Comp:   query.Get("comp"),
+		Header: r.Header.Clone(),
+	})
+
+	var resp *http.Response
+	if blobName == "" {
+		resp = m.handleContainer(r, containerName)
+	} else {
+		resp = m.handleBlob(r, containerName, blobName)
+	}
+	resp.Request = r
+	return resp, nil
+}
+
+func (m *mockStorage) handleContainer(r *http.Request, containerName string) *http.Response {
+	query := r.URL.Query()
+	container, ok := m.containers[containerName]
+
+	switch {
+	case r.Method == http.MethodPut && query.Get("restype") == "container":
+		if ok {
+			return mockError(http.StatusConflict, "ContainerAlreadyExists", "The specified container already exists.")
+		}
+		m.containers[containerName] = map[string]*mockBlob{}
+		return mockResponse(http.StatusCreated, nil, nil)
+	case !ok:
+		return mockError(http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		if strings.Contains(query.Get("include"), "versions") && !supportsVersions(r) {
+			return mockError(http.StatusBadRequest, "InvalidQueryParameterValue", "Value for one of the query parameters specified in the request URI is invalid.")
+		}
+		return m.listBlobs(container, query, strings.Contains(query.Get("include"), "snapshots"))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return mockResponse(http.StatusOK, nil, nil)
+	}
+
+	return mockError(http.StatusBadRequest, "UnsupportedHttpVerb", "The mock does not support this container operation.")
+}
+
+type mockListBlobsResult struct {
+	XMLName    xml.Name       `xml:"EnumerationResults"`
+	Prefix     string         `xml:"Prefix"`
+	Blobs      []mockListBlob `xml:"Blobs>Blob"`
+	NextMarker string         `xml:"NextMarker,omitempty"`
+}
+
+type mockListBlob struct {
+	Name             string           `xml:"Name"`
+	Snapshot         string           `xml:"Snapshot,omitempty"`
+	Deleted          bool             `xml:"Deleted,omitempty"`
+	VersionID        string           `xml:"VersionId,omitempty"`
+	IsCurrentVersion bool             `xml:"IsCurrentVersion,omitempty"`
+	LastModified     string           `xml:"Properties>Last-Modified,omitempty"`
+	Metadata         mockListMetadata `xml:"Metadata,omitempty"`
+}
+
+// mockListMetadata is the metadata of a listed blob, written as an element
+// per key as the Blob service does.
+type mockListMetadata map[string]string
+
+func (m mockListMetadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := e.EncodeElement(m[k], xml.StartElement{Name: xml.Name{Local: k}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// listBlobs lists the blobs matching the prefix query parameter. A page of
+// at most maxresults blobs is returned if that's set, with the name of the
+// first blob of the next page as its marker.
+func (m *mockStorage) listBlobs(container map[string]*mockBlob, query url.Values, includeSnapshots bool) *http.Response {
+	prefix, marker := query.Get("prefix"), query.Get("marker")
+	names := make([]string, 0, len(container))
+	for name := range container {
+		if strings.HasPrefix(name, prefix) && name >= marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := mockListBlobsResult{Prefix: prefix}
+	limit, err := strconv.Atoi(query.Get("maxresults"))
+	if err != nil && m.pageSize > 0 {
+		limit, err = m.pageSize, nil
+	}
+	if err == nil && limit < len(names) {
+		result.NextMarker = names[limit]
+		names = names[:limit]
+	}
+	includeDeleted := strings.Contains(query.Get("include"), "deleted")
+	for _, name := range names {
+		if includeSnapshots {
+			for _, snapshot := range container[name].snapshots {
+				if snapshot.deleted && !includeDeleted {
+					continue
+				}
+				result.Blobs = append(result.Blobs, mockListBlob{Name: name, Snapshot: snapshot.timestamp, Deleted: snapshot.deleted})
+			}
+		}
+		if versions := container[name].versions; strings.Contains(query.Get("include"), "versions") && len(versions) > 0 {
+			for i, version := range versions {
+				result.Blobs = append(result.Blobs, mockListBlob{
+					Name:             name,
+					VersionID:        version.id,
+					IsCurrentVersion: i == len(versions)-1 && !container[name].deleted,
+					LastModified:     version.lastModified.Format(http.TimeFormat),
+				})
+			}
+			continue
+		}
+		if container[name].deleted && includeDeleted {
+			result.Blobs = append(result.Blobs, mockListBlob{Name: name, Deleted: true})
+		}
+		if !container[name].deleted {
+			blob := mockListBlob{Name: name}
+			if strings.Contains(query.Get("include"), "metadata") {
+				blob.Metadata = container[name].metadata
+			}
+			result.Blobs = append(result.Blobs, blob)
+		}
+	}
+
+	body, err := xml.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	return mockResponse(http.StatusOK, header, body)
+}
+
+func (m *mockStorage) handleBlob(r *http.Request, containerName, blobName string) *http.Response {
+	container, ok := m.containers[containerName]
+	if !ok {
+		return mockError(http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+	}
+
+	query := r.URL.Query()
+	blob := container[blobName]
+	leaseID := r.Header.Get(leaseHeader)
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		if blob == nil || (blob.deleted && query.Get("snapshot") == "") {
+			return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		}
+		if query.Get("comp") == "tags" {
+			if !supportsVersions(r) {
+				return mockError(http.StatusBadRequest, "InvalidQueryParameterValue", "Value for one of the query parameters specified in the request URI is invalid.")
+			}
+			return blob.getTags()
+		}
+		if query.Get("comp") == "blocklist" {
+			return blob.getBlockList()
+		}
+		if blob.archived && blob.rehydrating && r.Method == http.MethodHead {
+			blob.rehydrateChecks--
+			if blob.rehydrateChecks <= 0 {
+				blob.archived, blob.rehydrating = false, false
+			}
+		}
+		if blob.archived && r.Method == http.MethodGet {
+			return mockError(http.StatusConflict, "BlobArchived", "This operation is not permitted on an archived blob.")
+		}
+		content, metadata := blob.content, blob.metadata
+		if ts := query.Get("snapshot"); ts != "" {
+			snapshot := blob.snapshot(ts)
+			if snapshot == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			content, metadata = snapshot.content, snapshot.metadata
+		}
+		if id := query.Get("versionid"); id != "" {
+			if !supportsVersions(r) {
+				return mockError(http.StatusBadRequest, "InvalidQueryParameterValue", "Value for one of the query parameters specified in the request URI is invalid.")
+			}
+			version := blob.version(id)
+			if version == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			content = version.content
+		}
+		header := blob.header(metadata)
+		if etag := r.Header.Get("If-None-Match"); etag != "" && etag == blob.etag && query.Get("snapshot") == "" {
+			return mockResponse(http.StatusNotModified, header, nil)
+		}
+		header.Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodHead {
+			return mockResponse(http.StatusOK, header, nil)
+		}
+		return mockResponse(http.StatusOK, header, content)
+
+	case http.MethodDelete:
+		if blob == nil {
+			return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		}
+		if ts := query.Get("snapshot"); ts != "" {
+			// a soft-deleted snapshot can only be deleted permanently
+			permanent := query.Get("deletetype") == "permanent" && r.Header.Get("x-ms-version") >= "2020-02-10"
+			for i, snapshot := range blob.snapshots {
+				if snapshot.timestamp != ts || snapshot.deleted != permanent {
+					continue
+				}
+				if m.softDelete && !permanent {
+					snapshot.deleted = true
+				} else {
+					blob.snapshots = append(blob.snapshots[:i], blob.snapshots[i+1:]...)
+				}
+				return mockResponse(http.StatusAccepted, nil, nil)
+			}
+			return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		}
+		if blob.deleted {
+			return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		}
+		if resp := blob.checkLease(leaseID); resp != nil {
+			return resp
+		}
+		if len(blob.snapshots) > 0 && r.Header.Get("x-ms-delete-snapshots") != "include" {
+			return mockError(http.StatusConflict, "SnapshotsPresent", "This operation is not permitted because the blob has snapshots.")
+		}
+		m.removeBlob(container, blobName)
+		return mockResponse(http.StatusAccepted, nil, nil)
+
+	case http.MethodPut:
+		if blob != nil && blob.deleted {
+			blob = nil
+		}
+		if source := r.Header.Get("x-ms-copy-source"); source != "" && query.Get("comp") == "" {
+			return m.copyBlob(r, source, container, blobName)
+		}
+		switch comp := query.Get("comp"); comp {
+		case "block":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			if resp := blob.checkLease(leaseID); resp != nil {
+				return resp
+			}
+			content, err := io.ReadAll(r.Body)
+			if err != nil {
+				panic(err)
+			}
+			if blob.uncommitted == nil {
+				blob.uncommitted = map[string][]byte{}
+			}
+			blob.uncommitted[query.Get("blockid")] = content
+			return mockResponse(http.StatusCreated, nil, nil)
+
+		case "", "blocklist":
+			if blob != nil && r.Header.Get("If-None-Match") == "*" {
+				return mockError(http.StatusConflict, "BlobAlreadyExists", "The specified blob already exists.")
+			}
+			if blob != nil {
+				if resp := blob.checkLease(leaseID); resp != nil {
+					return resp
+				}
+			}
+			if etag := r.Header.Get("If-Match"); etag != "" && (blob == nil || blob.etag != etag) {
+				return mockError(http.StatusPreconditionFailed, "ConditionNotMet", "The condition specified using HTTP conditional header(s) is not met.")
+			}
+			if blob == nil {
+				blob = &mockBlob{}
+				container[blobName] = blob
+			}
+			var content []byte
+			if r.Body != nil {
+				var err error
+				if content, err = io.ReadAll(r.Body); err != nil {
+					panic(err)
+				}
+			}
+			if comp == "blocklist" {
+				var ok bool
+				if content, ok = blob.commitBlocks(content); !ok {
+					return mockError(http.StatusBadRequest, "InvalidBlockList", "The specified block list is invalid.")
+				}
+			} else {
+				blob.blocks, blob.committed, blob.uncommitted = nil, nil, nil
+			}
+			blob.content = content
+			blob.copyID = ""
+			blob.contentType = r.Header.Get("x-ms-blob-content-type")
+			blob.cacheControl = r.Header.Get("x-ms-blob-cache-control")
+			blob.metadata = metadataFromHeader(r.Header)
+			blob.etag = m.nextETag()
+			blob.lastModified = time.Now().UTC()
+			header := http.Header{"Etag": {blob.etag}}
+			if m.versioning {
+				// the ETag counter keeps version IDs unique within a second
+				id := fmt.Sprintf("%s.%07dZ", blob.lastModified.Format("2006-01-02T15:04:05"), m.etag)
+				blob.versions = append(blob.versions, &mockVersion{id: id, content: content, lastModified: blob.lastModified})
+				header.Set("x-ms-version-id", id)
+			}
+			return mockResponse(http.StatusCreated, header, nil)
+
+		case "metadata":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			if resp := blob.checkLease(leaseID); resp != nil {
+				return resp
+			}
+			blob.metadata = metadataFromHeader(r.Header)
+			blob.etag = m.nextETag()
+			return mockResponse(http.StatusOK, http.Header{"Etag": {blob.etag}}, nil)
+
+		case "tags":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			if !supportsVersions(r) {
+				return mockError(http.StatusBadRequest, "InvalidQueryParameterValue", "Value for one of the query parameters specified in the request URI is invalid.")
+			}
+			return blob.setTags(r)
+
+		case "snapshot":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			// Azure gives each snapshot of a blob a later timestamp than
+			// the one before, even when they're taken in quick succession.
+			taken := time.Now().UTC()
+			if n := len(blob.snapshots); n > 0 {
+				if last, err := time.Parse(time.RFC3339Nano, blob.snapshots[n-1].timestamp); err == nil && !taken.After(last) {
+					taken = last.Add(100 * time.Nanosecond)
+				}
+			}
+			timestamp := taken.Format("2006-01-02T15:04:05.0000000Z")
+			blob.snapshots = append(blob.snapshots, &mockSnapshot{
+				timestamp: timestamp,
+				content:   blob.content,
+				metadata:  blob.metadata,
+			})
+			return mockResponse(http.StatusCreated, http.Header{"X-Ms-Snapshot": {timestamp}}, nil)
+
+		case "tier":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			if blob.rehydrating {
+				return mockError(http.StatusConflict, "BlobBeingRehydrated", "This operation is not permitted because the blob is being rehydrated.")
+			}
+			if !blob.archived {
+				return mockResponse(http.StatusOK, nil, nil)
+			}
+			blob.rehydrating = true
+			return mockResponse(http.StatusAccepted, nil, nil)
+
+		case "lease":
+			if blob == nil {
+				return mockError(http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			}
+			return blob.handleLease(r)
+		}
+	}
+
+	return mockError(http.StatusBadRequest, "UnsupportedHttpVerb", "The mock does not support this blob operation.")
+}
+
+// copyBlob copies the blob named by the source URL to the named blob of the
+// container, completing the copy right away. The copy gets the metadata of
+// the request, or that of the source blob when the request has none.
+func (m *mockStorage) copyBlob(r *http.Request, source string, container map[string]*mockBlob, blobName string) *http.Response {
+	u, err := url.Parse(source)
+	if err != nil {
+		return mockError(http.StatusBadRequest, "InvalidHeaderValue", "The value for one of the HTTP headers is not in the correct format.")
+	}
+	sourceContainer, sourceName, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	sourceBlob := m.containers[sourceContainer][sourceName]
+	if sourceBlob == nil || sourceBlob.deleted {
+		return mockError(http.StatusNotFound, "CannotVerifyCopySource", "The specified blob does not exist.")
+	}
+	if leaseID := r.Header.Get("x-ms-source-lease-id"); leaseID != "" && leaseID != sourceBlob.leaseID {
+		return mockError(http.StatusPreconditionFailed, "SourceConditionNotMet", "The source condition specified using HTTP conditional header(s) is not met.")
+	}
+	if blob := container[blobName]; blob != nil && !blob.deleted {
+		if r.Header.Get("If-None-Match") == "*" {
+			return mockError(http.StatusConflict, "BlobAlreadyExists", "The specified blob already exists.")
+		}
+		if resp := blob.checkLease(r.Header.Get(leaseHeader)); resp != nil {
+			return resp
+		}
+	}
+
+	metadata := metadataFromHeader(r.Header)
+	if len(metadata) == 0 {
+		metadata = sourceBlob.metadata
+	}
+	blob := &mockBlob{
+		content:      sourceBlob.content,
+		contentType:  sourceBlob.contentType,
+		cacheControl: sourceBlob.cacheControl,
+		metadata:     metadata,
+		etag:         m.nextETag(),
+		lastModified: time.Now().UTC(),
+		copyID:       fmt.Sprintf("copy-%d", m.etag),
+	}
+	container[blobName] = blob
+	return mockResponse(http.StatusAccepted, http.Header{
+		"Etag":             {blob.etag},
+		"X-Ms-Copy-Id":     {blob.copyID},
+		"X-Ms-Copy-Status": {"success"},
+	}, nil)
+}
+
+func (b *mockBlob) snapshot(timestamp string) *mockSnapshot {
+	for _, snapshot := range b.snapshots {
+		if snapshot.timestamp == timestamp && !snapshot.deleted {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// commitBlocks replaces the blocks of the blob with those of the block list
+// body, returning the content they make up, or false if one of them isn't
+// there.
+func (b *mockBlob) commitBlocks(body []byte) ([]byte, bool) {
+	var list struct {
+		IDs []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal(body, &list); err != nil {
+		return nil, false
+	}
+	var content []byte
+	var ids []string
+	committed := map[string][]byte{}
+	for _, id := range list.IDs {
+		data, ok := b.uncommitted[id.Value]
+		switch id.XMLName.Local {
+		case "Committed":
+			data, ok = b.committed[id.Value]
+		case "Latest":
+			if !ok {
+				data, ok = b.committed[id.Value]
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		content = append(content, data...)
+		ids = append(ids, id.Value)
+		committed[id.Value] = data
+	}
+	b.blocks, b.committed, b.uncommitted = ids, committed, nil
+	return content, true
+}
+
+func (b *mockBlob) getBlockList() *http.Response {
+	type block struct {
+		Name string `xml:"Name"`
+		Size int    `xml:"Size"`
+	}
+	var list struct {
+		XMLName   xml.Name `xml:"BlockList"`
+		Committed []block  `xml:"CommittedBlocks>Block"`
+	}
+	for _, id := range b.blocks {
+		list.Committed = append(list.Committed, block{Name: id, Size: len(b.committed[id])})
+	}
+	body, err := xml.Marshal(list)
+	if err != nil {
+		panic(err)
+	}
+	return mockResponse(http.StatusOK, http.Header{"Etag": {b.etag}, "Content-Type": {"application/xml"}}, body)
+}
+
+func (b *mockBlob) getTags() *http.Response {
+	var tagSet blobTagSet
+	for k, v := range b.tags {
+		tagSet.Tags = append(tagSet.Tags, blobTag{Key: k, Value: v})
+	}
+	body, err := xml.Marshal(tagSet)
+	if err != nil {
+		panic(err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	return mockResponse(http.StatusOK, header, body)
+}
+
+// setTags replaces the blob's index tags. Like in Azure, it doesn't change
+// the blob's ETag.
+func (b *mockBlob) setTags(r *http.Request) *http.Response {
+	var tagSet blobTagSet
+	if err := xml.NewDecoder(r.Body).Decode(&tagSet); err != nil {
+		return mockError(http.StatusBadRequest, "InvalidXmlDocument", "XML specified is not syntactically valid.")
+	}
+	b.tags = map[string]string{}
+	for _, tag := range tagSet.Tags {
+		b.tags[tag.Key] = tag.Value
+	}
+	return mockResponse(http.StatusNoContent, nil, nil)
+}
+
+func (b *mockBlob) version(id string) *mockVersion {
+	for _, version := range b.versions {
+		if version.id == id {
+			return version
+		}
+	}
+	return nil
+}
+
+// supportsVersions reports whether the request uses a version of the Blob
+// service API with blob versions.
+func supportsVersions(r *http.Request) bool {
+	return r.Header.Get("x-ms-version") >= "2019-12-12"
+}
+
+func (b *mockBlob) header(metadata map[string]string) http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", b.contentType)
+	if b.cacheControl != "" {
+		header.Set("Cache-Control", b.cacheControl)
+	}
+	header.Set("Etag", b.etag)
+	header.Set("Last-Modified", b.lastModified.Format(http.TimeFormat))
+	header.Set("x-ms-blob-type", "BlockBlob")
+	if b.archived {
+		header.Set("x-ms-access-tier", "Archive")
+	} else {
+		header.Set("x-ms-access-tier", "Hot")
+	}
+	if b.leaseID != "" {
+		header.Set("x-ms-lease-status", "locked")
+		header.Set("x-ms-lease-state", "leased")
+		header.Set("x-ms-lease-duration", "infinite")
+	} else {
+		header.Set("x-ms-lease-status", "unlocked")
+		header.Set("x-ms-lease-state", "available")
+	}
+	if b.copyID != "" {
+		header.Set("x-ms-copy-id", b.copyID)
+		header.Set("x-ms-copy-status", "success")
+	}
+	for k, v := range metadata {
+		header.Set("x-ms-meta-"+k, v)
+	}
+	return header
+}
+
+// checkLease mirrors the service's validation of the lease ID supplied with
+// a write against the lease currently held on the blob.
+func (b *mockBlob) checkLease(leaseID string) *http.Response {
+	switch {
+	case b.leaseID == "" && leaseID != "":
+		return mockError(http.StatusPreconditionFailed, "LeaseNotPresentWithBlobOperation", "There is currently no lease on the blob.")
+	case b.leaseID != "" && leaseID == "":
+		return mockError(http.StatusPreconditionFailed, "LeaseIdMissing", "There is currently a lease on the blob and no lease ID was specified in the request.")
+	case b.leaseID != leaseID:
+		return mockError(http.StatusPreconditionFailed, "LeaseIdMismatchWithBlobOperation", "The lease ID specified did not match the lease ID for the blob.")
+	}
+	return nil
+}
+
+func (b *mockBlob) handleLease(r *http.Request) *http.Response {
+	leaseID := r.Header.Get(leaseHeader)
+
+	switch r.Header.Get("x-ms-lease-action") {
+	case "acquire":
+		if b.leaseID != "" {
+			return mockError(http.StatusConflict, "LeaseAlreadyPresent", "There is already a lease present.")
+		}
+		b.leaseID = r.Header.Get("x-ms-proposed-lease-id")
+		return mockResponse(http.StatusCreated, http.Header{"X-Ms-Lease-Id": {b.leaseID}}, nil)
+	case "renew":
+		if b.leaseID == "" || b.leaseID != leaseID {
+			return mockError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation", "The lease ID specified did not match the lease ID for the blob.")
+		}
+		return mockResponse(http.StatusOK, http.Header{"X-Ms-Lease-Id": {b.leaseID}}, nil)
+	case "release":
+		if b.leaseID == "" || b.leaseID != leaseID {
+			return mockError(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation", "The lease ID specified did not match the lease ID for the blob.")
+		}
+		b.leaseID = ""
+		return mockResponse(http.StatusOK, nil, nil)
+	case "break":
+		b.leaseID = ""
+		return mockResponse(http.StatusAccepted, http.Header{"X-Ms-Lease-Time": {"0"}}, nil)
+	}
+
+	return mockError(http.StatusBadRequest, "InvalidHeaderValue", "The value for the x-ms-lease-action header is not valid.")
+}
+
+func metadataFromHeader(header http.Header) map[string]string {
+	metadata := map[string]string{}
+	for k, v := range header {
+		key := strings.ToLower(k)
+		if strings.HasPrefix(key, "x-ms-meta-") {
+			metadata[strings.TrimPrefix(key, "x-ms-meta-")] = v[0]
+		}
+	}
+	return metadata
+}
+
+func mockResponse(status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// checkSharedKey returns an error response, as Azure does, if the request
+// is authorized with a Shared Key signature that doesn't match the request
+// as it was sent, as happens when a request is changed after being signed.
+func checkSharedKey(r *http.Request) *http.Response {
+	got := r.Header.Get("Authorization")
+	if !strings.HasPrefix(got, "SharedKey ") {
+		return nil
+	}
+
+	auth, err := autorest.NewSharedKeyAuthorizer(mockAccountName, mockAccessKey, autorest.SharedKey)
+	if err != nil {
+		panic(err)
+	}
+	signed := r.Clone(context.Background())
+	signed.Header.Del("Authorization")
+	signed, err = autorest.Prepare(signed, auth.WithAuthorization())
+	if err != nil {
+		panic(err)
+	}
+	if want := signed.Header.Get("Authorization"); got != want {
+		return mockError(http.StatusForbidden, "AuthenticationFailed", "The MAC signature found in the HTTP request is not the same as any computed signature.")
+	}
+	return nil
+}
+
+// mockError builds a response in the shape of a Blob Storage service error.
+func mockError(status int, code, message string) *http.Response {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	header.Set("x-ms-error-code", code)
+	return mockResponse(status, header, []byte(body))
+}
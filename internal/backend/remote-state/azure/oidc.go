@@ -0,0 +1,165 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-azure-helpers/authentication"
+	authWrapper "github.com/manicminer/hamilton-autorest/auth"
+	"github.com/manicminer/hamilton/auth"
+	"github.com/manicminer/hamilton/environments"
+	"golang.org/x/oauth2"
+)
+
+// federatedTokenFileAuthorizer obtains Azure AD tokens with the federated
+// token in a file, reading the file again each time a token is obtained.
+// Projected tokens, such as those of Azure Workload Identity in Kubernetes,
+// are rotated in place and expire after an hour, so a token read once at
+// initialization can't be used to refresh the Azure AD token for a run that
+// outlives it.
+type federatedTokenFileAuthorizer struct {
+	ctx  context.Context
+	path string
+
+	// audience, when set, must be an audience of the token in the file.
+	audience string
+
+	// config is copied for each token, with the token read from the file as
+	// its federated assertion.
+	config auth.ClientCredentialsConfig
+}
+
+var _ auth.Authorizer = (*federatedTokenFileAuthorizer)(nil)
+
+func (a *federatedTokenFileAuthorizer) Token() (*oauth2.Token, error) {
+	source, err := a.source()
+	if err != nil {
+		return nil, err
+	}
+	return source.Token()
+}
+
+func (a *federatedTokenFileAuthorizer) AuxiliaryTokens() ([]*oauth2.Token, error) {
+	source, err := a.source()
+	if err != nil {
+		return nil, err
+	}
+	return source.AuxiliaryTokens()
+}
+
+// source returns a token source for the token currently in the file.
+func (a *federatedTokenFileAuthorizer) source() (auth.Authorizer, error) {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading OIDC token file %q: %w", a.path, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("OIDC token file %q is empty", a.path)
+	}
+	// a rotated token may have been issued for another audience
+	if err := checkOIDCTokenAudience(token, a.audience); err != nil {
+		return nil, fmt.Errorf("OIDC token file %q: %w", a.path, err)
+	}
+
+	config := a.config
+	config.FederatedAssertion = token
+	return config.TokenSource(a.ctx, auth.ClientCredentialsAssertionType), nil
+}
+
+// useFederatedTokenFile returns whether the Azure AD tokens are to be
+// obtained with the OIDC token file, rather than by armConfig itself, which
+// only ever reads the file once.
+func useFederatedTokenFile(config BackendConfig, armConfig *authentication.Config) bool {
+	// A token given directly as well is compared with the file's by
+	// armConfig, which fails once the file is rotated, but that's what was
+	// asked for.
+	return armConfig.AuthenticatedViaOIDC && config.OIDCTokenFilePath != "" && config.OIDCToken == ""
+}
+
+// federatedTokenFileAuth returns an authorizer for the given API using the
+// OIDC token file, caching each token until it expires.
+func federatedTokenFileAuth(ctx context.Context, config BackendConfig, armConfig *authentication.Config, env environments.Environment, api environments.Api) autorest.Authorizer {
+	source := &federatedTokenFileAuthorizer{
+		ctx:      ctx,
+		path:     config.OIDCTokenFilePath,
+		audience: config.OIDCAudience,
+		config: auth.ClientCredentialsConfig{
+			Environment:        env,
+			TenantID:           armConfig.TenantID,
+			AuxiliaryTenantIDs: armConfig.AuxiliaryTenantIDs,
+			ClientID:           armConfig.ClientID,
+			Scopes:             []string{api.DefaultScope()},
+			TokenVersion:       auth.TokenVersion2,
+		},
+	}
+	return &authWrapper.Authorizer{Authorizer: auth.NewCachedAuthorizer(source)}
+}
+
+// oidcRequestURLWithAudience returns the URL to request an ID token from,
+// asking for one issued for the given audience. Without one, the token is
+// requested for api://AzureADTokenExchange, the audience Azure AD expects by
+// default, unless the URL asks for an audience itself.
+func oidcRequestURLWithAudience(requestURL, audience string) (string, error) {
+	if requestURL == "" || audience == "" {
+		return requestURL, nil
+	}
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid oidc_request_url: %w", err)
+	}
+	query := u.Query()
+	query.Set("audience", audience)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// checkOIDCTokenAudience returns an error if the OIDC token isn't issued for
+// the given audience, which Azure AD would only reject with a less helpful
+// error once the token is exchanged. A token that isn't a JWT is left for
+// Azure AD to reject.
+func checkOIDCTokenAudience(token, audience string) error {
+	if audience == "" {
+		return nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Audience json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || len(claims.Audience) == 0 {
+		return nil
+	}
+	// the audience is either a single string or a list of them
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var single string
+		if err := json.Unmarshal(claims.Audience, &single); err != nil {
+			return nil
+		}
+		audiences = []string{single}
+	}
+	for _, aud := range audiences {
+		if aud == audience {
+			return nil
+		}
+	}
+	return fmt.Errorf("the OIDC token is issued for the audience %q, but oidc_audience is %q; request the token for that audience, or set oidc_audience to the audience of the federated credential", strings.Join(audiences, `", "`), audience)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-helpers/authentication"
+	authWrapper "github.com/manicminer/hamilton-autorest/auth"
+	"github.com/manicminer/hamilton/environments"
+)
+
+func TestFederatedTokenFileAuthRereadsFile(t *testing.T) {
+	// Azure AD tokens expire after expiresIn seconds. Anything under ten
+	// seconds is treated as expired already, so it's obtained again for
+	// every request.
+	var mu sync.Mutex
+	var assertions []string
+	expiresIn := 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		assertions = append(assertions, r.PostForm.Get("client_assertion"))
+		n, expires := len(assertions), expiresIn
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "access-%d", "token_type": "Bearer", "expires_in": %d}`, n, expires)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken := func(token string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := func(a *authWrapper.Authorizer) string {
+		t.Helper()
+		token, err := a.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.AccessToken
+	}
+
+	config := BackendConfig{UseOIDC: true, OIDCTokenFilePath: path}
+	armConfig := &authentication.Config{TenantID: "tenant", ClientID: "client", AuthenticatedViaOIDC: true}
+	if !useFederatedTokenFile(config, armConfig) {
+		t.Fatal("expected the token file to be used")
+	}
+	env := environments.Environment{AzureADEndpoint: environments.AzureADEndpoint(server.URL)}
+	api := environments.Api{Endpoint: "https://storage.azure.com"}
+	a := federatedTokenFileAuth(context.Background(), config, armConfig, env, api).(*authWrapper.Authorizer)
+
+	// the projected token is rotated between refreshes
+	writeToken("projected-1")
+	token(a)
+	writeToken("projected-2")
+	token(a)
+	if diff := cmp.Diff([]string{"projected-1", "projected-2"}, assertions); diff != "" {
+		t.Fatalf("expected each refresh to use the token in the file:\n%s", diff)
+	}
+
+	// an unexpired token is reused without reading the file
+	mu.Lock()
+	expiresIn = 3600
+	mu.Unlock()
+	first := token(a)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := token(a); got != first {
+		t.Fatalf("expected the cached token %q, got %q", first, got)
+	}
+	if len(assertions) != 3 {
+		t.Fatalf("expected the token to be cached, got %d token requests", len(assertions))
+	}
+}
+
+// testJWT returns an unsigned JWT with the given audience claim.
+func testJWT(t *testing.T, aud interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(map[string]interface{}{"iss": "https://token.actions.githubusercontent.com", "aud": aud})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestCheckOIDCTokenAudience(t *testing.T) {
+	cases := map[string]struct {
+		token    string
+		audience string
+		wantErr  bool
+	}{
+		"no audience configured": {
+			token: testJWT(t, "api://AzureADTokenExchange"),
+		},
+		"matching audience": {
+			token:    testJWT(t, "api://custom"),
+			audience: "api://custom",
+		},
+		"matching one of the audiences": {
+			token:    testJWT(t, []string{"api://other", "api://custom"}),
+			audience: "api://custom",
+		},
+		"other audience": {
+			token:    testJWT(t, "api://AzureADTokenExchange"),
+			audience: "api://custom",
+			wantErr:  true,
+		},
+		"not a JWT": {
+			token:    "opaque-token",
+			audience: "api://custom",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := checkOIDCTokenAudience(tc.token, tc.audience)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), `oidc_audience is "api://custom"`) {
+					t.Fatalf("expected the audience to be refused, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOIDCRequestURLWithAudience(t *testing.T) {
+	got, err := oidcRequestURLWithAudience("https://token.actions.githubusercontent.com/request?api-version=2.0&audience=api://other", "api://custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(url.Values{"api-version": {"2.0"}, "audience": {"api://custom"}}, u.Query()); diff != "" {
+		t.Fatalf("unexpected query:\n%s", diff)
+	}
+
+	// without an audience, the URL is left as is for the default one
+	if got, _ := oidcRequestURLWithAudience("https://example.com/request?x=1", ""); got != "https://example.com/request?x=1" {
+		t.Fatalf("expected the URL to be unchanged, got %q", got)
+	}
+}
+
+func TestFederatedTokenFileAuthChecksAudience(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "access", "token_type": "Bearer", "expires_in": 5}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	config := BackendConfig{UseOIDC: true, OIDCTokenFilePath: path, OIDCAudience: "api://custom"}
+	armConfig := &authentication.Config{TenantID: "tenant", ClientID: "client", AuthenticatedViaOIDC: true}
+	env := environments.Environment{AzureADEndpoint: environments.AzureADEndpoint(server.URL)}
+	api := environments.Api{Endpoint: "https://storage.azure.com"}
+	a := federatedTokenFileAuth(context.Background(), config, armConfig, env, api).(*authWrapper.Authorizer)
+
+	if err := os.WriteFile(path, []byte(testJWT(t, "api://custom")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is rotated for another audience
+	if err := os.WriteFile(path, []byte(testJWT(t, "api://AzureADTokenExchange")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Token(); err == nil || !strings.Contains(err.Error(), "oidc_audience") {
+		t.Fatalf("expected the refreshed token's audience to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"sync"
+	"time"
+)
+
+// readCache keeps the states recently read by the clients of one backend, so
+// that a process reading the same state repeatedly, as a server does, only
+// downloads it again once it has changed. A cached state is only served
+// after Azure confirms with a conditional read that the blob's ETag is
+// unchanged, so it's never stale, and is dropped once it's older than the
+// cache's TTL.
+type readCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]readCacheEntry
+
+	// now defaults to time.Now.
+	now func() time.Time
+}
+
+type readCacheEntry struct {
+	etag     string
+	contents []byte
+	fetched  time.Time
+}
+
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:     ttl,
+		entries: map[string]readCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// get returns the cached contents of the named blob, unless there are none
+// or they have expired.
+func (rc *readCache) get(name string) (readCacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[name]
+	if !ok {
+		return readCacheEntry{}, false
+	}
+	if rc.now().Sub(entry.fetched) >= rc.ttl {
+		delete(rc.entries, name)
+		return readCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put caches the contents of the named blob as downloaded with the given
+// ETag.
+func (rc *readCache) put(name, etag string, contents []byte) {
+	if etag == "" {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries[name] = readCacheEntry{
+		etag:     etag,
+		contents: contents,
+		fetched:  rc.now(),
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"fmt"
+)
+
+// readOnlyError returns the error with which a backend configured with
+// read_only refuses to do what's described by action.
+func readOnlyError(action string) error {
+	return fmt.Errorf("the backend is read-only, as read_only is set, so it can't %s", action)
+}
+
+// checkWritable returns an error if the client is read-only, refusing the
+// given operation on the state blob.
+func (c *RemoteClient) checkWritable(op string) error {
+	if !c.readOnly {
+		return nil
+	}
+	return readOnlyError(fmt.Sprintf("%s state Blob %q", op, c.keyName))
+}
+
+// checkWritable returns an error if the backend is read-only, refusing the
+// given action.
+func (b *Backend) checkWritable(action string) error {
+	if !b.readOnly {
+		return nil
+	}
+	return readOnlyError(action)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestBackendReadOnly(t *testing.T) {
+	m := newMockStorage()
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1}`), nil)
+	m.putBlob(mockContainerName, "test.tfstateenv:dev", []byte(`{"version": 4, "serial": 1}`), nil)
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"read_only": true,
+	})
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(); err != nil {
+		t.Fatal(err)
+	}
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workspaces) != 2 {
+		t.Fatalf("expected 2 workspaces, got %v", workspaces)
+	}
+
+	checkReadOnly := func(t *testing.T, err error) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(), "the backend is read-only") {
+			t.Fatalf("expected the backend to be read-only, got %v", err)
+		}
+	}
+	checkReadOnly(t, client.Put([]byte(`{"version": 4, "serial": 2}`)))
+	checkReadOnly(t, client.Delete())
+	_, err = client.Lock(statemgr.NewLockInfo())
+	checkReadOnly(t, err)
+	checkReadOnly(t, client.Unlock("lock-id"))
+	checkReadOnly(t, b.DeleteWorkspace("dev", false))
+
+	// a new workspace is read as empty rather than created
+	stateMgr, err := b.StateMgr("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stateMgr.State() != nil {
+		t.Fatal("expected the new workspace to have no state")
+	}
+
+	if got := m.requestCount(http.MethodPut, "") + m.requestCount(http.MethodPut, "lease") + m.requestCount(http.MethodDelete, ""); got != 0 {
+		t.Fatalf("expected nothing to be written, got %d writes", got)
+	}
+}
+
+func TestBackendConfigReadOnlyProbeWrite(t *testing.T) {
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"read_only":   true,
+		"probe_write": true,
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "read_only can't be used with probe_write") {
+		t.Fatalf("expected probe_write to be refused, got %v", diags.Err())
+	}
+}
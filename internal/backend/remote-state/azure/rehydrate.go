@@ -0,0 +1,84 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// rehydratePolicy controls how long reading a state blob in the Archive tier
+// waits for it to be rehydrated when auto_rehydrate is set. Rehydration is
+// measured in hours, so the state is polled sparingly.
+type rehydratePolicy struct {
+	// Timeout is how long to wait for the rehydration to complete.
+	Timeout time.Duration
+
+	// Interval is how long to wait between checks of the blob's tier.
+	Interval time.Duration
+
+	// sleep waits for the given duration, returning early with an error if
+	// ctx is cancelled. It defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+var defaultRehydratePolicy = rehydratePolicy{
+	Timeout:  time.Hour,
+	Interval: time.Minute,
+}
+
+// isBlobArchived reports whether the given response to a read of a blob
+// refused it because the blob is in the Archive tier.
+func isBlobArchived(resp autorest.Response) bool {
+	return resp.Response != nil && resp.StatusCode == http.StatusConflict &&
+		resp.Header.Get("x-ms-error-code") == "BlobArchived"
+}
+
+// rehydrate moves the archived state blob back to the Hot tier, and waits
+// according to the client's rehydrate policy for the move to complete.
+func (c *RemoteClient) rehydrate(ctx context.Context) error {
+	policy := c.rehydration
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultRehydratePolicy.Timeout
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = defaultRehydratePolicy.Interval
+	}
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+
+	log.Printf("[INFO] State Blob %q is in the Archive tier, rehydrating it to the Hot tier", c.keyName)
+	resp, err := c.giovanniBlobClient.SetTier(ctx, c.accountName, c.containerName, c.keyName, blobs.Hot)
+	// a conflict means the blob is already being rehydrated, which is
+	// waited for all the same
+	if err != nil && !resp.IsHTTPStatus(http.StatusConflict) {
+		return fmt.Errorf("error rehydrating Blob %q: %w", c.keyName, err)
+	}
+
+	for waited := time.Duration(0); waited < policy.Timeout; waited += policy.Interval {
+		if err := policy.sleep(ctx, policy.Interval); err != nil {
+			return fmt.Errorf("waiting for Blob %q to be rehydrated was interrupted: %w", c.keyName, err)
+		}
+		properties, err := c.giovanniBlobClient.GetProperties(ctx, c.accountName, c.containerName, c.keyName, blobs.GetPropertiesInput{})
+		if err != nil {
+			return err
+		}
+		if properties.AccessTier != blobs.Archive {
+			log.Printf("[INFO] State Blob %q was rehydrated", c.keyName)
+			return nil
+		}
+		log.Printf("[DEBUG] State Blob %q is still being rehydrated, waited %s of %s", c.keyName, waited+policy.Interval, policy.Timeout)
+	}
+
+	return fmt.Errorf("state Blob %q is still being rehydrated from the Archive tier after %s; try again once it's complete", c.keyName, policy.Timeout)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	armStorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// secondaryAccountSuffix turns the name of a Storage Account into the name
+// its secondary endpoint is addressed by, as in
+// "myaccount-secondary.blob.core.windows.net". Requests to it are still
+// authorized as the account itself.
+const secondaryAccountSuffix = "-secondary"
+
+// isPrimaryReadFailure returns whether a read from the primary endpoint
+// failed in a way the secondary endpoint may not: with a server error, or
+// by timing out.
+func isPrimaryReadFailure(resp autorest.Response, err error) bool {
+	if resp.Response != nil {
+		switch resp.StatusCode {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// secondaryReadWarning returns a warning for reading from the secondary
+// endpoint of a Storage Account that doesn't replicate to a readable one, as
+// such reads fail, or an empty string for an account that does. It needs the
+// Resource Group to look the account up, and warns of nothing without it.
+func (c ArmClient) secondaryReadWarning(ctx context.Context) string {
+	if c.storageAccountsClient == nil || c.resourceGroupName == "" {
+		return ""
+	}
+
+	account, err := c.storageAccountsClient.GetProperties(ctx, c.resourceGroupName, c.storageAccountName, "")
+	if err != nil {
+		return fmt.Sprintf("Couldn't check that Storage Account %q has a readable secondary endpoint for use_secondary_endpoint_on_read_failure: %s", c.storageAccountName, err)
+	}
+	if account.Sku != nil {
+		switch account.Sku.Name {
+		case armStorage.StandardRAGRS, armStorage.StandardRAGZRS:
+			return ""
+		}
+	}
+	return fmt.Sprintf("Storage Account %q isn't read-access geo-redundant (RA-GRS or RA-GZRS), so use_secondary_endpoint_on_read_failure can't read the state from its secondary endpoint", c.storageAccountName)
+}
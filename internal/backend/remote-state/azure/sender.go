@@ -6,20 +6,257 @@
 package azure
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-uuid"
 	"github.com/opentofu/opentofu/internal/logging"
+	"golang.org/x/net/http/httpproxy"
 )
 
-func buildSender() autorest.Sender {
+// clientRequestIDHeader is the header Azure Storage uses to correlate requests
+// made by the client with its own logs, as asked for by Azure support.
+const clientRequestIDHeader = "x-ms-client-request-id"
+
+// requestIDHeader is set by Azure on every response it sends, and is used to
+// tell its responses apart from those of something else on the way to it.
+const requestIDHeader = "x-ms-request-id"
+
+type clientRequestIDContextKey struct{}
+
+type omitBodyLoggingContextKey struct{}
+
+func buildSender(proxy func(*http.Request) (*url.URL, error)) autorest.Sender {
 	return autorest.DecorateSender(&http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
+			Proxy: proxy,
 		},
-	}, withRequestLogging())
+	}, withDNSRetries(defaultDNSRetryPolicy), withRequestLogging())
+}
+
+// buildProxy returns the proxy function of the transport of the sender.
+// Requests go through the proxy with the given URL when set, unless NO_PROXY
+// exempts their host, and otherwise through the proxy given by the
+// HTTP_PROXY and HTTPS_PROXY environment variables if fromEnvironment is set.
+// Credentials for the proxy can be given in its URL.
+func buildProxy(proxyURL string, fromEnvironment bool) (func(*http.Request) (*url.URL, error), error) {
+	config := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			// the URL may carry credentials, so it isn't repeated
+			return nil, fmt.Errorf("invalid proxy_url: expected a URL such as http://proxy.example.com:8080")
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid proxy_url %q: the scheme must be http, https or socks5", u.Redacted())
+		}
+		config.HTTPProxy = proxyURL
+		config.HTTPSProxy = proxyURL
+	} else if !fromEnvironment {
+		return nil, nil
+	}
+
+	proxy := config.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}, nil
+}
+
+// dnsRetryPolicy controls how requests that failed to resolve the endpoint
+// are retried. These retries happen below the storage clients' own, which
+// back off for far longer than a resolver hiccup usually lasts.
+type dnsRetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts int
+
+	// Backoff is how long to wait before the first retry. It doubles for
+	// each subsequent retry.
+	Backoff time.Duration
+
+	// sleep waits for the given duration, returning early with an error if
+	// ctx is cancelled. It defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+var defaultDNSRetryPolicy = dnsRetryPolicy{
+	Attempts: 4,
+	Backoff:  time.Second,
+}
+
+// withDNSRetries retries requests that failed because the endpoint's host
+// name couldn't be resolved, according to the given policy.
+func withDNSRetries(policy dnsRetryPolicy) autorest.SendDecorator {
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			rr := autorest.NewRetriableRequest(r)
+			backoff := policy.Backoff
+
+			var resp *http.Response
+			var err error
+			for attempt := 1; ; attempt++ {
+				if err = rr.Prepare(); err != nil {
+					return resp, err
+				}
+
+				resp, err = s.Do(rr.Request())
+				var dnsErr *net.DNSError
+				if err == nil || !errors.As(err, &dnsErr) || attempt >= policy.Attempts {
+					return resp, err
+				}
+
+				log.Printf("[DEBUG] Failed to resolve %q, retrying in %s (attempt %d of %d): %s", dnsErr.Name, backoff, attempt+1, policy.Attempts, err)
+				if sleepErr := policy.sleep(r.Context(), backoff); sleepErr != nil {
+					return resp, err
+				}
+				backoff *= 2
+			}
+		})
+	}
+}
+
+// throttleRetryPolicy controls how requests that Azure throttled, with a 429
+// or 503 response, are retried. The storage clients' own retries aren't
+// used for them, as they retry 429 responses without limit.
+type throttleRetryPolicy struct {
+	// MaxRetries is the maximum number of retries, which the RetryAttempts
+	// of the OperationOverrides of the request replace.
+	MaxRetries int
+
+	// Backoff is how long to wait before the first retry of a response
+	// without a Retry-After header. It doubles for each subsequent retry, up
+	// to maxThrottleBackoff.
+	Backoff time.Duration
+
+	// sleep waits for the given duration, returning early with an error if
+	// ctx is cancelled. It defaults to sleepContext.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+const (
+	defaultMaxRetries      = 3
+	defaultThrottleBackoff = time.Second
+	maxThrottleBackoff     = 30 * time.Second
+)
+
+// throttledError is returned for a request that was still throttled once the
+// retry budget was spent, along with the last response.
+type throttledError struct {
+	resp       *http.Response
+	retries    int
+	retryAfter string
+}
+
+func (e *throttledError) Error() string {
+	msg := fmt.Sprintf("request throttled by Azure with %q", e.resp.Status)
+	if code := e.resp.Header.Get("x-ms-error-code"); code != "" {
+		msg += fmt.Sprintf(" (%s)", code)
+	}
+	msg += fmt.Sprintf(" after %d retries", e.retries)
+	if e.retryAfter != "" {
+		msg += fmt.Sprintf(", the last with Retry-After %s", e.retryAfter)
+	}
+	return msg + "; raise max_retries or try again later"
+}
+
+// Response makes the retries of the storage clients treat the error as final,
+// as they do with an error refreshing a token, rather than retrying what was
+// retried already.
+func (e *throttledError) Response() *http.Response {
+	return e.resp
+}
+
+// isThrottled reports whether the response is one of Azure throttling the
+// request.
+func isThrottled(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable)
+}
+
+// retryAfterDelay returns how long the Retry-After header of the response
+// asks to wait, which is either a number of seconds or a date, and false
+// when there's no such header.
+func retryAfterDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// withThrottleRetries retries requests that Azure throttled according to the
+// given policy, waiting as long as their Retry-After header asks, and
+// otherwise backing off. Once the retries are spent, the last response is
+// returned along with a throttledError.
+func withThrottleRetries(policy throttleRetryPolicy) autorest.SendDecorator {
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultThrottleBackoff
+	}
+	if policy.sleep == nil {
+		policy.sleep = sleepContext
+	}
+
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			maxRetries := policy.MaxRetries
+			if overrides, ok := r.Context().Value(operationOverridesKey{}).(OperationOverrides); ok && overrides.RetryAttempts > 0 {
+				maxRetries = overrides.RetryAttempts
+			}
+			rr := autorest.NewRetriableRequest(r)
+			backoff := policy.Backoff
+			lastRetryAfter := ""
+
+			for retry := 0; ; retry++ {
+				if err := rr.Prepare(); err != nil {
+					return nil, err
+				}
+
+				resp, err := s.Do(rr.Request())
+				if err != nil || !isThrottled(resp) {
+					return resp, err
+				}
+				if ra := resp.Header.Get("Retry-After"); ra != "" {
+					lastRetryAfter = ra
+				}
+				if retry >= maxRetries {
+					autorest.DrainResponseBody(resp)
+					return resp, &throttledError{resp: resp, retries: retry, retryAfter: lastRetryAfter}
+				}
+
+				delay, ok := retryAfterDelay(resp, time.Now())
+				if !ok {
+					delay = backoff
+					backoff = min(backoff*2, maxThrottleBackoff)
+				}
+				log.Printf("[DEBUG] Request to %s throttled with %q, retrying in %s (retry %d of %d)", redactedURL(r.URL), resp.Status, delay, retry+1, maxRetries)
+				autorest.DrainResponseBody(resp)
+				if err := policy.sleep(r.Context(), delay); err != nil {
+					return resp, err
+				}
+			}
+		})
+	}
 }
 
 func withRequestLogging() autorest.SendDecorator {
@@ -38,15 +275,24 @@ func withRequestLogging() autorest.SendDecorator {
 				r.Header.Del(authHeaderName)
 			}
 
+			// responses carrying secrets are logged without their bodies
+			body := r.Context().Value(omitBodyLoggingContextKey{}) == nil
+
+			// and the signature of a SAS token from the URL
+			u := r.URL
+			redacted := redactedURL(u)
+			r.URL = redacted
+
 			// dump request to wire format
-			if dump, err := httputil.DumpRequestOut(r, true); err == nil {
+			if dump, err := httputil.DumpRequestOut(r, body); err == nil {
 				log.Printf("[DEBUG] Azure Backend Request: \n%s\n", dump)
 			} else {
 				// fallback to basic message
-				log.Printf("[DEBUG] Azure Backend Request: %s to %s\n", r.Method, r.URL)
+				log.Printf("[DEBUG] Azure Backend Request: %s to %s\n", r.Method, redacted)
 			}
 
-			// add the auth header back
+			// add the auth header and URL back
+			r.URL = u
 			if auth != "" {
 				r.Header.Add(authHeaderName, auth)
 			}
@@ -54,16 +300,211 @@ func withRequestLogging() autorest.SendDecorator {
 			resp, err := s.Do(r)
 			if resp != nil {
 				// dump response to wire format
-				if dump, err2 := httputil.DumpResponse(resp, true); err2 == nil {
-					log.Printf("[DEBUG] Azure Backend Response for %s: \n%s\n", r.URL, dump)
+				if dump, err2 := httputil.DumpResponse(resp, body); err2 == nil {
+					log.Printf("[DEBUG] Azure Backend Response for %s: \n%s\n", redacted, dump)
 				} else {
 					// fallback to basic message
-					log.Printf("[DEBUG] Azure Backend Response: %s for %s\n", resp.Status, r.URL)
+					log.Printf("[DEBUG] Azure Backend Response: %s for %s\n", resp.Status, redacted)
 				}
 			} else {
-				log.Printf("[DEBUG] Request to %s completed with no response", r.URL)
+				log.Printf("[DEBUG] Request to %s completed with no response", redacted)
 			}
 			return resp, err
 		})
 	}
 }
+
+// withRequestSummaryLogging logs a line for every request once it's done,
+// with the IDs Azure and the client gave it, its status and how long it
+// took, for the requests to be correlated with the logs of Azure.
+func withRequestSummaryLogging() autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			if logging.CurrentLogLevel() == "" {
+				return s.Do(r)
+			}
+
+			start := time.Now()
+			resp, err := s.Do(r)
+			log.Printf("[DEBUG] %s", requestSummary(r, resp, err, time.Since(start)))
+			return resp, err
+		})
+	}
+}
+
+// requestSummary describes a request that was sent, as a list of key=value
+// pairs. It leaves out the credentials of the request.
+func requestSummary(r *http.Request, resp *http.Response, err error, latency time.Duration) string {
+	redacted := redactedURL(r.URL)
+	summary := fmt.Sprintf("Azure Backend request: method=%s url=%q %s=%q", r.Method, redacted, clientRequestIDHeader, r.Header.Get(clientRequestIDHeader))
+	if resp != nil {
+		summary += fmt.Sprintf(" %s=%q status=%d", requestIDHeader, resp.Header.Get(requestIDHeader), resp.StatusCode)
+		if code := resp.Header.Get("x-ms-error-code"); code != "" {
+			summary += fmt.Sprintf(" error_code=%q", code)
+		}
+	}
+	if err != nil {
+		// the errors of the transport repeat the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			redactedErr := *urlErr
+			redactedErr.URL = redacted.String()
+			err = &redactedErr
+		}
+		summary += fmt.Sprintf(" error=%q", err)
+	}
+	return summary + fmt.Sprintf(" latency=%s", latency.Round(time.Millisecond))
+}
+
+// redactedURL returns a copy of u without the password of its user info or
+// the signature of a SAS token in its query, for it to be logged.
+func redactedURL(u *url.URL) *url.URL {
+	redacted := *u
+	if _, ok := redacted.User.Password(); ok {
+		redacted.User = url.UserPassword(redacted.User.Username(), "xxxxx")
+	}
+	query := redacted.Query()
+	for name := range query {
+		if strings.EqualFold(name, "sig") {
+			query.Set(name, "REDACTED")
+		}
+	}
+	if len(query) > 0 {
+		redacted.RawQuery = query.Encode()
+	}
+	return &redacted
+}
+
+// withClientRequestIDHeader sets the x-ms-client-request-id header on every
+// request. The ID is taken from the request context when the caller attached
+// one with contextWithClientRequestID, so that all requests belonging to one
+// operation share it, and is otherwise generated using the given prefix.
+func withClientRequestIDHeader(prefix string) autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Header.Get(clientRequestIDHeader) == "" {
+				id, ok := r.Context().Value(clientRequestIDContextKey{}).(string)
+				if !ok {
+					id = newClientRequestID(prefix)
+				}
+				r.Header.Set(clientRequestIDHeader, id)
+			}
+			return s.Do(r)
+		})
+	}
+}
+
+// withUnexpectedResponseCheck returns an error for responses that evidently
+// didn't come from Azure, such as the HTML error page of a misconfigured
+// proxy, which would otherwise surface as a confusing failure to parse the
+// body as state or XML.
+func withUnexpectedResponseCheck() autorest.RespondDecorator {
+	return func(r autorest.Responder) autorest.Responder {
+		return autorest.ResponderFunc(func(resp *http.Response) error {
+			if resp != nil && resp.Header.Get(requestIDHeader) == "" {
+				if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" {
+					endpoint := "the endpoint"
+					if resp.Request != nil {
+						endpoint = resp.Request.URL.Host
+					}
+					return fmt.Errorf("unexpected response from %s: received %q with Content-Type %q, which isn't a response from Azure. Check the proxy and endpoint configuration", endpoint, resp.Status, mediaType)
+				}
+			}
+			return r.Respond(resp)
+		})
+	}
+}
+
+// blobPermissionErrors explains the error codes with which the Blob service
+// rejects credentials that are valid but aren't authorized for the Blob
+// service, as opposed to credentials that failed to authenticate at all.
+var blobPermissionErrors = map[string]string{
+	"AuthorizationServiceMismatch":      "the credentials aren't authorized for the Blob service; a SAS token must include it in its allowed services (ss=b), rather than only File, Queue or Table",
+	"AuthorizationResourceTypeMismatch": "the credentials aren't authorized for the resource types the backend uses; a SAS token must allow both the container and object resource types (srt=co)",
+	"AuthorizationPermissionMismatch":   "the credentials lack the permission for this operation on the Blob service; Azure AD principals need a data role such as Storage Blob Data Contributor, and a SAS token must allow read, write, delete and list (sp=rwdl)",
+}
+
+// withBlobPermissionCheck returns a tailored error for responses from the
+// Blob service which reject the request's credentials as not authorized
+// for it, which would otherwise surface as a generic authorization failure.
+func withBlobPermissionCheck() autorest.RespondDecorator {
+	return func(r autorest.Responder) autorest.Responder {
+		return autorest.ResponderFunc(func(resp *http.Response) error {
+			if resp != nil && resp.StatusCode == http.StatusForbidden {
+				code := resp.Header.Get("x-ms-error-code")
+				if explanation, ok := blobPermissionErrors[code]; ok {
+					endpoint := "the storage account"
+					if resp.Request != nil {
+						endpoint = resp.Request.URL.Host
+					}
+					resp.Body.Close()
+					return fmt.Errorf("request to %s was forbidden (%s): %s", endpoint, code, explanation)
+				}
+			}
+			return r.Respond(resp)
+		})
+	}
+}
+
+// withAuthorization authorizes every request again just before it's sent.
+// Requests are authorized when they're prepared, but a Shared Key signature
+// covers the request's x-ms headers, conditional headers and query, which
+// are changed after that: the client request ID is set while sending, and
+// some requests are prepared by the storage SDK and then changed to do
+// what the SDK can't express.
+func withAuthorization(auth autorest.Authorizer) autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			r, err := autorest.Prepare(r, auth.WithAuthorization())
+			if err != nil {
+				return nil, err
+			}
+			return s.Do(r)
+		})
+	}
+}
+
+// contextWithClientRequestID returns a copy of ctx which causes requests made
+// with it to carry the given client request ID.
+func contextWithClientRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientRequestIDContextKey{}, id)
+}
+
+// contextWithoutBodyLogging returns a copy of ctx which causes requests made
+// with it to be logged without the bodies of the request and response, for
+// requests whose responses carry secrets.
+func contextWithoutBodyLogging(ctx context.Context) context.Context {
+	return context.WithValue(ctx, omitBodyLoggingContextKey{}, true)
+}
+
+// newClientRequestID generates a unique client request ID with the given
+// prefix.
+func newClientRequestID(prefix string) string {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		// the ID is only used for correlation, so it's enough for it to be
+		// unlikely to collide
+		id = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return prefix + id
+}
+
+// clientRequestIDError annotates an error with the client request ID of the
+// operation that failed, so that it can be quoted in Azure support requests,
+// and with the caller-supplied idempotency key, if any.
+type clientRequestIDError struct {
+	Err             error
+	ClientRequestID string
+	IdempotencyKey  string
+}
+
+func (e *clientRequestIDError) Error() string {
+	if e.IdempotencyKey != "" {
+		return fmt.Sprintf("%s (%s: %s, idempotency key: %s)", e.Err, clientRequestIDHeader, e.ClientRequestID, e.IdempotencyKey)
+	}
+	return fmt.Sprintf("%s (%s: %s)", e.Err, clientRequestIDHeader, e.ClientRequestID)
+}
+
+func (e *clientRequestIDError) Unwrap() error {
+	return e.Err
+}
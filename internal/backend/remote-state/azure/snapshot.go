@@ -0,0 +1,537 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/states/statefile"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
+)
+
+// ReadSnapshot returns the state stored in the snapshot of the given
+// workspace's state blob taken at the given timestamp, without restoring it.
+// The timestamp is the snapshot's identifier as reported by Azure, for
+// example "2024-01-02T15:04:05.0000000Z".
+func (b *Backend) ReadSnapshot(workspace, timestamp string) (*statefile.File, error) {
+	if timestamp == "" {
+		return nil, fmt.Errorf("a snapshot timestamp is required")
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := b.workspaceEncryption(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.getSnapshot(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := statefile.Read(bytes.NewReader(data), enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %q of workspace %q: %w", timestamp, workspace, err)
+	}
+	return file, nil
+}
+
+// SnapshotDiff summarizes how the state in a snapshot differs from the
+// current state, that is what restoring the snapshot would change.
+type SnapshotDiff struct {
+	CurrentSerial  uint64
+	SnapshotSerial uint64
+
+	// SerialDelta is the snapshot's serial less the current state's, so it
+	// is negative when the snapshot is older.
+	SerialDelta int64
+
+	// LineageChanged is set when the snapshot belongs to a different lineage
+	// than the current state.
+	LineageChanged bool
+
+	// Added lists the addresses of the resource instances in the snapshot
+	// that aren't in the current state, and Removed those in the current
+	// state that aren't in the snapshot, both sorted.
+	Added   []string
+	Removed []string
+}
+
+// DiffSnapshot compares the state in the snapshot of the given workspace's
+// state blob taken at the given timestamp with the workspace's current
+// state. A workspace without a current state is compared as if it were
+// empty.
+func (b *Backend) DiffSnapshot(workspace, timestamp string) (*SnapshotDiff, error) {
+	snapshot, err := b.ReadSnapshot(workspace, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := b.workspaceEncryption(workspace)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := client.Get()
+	if err != nil {
+		return nil, err
+	}
+	current := &statefile.File{State: states.NewState()}
+	if payload != nil {
+		current, err = statefile.Read(bytes.NewReader(payload.Data), enc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current state of workspace %q: %w", workspace, err)
+		}
+	}
+
+	diff := &SnapshotDiff{
+		CurrentSerial:  current.Serial,
+		SnapshotSerial: snapshot.Serial,
+		SerialDelta:    int64(snapshot.Serial) - int64(current.Serial),
+		LineageChanged: payload != nil && current.Lineage != snapshot.Lineage,
+	}
+
+	currentAddrs := resourceInstanceAddrs(current.State)
+	snapshotAddrs := resourceInstanceAddrs(snapshot.State)
+	for addr := range snapshotAddrs {
+		if !currentAddrs[addr] {
+			diff.Added = append(diff.Added, addr)
+		}
+	}
+	for addr := range currentAddrs {
+		if !snapshotAddrs[addr] {
+			diff.Removed = append(diff.Removed, addr)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff, nil
+}
+
+// RestoreSnapshot replaces the current state of the given workspace with the
+// state stored in the snapshot of its state blob taken at the given
+// timestamp. Unless force is set, it refuses to when the state has changed
+// since the write that replaced the snapshot, as restoring it would lose
+// those changes as well.
+func (b *Backend) RestoreSnapshot(workspace, timestamp string, force bool) error {
+	if timestamp == "" {
+		return fmt.Errorf("a snapshot timestamp is required")
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return err
+	}
+	// Restoring a snapshot deliberately goes back to an older state, and
+	// must be written before the lock is released.
+	client.coalesceWrites = false
+	client.minSerialGuard = false
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "restore"
+
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock workspace %q: %w", workspace, err)
+	}
+	defer client.Unlock(lockID)
+
+	data, err := client.getSnapshot(timestamp)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		containersClient, err := b.armClient.getContainersClient(context.TODO())
+		if err != nil {
+			return err
+		}
+		if err := client.checkRestore(containersClient, timestamp); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Put(data); err != nil {
+		return fmt.Errorf("failed to restore snapshot %q of workspace %q: %w", timestamp, workspace, err)
+	}
+	return nil
+}
+
+// checkRestore returns an error if restoring the snapshot taken at the given
+// timestamp would lose more than the write that replaced it. A snapshot is
+// taken right before each write, so the write that replaced the snapshot is
+// captured by the next snapshot, and without a next snapshot it's still the
+// current state. The current state must otherwise have the lineage and serial
+// of the next snapshot.
+func (c *RemoteClient) checkRestore(containersClient *containers.Client, timestamp string) error {
+	next, err := c.nextSnapshot(containersClient, timestamp)
+	if err != nil || next == "" {
+		return err
+	}
+	replaced, err := c.getSnapshot(next)
+	if err != nil {
+		return err
+	}
+
+	ctx, requestID, done := c.operationContext(context.TODO())
+	defer done()
+
+	options := blobs.GetInput{}
+	if c.leaseID != "" {
+		options.LeaseID = &c.leaseID
+	}
+	current, err := c.getBlob(ctx, options)
+	if err != nil {
+		if current.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil
+		}
+		return c.operationError(err, requestID)
+	}
+
+	currentSerial, currentLineage, currentOk := stateSerialAndLineage(current.Contents)
+	replacedSerial, replacedLineage, replacedOk := stateSerialAndLineage(replaced)
+	if !currentOk || !replacedOk {
+		// The serial of an encrypted state can't be read, but then the
+		// state is unchanged only if it's exactly the same.
+		if !bytes.Equal(current.Contents, replaced) {
+			return fmt.Errorf("the current state of Blob %q has changed since the write that replaced snapshot %q; restoring it would lose the changes made since, force the restore to do it anyway", c.keyName, timestamp)
+		}
+		return nil
+	}
+	if currentLineage != replacedLineage {
+		return fmt.Errorf("the current state of Blob %q has lineage %q, not the lineage %q of the state that replaced snapshot %q; restoring it would lose the changes made since, force the restore to do it anyway", c.keyName, currentLineage, replacedLineage, timestamp)
+	}
+	if currentSerial > replacedSerial {
+		return fmt.Errorf("the current state of Blob %q has serial %d, newer than the serial %d of the state that replaced snapshot %q; restoring it would lose the changes made since, force the restore to do it anyway", c.keyName, currentSerial, replacedSerial, timestamp)
+	}
+	return nil
+}
+
+// nextSnapshot returns the timestamp of the earliest snapshot of the state
+// blob taken after the given timestamp, or "" if there's none.
+func (c *RemoteClient) nextSnapshot(containersClient *containers.Client, timestamp string) (string, error) {
+	taken, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot timestamp %q: %w", timestamp, err)
+	}
+
+	ctx, requestID, done := c.operationContext(context.TODO())
+	defer done()
+
+	params := containers.ListBlobsInput{
+		Prefix:  &c.keyName,
+		Include: &[]containers.Dataset{containers.Snapshots},
+	}
+	var next string
+	var nextTaken time.Time
+	for {
+		resp, err := containersClient.ListBlobs(ctx, c.accountName, c.containerName, params)
+		if err != nil {
+			return "", c.operationError(fmt.Errorf("error listing the snapshots of Blob %q: %w", c.keyName, err), requestID)
+		}
+		for _, obj := range resp.Blobs.Blobs {
+			if obj.Name != c.keyName || obj.Snapshot == nil {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, *obj.Snapshot)
+			if err != nil || !t.After(taken) {
+				continue
+			}
+			if next == "" || t.Before(nextTaken) {
+				next, nextTaken = *obj.Snapshot, t
+			}
+		}
+		if resp.NextMarker == nil || *resp.NextMarker == "" {
+			break
+		}
+		params.Marker = resp.NextMarker
+	}
+	return next, nil
+}
+
+// stateSerialAndLineage returns the serial and lineage of the given encoded
+// state, and false if it doesn't have a serial.
+func stateSerialAndLineage(data []byte) (uint64, string, bool) {
+	var state struct {
+		Lineage string `json:"lineage"`
+	}
+	serial, ok := stateSerial(data)
+	if !ok || json.Unmarshal(data, &state) != nil {
+		return 0, "", false
+	}
+	return serial, state.Lineage, true
+}
+
+// resourceInstanceAddrs returns the set of addresses of the resource
+// instances in the given state.
+func resourceInstanceAddrs(state *states.State) map[string]bool {
+	addrs := map[string]bool{}
+	if state == nil {
+		return addrs
+	}
+	for _, ms := range state.Modules {
+		for _, rs := range ms.Resources {
+			for key := range rs.Instances {
+				addrs[rs.Addr.Instance(key).String()] = true
+			}
+		}
+	}
+	return addrs
+}
+
+// getSnapshot returns the raw contents of the snapshot of the state blob
+// taken at the given timestamp.
+func (c *RemoteClient) getSnapshot(timestamp string) ([]byte, error) {
+	ctx, requestID, done := c.operationContext(context.TODO())
+	defer done()
+
+	result, err := c.getBlobWithParameter(ctx, "snapshot", timestamp, "")
+	if err != nil {
+		if result.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil, fmt.Errorf("snapshot %q of Blob %q (Container %q / Account %q) does not exist", timestamp, c.keyName, c.containerName, c.accountName)
+		}
+		return nil, c.operationError(fmt.Errorf("error retrieving snapshot %q of Blob %q: %w", timestamp, c.keyName, err), requestID)
+	}
+
+	return result.Contents, nil
+}
+
+// getBlobWithParameter reads the state blob with the given query parameter
+// added to the request, such as to select a snapshot, using the given
+// version of the Blob service API unless it's empty. The storage SDK has no
+// way to add either, so they're added to the prepared request.
+func (c *RemoteClient) getBlobWithParameter(ctx context.Context, name, value, apiVersion string) (blobs.GetResult, error) {
+	req, err := c.giovanniBlobClient.GetPreparer(ctx, c.accountName, c.containerName, c.keyName, blobs.GetInput{})
+	if err != nil {
+		return blobs.GetResult{}, fmt.Errorf("error preparing request: %w", err)
+	}
+	// The parameter is appended rather than the query being encoded again,
+	// which would reorder a SAS token in it.
+	req.URL.RawQuery += "&" + name + "=" + url.QueryEscape(value)
+	if apiVersion != "" {
+		req.Header.Set("x-ms-version", apiVersion)
+	}
+
+	resp, err := c.giovanniBlobClient.GetSender(req)
+	if err != nil {
+		return blobs.GetResult{Response: autorest.Response{Response: resp}}, err
+	}
+	result, err := c.giovanniBlobClient.GetResponder(resp)
+	if err != nil {
+		return result, err
+	}
+	result, err = c.decryptBlob(ctx, result)
+	if err != nil {
+		return result, err
+	}
+	return result, c.verifyChecksum(result)
+}
+
+// permanentDeleteAPIVersion is the first version of the Blob service API
+// that can permanently delete a soft-deleted snapshot. The storage SDK uses
+// an older one, so the requests doing it are changed to use this one.
+const permanentDeleteAPIVersion = "2020-02-10"
+
+// OrphanedSnapshot identifies a snapshot whose base blob no longer exists.
+type OrphanedSnapshot struct {
+	Blob      string
+	Timestamp string
+}
+
+// OrphanedSnapshotsReport is the result of CleanupOrphanedSnapshots.
+type OrphanedSnapshotsReport struct {
+	// Found lists every orphaned snapshot of the backend's state blobs.
+	Found []OrphanedSnapshot
+
+	// Deleted lists the orphaned snapshots that were deleted.
+	Deleted []OrphanedSnapshot
+}
+
+// CleanupOrphanedSnapshots finds the snapshots of this backend's state blobs
+// whose base blob no longer exists, and permanently deletes them if del is
+// set. Azure won't delete a blob without its snapshots, so these are left
+// behind by a Storage Account with blob soft delete enabled: deleting a
+// state blob outside of OpenTofu soft deletes its snapshots along with it,
+// and they're kept, and billed, until the retention period ends. Deleting
+// them requires permanent delete to be allowed on the Storage Account.
+//
+// Snapshots of blobs that still exist are never touched. When deleting a
+// snapshot fails the others are still attempted, and the report lists those
+// that were deleted alongside the error.
+func (b *Backend) CleanupOrphanedSnapshots(del bool) (*OrphanedSnapshotsReport, error) {
+	if del {
+		if err := b.checkWritable("delete orphaned snapshots"); err != nil {
+			return nil, err
+		}
+	}
+	ctx := context.TODO()
+	containersClient, err := b.armClient.getContainersClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The states are listed with the same prefixes as the workspaces, as
+	// the default state isn't under the workspace prefix when
+	// workspace_key_prefix is set.
+	prefixes := []string{b.keyName}
+	if prefix := b.workspacePrefix(); !strings.HasPrefix(prefix, b.keyName) {
+		prefixes = append(prefixes, prefix)
+	}
+
+	live := map[string]bool{}
+	var snapshots []OrphanedSnapshot
+	for _, prefix := range prefixes {
+		params := containers.ListBlobsInput{
+			Prefix:  &prefix,
+			Include: &[]containers.Dataset{containers.Snapshots, containers.Deleted},
+		}
+		for {
+			resp, err := containersClient.ListBlobs(ctx, b.armClient.storageAccountName, b.containerName, params)
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range resp.Blobs.Blobs {
+				if !b.isStateBlob(obj.Name) {
+					continue
+				}
+				if obj.Snapshot == nil {
+					if !obj.Deleted {
+						live[obj.Name] = true
+					}
+					continue
+				}
+				snapshots = append(snapshots, OrphanedSnapshot{Blob: obj.Name, Timestamp: *obj.Snapshot})
+			}
+			if resp.NextMarker == nil || *resp.NextMarker == "" {
+				break
+			}
+			params.Marker = resp.NextMarker
+		}
+	}
+
+	report := &OrphanedSnapshotsReport{}
+	for _, snapshot := range snapshots {
+		if !live[snapshot.Blob] {
+			report.Found = append(report.Found, snapshot)
+		}
+	}
+	if !del || len(report.Found) == 0 {
+		return report, nil
+	}
+
+	blobClient, err := b.armClient.getBlobClient(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	var result *multierror.Error
+	for _, snapshot := range report.Found {
+		log.Printf("[DEBUG] Permanently deleting orphaned snapshot %q of Blob %q", snapshot.Timestamp, snapshot.Blob)
+		if err := b.deleteSnapshotPermanently(ctx, blobClient, snapshot); err != nil {
+			result = multierror.Append(result, fmt.Errorf("failed to delete snapshot %q of Blob %q: %w", snapshot.Timestamp, snapshot.Blob, err))
+			continue
+		}
+		report.Deleted = append(report.Deleted, snapshot)
+	}
+
+	return report, result.ErrorOrNil()
+}
+
+// isStateBlob returns whether the named blob is the state of a workspace.
+func (b *Backend) isStateBlob(name string) bool {
+	if name == b.keyName {
+		return true
+	}
+	_, ok := b.workspaceOfPath(name)
+	return ok
+}
+
+// deleteSnapshotPermanently permanently deletes a soft-deleted snapshot. The
+// storage SDK has no way to, so the request is changed to.
+func (b *Backend) deleteSnapshotPermanently(ctx context.Context, client *blobs.Client, snapshot OrphanedSnapshot) error {
+	req, err := client.DeleteSnapshotPreparer(ctx, b.armClient.storageAccountName, b.containerName, snapshot.Blob, blobs.DeleteSnapshotInput{SnapshotDateTime: snapshot.Timestamp})
+	if err != nil {
+		return fmt.Errorf("error preparing request: %w", err)
+	}
+	// The parameter is appended rather than the query being encoded again,
+	// which would reorder a SAS token in it.
+	req.URL.RawQuery += "&deletetype=permanent"
+	req.Header.Set("x-ms-version", permanentDeleteAPIVersion)
+
+	resp, err := client.DeleteSnapshotSender(req)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteSnapshotResponder(resp)
+	return err
+}
+
+// snapshotLimiter paces the snapshots taken by the clients of one backend,
+// so that writing the states of many workspaces at once, as a mass re-apply
+// does, doesn't take a burst of snapshots that overwhelms the storage
+// account. It's shared by every client the backend creates.
+type snapshotLimiter struct {
+	// interval is the least time between two snapshots.
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+
+	// now and sleep default to time.Now and sleepContext.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newSnapshotLimiter(interval time.Duration) *snapshotLimiter {
+	return &snapshotLimiter{
+		interval: interval,
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+// wait blocks until the caller may take a snapshot, returning early with an
+// error if ctx is cancelled. Each caller is given the next free slot, so
+// concurrent callers take their snapshots one interval apart.
+func (l *snapshotLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	log.Printf("[DEBUG] Waiting %s before taking a snapshot, to pace snapshots across workspaces", delay)
+	return l.sleep(ctx, delay)
+}
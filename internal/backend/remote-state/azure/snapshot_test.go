@@ -0,0 +1,343 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/encryption/enctest"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/states/statefile"
+)
+
+func TestBackendReadSnapshot(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+	b.encryption = enctest.EncryptionRequired().State()
+
+	current := &statefile.File{Lineage: "snapshot-lineage", Serial: 2, State: states.NewState()}
+	old := &statefile.File{Lineage: "snapshot-lineage", Serial: 1, State: states.NewState()}
+
+	var buf bytes.Buffer
+	if err := statefile.Write(current, &buf, b.encryption); err != nil {
+		t.Fatal(err)
+	}
+	m.putBlob(mockContainerName, "test.tfstate", buf.Bytes(), nil)
+
+	buf.Reset()
+	if err := statefile.Write(old, &buf, b.encryption); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"encrypted_data"`) {
+		t.Fatal("snapshot content was not encrypted")
+	}
+	timestamp := "2024-01-02T15:04:05.0000000Z"
+	m.putSnapshot(mockContainerName, "test.tfstate", timestamp, buf.Bytes())
+
+	file, err := b.ReadSnapshot("default", timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Serial != 1 || file.Lineage != "snapshot-lineage" {
+		t.Fatalf("got serial %d and lineage %q, want the snapshot's", file.Serial, file.Lineage)
+	}
+
+	// the snapshot must be read without touching the current state
+	if n := m.requestCount("PUT", ""); n != 0 {
+		t.Fatalf("reading a snapshot made %d writes", n)
+	}
+
+	if _, err := b.ReadSnapshot("default", "2024-01-01T00:00:00.0000000Z"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing snapshot error, got %v", err)
+	}
+}
+
+func TestBackendCleanupOrphanedSnapshots(t *testing.T) {
+	m := newMockStorage()
+	m.softDelete = true
+	b := testBackendWithMockStorage(t, m, nil)
+
+	// the default state still exists, the "gone" workspace was deleted by
+	// hand, which soft deleted its snapshots along with it
+	m.putBlob(mockContainerName, "test.tfstate", []byte("{}"), nil)
+	m.putSnapshot(mockContainerName, "test.tfstate", "2024-01-01T00:00:00.0000000Z", []byte("{}"))
+	m.putBlob(mockContainerName, "test.tfstateenv:gone", []byte("{}"), nil)
+	m.putSnapshot(mockContainerName, "test.tfstateenv:gone", "2024-01-02T00:00:00.0000000Z", []byte("{}"))
+	m.putSnapshot(mockContainerName, "test.tfstateenv:gone", "2024-01-03T00:00:00.0000000Z", []byte("{}"))
+	m.deleteBlob(mockContainerName, "test.tfstateenv:gone")
+
+	want := []OrphanedSnapshot{
+		{Blob: "test.tfstateenv:gone", Timestamp: "2024-01-02T00:00:00.0000000Z"},
+		{Blob: "test.tfstateenv:gone", Timestamp: "2024-01-03T00:00:00.0000000Z"},
+	}
+
+	report, err := b.CleanupOrphanedSnapshots(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, report.Found); diff != "" {
+		t.Fatalf("unexpected orphans:\n%s", diff)
+	}
+	if len(report.Deleted) != 0 || m.requestCount(http.MethodDelete, "") != 0 {
+		t.Fatal("snapshots were deleted without being asked to")
+	}
+
+	report, err = b.CleanupOrphanedSnapshots(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, report.Deleted); diff != "" {
+		t.Fatalf("unexpected deletions:\n%s", diff)
+	}
+	if blob := m.blob(mockContainerName, "test.tfstateenv:gone"); len(blob.snapshots) != 0 {
+		t.Fatal("orphaned snapshots were not deleted")
+	}
+	if blob := m.blob(mockContainerName, "test.tfstate"); len(blob.snapshots) != 1 {
+		t.Fatal("snapshot of a live blob was deleted")
+	}
+
+	report, err = b.CleanupOrphanedSnapshots(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Found) != 0 {
+		t.Fatalf("unexpected orphans after the cleanup: %v", report.Found)
+	}
+}
+
+func TestBackendCleanupOrphanedSnapshotsWorkspaceKeyPrefix(t *testing.T) {
+	m := newMockStorage()
+	m.softDelete = true
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"workspace_key_prefix":      "env",
+		"obfuscate_workspace_names": true,
+	})
+
+	// the states of the workspaces aren't named after the key, nor after
+	// the workspaces
+	gone := b.path("gone")
+	m.putBlob(mockContainerName, b.path("kept"), []byte("{}"), nil)
+	m.putSnapshot(mockContainerName, b.path("kept"), "2024-01-01T00:00:00.0000000Z", []byte("{}"))
+	m.putBlob(mockContainerName, gone, []byte("{}"), nil)
+	m.putSnapshot(mockContainerName, gone, "2024-01-02T00:00:00.0000000Z", []byte("{}"))
+	m.deleteBlob(mockContainerName, gone)
+	// nor are blobs that aren't states
+	m.putBlob(mockContainerName, "env/other", []byte("{}"), nil)
+	m.putSnapshot(mockContainerName, "env/other", "2024-01-03T00:00:00.0000000Z", []byte("{}"))
+	m.deleteBlob(mockContainerName, "env/other")
+
+	report, err := b.CleanupOrphanedSnapshots(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OrphanedSnapshot{{Blob: gone, Timestamp: "2024-01-02T00:00:00.0000000Z"}}
+	if diff := cmp.Diff(want, report.Found); diff != "" {
+		t.Fatalf("unexpected orphans:\n%s", diff)
+	}
+}
+
+func TestBackendDiffSnapshot(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	stateWith := func(names ...string) *states.State {
+		state := states.NewState()
+		root := state.EnsureModule(addrs.RootModuleInstance)
+		for _, name := range names {
+			addr := addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "test_thing", Name: name}.Instance(addrs.NoKey)
+			root.SetResourceInstanceCurrent(addr, &states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectReady,
+				AttrsJSON: []byte(`{}`),
+			}, addrs.AbsProviderConfig{Provider: addrs.NewDefaultProvider("test"), Module: addrs.RootModule})
+		}
+		return state
+	}
+	write := func(file *statefile.File) []byte {
+		var buf bytes.Buffer
+		if err := statefile.Write(file, &buf, b.encryption); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	m.putBlob(mockContainerName, "test.tfstate", write(&statefile.File{Lineage: "diff", Serial: 7, State: stateWith("kept", "new")}), nil)
+	timestamp := "2024-01-02T15:04:05.0000000Z"
+	m.putSnapshot(mockContainerName, "test.tfstate", timestamp, write(&statefile.File{Lineage: "diff", Serial: 4, State: stateWith("kept", "old")}))
+
+	diff, err := b.DiffSnapshot("default", timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SnapshotDiff{
+		CurrentSerial:  7,
+		SnapshotSerial: 4,
+		SerialDelta:    -3,
+		Added:          []string{"test_thing.old"},
+		Removed:        []string{"test_thing.new"},
+	}
+	if d := cmp.Diff(want, diff); d != "" {
+		t.Fatalf("unexpected diff:\n%s", d)
+	}
+}
+
+func TestBackendRestoreSnapshot(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	snapshot := []byte(`{"version": 4, "serial": 1, "lineage": "a"}`)
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 3, "lineage": "a"}`), nil)
+	m.putSnapshot(mockContainerName, "test.tfstate", "2024-01-02T15:04:05.0000000Z", snapshot)
+	m.putSnapshot(mockContainerName, "test.tfstate", "2024-01-02T16:04:05.0000000Z", []byte(`{"version": 4, "serial": 2, "lineage": "a"}`))
+
+	// the current state has changes made after the write that replaced the
+	// snapshot
+	err := b.RestoreSnapshot(backend.DefaultStateName, "2024-01-02T15:04:05.0000000Z", false)
+	if err == nil || !strings.Contains(err.Error(), "has serial 3, newer than the serial 2") {
+		t.Fatalf("expected the restore to be refused, got %v", err)
+	}
+	if got := m.blob(mockContainerName, "test.tfstate"); got.leaseID != "" || string(got.content) == string(snapshot) {
+		t.Fatal("refused restore changed the state or kept it locked")
+	}
+
+	if err := b.RestoreSnapshot(backend.DefaultStateName, "2024-01-02T15:04:05.0000000Z", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.blob(mockContainerName, "test.tfstate"); string(got.content) != string(snapshot) {
+		t.Fatalf("state was not restored, got %s", got.content)
+	}
+}
+
+func TestBackendRestoreSnapshotTakenByPut(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"snapshot": true,
+	})
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 1, "lineage": "a"}`), nil)
+	for _, state := range []string{
+		`{"version": 4, "serial": 2, "lineage": "a"}`,
+		`{"version": 4, "serial": 3, "lineage": "a"}`,
+	} {
+		if err := client.Put([]byte(state)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots := m.blob(mockContainerName, "test.tfstate").snapshots
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+	first, last := snapshots[0].timestamp, snapshots[1].timestamp
+
+	// restoring the first snapshot would also undo the last write
+	err = b.RestoreSnapshot(backend.DefaultStateName, first, false)
+	if err == nil || !strings.Contains(err.Error(), "has serial 3, newer than the serial 2") {
+		t.Fatalf("expected the restore to be refused, got %v", err)
+	}
+
+	// restoring the snapshot taken before the last write only undoes it
+	if err := b.RestoreSnapshot(backend.DefaultStateName, last, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.blob(mockContainerName, "test.tfstate"); string(got.content) != `{"version": 4, "serial": 2, "lineage": "a"}` {
+		t.Fatalf("state was not restored, got %s", got.content)
+	}
+}
+
+func TestBackendRestoreSnapshotLineageChanged(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	// same serial, but the state was replaced after the snapshot was
+	m.putBlob(mockContainerName, "test.tfstate", []byte(`{"version": 4, "serial": 2, "lineage": "new"}`), nil)
+	m.putSnapshot(mockContainerName, "test.tfstate", "2024-01-02T15:04:05.0000000Z", []byte(`{"version": 4, "serial": 1, "lineage": "old"}`))
+	m.putSnapshot(mockContainerName, "test.tfstate", "2024-01-02T16:04:05.0000000Z", []byte(`{"version": 4, "serial": 2, "lineage": "old"}`))
+
+	err := b.RestoreSnapshot(backend.DefaultStateName, "2024-01-02T15:04:05.0000000Z", false)
+	if err == nil || !strings.Contains(err.Error(), `has lineage "new", not the lineage "old"`) {
+		t.Fatalf("expected the restore to be refused, got %v", err)
+	}
+}
+
+func TestBackendSnapshotInterval(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"snapshot":          true,
+		"snapshot_interval": "2s",
+	})
+
+	// The clock doesn't move while the writers wait, so each must be given
+	// a later slot than the ones before it.
+	var mu sync.Mutex
+	var sleeps []time.Duration
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	b.snapshotLimiter.now = func() time.Time { return start }
+	b.snapshotLimiter.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+
+	const writers = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		name := fmt.Sprintf("ws%d", i)
+		m.putBlob(mockContainerName, b.path(name), []byte(`{"version": 4}`), nil)
+
+		client, err := b.remoteClient(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.Put([]byte(`{"version": 4, "serial": 1}`))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := m.requestCount(http.MethodPut, "snapshot"); got != writers {
+		t.Fatalf("expected %d snapshots, got %d", writers, got)
+	}
+	// the first snapshot is taken straight away
+	sort.Slice(sleeps, func(i, j int) bool { return sleeps[i] < sleeps[j] })
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 6 * time.Second, 8 * time.Second}
+	if diff := cmp.Diff(want, sleeps); diff != "" {
+		t.Fatalf("unexpected waits between snapshots:\n%s", diff)
+	}
+}
+
+func TestBackendInvalidSnapshotInterval(t *testing.T) {
+	m := newMockStorage()
+	_, diags := configureBackendWithMockStorage(t, m, map[string]interface{}{
+		"snapshot_interval": "often",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), "invalid snapshot_interval") {
+		t.Fatalf("expected an invalid snapshot_interval to be rejected, got %v", diags.Err())
+	}
+}
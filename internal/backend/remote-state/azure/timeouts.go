@@ -0,0 +1,59 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// The operations of a RemoteClient limited by operation_timeout and
+// lock_timeout, as named in the errors of those that time out.
+const (
+	operationGet     = "get"
+	operationPut     = "put"
+	operationDelete  = "delete"
+	operationLock    = "lock"
+	operationUnlock  = "unlock"
+	operationMigrate = "migrate"
+)
+
+// withTimeout limits the operation of the client named op to the timeout
+// configured for it, if any. The returned function must be called with the
+// operation's error once it's done, and returns the error to report, which
+// names the operation and its timeout when the operation ran out of time.
+func (c *RemoteClient) withTimeout(ctx context.Context, op string) (context.Context, func(error) error) {
+	setting, timeout := "operation_timeout", c.operationTimeout
+	if op == operationLock || op == operationUnlock {
+		setting, timeout = "lock_timeout", c.lockTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	return timeoutCtx, func(err error) error {
+		defer cancel()
+		// only the timeout set here is reported, rather than a deadline of
+		// the caller's
+		if err == nil || ctx.Err() != nil || !errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+
+		wrap := func(err error) error {
+			return fmt.Errorf("%s of state Blob %q exceeded %s of %s: %w", op, c.keyName, setting, timeout, err)
+		}
+		// callers expect lock errors as such, so the error they carry is
+		// wrapped instead
+		if lockErr, ok := err.(*statemgr.LockError); ok {
+			return &statemgr.LockError{Info: lockErr.Info, Err: wrap(lockErr.Err)}
+		}
+		return wrap(err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClientTimeouts(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"operation_timeout": "20ms",
+		"lock_timeout":      "30ms",
+	})
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Azure stops answering
+	m.intercept = func(r *http.Request) *http.Response {
+		<-r.Context().Done()
+		return mockResponse(http.StatusServiceUnavailable, nil, nil)
+	}
+
+	_, err = client.Get()
+	if err == nil || !strings.Contains(err.Error(), `get of state Blob "test.tfstate" exceeded operation_timeout of 20ms`) {
+		t.Fatalf("expected the get to time out, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the error to wrap the deadline, got %v", err)
+	}
+
+	err = client.Put([]byte(`{"version": 4, "serial": 2}`))
+	if err == nil || !strings.Contains(err.Error(), `put of state Blob "test.tfstate" exceeded operation_timeout of 20ms`) {
+		t.Fatalf("expected the put to time out, got %v", err)
+	}
+
+	_, err = client.Lock(statemgr.NewLockInfo())
+	var lockErr *statemgr.LockError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a lock error, got %v", err)
+	}
+	if !strings.Contains(lockErr.Err.Error(), `lock of state Blob "test.tfstate" exceeded lock_timeout of 30ms`) {
+		t.Fatalf("expected the lock to time out, got %v", lockErr.Err)
+	}
+
+	// a deadline of the caller's is reported as is
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetWithContext(ctx); err == nil || strings.Contains(err.Error(), "operation_timeout") {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+}
+
+func TestBackendConfigInvalidTimeout(t *testing.T) {
+	_, diags := configureBackendWithMockStorage(t, newMockStorage(), map[string]interface{}{
+		"lock_timeout": "soon",
+	})
+	if !diags.HasErrors() || !strings.Contains(diags.Err().Error(), `invalid lock_timeout "soon"`) {
+		t.Fatalf("expected the timeout to be refused, got %v", diags.Err())
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// LockMismatchError is the error Unlock returns, wrapped in a
+// statemgr.LockError, when the lock it was asked to release isn't the lock
+// held on the state.
+type LockMismatchError struct {
+	// ID is the lock ID Unlock was called with.
+	ID string
+
+	// Expected is the lock info the client locked the state with, when the
+	// lock ID matches but strict_unlock found the lock held by another
+	// operation. It is nil when the lock ID doesn't match.
+	Expected *statemgr.LockInfo
+
+	// Holder is the lock info of the lock held on the state.
+	Holder *statemgr.LockInfo
+}
+
+func (e *LockMismatchError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("lock id %q does not match existing lock %q held by %q since %s", e.ID, e.Holder.ID, e.Holder.Who, e.Holder.Created.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("lock id %q is held by another operation: locked by %q at %s, not by %q at %s", e.ID, e.Holder.Who, e.Holder.Created.Format(time.RFC3339), e.Expected.Who, e.Expected.Created.Format(time.RFC3339))
+}
+
+// holdLock records the lock info the client locked the state with, for
+// Unlock to check that the lock is still the one it took.
+func (c *RemoteClient) holdLock(info *statemgr.LockInfo) {
+	held := *info
+	c.heldLock = &held
+}
+
+// checkUnlock returns a LockMismatchError unless the lock with the given ID
+// may be released, lockInfo being the lock info stored with the lock.
+//
+// Lock IDs given by the caller may be reused, for example by CI jobs naming
+// locks after their pipeline, and Azure grants a lease with the same ID to
+// whoever takes it once the previous one has been broken. With strictUnlock
+// set, a lock taken by the client is only released if the lock info still
+// records the same holder and creation time.
+func (c *RemoteClient) checkUnlock(id string, lockInfo *statemgr.LockInfo) error {
+	if lockInfo.ID != id {
+		return &LockMismatchError{ID: id, Holder: lockInfo}
+	}
+	if !c.strictUnlock || c.heldLock == nil || c.heldLock.ID != id {
+		return nil
+	}
+	if lockInfo.Who != c.heldLock.Who || !lockInfo.Created.Equal(c.heldLock.Created) {
+		return &LockMismatchError{ID: id, Expected: c.heldLock, Holder: lockInfo}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClientStrictUnlock(t *testing.T) {
+	cases := map[string]struct {
+		lockMethod string
+		strict     bool
+	}{
+		"lease":        {lockMethod: lockMethodLease},
+		"lease strict": {lockMethod: lockMethodLease, strict: true},
+		"blob":         {lockMethod: lockMethodBlob},
+		"blob strict":  {lockMethod: lockMethodBlob, strict: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, map[string]interface{}{
+				"lock_method":   tc.lockMethod,
+				"strict_unlock": tc.strict,
+			})
+			newClient := func() *RemoteClient {
+				t.Helper()
+				client, err := b.remoteClient(backend.DefaultStateName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return client
+			}
+			lockInfo := func(who string) *statemgr.LockInfo {
+				info := statemgr.NewLockInfo()
+				info.ID = "ci-pipeline-42"
+				info.Who = who
+				return info
+			}
+
+			jobA, jobB := newClient(), newClient()
+			if _, err := jobA.Lock(lockInfo("job-a")); err != nil {
+				t.Fatal(err)
+			}
+
+			// job B force-unlocks the lock of job A and locks the state
+			// with the same lock ID
+			if err := jobB.Unlock("ci-pipeline-42"); err != nil {
+				t.Fatal(err)
+			}
+			taken := lockInfo("job-b")
+			taken.Created = taken.Created.Add(time.Minute)
+			if _, err := jobB.Lock(taken); err != nil {
+				t.Fatal(err)
+			}
+
+			err := jobA.Unlock("ci-pipeline-42")
+			if !tc.strict {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var lockErr *statemgr.LockError
+			if !errors.As(err, &lockErr) {
+				t.Fatalf("expected a lock error, got %v", err)
+			}
+			var mismatch *LockMismatchError
+			if !errors.As(lockErr.Err, &mismatch) {
+				t.Fatalf("expected a lock mismatch, got %v", lockErr.Err)
+			}
+			if mismatch.Holder.Who != "job-b" || mismatch.Expected.Who != "job-a" {
+				t.Fatalf("expected the lock of job-b rather than job-a, got %q rather than %q", mismatch.Holder.Who, mismatch.Expected.Who)
+			}
+
+			// the lock of job B is left in place for it to release
+			if err := jobB.Unlock("ci-pipeline-42"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRemoteClientUnlockWrongID(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := client.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Unlock("not-the-lock")
+	var lockErr *statemgr.LockError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a lock error, got %v", err)
+	}
+	var mismatch *LockMismatchError
+	if !errors.As(lockErr.Err, &mismatch) {
+		t.Fatalf("expected a lock mismatch, got %v", lockErr.Err)
+	}
+	if mismatch.ID != "not-the-lock" || mismatch.Holder.ID != id || mismatch.Expected != nil {
+		t.Fatalf("unexpected lock mismatch: %#v", mismatch)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-uuid"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// The errors below are wrapped by the errors Validate returns, telling which
+// access the backend's credentials lack.
+var (
+	ErrContainerMissing  = errors.New("container missing")
+	ErrNoReadPermission  = errors.New("no read permission")
+	ErrNoWritePermission = errors.New("no write permission")
+	ErrNoLeasePermission = errors.New("no lease permission")
+)
+
+// validateLeaseDuration is how long, in seconds, the probe blob is leased
+// for. The lease is released right away, but expires on its own should that
+// fail. Azure grants leases of 15 seconds, but the storage SDK wrongly
+// refuses to request them, so it's a second longer.
+const validateLeaseDuration = 16
+
+// Validate checks that the configured credentials have the access the
+// backend needs, without touching any state: that the container exists,
+// and that a temporary probe blob next to the state can be written, read and
+// leased. The probe blob is removed again. The error tells which access is
+// missing by wrapping ErrContainerMissing, ErrNoReadPermission,
+// ErrNoWritePermission or ErrNoLeasePermission, with a hint at what to
+// grant.
+func (b *Backend) Validate(ctx context.Context) error {
+	containersClient, err := b.armClient.getContainersClient(ctx)
+	if err != nil {
+		return err
+	}
+	if container, err := containersClient.GetProperties(ctx, b.accountName, b.containerName); err != nil {
+		switch {
+		case container.Response.IsHTTPStatus(http.StatusNotFound):
+			return fmt.Errorf("%w: Container %q doesn't exist in Storage Account %q; create it before initializing the backend", ErrContainerMissing, b.containerName, b.accountName)
+		case isForbidden(container.Response):
+			return fmt.Errorf("%w: the properties of Container %q in Storage Account %q can't be read; Azure AD principals need a data role such as Storage Blob Data Reader, and a SAS token must allow read (sp=r): %w", ErrNoReadPermission, b.containerName, b.accountName, err)
+		}
+		return fmt.Errorf("Error retrieving Container %q in Storage Account %q: %w", b.containerName, b.accountName, err)
+	}
+
+	client, err := b.armClient.getBlobClient(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	probeKey := b.keyName + ".validate-" + id
+
+	contentType := "text/plain"
+	content := []byte("OpenTofu access validation")
+	put, err := client.PutBlockBlob(ctx, b.accountName, b.containerName, probeKey, blobs.PutBlockBlobInput{
+		Content:     &content,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		if isForbidden(put) {
+			return fmt.Errorf("%w: Blob %q can't be written to Container %q; Azure AD principals need a data role such as Storage Blob Data Contributor, and a SAS token must allow write (sp=w): %w", ErrNoWritePermission, probeKey, b.containerName, err)
+		}
+		return fmt.Errorf("Error writing Blob %q: %w", probeKey, err)
+	}
+
+	result := multierror.Append(nil, b.validateProbe(ctx, client, probeKey, id))
+	if _, err := client.Delete(ctx, b.accountName, b.containerName, probeKey, blobs.DeleteInput{}); err != nil {
+		result = multierror.Append(result, fmt.Errorf("failed to delete Blob %q; Azure AD principals need a data role such as Storage Blob Data Contributor, and a SAS token must allow delete (sp=d): %w", probeKey, err))
+	}
+	if err := result.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Access to Container %q in Storage Account %q validated", b.containerName, b.accountName)
+	return nil
+}
+
+// validateProbe checks that the probe blob written by Validate can be read
+// and leased.
+func (b *Backend) validateProbe(ctx context.Context, client *blobs.Client, probeKey, leaseID string) error {
+	if get, err := client.Get(ctx, b.accountName, b.containerName, probeKey, blobs.GetInput{}); err != nil {
+		if isForbidden(get.Response) {
+			return fmt.Errorf("%w: Blob %q can't be read from Container %q; Azure AD principals need a data role such as Storage Blob Data Reader, and a SAS token must allow read (sp=r): %w", ErrNoReadPermission, probeKey, b.containerName, err)
+		}
+		return fmt.Errorf("Error reading Blob %q: %w", probeKey, err)
+	}
+
+	lease, err := client.AcquireLease(ctx, b.accountName, b.containerName, probeKey, blobs.AcquireLeaseInput{
+		ProposedLeaseID: &leaseID,
+		LeaseDuration:   validateLeaseDuration,
+	})
+	if err != nil {
+		if isForbidden(lease.Response) || isLeaseUnsupported(lease.Response) {
+			return fmt.Errorf("%w: Blob %q in Container %q can't be leased, so the state can't be locked; Azure AD principals need a data role such as Storage Blob Data Contributor, and a SAS token must allow write (sp=w). Where leasing isn't supported, set lock_method to \"blob\": %w", ErrNoLeasePermission, probeKey, b.containerName, err)
+		}
+		return fmt.Errorf("Error leasing Blob %q: %w", probeKey, err)
+	}
+	if _, err := client.ReleaseLease(ctx, b.accountName, b.containerName, probeKey, lease.LeaseID); err != nil {
+		return fmt.Errorf("%w: the lease on Blob %q can't be released: %w", ErrNoLeasePermission, probeKey, err)
+	}
+	return nil
+}
+
+// isForbidden returns whether resp rejected the request's credentials as not
+// allowed to make it.
+func isForbidden(resp autorest.Response) bool {
+	return resp.Response != nil && resp.StatusCode == http.StatusForbidden
+}
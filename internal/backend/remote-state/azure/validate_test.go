@@ -0,0 +1,93 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBackendValidate(t *testing.T) {
+	forbidden := func(r *http.Request) *http.Response {
+		return mockError(http.StatusForbidden, "AuthorizationPermissionMismatch", "This request is not authorized to perform this operation using this permission.")
+	}
+	cases := map[string]struct {
+		// setup is run against the storage once the backend is configured
+		setup   func(m *mockStorage)
+		wantErr error
+	}{
+		"valid": {},
+		"container missing": {
+			setup: func(m *mockStorage) {
+				delete(m.containers, mockContainerName)
+			},
+			wantErr: ErrContainerMissing,
+		},
+		"no write permission": {
+			setup: func(m *mockStorage) {
+				m.intercept = func(r *http.Request) *http.Response {
+					if r.Method == http.MethodPut && r.URL.Query().Get("comp") == "" {
+						return forbidden(r)
+					}
+					return nil
+				}
+			},
+			wantErr: ErrNoWritePermission,
+		},
+		"no read permission": {
+			setup: func(m *mockStorage) {
+				m.intercept = func(r *http.Request) *http.Response {
+					if r.Method == http.MethodGet && strings.Contains(r.URL.Path, ".validate-") {
+						return forbidden(r)
+					}
+					return nil
+				}
+			},
+			wantErr: ErrNoReadPermission,
+		},
+		"no lease permission": {
+			setup: func(m *mockStorage) {
+				m.intercept = func(r *http.Request) *http.Response {
+					if r.Header.Get("x-ms-lease-action") == "acquire" {
+						return forbidden(r)
+					}
+					return nil
+				}
+			},
+			wantErr: ErrNoLeasePermission,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newMockStorage()
+			b := testBackendWithMockStorage(t, m, nil)
+			if tc.setup != nil {
+				tc.setup(m)
+			}
+
+			err := b.Validate(context.Background())
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			} else if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %q, got %v", tc.wantErr, err)
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for name := range m.containers[mockContainerName] {
+				if strings.Contains(name, ".validate-") {
+					t.Errorf("probe blob %q was left behind", name)
+				}
+			}
+		})
+	}
+}
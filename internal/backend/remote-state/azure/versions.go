@@ -0,0 +1,165 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/containers"
+)
+
+// versioningAPIVersion is the first version of the Blob service API with
+// blob versions. The storage SDK uses an older one, so the requests dealing
+// with versions are changed to use this one.
+const versioningAPIVersion = "2019-12-12"
+
+// StateVersion identifies a version of the state blob kept by Azure when
+// blob versioning is enabled on the storage account.
+type StateVersion struct {
+	// VersionID is Azure's identifier of the version, which is the time it
+	// was created, for example "2024-01-02T15:04:05.1234567Z".
+	VersionID string
+
+	// LastModified is when the version was written.
+	LastModified time.Time
+
+	// IsCurrent is set for the version that is the current state.
+	IsCurrent bool
+}
+
+// listVersionsResult is the part of the response to listing the blobs of a
+// container with their versions that's used, which the storage SDK can't
+// decode.
+type listVersionsResult struct {
+	Blobs []struct {
+		Name             string `xml:"Name"`
+		VersionID        string `xml:"VersionId"`
+		IsCurrentVersion bool   `xml:"IsCurrentVersion"`
+		LastModified     string `xml:"Properties>Last-Modified"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// StateVersions lists the versions of the state blob, oldest first. It fails
+// rather than listing none when blob versioning isn't enabled on the storage
+// account, and lists none when the state has never been written.
+func (c *RemoteClient) StateVersions(ctx context.Context) ([]StateVersion, error) {
+	ctx, requestID, done := c.operationContext(ctx)
+	defer done()
+
+	client := containers.Client{Client: c.giovanniBlobClient.Client, BaseURI: c.giovanniBlobClient.BaseURI}
+	input := containers.ListBlobsInput{
+		Prefix:  &c.keyName,
+		Include: &[]containers.Dataset{"versions"},
+	}
+
+	var versions []StateVersion
+	unversioned := false
+	for {
+		// The storage SDK has no way to list versions, so the request is
+		// changed to use an API version that does.
+		req, err := client.ListBlobsPreparer(ctx, c.accountName, c.containerName, input)
+		if err != nil {
+			return nil, fmt.Errorf("error preparing request to list the versions of Blob %q: %w", c.keyName, err)
+		}
+		req.Header.Set("x-ms-version", versioningAPIVersion)
+
+		resp, err := client.ListBlobsSender(req)
+		if err != nil {
+			return nil, c.operationError(fmt.Errorf("error listing the versions of Blob %q: %w", c.keyName, err), requestID)
+		}
+		var result listVersionsResult
+		err = autorest.Respond(
+			resp,
+			client.ByInspecting(),
+			azure.WithErrorUnlessStatusCode(http.StatusOK),
+			autorest.ByUnmarshallingXML(&result),
+			autorest.ByClosing())
+		if err != nil {
+			return nil, c.operationError(fmt.Errorf("error listing the versions of Blob %q: %w", c.keyName, err), requestID)
+		}
+
+		for _, blob := range result.Blobs {
+			// the prefix also matches the blobs named after the state's
+			if blob.Name != c.keyName {
+				continue
+			}
+			if blob.VersionID == "" {
+				unversioned = true
+				continue
+			}
+			modified, err := time.Parse(http.TimeFormat, blob.LastModified)
+			if err != nil {
+				return nil, fmt.Errorf("invalid last modified time %q of version %q of Blob %q: %w", blob.LastModified, blob.VersionID, c.keyName, err)
+			}
+			versions = append(versions, StateVersion{
+				VersionID:    blob.VersionID,
+				LastModified: modified,
+				IsCurrent:    blob.IsCurrentVersion,
+			})
+		}
+
+		if result.NextMarker == "" {
+			break
+		}
+		input.Marker = &result.NextMarker
+	}
+
+	if len(versions) == 0 && unversioned {
+		return nil, fmt.Errorf("blob versioning isn't enabled on Storage Account %q, so there are no versions of Blob %q to list; enable it to keep the history of the state", c.accountName, c.keyName)
+	}
+	return versions, nil
+}
+
+// GetVersion returns the state stored in the given version of the state
+// blob, as listed by StateVersions.
+func (c *RemoteClient) GetVersion(versionID string) (*remote.Payload, error) {
+	if versionID == "" {
+		return nil, fmt.Errorf("a version ID is required")
+	}
+
+	ctx, requestID, done := c.operationContext(context.TODO())
+	defer done()
+
+	result, err := c.getBlobWithParameter(ctx, "versionid", versionID, versioningAPIVersion)
+	if err != nil {
+		if result.Response.IsHTTPStatus(http.StatusNotFound) {
+			return nil, fmt.Errorf("version %q of Blob %q (Container %q / Account %q) does not exist", versionID, c.keyName, c.containerName, c.accountName)
+		}
+		return nil, c.operationError(fmt.Errorf("error retrieving version %q of Blob %q: %w", versionID, c.keyName, err), requestID)
+	}
+
+	return &remote.Payload{Data: result.Contents}, nil
+}
+
+// noHistoryWarning returns a warning when neither snapshots nor blob
+// versioning keep the previous states, so that a state overwritten by a bad
+// apply can't be recovered, or an empty string when versioning is enabled.
+// Versioning is a property of the Storage Account's Blob service, which
+// needs the Resource Group to be read; without it, or without the
+// permission to read it, there's nothing to warn of.
+func (c ArmClient) noHistoryWarning(ctx context.Context) string {
+	if c.blobServicesClient == nil || c.resourceGroupName == "" {
+		return ""
+	}
+
+	properties, err := c.blobServicesClient.GetServiceProperties(ctx, c.resourceGroupName, c.storageAccountName)
+	if err != nil {
+		log.Printf("[DEBUG] Couldn't check whether blob versioning is enabled on Storage Account %q: %s", c.storageAccountName, err)
+		return ""
+	}
+	if properties.BlobServicePropertiesProperties != nil && properties.IsVersioningEnabled != nil && *properties.IsVersioningEnabled {
+		return ""
+	}
+	return fmt.Sprintf("Blob versioning isn't enabled on Storage Account %q, and snapshot isn't set, so no previous state is kept: a state overwritten by a bad apply can't be recovered. Set snapshot to keep a snapshot of every previous state, or enable blob versioning on the Storage Account.", c.storageAccountName)
+}
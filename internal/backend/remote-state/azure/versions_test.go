@@ -0,0 +1,141 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	armStorage "github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2021-01-01/storage"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestRemoteClientStateVersions(t *testing.T) {
+	m := newMockStorage()
+	m.versioning = true
+	b := testBackendWithMockStorage(t, m, nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := []string{
+		`{"version": 4, "serial": 1}`,
+		`{"version": 4, "serial": 2}`,
+		`{"version": 4, "serial": 3}`,
+	}
+	for _, state := range states {
+		if err := client.Put([]byte(state)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the versions of other blobs that share the state's prefix aren't
+	// listed
+	other, err := b.remoteClient("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.StateVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(states) {
+		t.Fatalf("expected %d versions, got %#v", len(states), versions)
+	}
+	for i, version := range versions {
+		if version.IsCurrent != (i == len(versions)-1) {
+			t.Errorf("version %d has IsCurrent %t", i, version.IsCurrent)
+		}
+		if version.LastModified.IsZero() {
+			t.Errorf("version %d has no last modified time", i)
+		}
+	}
+
+	payload, err := client.GetVersion(versions[0].VersionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(payload.Data); got != states[0] {
+		t.Fatalf("expected the first version's state, got %s", got)
+	}
+
+	if _, err := client.GetVersion("2000-01-01T00:00:00.0000000Z"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing version error, got %v", err)
+	}
+}
+
+func TestRemoteClientStateVersionsDisabled(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a state that was never written has no versions either way
+	versions, err := client.StateVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Fatalf("expected no versions, got %#v", versions)
+	}
+
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.StateVersions(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "blob versioning isn't enabled") {
+		t.Fatalf("expected an error for disabled versioning, got %v", err)
+	}
+}
+
+func TestArmClientNoHistoryWarning(t *testing.T) {
+	cases := map[string]struct {
+		status     int
+		properties string
+		want       string
+	}{
+		"enabled":   {status: http.StatusOK, properties: `{"isVersioningEnabled": true}`},
+		"disabled":  {status: http.StatusOK, properties: `{"isVersioningEnabled": false}`, want: "Blob versioning isn't enabled"},
+		"unset":     {status: http.StatusOK, properties: `{}`, want: "Blob versioning isn't enabled"},
+		"forbidden": {status: http.StatusForbidden, properties: `{}`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			blobServicesClient := armStorage.NewBlobServicesClientWithBaseURI("https://management.azure.invalid", "00000000-0000-0000-0000-000000000000")
+			blobServicesClient.Sender = autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+				header := http.Header{}
+				header.Set("Content-Type", "application/json")
+				resp := mockResponse(tc.status, header, []byte(`{"name": "default", "properties": `+tc.properties+`}`))
+				resp.Request = r
+				return resp, nil
+			})
+
+			client := ArmClient{
+				resourceGroupName:  "tofu-rg",
+				storageAccountName: mockAccountName,
+				blobServicesClient: &blobServicesClient,
+			}
+			got := client.noHistoryWarning(context.Background())
+			if tc.want == "" && got != "" {
+				t.Fatalf("expected no warning, got %q", got)
+			}
+			if !strings.Contains(got, tc.want) {
+				t.Fatalf("expected a warning containing %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/tombuildsstuff/giovanni/storage/2018-11-09/blob/blobs"
+)
+
+// workspaceNamesSuffix is appended to the key of the default state to name
+// the blob mapping the state blobs of workspaces back to the workspace names
+// when obfuscate_workspace_names is set.
+const workspaceNamesSuffix = ".workspaces.json"
+
+// workspaceNames is the content of the workspace names blob.
+type workspaceNames struct {
+	Version int `json:"version"`
+
+	// Workspaces maps the hash naming the state blob of each workspace to
+	// the workspace's name.
+	Workspaces map[string]string `json:"workspaces"`
+}
+
+// workspaceNameHash returns the name the state blob of the given workspace
+// has in place of the workspace name when obfuscate_workspace_names is set.
+func workspaceNameHash(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *Backend) workspaceNamesBlob() string {
+	return b.keyName + workspaceNamesSuffix
+}
+
+// readWorkspaceNames returns the mapping from the hashes naming the state
+// blobs of workspaces to the workspace names, which is empty if no
+// workspace has been recorded yet.
+func (b *Backend) readWorkspaceNames(ctx context.Context, client *blobs.Client) (map[string]string, error) {
+	blob, err := client.Get(ctx, b.armClient.storageAccountName, b.containerName, b.workspaceNamesBlob(), blobs.GetInput{})
+	if err != nil {
+		if blob.Response.IsHTTPStatus(http.StatusNotFound) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("error reading workspace names from Blob %q: %w", b.workspaceNamesBlob(), err)
+	}
+
+	var names workspaceNames
+	if err := json.Unmarshal(blob.Contents, &names); err != nil {
+		return nil, fmt.Errorf("invalid workspace names in Blob %q: %w", b.workspaceNamesBlob(), err)
+	}
+	if names.Workspaces == nil {
+		names.Workspaces = map[string]string{}
+	}
+	return names.Workspaces, nil
+}
+
+// recordWorkspaceName adds the given workspace to the workspace names blob,
+// or removes it if remove is set. Azure has no way to update the blob
+// atomically, so workspaces created or deleted concurrently may race.
+func (b *Backend) recordWorkspaceName(ctx context.Context, client *blobs.Client, name string, remove bool) error {
+	names, err := b.readWorkspaceNames(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	hash := workspaceNameHash(name)
+	if _, ok := names[hash]; ok != remove {
+		return nil
+	}
+	if remove {
+		delete(names, hash)
+	} else {
+		names[hash] = name
+	}
+
+	return b.writeWorkspaceNames(ctx, client, names)
+}
+
+// writeWorkspaceNames replaces the content of the workspace names blob with
+// the given mapping from hashes to workspace names.
+func (b *Backend) writeWorkspaceNames(ctx context.Context, client *blobs.Client, names map[string]string) error {
+	data, err := json.Marshal(workspaceNames{Version: 1, Workspaces: names})
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	input := blobs.PutBlockBlobInput{
+		Content:     &data,
+		ContentType: &contentType,
+	}
+	if _, err := client.PutBlockBlob(ctx, b.armClient.storageAccountName, b.containerName, b.workspaceNamesBlob(), input); err != nil {
+		return fmt.Errorf("error writing workspace names to Blob %q: %w", b.workspaceNamesBlob(), err)
+	}
+	return nil
+}
+
+// WorkspaceIndexDrift describes how the workspace names blob kept when
+// obfuscate_workspace_names is set differs from the state blobs that exist.
+type WorkspaceIndexDrift struct {
+	// Missing lists the state blobs that aren't recorded in the index, by
+	// the hash naming them, sorted.
+	Missing []string
+
+	// Extra lists the workspaces recorded in the index whose state blob
+	// doesn't exist, sorted.
+	Extra []string
+}
+
+// InSync reports whether the index matches the state blobs.
+func (d *WorkspaceIndexDrift) InSync() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0
+}
+
+// VerifyWorkspaceIndex compares the workspace names blob with the state
+// blobs in the container, without changing either.
+func (b *Backend) VerifyWorkspaceIndex() (*WorkspaceIndexDrift, error) {
+	ctx := context.TODO()
+	_, drift, err := b.workspaceIndexDrift(ctx)
+	return drift, err
+}
+
+// RebuildWorkspaceIndex rewrites the workspace names blob to match the state
+// blobs in the container. Entries whose state blob doesn't exist are
+// dropped. A workspace name can't be recovered from the hash naming its
+// state blob, so missing entries are only restored for the given names; the
+// returned drift lists what the rebuilt index still lacks.
+func (b *Backend) RebuildWorkspaceIndex(names ...string) (*WorkspaceIndexDrift, error) {
+	if err := b.checkWritable("rebuild the workspace index"); err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+	index, drift, err := b.workspaceIndexDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]string{}
+	for _, name := range names {
+		known[workspaceNameHash(name)] = name
+	}
+	extra := map[string]bool{}
+	for _, name := range drift.Extra {
+		extra[name] = true
+	}
+	for hash, name := range index {
+		if extra[name] {
+			delete(index, hash)
+		}
+	}
+	var missing []string
+	for _, hash := range drift.Missing {
+		name, ok := known[hash]
+		if !ok {
+			missing = append(missing, hash)
+			continue
+		}
+		index[hash] = name
+	}
+
+	if len(missing) < len(drift.Missing) || len(drift.Extra) > 0 {
+		client, err := b.armClient.getBlobClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.writeWorkspaceNames(ctx, client, index); err != nil {
+			return nil, err
+		}
+	}
+	return &WorkspaceIndexDrift{Missing: missing}, nil
+}
+
+// workspaceIndexDrift returns the content of the workspace names blob and
+// how it differs from the state blobs in the container.
+func (b *Backend) workspaceIndexDrift(ctx context.Context) (map[string]string, *WorkspaceIndexDrift, error) {
+	if !b.obfuscateWorkspaceNames {
+		return nil, nil, fmt.Errorf("the workspace index is only kept when obfuscate_workspace_names is set")
+	}
+
+	stateBlobs, err := b.workspaceBlobs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := b.armClient.getBlobClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := b.readWorkspaceNames(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	drift := &WorkspaceIndexDrift{}
+	for hash := range stateBlobs {
+		if _, ok := index[hash]; !ok {
+			drift.Missing = append(drift.Missing, hash)
+		}
+	}
+	for hash, name := range index {
+		if _, ok := stateBlobs[hash]; !ok {
+			drift.Extra = append(drift.Extra, name)
+		}
+	}
+	sort.Strings(drift.Missing)
+	sort.Strings(drift.Extra)
+	return index, drift, nil
+}
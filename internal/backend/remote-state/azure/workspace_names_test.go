@@ -0,0 +1,122 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package azure
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackendWorkspaceIndexDrift(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"obfuscate_workspace_names": true,
+	})
+
+	for _, name := range []string{"customer-acme", "customer-globex"} {
+		if _, err := b.StateMgr(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drift, err := b.VerifyWorkspaceIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.InSync() {
+		t.Fatalf("expected the index to be in sync, got %#v", drift)
+	}
+
+	// Make the index stale: a state blob created without recording its
+	// workspace, and a recorded workspace whose state blob was removed.
+	m.putBlob(mockContainerName, b.path("customer-initech"), []byte(`{"version": 4}`), nil)
+	m.mu.Lock()
+	delete(m.containers[mockContainerName], b.path("customer-globex"))
+	m.mu.Unlock()
+	indexBefore := m.blob(mockContainerName, b.workspaceNamesBlob()).content
+
+	drift, err = b.VerifyWorkspaceIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WorkspaceIndexDrift{
+		Missing: []string{workspaceNameHash("customer-initech")},
+		Extra:   []string{"customer-globex"},
+	}
+	if diff := cmp.Diff(want, drift); diff != "" {
+		t.Fatalf("unexpected drift:\n%s", diff)
+	}
+	if got := m.blob(mockContainerName, b.workspaceNamesBlob()).content; string(got) != string(indexBefore) {
+		t.Fatalf("verifying changed the index: %s", got)
+	}
+
+	drift, err = b.RebuildWorkspaceIndex("customer-initech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.InSync() {
+		t.Fatalf("expected the rebuilt index to be in sync, got %#v", drift)
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{backend.DefaultStateName, "customer-acme", "customer-initech"}, workspaces); diff != "" {
+		t.Fatalf("unexpected workspaces after rebuild:\n%s", diff)
+	}
+}
+
+func TestBackendRebuildWorkspaceIndexUnknownName(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, map[string]interface{}{
+		"obfuscate_workspace_names": true,
+	})
+
+	if _, err := b.StateMgr("customer-acme"); err != nil {
+		t.Fatal(err)
+	}
+	m.putBlob(mockContainerName, b.path("customer-initech"), []byte(`{"version": 4}`), nil)
+
+	// the name of the unrecorded workspace isn't given, so it can't be
+	// restored
+	drift, err := b.RebuildWorkspaceIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WorkspaceIndexDrift{Missing: []string{workspaceNameHash("customer-initech")}}
+	if diff := cmp.Diff(want, drift); diff != "" {
+		t.Fatalf("unexpected remaining drift:\n%s", diff)
+	}
+
+	var index workspaceNames
+	if err := json.Unmarshal(m.blob(mockContainerName, b.workspaceNamesBlob()).content, &index); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, name := range index.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if diff := cmp.Diff([]string{"customer-acme"}, names); diff != "" {
+		t.Fatalf("unexpected index:\n%s", diff)
+	}
+}
+
+func TestBackendVerifyWorkspaceIndexNotObfuscated(t *testing.T) {
+	m := newMockStorage()
+	b := testBackendWithMockStorage(t, m, nil)
+
+	_, err := b.VerifyWorkspaceIndex()
+	if err == nil || !strings.Contains(err.Error(), "obfuscate_workspace_names") {
+		t.Fatalf("expected an error without obfuscate_workspace_names, got %v", err)
+	}
+}
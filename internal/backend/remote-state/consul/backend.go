@@ -7,7 +7,11 @@ package consul
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net"
+	"os"
 	"strings"
 	"time"
 
@@ -151,6 +155,9 @@ func (b *Backend) configure(ctx context.Context) error {
 	if v, ok := data.GetOk("key_file"); ok && v.(string) != "" {
 		config.TLSConfig.KeyFile = v.(string)
 	}
+	if err := validateTLSConfig(&config.TLSConfig); err != nil {
+		return err
+	}
 
 	if v, ok := data.GetOk("http_auth"); ok && v.(string) != "" {
 		auth := v.(string)
@@ -179,6 +186,33 @@ func (b *Backend) configure(ctx context.Context) error {
 	return nil
 }
 
+// validateTLSConfig checks that the files of the TLS configuration can be
+// loaded, so that a mistake is reported when configuring the backend rather
+// than on the first request to Consul.
+func validateTLSConfig(config *consulapi.TLSConfig) error {
+	if config.CertFile != "" && config.KeyFile == "" {
+		return fmt.Errorf("cert_file is set but key_file is not")
+	}
+	if config.KeyFile != "" && config.CertFile == "" {
+		return fmt.Errorf("key_file is set but cert_file is not")
+	}
+	if config.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile); err != nil {
+			return fmt.Errorf("cannot load the client certificate from cert_file and key_file: %w", err)
+		}
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return fmt.Errorf("cannot read ca_file: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ca_file %q doesn't contain any PEM-encoded certificates", config.CAFile)
+		}
+	}
+	return nil
+}
+
 // dialContext is the DialContext function for the consul client transport.
 // This is stored in a package var to inject a different dialer for tests.
 var dialContext = (&net.Dialer{
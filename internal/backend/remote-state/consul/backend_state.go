@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/states"
 	"github.com/opentofu/opentofu/internal/states/remote"
 	"github.com/opentofu/opentofu/internal/states/statemgr"
@@ -69,6 +70,11 @@ func (b *Backend) DeleteWorkspace(name string, _ bool) error {
 }
 
 func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
+	enc, err := encryption.StateEncryptionForWorkspace(b.encryption, name)
+	if err != nil {
+		return nil, err
+	}
+
 	// Determine the path of the data
 	path := b.path(name)
 
@@ -83,7 +89,7 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 			GZip:      gzip,
 			lockState: b.lock,
 		},
-		b.encryption,
+		enc,
 	)
 
 	if !b.lock {
@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 )
@@ -22,6 +24,85 @@ func TestBackend_impl(t *testing.T) {
 	var _ backend.Backend = new(Backend)
 }
 
+func TestBackend_tlsConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"client certificate": {
+			config: map[string]interface{}{
+				"ca_file":   "testdata/certs/ca.cert.pem",
+				"cert_file": "testdata/certs/client.crt",
+				"key_file":  "testdata/certs/client.key",
+			},
+		},
+		"missing key_file": {
+			config: map[string]interface{}{
+				"cert_file": "testdata/certs/client.crt",
+			},
+			wantErr: "cert_file is set but key_file is not",
+		},
+		"missing cert_file": {
+			config: map[string]interface{}{
+				"key_file": "testdata/certs/client.key",
+			},
+			wantErr: "key_file is set but cert_file is not",
+		},
+		"mismatched key pair": {
+			config: map[string]interface{}{
+				"cert_file": "testdata/certs/client.crt",
+				"key_file":  "testdata/certs/ca.cert.pem",
+			},
+			wantErr: "cannot load the client certificate from cert_file and key_file",
+		},
+		"missing ca_file": {
+			config: map[string]interface{}{
+				"ca_file": "testdata/certs/missing.pem",
+			},
+			wantErr: "cannot read ca_file",
+		},
+		"invalid ca_file": {
+			config: map[string]interface{}{
+				"ca_file": "testdata/certs/client.key",
+			},
+			wantErr: "doesn't contain any PEM-encoded certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The backend doesn't connect to Consul when it is configured.
+			test.config["address"] = "127.0.0.1:8501"
+			test.config["scheme"] = "https"
+			test.config["path"] = "tf-unit"
+			body := backend.TestWrapConfig(test.config)
+
+			b := New(encryption.StateEncryptionDisabled())
+			obj, decDiags := hcldec.Decode(body, b.ConfigSchema().DecoderSpec(), nil)
+			if decDiags.HasErrors() {
+				t.Fatal(decDiags.Error())
+			}
+			obj, diags := b.PrepareConfig(obj)
+			if !diags.HasErrors() {
+				diags = diags.Append(b.Configure(obj))
+			}
+
+			if test.wantErr == "" {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected error: %s", diags.Err())
+				}
+				return
+			}
+			if !diags.HasErrors() {
+				t.Fatalf("expected an error")
+			}
+			if got := diags.Err().Error(); !strings.Contains(got, test.wantErr) {
+				t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, test.wantErr)
+			}
+		})
+	}
+}
+
 func newConsulTestServer(t *testing.T) *testutil.TestServer {
 	if os.Getenv("TF_ACC") == "" && os.Getenv("TF_CONSUL_TEST") == "" {
 		t.Skipf("consul server tests require setting TF_ACC or TF_CONSUL_TEST")
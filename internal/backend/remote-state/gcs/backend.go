@@ -15,11 +15,13 @@ import (
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/googleapis/gax-go/v2/callctx"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/httpclient"
 	"github.com/opentofu/opentofu/internal/legacy/helper/schema"
 	"github.com/opentofu/opentofu/version"
+	"golang.org/x/net/http/httpguts"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
@@ -40,6 +42,10 @@ type Backend struct {
 
 	encryptionKey []byte
 	kmsKeyName    string
+
+	// billingProject, when set, is billed for the requests made to a
+	// requester-pays bucket.
+	billingProject string
 }
 
 func New(enc encryption.StateEncryption) backend.Backend {
@@ -120,6 +126,23 @@ func New(enc encryption.StateEncryption) backend.Backend {
 					"GOOGLE_STORAGE_CUSTOM_ENDPOINT",
 				}, nil),
 			},
+
+			"billing_project": {
+				Type:     schema.TypeString,
+				Optional: true,
+				DefaultFunc: schema.MultiEnvDefaultFunc([]string{
+					"GOOGLE_BACKEND_BILLING_PROJECT",
+					"GOOGLE_BILLING_PROJECT",
+				}, nil),
+				Description: "The project to bill for the requests made to a requester-pays bucket",
+			},
+
+			"request_headers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Additional HTTP headers to send with every request to Google Cloud Storage",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
 		},
 	}
 
@@ -139,6 +162,22 @@ func (b *Backend) configure(ctx context.Context) error {
 
 	data := schema.FromContextBackendConfig(b.storageContext)
 
+	// Custom request headers, such as those some VPC Service Controls
+	// perimeters require, are sent with every request made with the context.
+	if v, ok := data.GetOk("request_headers"); ok {
+		var keyvals []string
+		for name, value := range v.(map[string]interface{}) {
+			if !httpguts.ValidHeaderFieldName(name) {
+				return fmt.Errorf("invalid request_headers name %q", name)
+			}
+			if !httpguts.ValidHeaderFieldValue(value.(string)) {
+				return fmt.Errorf("invalid value for request_headers %q", name)
+			}
+			keyvals = append(keyvals, name, value.(string))
+		}
+		b.storageContext = callctx.SetHeaders(b.storageContext, keyvals...)
+	}
+
 	b.bucketName = data.Get("bucket").(string)
 	b.prefix = strings.TrimLeft(data.Get("prefix").(string), "/")
 	if b.prefix != "" && !strings.HasSuffix(b.prefix, "/") {
@@ -247,6 +286,8 @@ func (b *Backend) configure(ctx context.Context) error {
 		b.encryptionKey = k
 	}
 
+	b.billingProject = data.Get("billing_project").(string)
+
 	// Customer-managed encryption
 	kmsName := data.Get("kms_encryption_key").(string)
 	if kmsName != "" {
@@ -255,3 +296,13 @@ func (b *Backend) configure(ctx context.Context) error {
 
 	return nil
 }
+
+// bucket returns a handle for the bucket the states are stored in, billing
+// the requests made with it to the billing project, if any.
+func (b *Backend) bucket() *storage.BucketHandle {
+	h := b.storageClient.Bucket(b.bucketName)
+	if b.billingProject != "" {
+		return h.UserProject(b.billingProject)
+	}
+	return h
+}
@@ -15,6 +15,7 @@ import (
 	"google.golang.org/api/iterator"
 
 	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/states"
 	"github.com/opentofu/opentofu/internal/states/remote"
 	"github.com/opentofu/opentofu/internal/states/statemgr"
@@ -30,8 +31,7 @@ const (
 func (b *Backend) Workspaces() ([]string, error) {
 	states := []string{backend.DefaultStateName}
 
-	bucket := b.storageClient.Bucket(b.bucketName)
-	objs := bucket.Objects(b.storageContext, &storage.Query{
+	objs := b.bucket().Objects(b.storageContext, &storage.Query{
 		Delimiter: "/",
 		Prefix:    b.prefix,
 	})
@@ -87,6 +87,7 @@ func (b *Backend) client(name string) (*remoteClient, error) {
 		lockFilePath:   b.lockFile(name),
 		encryptionKey:  b.encryptionKey,
 		kmsKeyName:     b.kmsKeyName,
+		billingProject: b.billingProject,
 	}, nil
 }
 
@@ -98,7 +99,12 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 		return nil, err
 	}
 
-	st := remote.NewState(c, b.encryption)
+	enc, err := encryption.StateEncryptionForWorkspace(b.encryption, name)
+	if err != nil {
+		return nil, err
+	}
+
+	st := remote.NewState(c, enc)
 
 	// Grab the value
 	if err := st.RefreshState(); err != nil {
@@ -10,13 +10,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	kms "cloud.google.com/go/kms/apiv1"
 	"cloud.google.com/go/storage"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/httpclient"
@@ -75,6 +79,85 @@ func TestStateFile(t *testing.T) {
 	}
 }
 
+func TestBackendBillingProjectAndRequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind": "storage#objects", "items": [{"name": "blue.tfstate"}]}`)
+	}))
+	defer server.Close()
+
+	b := backend.TestBackendConfig(t, New(encryption.StateEncryptionDisabled()), backend.TestWrapConfig(map[string]interface{}{
+		"bucket":                  "requester-pays",
+		"access_token":            "token",
+		"storage_custom_endpoint": server.URL + "/storage/v1/",
+		"billing_project":         "billed-project",
+		"request_headers": map[string]interface{}{
+			"X-Perimeter": "allowed",
+		},
+	})).(*Backend)
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(workspaces, ","), "default,blue"; got != want {
+		t.Fatalf("expected workspaces %s, got %s", want, got)
+	}
+	if err := b.DeleteWorkspace("blue", false); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("expected a list and a delete request, got %d requests", len(requests))
+	}
+	for _, r := range requests {
+		if got := r.URL.Query().Get("userProject"); got != "billed-project" {
+			t.Errorf("%s %s: expected the billing project, got %q", r.Method, r.URL.Path, got)
+		}
+		if got := r.Header.Get("X-Perimeter"); got != "allowed" {
+			t.Errorf("%s %s: expected the request header, got %q", r.Method, r.URL.Path, got)
+		}
+	}
+}
+
+func TestBackendInvalidRequestHeaders(t *testing.T) {
+	t.Parallel()
+
+	b := New(encryption.StateEncryptionDisabled())
+	config := backend.TestWrapConfig(map[string]interface{}{
+		"bucket":       "bucket",
+		"access_token": "token",
+		"request_headers": map[string]interface{}{
+			"X Perimeter": "allowed",
+		},
+	})
+	obj, diags := hcldec.Decode(config, b.ConfigSchema().DecoderSpec(), nil)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	obj, valDiags := b.PrepareConfig(obj)
+	if valDiags.HasErrors() {
+		t.Fatal(valDiags.Err())
+	}
+	confDiags := b.Configure(obj)
+	if !confDiags.HasErrors() || !strings.Contains(confDiags.Err().Error(), "invalid request_headers name") {
+		t.Fatalf("expected the header name to be refused, got %v", confDiags.Err())
+	}
+}
+
 func TestRemoteClient(t *testing.T) {
 	t.Parallel()
 
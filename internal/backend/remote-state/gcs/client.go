@@ -30,6 +30,7 @@ type remoteClient struct {
 	lockFilePath   string
 	encryptionKey  []byte
 	kmsKeyName     string
+	billingProject string
 }
 
 func (c *remoteClient) Get() (payload *remote.Payload, err error) {
@@ -179,8 +180,18 @@ func (c *remoteClient) lockInfo() (*statemgr.LockInfo, error) {
 	return info, nil
 }
 
+// bucket returns a handle for the bucket, billing the requests made with it
+// to the billing project, if any.
+func (c *remoteClient) bucket() *storage.BucketHandle {
+	h := c.storageClient.Bucket(c.bucketName)
+	if c.billingProject != "" {
+		return h.UserProject(c.billingProject)
+	}
+	return h
+}
+
 func (c *remoteClient) stateFile() *storage.ObjectHandle {
-	h := c.storageClient.Bucket(c.bucketName).Object(c.stateFilePath)
+	h := c.bucket().Object(c.stateFilePath)
 	if len(c.encryptionKey) > 0 {
 		return h.Key(c.encryptionKey)
 	}
@@ -192,7 +203,7 @@ func (c *remoteClient) stateFileURL() string {
 }
 
 func (c *remoteClient) lockFile() *storage.ObjectHandle {
-	return c.storageClient.Bucket(c.bucketName).Object(c.lockFilePath)
+	return c.bucket().Object(c.lockFilePath)
 }
 
 func (c *remoteClient) lockFileURL() string {
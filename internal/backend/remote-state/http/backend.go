@@ -38,10 +38,11 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				Description: "The address of the REST endpoint",
 			},
 			"update_method": &schema.Schema{
-				Type:        schema.TypeString,
-				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("TF_HTTP_UPDATE_METHOD", "POST"),
-				Description: "HTTP method to use when updating state",
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("TF_HTTP_UPDATE_METHOD", "POST"),
+				ValidateFunc: validateHTTPMethod,
+				Description:  "HTTP method to use when updating state",
 			},
 			"lock_address": &schema.Schema{
 				Type:        schema.TypeString,
@@ -56,16 +57,33 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				Description: "The address of the unlock REST endpoint",
 			},
 			"lock_method": &schema.Schema{
-				Type:        schema.TypeString,
-				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("TF_HTTP_LOCK_METHOD", "LOCK"),
-				Description: "The HTTP method to use when locking",
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("TF_HTTP_LOCK_METHOD", "LOCK"),
+				ValidateFunc: validateHTTPMethod,
+				Description:  "The HTTP method to use when locking",
 			},
 			"unlock_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("TF_HTTP_UNLOCK_METHOD", "UNLOCK"),
+				ValidateFunc: validateHTTPMethod,
+				Description:  "The HTTP method to use when unlocking",
+			},
+			"lock_action_header": &schema.Schema{
 				Type:        schema.TypeString,
 				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("TF_HTTP_UNLOCK_METHOD", "UNLOCK"),
-				Description: "The HTTP method to use when unlocking",
+				DefaultFunc: schema.EnvDefaultFunc("TF_HTTP_LOCK_ACTION_HEADER", nil),
+				ValidateFunc: func(cv interface{}, ck string) ([]string, []error) {
+					nameRegex := regexp.MustCompile("[^a-zA-Z0-9-_]")
+
+					if name := cv.(string); nameRegex.MatchString(name) {
+						return nil, []error{fmt.Errorf(
+							"%s %q must only contain A-Za-z0-9-_ characters", ck, name)}
+					}
+					return nil, nil
+				},
+				Description: "The name of a header to set to \"lock\" or \"unlock\" in the lock and unlock requests",
 			},
 			"username": &schema.Schema{
 				Type:        schema.TypeString,
@@ -85,6 +103,18 @@ func New(enc encryption.StateEncryption) backend.Backend {
 				Default:     false,
 				Description: "Whether to skip TLS verification.",
 			},
+			"use_conditional_requests": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether to cache the state along with its ETag and only download it again when it changed.",
+			},
+			"compress": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether to gzip-compress the state when updating it.",
+			},
 			"retry_max": &schema.Schema{
 				Type:        schema.TypeInt,
 				Optional:    true,
@@ -155,6 +185,18 @@ func New(enc encryption.StateEncryption) backend.Backend {
 	return b
 }
 
+// methodTokenRegex matches a legal HTTP method, which must be a token as
+// defined by RFC 9110.
+var methodTokenRegex = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+func validateHTTPMethod(cv interface{}, ck string) ([]string, []error) {
+	if method := cv.(string); !methodTokenRegex.MatchString(method) {
+		return nil, []error{fmt.Errorf(
+			"%s %q is not a valid HTTP method", ck, method)}
+	}
+	return nil, nil
+}
+
 type Backend struct {
 	*schema.Backend
 	encryption encryption.StateEncryption
@@ -247,6 +289,13 @@ func (b *Backend) configure(ctx context.Context) error {
 	}
 
 	unlockMethod := data.Get("unlock_method").(string)
+	lockActionHeader := data.Get("lock_action_header").(string)
+	switch strings.ToLower(lockActionHeader) {
+	case "authorization", "content-type", "content-md5":
+		return fmt.Errorf("lock_action_header \"%s\" is reserved", lockActionHeader)
+	}
+
+	compress := data.Get("compress").(bool)
 
 	username := data.Get("username").(string)
 	password := data.Get("password").(string)
@@ -261,6 +310,9 @@ func (b *Backend) configure(ctx context.Context) error {
 			if !ok {
 				return fmt.Errorf("header value for %s must be a string", k)
 			}
+			if lockActionHeader != "" && strings.EqualFold(k, lockActionHeader) {
+				return fmt.Errorf("headers \"%s\" cannot be set when it is the lock_action_header", k)
+			}
 			switch strings.ToLower(k) {
 			case "authorization":
 				if username != "" {
@@ -269,6 +321,11 @@ func (b *Backend) configure(ctx context.Context) error {
 				headers[k] = value
 			case "content-type", "content-md5":
 				return fmt.Errorf("headers \"%s\" is reserved", k)
+			case "content-encoding":
+				if compress {
+					return fmt.Errorf("headers \"%s\" cannot be set when compress is enabled", k)
+				}
+				headers[k] = value
 			default:
 				headers[k] = value
 			}
@@ -293,6 +350,11 @@ func (b *Backend) configure(ctx context.Context) error {
 		UnlockURL:    unlockURL,
 		UnlockMethod: unlockMethod,
 
+		LockActionHeader: lockActionHeader,
+
+		UseConditionalRequests: data.Get("use_conditional_requests").(bool),
+		Compress:               compress,
+
 		Headers:  headers,
 		Username: username,
 		Password: password,
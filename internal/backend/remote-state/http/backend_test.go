@@ -6,9 +6,11 @@
 package http
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/opentofu/opentofu/internal/configs"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/zclconf/go-cty/cty"
@@ -51,20 +53,25 @@ func TestHTTPClientFactory(t *testing.T) {
 	if client.Headers != nil {
 		t.Fatal("Unexpected headers")
 	}
+	if client.UseConditionalRequests {
+		t.Fatal("Unexpected use_conditional_requests")
+	}
 
 	// custom
 	conf = map[string]cty.Value{
-		"address":        cty.StringVal("http://127.0.0.1:8888/foo"),
-		"update_method":  cty.StringVal("BLAH"),
-		"lock_address":   cty.StringVal("http://127.0.0.1:8888/bar"),
-		"lock_method":    cty.StringVal("BLIP"),
-		"unlock_address": cty.StringVal("http://127.0.0.1:8888/baz"),
-		"unlock_method":  cty.StringVal("BLOOP"),
-		"username":       cty.StringVal("user"),
-		"password":       cty.StringVal("pass"),
-		"retry_max":      cty.StringVal("999"),
-		"retry_wait_min": cty.StringVal("15"),
-		"retry_wait_max": cty.StringVal("150"),
+		"address":                  cty.StringVal("http://127.0.0.1:8888/foo"),
+		"update_method":            cty.StringVal("BLAH"),
+		"lock_address":             cty.StringVal("http://127.0.0.1:8888/bar"),
+		"lock_method":              cty.StringVal("BLIP"),
+		"unlock_address":           cty.StringVal("http://127.0.0.1:8888/baz"),
+		"unlock_method":            cty.StringVal("BLOOP"),
+		"lock_action_header":       cty.StringVal("X-Lock-Action"),
+		"use_conditional_requests": cty.True,
+		"username":                 cty.StringVal("user"),
+		"password":                 cty.StringVal("pass"),
+		"retry_max":                cty.StringVal("999"),
+		"retry_wait_min":           cty.StringVal("15"),
+		"retry_wait_max":           cty.StringVal("150"),
 		"headers": cty.MapVal(map[string]cty.Value{
 			"user-defined": cty.StringVal("test"),
 		}),
@@ -87,6 +94,12 @@ func TestHTTPClientFactory(t *testing.T) {
 		t.Fatalf("Unexpected unlock_address \"%s\" vs \"%s\" or unlock_method \"%s\" vs \"%s\"", client.UnlockURL.String(),
 			conf["unlock_address"].AsString(), client.UnlockMethod, conf["unlock_method"])
 	}
+	if client.LockActionHeader != "X-Lock-Action" {
+		t.Fatalf("Expected lock_action_header \"%s\", got \"%s\"", "X-Lock-Action", client.LockActionHeader)
+	}
+	if !client.UseConditionalRequests {
+		t.Fatal("Expected use_conditional_requests to be set")
+	}
 	if client.Username != "user" || client.Password != "pass" {
 		t.Fatalf("Unexpected username \"%s\" vs \"%s\" or password \"%s\" vs \"%s\"", client.Username, conf["username"],
 			client.Password, conf["password"])
@@ -125,6 +138,80 @@ func TestHTTPClientFactory(t *testing.T) {
 	}
 }
 
+func TestHTTPClientFactory_invalid(t *testing.T) {
+	tests := map[string]struct {
+		conf    map[string]cty.Value
+		wantErr string
+	}{
+		"invalid lock method": {
+			conf: map[string]cty.Value{
+				"address":     cty.StringVal("http://127.0.0.1:8888/foo"),
+				"lock_method": cty.StringVal("LOCK IT"),
+			},
+			wantErr: `lock_method "LOCK IT" is not a valid HTTP method`,
+		},
+		"invalid unlock method": {
+			conf: map[string]cty.Value{
+				"address":       cty.StringVal("http://127.0.0.1:8888/foo"),
+				"unlock_method": cty.StringVal(""),
+			},
+			wantErr: `unlock_method "" is not a valid HTTP method`,
+		},
+		"invalid update method": {
+			conf: map[string]cty.Value{
+				"address":       cty.StringVal("http://127.0.0.1:8888/foo"),
+				"update_method": cty.StringVal("PUT/2"),
+			},
+			wantErr: `update_method "PUT/2" is not a valid HTTP method`,
+		},
+		"invalid lock action header": {
+			conf: map[string]cty.Value{
+				"address":            cty.StringVal("http://127.0.0.1:8888/foo"),
+				"lock_action_header": cty.StringVal("X Lock"),
+			},
+			wantErr: `lock_action_header "X Lock" must only contain A-Za-z0-9-_ characters`,
+		},
+		"reserved lock action header": {
+			conf: map[string]cty.Value{
+				"address":            cty.StringVal("http://127.0.0.1:8888/foo"),
+				"lock_action_header": cty.StringVal("Content-Type"),
+			},
+			wantErr: `lock_action_header "Content-Type" is reserved`,
+		},
+		"lock action header in headers": {
+			conf: map[string]cty.Value{
+				"address":            cty.StringVal("http://127.0.0.1:8888/foo"),
+				"lock_action_header": cty.StringVal("X-Lock-Action"),
+				"headers": cty.MapVal(map[string]cty.Value{
+					"x-lock-action": cty.StringVal("lock"),
+				}),
+			},
+			wantErr: `headers "x-lock-action" cannot be set when it is the lock_action_header`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := New(encryption.StateEncryptionDisabled())
+			obj, diags := hcldec.Decode(configs.SynthBody("synth", test.conf), b.ConfigSchema().DecoderSpec(), nil)
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+
+			obj, valDiags := b.PrepareConfig(obj)
+			if !valDiags.HasErrors() {
+				valDiags = valDiags.Append(b.Configure(obj))
+			}
+			if !valDiags.HasErrors() {
+				t.Fatalf("expected an error")
+			}
+			if got := valDiags.Err().Error(); !strings.Contains(got, test.wantErr) {
+				t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, test.wantErr)
+			}
+		})
+	}
+}
+
 func TestHTTPClientFactoryWithEnv(t *testing.T) {
 	// env
 	conf := map[string]string{
@@ -7,6 +7,7 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
@@ -14,6 +15,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/opentofu/opentofu/internal/states/remote"
@@ -32,6 +34,19 @@ type httpClient struct {
 	UnlockURL    *url.URL
 	UnlockMethod string
 
+	// LockActionHeader is the name of a header set to "lock" or "unlock" in
+	// the lock and unlock requests, for servers that can't tell them apart
+	// by their method or address.
+	LockActionHeader string
+
+	// UseConditionalRequests enables caching the state returned by Get along
+	// with its ETag, so that later calls can send If-None-Match and reuse the
+	// cached state when the server responds with 304: Not Modified.
+	UseConditionalRequests bool
+
+	// Compress enables gzip-compressing the state uploaded by Put.
+	Compress bool
+
 	// HTTP
 	Client   *retryablehttp.Client
 	Headers  map[string]string
@@ -40,9 +55,14 @@ type httpClient struct {
 
 	lockID       string
 	jsonLockInfo []byte
+
+	// etag and cachedPayload are the ETag and the state from the last
+	// successful Get, when UseConditionalRequests is set.
+	etag          string
+	cachedPayload *remote.Payload
 }
 
-func (c *httpClient) httpRequest(method string, url *url.URL, data []byte, what string) (*http.Response, error) {
+func (c *httpClient) httpRequest(method string, url *url.URL, data []byte, header http.Header, what string) (*http.Response, error) {
 	var body interface{}
 	if len(data) > 0 {
 		body = data
@@ -59,6 +79,11 @@ func (c *httpClient) httpRequest(method string, url *url.URL, data []byte, what
 		req.Header.Set(k, v)
 	}
 
+	// Add the headers specific to this request
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
 	if c.Username != "" {
 		req.SetBasicAuth(c.Username, c.Password)
 	}
@@ -82,6 +107,17 @@ func (c *httpClient) httpRequest(method string, url *url.URL, data []byte, what
 	return resp, nil
 }
 
+// lockActionHeader returns the header that identifies the given locking
+// action, if LockActionHeader is set.
+func (c *httpClient) lockActionHeader(action string) http.Header {
+	if c.LockActionHeader == "" {
+		return nil
+	}
+	header := make(http.Header)
+	header.Set(c.LockActionHeader, action)
+	return header
+}
+
 func (c *httpClient) Lock(info *statemgr.LockInfo) (string, error) {
 	if c.LockURL == nil {
 		return "", nil
@@ -89,7 +125,7 @@ func (c *httpClient) Lock(info *statemgr.LockInfo) (string, error) {
 	c.lockID = ""
 
 	jsonLockInfo := info.Marshal()
-	resp, err := c.httpRequest(c.LockMethod, c.LockURL, jsonLockInfo, "lock")
+	resp, err := c.httpRequest(c.LockMethod, c.LockURL, jsonLockInfo, c.lockActionHeader("lock"), "lock")
 	if err != nil {
 		return "", err
 	}
@@ -134,7 +170,7 @@ func (c *httpClient) Unlock(id string) error {
 		return nil
 	}
 
-	resp, err := c.httpRequest(c.UnlockMethod, c.UnlockURL, c.jsonLockInfo, "unlock")
+	resp, err := c.httpRequest(c.UnlockMethod, c.UnlockURL, c.jsonLockInfo, c.lockActionHeader("unlock"), "unlock")
 	if err != nil {
 		return err
 	}
@@ -149,7 +185,15 @@ func (c *httpClient) Unlock(id string) error {
 }
 
 func (c *httpClient) Get() (*remote.Payload, error) {
-	resp, err := c.httpRequest(http.MethodGet, c.URL, nil, "get state")
+	// Only ask for the state if it changed when we have a copy to reuse.
+	var header http.Header
+	cached := c.cachedPayload
+	if c.UseConditionalRequests && c.etag != "" {
+		header = make(http.Header)
+		header.Set("If-None-Match", c.etag)
+	}
+
+	resp, err := c.httpRequest(http.MethodGet, c.URL, nil, header, "get state")
 	if err != nil {
 		return nil, err
 	}
@@ -159,9 +203,25 @@ func (c *httpClient) Get() (*remote.Payload, error) {
 	switch resp.StatusCode {
 	case http.StatusOK:
 		// Handled after
+	case http.StatusNotModified:
+		if header == nil {
+			return nil, fmt.Errorf("Unexpected HTTP response code %d to a request without If-None-Match", resp.StatusCode)
+		}
+		if cached == nil {
+			// We have nothing to reuse, so fetch the state again without
+			// the condition instead.
+			c.invalidateCache()
+			return c.Get()
+		}
+		return &remote.Payload{
+			Data: bytes.Clone(cached.Data),
+			MD5:  bytes.Clone(cached.MD5),
+		}, nil
 	case http.StatusNoContent:
+		c.invalidateCache()
 		return nil, nil
 	case http.StatusNotFound:
+		c.invalidateCache()
 		return nil, nil
 	case http.StatusUnauthorized:
 		return nil, fmt.Errorf("HTTP remote state endpoint requires auth")
@@ -173,9 +233,20 @@ func (c *httpClient) Get() (*remote.Payload, error) {
 		return nil, fmt.Errorf("Unexpected HTTP response code %d", resp.StatusCode)
 	}
 
-	// Read in the body
+	// Read in the body, decompressing it if needed. The HTTP client already
+	// does this itself when it asked for a compressed response.
+	var body io.Reader = resp.Body
+	compressed := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && !resp.Uncompressed
+	if compressed {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress remote state: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
 	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, resp.Body); err != nil {
+	if _, err := io.Copy(buf, body); err != nil {
 		return nil, fmt.Errorf("Failed to read remote state: %w", err)
 	}
 
@@ -186,11 +257,13 @@ func (c *httpClient) Get() (*remote.Payload, error) {
 
 	// If there was no data, then return nil
 	if len(payload.Data) == 0 {
+		c.invalidateCache()
 		return nil, nil
 	}
 
-	// Check for the MD5
-	if raw := resp.Header.Get("Content-MD5"); raw != "" {
+	// Check for the MD5, which describes the compressed body if the state
+	// was compressed.
+	if raw := resp.Header.Get("Content-MD5"); raw != "" && !compressed {
 		md5, err := base64.StdEncoding.DecodeString(raw)
 		if err != nil {
 			return nil, fmt.Errorf(
@@ -204,9 +277,25 @@ func (c *httpClient) Get() (*remote.Payload, error) {
 		payload.MD5 = hash[:]
 	}
 
+	c.invalidateCache()
+	if etag := resp.Header.Get("ETag"); c.UseConditionalRequests && etag != "" {
+		c.etag = etag
+		c.cachedPayload = &remote.Payload{
+			Data: bytes.Clone(payload.Data),
+			MD5:  bytes.Clone(payload.MD5),
+		}
+	}
+
 	return payload, nil
 }
 
+// invalidateCache forgets the state cached for conditional requests, so that
+// the next Get fetches it unconditionally.
+func (c *httpClient) invalidateCache() {
+	c.etag = ""
+	c.cachedPayload = nil
+}
+
 func (c *httpClient) Put(data []byte) error {
 	// Copy the target URL
 	base := *c.URL
@@ -230,7 +319,22 @@ func (c *httpClient) Put(data []byte) error {
 	if c.UpdateMethod != "" {
 		method = c.UpdateMethod
 	}
-	resp, err := c.httpRequest(method, &base, data, "upload state")
+	var header http.Header
+	if c.Compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return fmt.Errorf("Failed to compress state: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("Failed to compress state: %w", err)
+		}
+		data = buf.Bytes()
+		header = make(http.Header)
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := c.httpRequest(method, &base, data, header, "upload state")
 	if err != nil {
 		return err
 	}
@@ -239,7 +343,14 @@ func (c *httpClient) Put(data []byte) error {
 	// Handle the error codes
 	switch resp.StatusCode {
 	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		// The state we cached is now outdated.
+		c.invalidateCache()
 		return nil
+	case http.StatusUnsupportedMediaType:
+		if c.Compress {
+			return fmt.Errorf("HTTP remote state endpoint rejected the gzip-compressed state (HTTP error %d); disable the compress option if the server doesn't support compressed requests", resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP error: %d", resp.StatusCode)
 	default:
 		return fmt.Errorf("HTTP error: %d", resp.StatusCode)
 	}
@@ -247,7 +358,7 @@ func (c *httpClient) Put(data []byte) error {
 
 func (c *httpClient) Delete() error {
 	// Make the request
-	resp, err := c.httpRequest(http.MethodDelete, c.URL, nil, "delete state")
+	resp, err := c.httpRequest(http.MethodDelete, c.URL, nil, nil, "delete state")
 	if err != nil {
 		return err
 	}
@@ -256,6 +367,7 @@ func (c *httpClient) Delete() error {
 	// Handle the error codes
 	switch resp.StatusCode {
 	case http.StatusOK:
+		c.invalidateCache()
 		return nil
 	default:
 		return fmt.Errorf("HTTP error: %d", resp.StatusCode)
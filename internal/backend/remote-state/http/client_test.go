@@ -7,12 +7,16 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-retryablehttp"
@@ -95,6 +99,44 @@ func TestHTTPClient(t *testing.T) {
 	}
 	remote.TestRemoteLocks(t, a, b)
 
+	// Test locking with a custom method and an action header
+	actionHandler := &testHTTPHandler{LockActionHeader: "X-Lock-Action"}
+	ts = httptest.NewServer(http.HandlerFunc(actionHandler.Handle))
+	defer ts.Close()
+
+	url, err = url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	lockURL, err := url.Parse(ts.URL + "?action=lock")
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	unlockURL, err := url.Parse(ts.URL + "?action=unlock")
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	a = &httpClient{
+		URL:              url,
+		LockURL:          lockURL,
+		LockMethod:       "POST",
+		UnlockURL:        unlockURL,
+		UnlockMethod:     "POST",
+		LockActionHeader: "X-Lock-Action",
+		Client:           retryablehttp.NewClient(),
+	}
+	b = &httpClient{
+		URL:              url,
+		LockURL:          lockURL,
+		LockMethod:       "POST",
+		UnlockURL:        unlockURL,
+		UnlockMethod:     "POST",
+		LockActionHeader: "X-Lock-Action",
+		Client:           retryablehttp.NewClient(),
+	}
+	remote.TestClient(t, a)
+	remote.TestRemoteLocks(t, a, b)
+
 	// test a WebDAV-ish backend
 	davhandler := new(testHTTPHandler)
 	ts = httptest.NewServer(http.HandlerFunc(davhandler.HandleWebDAV))
@@ -127,12 +169,220 @@ func TestHTTPClient(t *testing.T) {
 	remote.TestClient(t, client)
 }
 
+func TestHTTPClient_conditionalRequests(t *testing.T) {
+	handler := &testETagHTTPHandler{testHTTPHandler: new(testHTTPHandler)}
+	ts := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer ts.Close()
+
+	url, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	client := &httpClient{
+		URL:                    url,
+		UseConditionalRequests: true,
+		Client:                 retryablehttp.NewClient(),
+	}
+
+	get := func(want string, wantFull, wantNotModified int) {
+		t.Helper()
+		payload, err := client.Get()
+		if err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		if payload == nil || string(payload.Data) != want {
+			t.Fatalf("wrong state %#v, want %q", payload, want)
+		}
+		if handler.full != wantFull || handler.notModified != wantNotModified {
+			t.Fatalf("wrong responses: %d full and %d not modified, want %d and %d",
+				handler.full, handler.notModified, wantFull, wantNotModified)
+		}
+	}
+
+	if err := client.Put([]byte("first")); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	get("first", 1, 0)
+	// The second read reuses the cached state.
+	get("first", 1, 1)
+
+	// A successful Put invalidates the cache, so the next read is
+	// unconditional.
+	if err := client.Put([]byte("second")); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	get("second", 2, 1)
+	if handler.lastIfNoneMatch != "" {
+		t.Fatalf("unexpected If-None-Match %q after Put", handler.lastIfNoneMatch)
+	}
+
+	// A change made by someone else is downloaded again.
+	handler.Data = []byte("third")
+	get("third", 3, 1)
+	if handler.lastIfNoneMatch == "" {
+		t.Fatal("expected If-None-Match to be sent")
+	}
+}
+
+func TestHTTPClient_compress(t *testing.T) {
+	handler := &testGzipHTTPHandler{testHTTPHandler: new(testHTTPHandler), t: t}
+	ts := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer ts.Close()
+
+	url, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"decompressed by the HTTP client": nil,
+		// Asking for the encoding ourselves stops the HTTP client from
+		// decompressing the response transparently.
+		"decompressed by the backend": {"Accept-Encoding": "gzip"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := &httpClient{
+				URL:          url,
+				LockURL:      url,
+				LockMethod:   "LOCK",
+				UnlockURL:    url,
+				UnlockMethod: "UNLOCK",
+				Compress:     true,
+				Headers:      headers,
+				Client:       retryablehttp.NewClient(),
+			}
+			b := &httpClient{
+				URL:          url,
+				LockURL:      url,
+				LockMethod:   "LOCK",
+				UnlockURL:    url,
+				UnlockMethod: "UNLOCK",
+				Compress:     true,
+				Headers:      headers,
+				Client:       retryablehttp.NewClient(),
+			}
+			remote.TestClient(t, a)
+			remote.TestRemoteLocks(t, a, b)
+		})
+	}
+	if handler.compressedPuts == 0 {
+		t.Fatal("expected the state to be uploaded compressed")
+	}
+
+	// A server that doesn't support compressed requests
+	handler.rejectGzip = true
+	client := &httpClient{URL: url, Compress: true, Client: retryablehttp.NewClient()}
+	err = client.Put([]byte("state"))
+	if err == nil || !strings.Contains(err.Error(), "rejected the gzip-compressed state") {
+		t.Fatalf("expected an error about the compressed state, got: %v", err)
+	}
+}
+
+// testGzipHTTPHandler stores the state uploaded compressed by the client,
+// and returns it compressed.
+type testGzipHTTPHandler struct {
+	*testHTTPHandler
+	t *testing.T
+
+	rejectGzip     bool
+	compressedPuts int
+}
+
+func (h *testGzipHTTPHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	encoding := r.Header.Get("Content-Encoding")
+	switch r.Method {
+	case "LOCK", "UNLOCK":
+		if encoding != "" {
+			h.t.Errorf("unexpected Content-Encoding %q for the %s request", encoding, r.Method)
+		}
+		h.testHTTPHandler.Handle(w, r)
+	case "POST":
+		if encoding != "gzip" {
+			h.t.Errorf("expected the state to be compressed, got Content-Encoding %q", encoding)
+		}
+		if h.rejectGzip {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		data, err := io.ReadAll(gz)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		h.compressedPuts++
+		h.Data = data
+	case "GET":
+		if len(h.Data) == 0 {
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(h.Data)
+		gz.Close()
+	default:
+		h.testHTTPHandler.Handle(w, r)
+	}
+}
+
+// testETagHTTPHandler adds ETags to the state returned by testHTTPHandler,
+// and counts how many times it was returned in full.
+type testETagHTTPHandler struct {
+	*testHTTPHandler
+
+	full            int
+	notModified     int
+	lastIfNoneMatch string
+}
+
+func (h *testETagHTTPHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.testHTTPHandler.Handle(w, r)
+		return
+	}
+
+	hash := md5.Sum(h.Data)
+	etag := fmt.Sprintf("%q", base64.StdEncoding.EncodeToString(hash[:]))
+	h.lastIfNoneMatch = r.Header.Get("If-None-Match")
+	if h.lastIfNoneMatch == etag {
+		h.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.full++
+	w.Header().Set("ETag", etag)
+	w.Write(h.Data)
+}
+
 type testHTTPHandler struct {
 	Data   []byte
 	Locked bool
+
+	// LockActionHeader, when set, is the header that distinguishes the lock
+	// and unlock requests from the updates of the state.
+	LockActionHeader string
 }
 
 func (h *testHTTPHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if h.LockActionHeader != "" {
+		switch r.Header.Get(h.LockActionHeader) {
+		case "lock":
+			if h.Locked {
+				w.WriteHeader(423)
+			} else {
+				h.Locked = true
+			}
+			return
+		case "unlock":
+			h.Locked = false
+			return
+		}
+	}
+
 	switch r.Method {
 	case "GET":
 		w.Write(h.Data)
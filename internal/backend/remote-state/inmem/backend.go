@@ -124,11 +124,15 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 
 	s := states.m[name]
 	if s == nil {
+		enc, err := encryption.StateEncryptionForWorkspace(b.encryption, name)
+		if err != nil {
+			return nil, err
+		}
 		s = remote.NewState(
 			&RemoteClient{
 				Name: name,
 			},
-			b.encryption,
+			enc,
 		)
 		states.m[name] = s
 
@@ -53,6 +53,9 @@ type Backend struct {
 	ddbTable              string
 	workspaceKeyPrefix    string
 	skipS3Checksum        bool
+
+	bypassGovernanceRetention bool
+	deleteAllVersions         bool
 }
 
 // ConfigSchema returns a description of the expected configuration
@@ -453,6 +456,16 @@ See details: https://cs.opensource.google/go/x/net/+/refs/tags/v0.17.0:http/http
 				Optional:    true,
 				Description: "Do not include checksum when uploading S3 Objects. Useful for some S3-Compatible APIs as some of them do not support checksum checks.",
 			},
+			"bypass_governance_retention": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Bypass governance mode object lock retention when deleting the versions of state objects. Requires the s3:BypassGovernanceRetention permission.",
+			},
+			"delete_all_versions": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Permanently delete every version of a state object when deleting it, rather than adding a delete marker in a versioned bucket.",
+			},
 		},
 	}
 }
@@ -672,6 +685,8 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 	b.kmsKeyID = stringAttr(obj, "kms_key_id")
 	b.ddbTable = stringAttr(obj, "dynamodb_table")
 	b.skipS3Checksum = boolAttr(obj, "skip_s3_checksum")
+	b.bypassGovernanceRetention = boolAttr(obj, "bypass_governance_retention")
+	b.deleteAllVersions = boolAttr(obj, "delete_all_versions")
 
 	if customerKey, ok := stringAttrOk(obj, "sse_customer_key"); ok {
 		if len(customerKey) != 44 {
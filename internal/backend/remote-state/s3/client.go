@@ -50,6 +50,12 @@ type RemoteClient struct {
 	ddbTable              string
 
 	skipS3Checksum bool
+
+	// deleteAllVersions deletes every version of the state object rather
+	// than adding a delete marker, and bypassGovernanceRetention lets it
+	// delete the versions protected by an object lock in governance mode.
+	deleteAllVersions         bool
+	bypassGovernanceRetention bool
 }
 
 var (
@@ -255,11 +261,15 @@ func (c *RemoteClient) Delete() error {
 	ctx := context.TODO()
 	ctx, _ = attachLoggerToContext(ctx)
 
-	_, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: &c.bucketName,
-		Key:    &c.path,
-	})
-
+	var err error
+	if c.deleteAllVersions {
+		err = c.deleteVersions(ctx)
+	} else {
+		_, err = c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: &c.bucketName,
+			Key:    &c.path,
+		})
+	}
 	if err != nil {
 		return err
 	}
@@ -271,6 +281,77 @@ func (c *RemoteClient) Delete() error {
 	return nil
 }
 
+// deleteVersions permanently deletes every version of the state object, and
+// its delete markers. In a versioned bucket, deleting an object without a
+// version ID only adds a delete marker, which leaves the versions in place.
+// With bypassGovernanceRetention, the deletes bypass the retention of an
+// object lock in governance mode, which the delete marker doesn't need.
+func (c *RemoteClient) deleteVersions(ctx context.Context) error {
+	paginator := s3.NewListObjectVersionsPaginator(c.s3Client, &s3.ListObjectVersionsInput{
+		Bucket: &c.bucketName,
+		Prefix: &c.path,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list the versions of state object %q in bucket %q: %w", c.path, c.bucketName, err)
+		}
+
+		var versionIDs []*string
+		for _, version := range page.Versions {
+			if aws.ToString(version.Key) == c.path {
+				versionIDs = append(versionIDs, version.VersionId)
+			}
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) == c.path {
+				versionIDs = append(versionIDs, marker.VersionId)
+			}
+		}
+
+		for _, versionID := range versionIDs {
+			log.Printf("[DEBUG] Deleting version %q of state object %q", aws.ToString(versionID), c.path)
+			input := &s3.DeleteObjectInput{
+				Bucket:    &c.bucketName,
+				Key:       &c.path,
+				VersionId: versionID,
+			}
+			if c.bypassGovernanceRetention {
+				input.BypassGovernanceRetention = aws.Bool(true)
+			}
+			if _, err := c.s3Client.DeleteObject(ctx, input); err != nil {
+				if c.bypassGovernanceRetention {
+					if retentionErr := c.complianceRetentionError(ctx, versionID); retentionErr != nil {
+						return retentionErr
+					}
+				}
+				return fmt.Errorf("failed to delete version %q of state object %q in bucket %q: %w", aws.ToString(versionID), c.path, c.bucketName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// complianceRetentionError returns an error explaining why a version of the
+// state object couldn't be deleted if it's retained by an object lock in
+// compliance mode, which unlike governance mode can't be bypassed by anyone.
+// It returns nil if the retention can't be read or isn't in compliance mode.
+func (c *RemoteClient) complianceRetentionError(ctx context.Context, versionID *string) error {
+	out, err := c.s3Client.GetObjectRetention(ctx, &s3.GetObjectRetentionInput{
+		Bucket:    &c.bucketName,
+		Key:       &c.path,
+		VersionId: versionID,
+	})
+	if err != nil || out.Retention == nil || out.Retention.Mode != types.ObjectLockRetentionModeCompliance {
+		return nil
+	}
+	until := "its retention period ends"
+	if out.Retention.RetainUntilDate != nil {
+		until = out.Retention.RetainUntilDate.UTC().Format(time.RFC3339)
+	}
+	return fmt.Errorf("version %q of state object %q in bucket %q is retained by an object lock in compliance mode until %s: bypass_governance_retention only bypasses governance mode, so it can't be deleted before then", aws.ToString(versionID), c.path, c.bucketName, until)
+}
+
 func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
 	if c.ddbTable == "" {
 		return "", nil
@@ -10,10 +10,14 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/encryption"
 	"github.com/opentofu/opentofu/internal/states/remote"
@@ -361,3 +365,95 @@ func TestRemoteClient_IsLockingEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoteClientDeleteBypassGovernanceRetention(t *testing.T) {
+	const path = "env:/blue/terraform.tfstate"
+
+	cases := map[string]struct {
+		allVersions bool
+		retention   string
+		wantDeleted string
+		wantErr     string
+	}{
+		"delete marker": {
+			// without a version ID the delete only adds a delete marker,
+			// which retention doesn't prevent
+			wantDeleted: "",
+		},
+		"governance mode": {
+			allVersions: true,
+			wantDeleted: "v2,v1,v3",
+		},
+		"compliance mode": {
+			allVersions: true,
+			retention:   "COMPLIANCE",
+			wantErr:     `version "v2" of state object "env:/blue/terraform.tfstate" in bucket "bucket" is retained by an object lock in compliance mode until 2030-01-02T03:04:05Z`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// The bucket is versioned, as object lock requires: the state
+			// has two versions and a delete marker, next to another object
+			// sharing its prefix.
+			var deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				switch {
+				case r.Method == http.MethodGet && query.Has("versions"):
+					fmt.Fprintf(w, `<ListVersionsResult><Name>bucket</Name><Prefix>%[1]s</Prefix><IsTruncated>false</IsTruncated>`+
+						`<Version><Key>%[1]s</Key><VersionId>v2</VersionId><IsLatest>false</IsLatest></Version>`+
+						`<Version><Key>%[1]s</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest></Version>`+
+						`<Version><Key>%[1]s.backup</Key><VersionId>b1</VersionId><IsLatest>true</IsLatest></Version>`+
+						`<DeleteMarker><Key>%[1]s</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest></DeleteMarker>`+
+						`</ListVersionsResult>`, path)
+				case r.Method == http.MethodDelete:
+					bypass := r.Header.Get("x-amz-bypass-governance-retention") == "true"
+					if versioned := query.Has("versionId"); bypass != versioned {
+						t.Errorf("delete of version %q sent bypass governance retention %t", query.Get("versionId"), bypass)
+					}
+					if tc.retention != "" && query.Get("versionId") == "v2" {
+						w.WriteHeader(http.StatusForbidden)
+						fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+						return
+					}
+					if query.Has("versionId") {
+						deleted = append(deleted, query.Get("versionId"))
+					}
+					w.WriteHeader(http.StatusNoContent)
+				case query.Has("retention") && query.Get("versionId") == "v2":
+					fmt.Fprintf(w, `<Retention><Mode>%s</Mode><RetainUntilDate>2030-01-02T03:04:05Z</RetainUntilDate></Retention>`, tc.retention)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client := &RemoteClient{
+				s3Client: s3.New(s3.Options{
+					BaseEndpoint: aws.String(server.URL),
+					Region:       "us-east-1",
+					UsePathStyle: true,
+					Credentials:  aws.AnonymousCredentials{},
+				}),
+				bucketName:                "bucket",
+				path:                      path,
+				deleteAllVersions:         tc.allVersions,
+				bypassGovernanceRetention: true,
+			}
+
+			err := client.Delete()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(deleted, ","); got != tc.wantDeleted {
+				t.Fatalf("deleted versions %q, want %q", got, tc.wantDeleted)
+			}
+		})
+	}
+}
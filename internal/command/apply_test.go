@@ -828,6 +828,9 @@ func TestApply_plan_remoteState(t *testing.T) {
 		"unlock_address":            cty.NullVal(cty.String),
 		"lock_method":               cty.NullVal(cty.String),
 		"unlock_method":             cty.NullVal(cty.String),
+		"lock_action_header":        cty.NullVal(cty.String),
+		"use_conditional_requests":  cty.NullVal(cty.Bool),
+		"compress":                  cty.NullVal(cty.Bool),
 		"username":                  cty.NullVal(cty.String),
 		"password":                  cty.NullVal(cty.String),
 		"skip_cert_verification":    cty.NullVal(cty.Bool),
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/opentofu/opentofu/internal/addrs"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/command/arguments"
 	"github.com/opentofu/opentofu/internal/dag"
@@ -32,6 +33,8 @@ func (c *GraphCommand) Run(args []string) int {
 	var moduleDepth int
 	var verbose bool
 	var planPath string
+	var focusRaw FlagStringSlice
+	var focusDepth int
 
 	args = c.Meta.process(args)
 	cmdFlags := c.Meta.defaultFlagSet("graph")
@@ -41,6 +44,8 @@ func (c *GraphCommand) Run(args []string) int {
 	cmdFlags.IntVar(&moduleDepth, "module-depth", -1, "module-depth")
 	cmdFlags.BoolVar(&verbose, "verbose", false, "verbose")
 	cmdFlags.StringVar(&planPath, "plan", "", "plan")
+	cmdFlags.Var(&focusRaw, "focus", "resource address")
+	cmdFlags.IntVar(&focusDepth, "focus-depth", -1, "focus-depth")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
@@ -53,6 +58,24 @@ func (c *GraphCommand) Run(args []string) int {
 		return 1
 	}
 
+	var focus []addrs.Targetable
+	for _, raw := range focusRaw {
+		target, targetDiags := addrs.ParseTargetStr(raw)
+		if targetDiags.HasErrors() {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				fmt.Sprintf("Invalid focus address %q", raw),
+				targetDiags[0].Description().Detail,
+			))
+			continue
+		}
+		focus = append(focus, target.Subject)
+	}
+	if diags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
 	// Check for user-supplied plugin path
 	if c.pluginPath, err = c.loadPluginPath(); err != nil {
 		c.Ui.Error(fmt.Sprintf("Error loading plugin path: %s", err))
@@ -224,6 +247,13 @@ func (c *GraphCommand) Run(args []string) int {
 		return 1
 	}
 
+	if len(focus) > 0 {
+		if err := tofu.FocusGraph(g, focus, focusDepth); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error filtering graph: %s", err))
+			return 1
+		}
+	}
+
 	graphStr, err := tofu.GraphDot(g, &dag.DotOpts{
 		DrawCycles: drawCycles,
 		MaxDepth:   moduleDepth,
@@ -270,6 +300,15 @@ Options:
                    plan-destroy, or apply. By default OpenTofu chooses
 				   "plan", or "apply" if you also set the -plan=... option.
 
+  -focus=resource  Only render the given resource, along with the objects it
+                   depends on and the objects that depend on it. Use this
+                   option more than once to include more than one resource.
+
+  -focus-depth=n   When used with -focus, limit the objects included to those
+                   within n steps of the given resources. By default, all of
+                   the direct and indirect dependencies and dependents are
+                   included.
+
   -module-depth=n  (deprecated) In prior versions of OpenTofu, specified the
 				   depth of modules to show in the output.
 
@@ -105,6 +105,81 @@ func TestGraph_noConfig(t *testing.T) {
 	}
 }
 
+func TestGraph_focus(t *testing.T) {
+	tests := map[string]struct {
+		args    []string
+		want    []string
+		wantNot []string
+	}{
+		"unlimited depth": {
+			args:    []string{"-focus=test_instance.b"},
+			want:    []string{"test_instance.a", "test_instance.b", "test_instance.c", "test_instance.d"},
+			wantNot: []string{"test_instance.unrelated"},
+		},
+		"depth": {
+			args:    []string{"-focus=test_instance.b", "-focus-depth=1"},
+			want:    []string{"test_instance.a", "test_instance.b", "test_instance.c"},
+			wantNot: []string{"test_instance.d", "test_instance.unrelated"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			td := t.TempDir()
+			testCopyDir(t, testFixturePath("graph-focus"), td)
+			defer testChdir(t, td)()
+
+			ui := new(cli.MockUi)
+			c := &GraphCommand{
+				Meta: Meta{
+					testingOverrides: metaOverridesForProvider(applyFixtureProvider()),
+					Ui:               ui,
+				},
+			}
+
+			if code := c.Run(test.args); code != 0 {
+				t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+			}
+
+			output := ui.OutputWriter.String()
+			if !strings.HasPrefix(output, "digraph {") {
+				t.Fatalf("doesn't look like digraph: %s", output)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("missing %s in the output:\n%s", want, output)
+				}
+			}
+			for _, wantNot := range test.wantNot {
+				if strings.Contains(output, wantNot) {
+					t.Errorf("unexpected %s in the output:\n%s", wantNot, output)
+				}
+			}
+		})
+	}
+}
+
+func TestGraph_focusNoMatch(t *testing.T) {
+	td := t.TempDir()
+	testCopyDir(t, testFixturePath("graph-focus"), td)
+	defer testChdir(t, td)()
+
+	ui := new(cli.MockUi)
+	c := &GraphCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(applyFixtureProvider()),
+			Ui:               ui,
+		},
+	}
+
+	if code := c.Run([]string{"-focus=test_instance.missing"}); code != 1 {
+		t.Fatalf("expected the command to fail, got %d\n%s", code, ui.OutputWriter.String())
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, "none of the resources in the graph match") {
+		t.Fatalf("wrong error: %s", got)
+	}
+}
+
 func TestGraph_plan(t *testing.T) {
 	testCwd(t)
 
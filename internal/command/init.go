@@ -24,6 +24,7 @@ import (
 	"github.com/opentofu/opentofu/internal/addrs"
 	"github.com/opentofu/opentofu/internal/backend"
 	backendInit "github.com/opentofu/opentofu/internal/backend/init"
+	backendLocal "github.com/opentofu/opentofu/internal/backend/local"
 	"github.com/opentofu/opentofu/internal/cloud"
 	"github.com/opentofu/opentofu/internal/command/arguments"
 	"github.com/opentofu/opentofu/internal/command/views"
@@ -47,7 +48,7 @@ type InitCommand struct {
 
 func (c *InitCommand) Run(args []string) int {
 	var flagFromModule, flagLockfile, testsDirectory string
-	var flagBackend, flagCloud, flagGet, flagUpgrade bool
+	var flagBackend, flagBackendValidate, flagCloud, flagGet, flagUpgrade, flagVerifyPlugins bool
 	var flagPluginPath FlagStringSlice
 	flagConfigExtra := newRawFlags("-backend-config")
 
@@ -56,6 +57,7 @@ func (c *InitCommand) Run(args []string) int {
 	cmdFlags.BoolVar(&flagBackend, "backend", true, "")
 	cmdFlags.BoolVar(&flagCloud, "cloud", true, "")
 	cmdFlags.Var(flagConfigExtra, "backend-config", "")
+	cmdFlags.BoolVar(&flagBackendValidate, "backend-validate", false, "validate the backend's access")
 	cmdFlags.StringVar(&flagFromModule, "from-module", "", "copy the source of the given module into the directory before init")
 	cmdFlags.BoolVar(&flagGet, "get", true, "")
 	cmdFlags.BoolVar(&c.forceInitCopy, "force-copy", false, "suppress prompts about copying state data")
@@ -66,6 +68,7 @@ func (c *InitCommand) Run(args []string) int {
 	cmdFlags.BoolVar(&flagUpgrade, "upgrade", false, "")
 	cmdFlags.Var(&flagPluginPath, "plugin-dir", "plugin directory")
 	cmdFlags.StringVar(&flagLockfile, "lockfile", "", "Set a dependency lockfile mode")
+	cmdFlags.BoolVar(&flagVerifyPlugins, "verify-plugins", false, "verify cached providers against the dependency lock file")
 	cmdFlags.BoolVar(&c.Meta.ignoreRemoteVersion, "ignore-remote-version", false, "continue even if remote and local OpenTofu versions are incompatible")
 	cmdFlags.StringVar(&testsDirectory, "test-directory", "tests", "test-directory")
 	cmdFlags.BoolVar(&c.outputInJSON, "json", false, "json")
@@ -237,6 +240,13 @@ func (c *InitCommand) Run(args []string) int {
 	// If we have a functional backend (either just initialized or initialized
 	// on a previous run) we'll use the current state as a potential source
 	// of provider dependencies.
+	if back != nil && flagBackendValidate {
+		if err := c.validateBackend(ctx, back); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error validating the backend: %s", err))
+			return 1
+		}
+	}
+
 	if back != nil {
 		c.ignoreRemoteVersionConflict(back)
 		workspace, err := c.Workspace()
@@ -339,7 +349,7 @@ func (c *InitCommand) Run(args []string) int {
 	}
 
 	// Now that we have loaded all modules, check the module tree for missing providers.
-	providersOutput, providersAbort, providerDiags := c.getProviders(ctx, config, state, flagUpgrade, flagPluginPath, flagLockfile)
+	providersOutput, providersAbort, providerDiags := c.getProviders(ctx, config, state, flagUpgrade, flagPluginPath, flagLockfile, flagVerifyPlugins)
 	diags = diags.Append(providerDiags)
 	if providersAbort || providerDiags.HasErrors() {
 		c.showDiagnostics(diags)
@@ -462,6 +472,27 @@ func (c *InitCommand) initCloud(ctx context.Context, root *configs.Module, extra
 	return back, true, diags
 }
 
+// validateBackend checks the access of the given backend, as requested with
+// -backend-validate, for backends that can check it.
+func (c *InitCommand) validateBackend(ctx context.Context, b backend.Backend) error {
+	// Backends without operations of their own are wrapped by the local
+	// backend.
+	if local, ok := b.(*backendLocal.Local); ok && local.Backend != nil {
+		b = local.Backend
+	}
+
+	validator, ok := b.(backend.Validator)
+	if !ok {
+		c.Ui.Warn("The backend doesn't support validating its access, so -backend-validate has no effect.")
+		return nil
+	}
+	if err := validator.Validate(ctx); err != nil {
+		return err
+	}
+	c.Ui.Output(c.Colorize().Color("[reset][green]The backend's access was validated successfully."))
+	return nil
+}
+
 func (c *InitCommand) initBackend(ctx context.Context, root *configs.Module, extraConfig rawFlags, enc encryption.Encryption) (be backend.Backend, output bool, diags tfdiags.Diagnostics) {
 	ctx, span := tracer.Start(ctx, "initialize backend")
 	_ = ctx // prevent staticcheck from complaining to avoid a maintenance hazard of having the wrong ctx in scope here
@@ -547,7 +578,7 @@ the backend configuration is present and valid.
 
 // Load the complete module tree, and fetch any missing providers.
 // This method outputs its own Ui.
-func (c *InitCommand) getProviders(ctx context.Context, config *configs.Config, state *states.State, upgrade bool, pluginDirs []string, flagLockfile string) (output, abort bool, diags tfdiags.Diagnostics) {
+func (c *InitCommand) getProviders(ctx context.Context, config *configs.Config, state *states.State, upgrade bool, pluginDirs []string, flagLockfile string, verifyPlugins bool) (output, abort bool, diags tfdiags.Diagnostics) {
 	ctx, span := tracer.Start(ctx, "install providers")
 	defer span.End()
 
@@ -627,6 +658,7 @@ func (c *InitCommand) getProviders(ctx context.Context, config *configs.Config,
 		log.Println("[DEBUG] init: overriding provider plugin search paths")
 		log.Printf("[DEBUG] will search for provider plugins in %s", pluginDirs)
 	}
+	inst.SetVerifyPlugins(verifyPlugins)
 
 	// We want to print out a nice warning if we don't manage to pull
 	// checksums for all our providers. This is tracked via callbacks
@@ -1193,6 +1225,10 @@ Options:
                           times. The backend type must be in the configuration
                           itself.
 
+  -backend-validate       Check that the backend's configuration grants the
+                          access it needs, on backends that support it,
+                          before using its state.
+
   -compact-warnings       If OpenTofu produces any warnings that are not
                           accompanied by errors, show them in a more compact
                           form that includes only the summary messages.
@@ -1246,6 +1282,12 @@ Options:
   -lockfile=MODE          Set a dependency lockfile mode.
                           Currently only "readonly" is valid.
 
+  -verify-plugins         Verify the providers in the plugin cache directory
+                          against the checksums of the dependency lock file
+                          before using them, even when
+                          plugin_cache_may_break_dependency_lock_file is set.
+                          Providers that don't match are installed again.
+
   -ignore-remote-version  A rare option used for cloud backend and the remote backend
                           only. Set this to ignore checking that the local and remote
                           OpenTofu versions use compatible state representations, making
@@ -246,6 +246,32 @@ func TestInit_backend(t *testing.T) {
 	}
 }
 
+func TestInit_backendValidateUnsupported(t *testing.T) {
+	// Create a temporary working directory that is empty
+	td := t.TempDir()
+	testCopyDir(t, testFixturePath("init-backend"), td)
+	defer testChdir(t, td)()
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	c := &InitCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+
+	// the local backend can't validate its access, which isn't an error
+	args := []string{"-backend-validate"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, "-backend-validate has no effect") {
+		t.Fatalf("expected a warning, got:\n%s", got)
+	}
+}
+
 func TestInit_backendUnset(t *testing.T) {
 	// Create a temporary working directory that is empty
 	td := t.TempDir()
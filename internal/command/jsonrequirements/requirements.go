@@ -0,0 +1,142 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package jsonrequirements implements the JSON output of the
+// "tofu providers -json" command, describing the provider requirements of a
+// configuration and its state along with the installed providers.
+package jsonrequirements
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/configs"
+	"github.com/opentofu/opentofu/internal/getproviders"
+)
+
+// FormatVersion represents the version of the json format and will be
+// incremented for any change to this format that requires changes to a
+// consuming parser.
+const FormatVersion = "1.0"
+
+// requirements is the top-level object returned when exporting the provider
+// requirements
+type requirements struct {
+	FormatVersion      string              `json:"format_version"`
+	RootModule         *Module             `json:"root_module"`
+	StateProviders     []string            `json:"state_providers"`
+	InstalledProviders []InstalledProvider `json:"installed_providers"`
+}
+
+// Module describes the provider requirements of a module, and of the modules
+// it calls.
+type Module struct {
+	// Source is the source address of the module, empty for the root module.
+	Source string `json:"source,omitempty"`
+
+	// Providers are the providers required by the module, sorted by their
+	// source addresses.
+	Providers []Requirement `json:"providers"`
+
+	// ModuleCalls are the modules called by the module, by the name of the
+	// module block.
+	ModuleCalls map[string]*Module `json:"module_calls,omitempty"`
+
+	// Tests are the test files of the module, by their paths.
+	Tests map[string]*TestFile `json:"tests,omitempty"`
+}
+
+// TestFile describes the provider requirements of a test file.
+type TestFile struct {
+	Providers []Requirement      `json:"providers"`
+	Runs      map[string]*Module `json:"runs,omitempty"`
+}
+
+// Requirement is a provider required by a module.
+type Requirement struct {
+	// Source is the fully-qualified source address of the provider.
+	Source string `json:"source"`
+
+	// VersionConstraint is the combined version constraint of the module for
+	// the provider, empty if any version is accepted.
+	VersionConstraint string `json:"version_constraint,omitempty"`
+}
+
+// InstalledProvider is a provider installed for the configuration.
+type InstalledProvider struct {
+	Source  string `json:"source"`
+	Version string `json:"version"`
+}
+
+// Marshal returns the JSON representation of the provider requirements of the
+// configuration and state, and of the installed providers.
+func Marshal(reqs *configs.ModuleRequirements, stateReqs getproviders.Requirements, installed map[addrs.Provider]getproviders.Version) ([]byte, error) {
+	output := requirements{
+		FormatVersion:      FormatVersion,
+		RootModule:         marshalModule(reqs),
+		StateProviders:     []string{},
+		InstalledProviders: []InstalledProvider{},
+	}
+	for provider := range stateReqs {
+		output.StateProviders = append(output.StateProviders, provider.String())
+	}
+	sort.Strings(output.StateProviders)
+	for provider, version := range installed {
+		output.InstalledProviders = append(output.InstalledProviders, InstalledProvider{
+			Source:  provider.String(),
+			Version: version.String(),
+		})
+	}
+	sort.Slice(output.InstalledProviders, func(i, j int) bool {
+		return output.InstalledProviders[i].Source < output.InstalledProviders[j].Source
+	})
+	return json.Marshal(output)
+}
+
+func marshalModule(reqs *configs.ModuleRequirements) *Module {
+	module := &Module{
+		Providers: marshalRequirements(reqs.Requirements),
+	}
+	if reqs.SourceAddr != nil {
+		module.Source = reqs.SourceAddr.String()
+	}
+	if len(reqs.Children) > 0 {
+		module.ModuleCalls = make(map[string]*Module, len(reqs.Children))
+		for name, child := range reqs.Children {
+			module.ModuleCalls[name] = marshalModule(child)
+		}
+	}
+	if len(reqs.Tests) > 0 {
+		module.Tests = make(map[string]*TestFile, len(reqs.Tests))
+		for name, test := range reqs.Tests {
+			file := &TestFile{
+				Providers: marshalRequirements(test.Requirements),
+			}
+			if len(test.Runs) > 0 {
+				file.Runs = make(map[string]*Module, len(test.Runs))
+				for run, runReqs := range test.Runs {
+					file.Runs[run] = marshalModule(runReqs)
+				}
+			}
+			module.Tests[name] = file
+		}
+	}
+	return module
+}
+
+func marshalRequirements(reqs getproviders.Requirements) []Requirement {
+	ret := make([]Requirement, 0, len(reqs))
+	for provider, constraints := range reqs {
+		ret = append(ret, Requirement{
+			Source:            provider.String(),
+			VersionConstraint: getproviders.VersionConstraintsString(constraints),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Source < ret[j].Source
+	})
+	return ret
+}
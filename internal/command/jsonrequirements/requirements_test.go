@@ -0,0 +1,60 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package jsonrequirements
+
+import (
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/configs"
+	"github.com/opentofu/opentofu/internal/getproviders"
+)
+
+func TestMarshal(t *testing.T) {
+	foo := addrs.NewDefaultProvider("foo")
+	bar := addrs.NewDefaultProvider("bar")
+
+	reqs := &configs.ModuleRequirements{
+		Requirements: getproviders.Requirements{
+			foo: getproviders.MustParseVersionConstraints("~> 1.0"),
+		},
+		Tests: map[string]*configs.TestFileModuleRequirements{
+			"main.tftest.hcl": {
+				Requirements: getproviders.Requirements{
+					bar: nil,
+				},
+				Runs: map[string]*configs.ModuleRequirements{
+					"setup": {
+						Requirements: getproviders.Requirements{
+							foo: nil,
+						},
+					},
+				},
+			},
+		},
+	}
+	stateReqs := getproviders.Requirements{
+		foo: nil,
+		bar: nil,
+	}
+	installed := map[addrs.Provider]getproviders.Version{
+		foo: getproviders.MustParseVersion("1.2.0"),
+	}
+
+	got, err := Marshal(reqs, stateReqs, installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"format_version":"1.0",` +
+		`"root_module":{"providers":[{"source":"registry.opentofu.org/hashicorp/foo","version_constraint":"~\u003e 1.0"}],` +
+		`"tests":{"main.tftest.hcl":{"providers":[{"source":"registry.opentofu.org/hashicorp/bar"}],` +
+		`"runs":{"setup":{"providers":[{"source":"registry.opentofu.org/hashicorp/foo"}]}}}}},` +
+		`"state_providers":["registry.opentofu.org/hashicorp/bar","registry.opentofu.org/hashicorp/foo"],` +
+		`"installed_providers":[{"source":"registry.opentofu.org/hashicorp/foo","version":"1.2.0"}]}`
+	if string(got) != want {
+		t.Errorf("wrong output\ngot:  %s\nwant: %s", got, want)
+	}
+}
@@ -734,6 +734,12 @@ func (m *Meta) showDiagnostics(vals ...interface{}) {
 		return
 	}
 
+	// The diagnostics below are rendered through the Ui rather than the
+	// view, so they must be recorded separately.
+	if m.View != nil {
+		m.View.RecordDiagnostics(diags)
+	}
+
 	outputWidth := m.ErrorColumns()
 
 	if m.consolidateWarnings {
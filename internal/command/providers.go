@@ -12,6 +12,8 @@ import (
 
 	"github.com/xlab/treeprint"
 
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/command/jsonrequirements"
 	"github.com/opentofu/opentofu/internal/configs"
 	"github.com/opentofu/opentofu/internal/getproviders"
 	"github.com/opentofu/opentofu/internal/tfdiags"
@@ -33,11 +35,13 @@ func (c *ProvidersCommand) Synopsis() string {
 
 func (c *ProvidersCommand) Run(args []string) int {
 	var testsDirectory string
+	var jsonOutput bool
 
 	args = c.Meta.process(args)
 	cmdFlags := c.Meta.defaultFlagSet("providers")
 	c.Meta.varFlagSet(cmdFlags)
 	cmdFlags.StringVar(&testsDirectory, "test-directory", "tests", "test-directory")
+	cmdFlags.BoolVar(&jsonOutput, "json", false, "produce JSON output")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
@@ -133,6 +137,10 @@ func (c *ProvidersCommand) Run(args []string) int {
 		stateReqs = state.ProviderRequirements()
 	}
 
+	if jsonOutput {
+		return c.outputJSON(reqs, stateReqs, diags)
+	}
+
 	printRoot := treeprint.New()
 	c.populateTreeNode(printRoot, reqs)
 
@@ -153,6 +161,40 @@ func (c *ProvidersCommand) Run(args []string) int {
 	return 0
 }
 
+// outputJSON prints the requirements and the installed providers as JSON. The
+// diagnostics are shown on the error output, so they don't interfere with it.
+func (c *ProvidersCommand) outputJSON(reqs *configs.ModuleRequirements, stateReqs getproviders.Requirements, diags tfdiags.Diagnostics) int {
+	locks, locksDiags := c.lockedDependencies()
+	diags = diags.Append(locksDiags)
+	if locksDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	// The locked providers are installed if they're in the local cache
+	// directory, as "tofu init" leaves them.
+	cacheDir := c.providerLocalCacheDir()
+	installed := make(map[addrs.Provider]getproviders.Version)
+	for provider, lock := range locks.AllProviders() {
+		if cacheDir.ProviderVersion(provider, lock.Version()) != nil {
+			installed[provider] = lock.Version()
+		}
+	}
+
+	jsonReqs, err := jsonrequirements.Marshal(reqs, stateReqs, installed)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to marshal provider requirements to json: %s", err))
+		return 1
+	}
+	c.Ui.Output(string(jsonReqs))
+
+	c.showDiagnostics(diags)
+	if diags.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
 func (c *ProvidersCommand) populateTreeNode(tree treeprint.Tree, node *configs.ModuleRequirements) {
 	for fqn, dep := range node.Requirements {
 		versionsStr := getproviders.VersionConstraintsString(dep)
@@ -197,6 +239,9 @@ Usage: tofu [global options] providers [options] [DIR]
 
 Options:
 
+  -json                 Print the requirements and the installed providers
+                        as a machine-readable JSON document.
+
   -test-directory=path  Set the OpenTofu test directory, defaults to "tests". When set, the
                         test command will search for test files in the current directory and
                         in the one specified by the flag.
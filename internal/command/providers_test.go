@@ -6,10 +6,12 @@
 package command
 
 import (
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/mitchellh/cli"
 )
 
@@ -204,3 +206,72 @@ func TestProviders_tests(t *testing.T) {
 		}
 	}
 }
+
+func TestProviders_json(t *testing.T) {
+	td := t.TempDir()
+	testCopyDir(t, testFixturePath("providers/modules"), td)
+	defer testChdir(t, td)()
+
+	// first run init with mock provider sources to install the providers
+	initUi := new(cli.MockUi)
+	providerSource, close := newMockProviderSource(t, map[string][]string{
+		"foo": {"1.0.0"},
+		"bar": {"2.0.0"},
+		"baz": {"1.2.2"},
+	})
+	defer close()
+	m := Meta{
+		testingOverrides: metaOverridesForProvider(testProvider()),
+		Ui:               initUi,
+		ProviderSource:   providerSource,
+	}
+	ic := &InitCommand{
+		Meta: m,
+	}
+	if code := ic.Run([]string{}); code != 0 {
+		t.Fatalf("init failed\n%s", initUi.ErrorWriter)
+	}
+
+	ui := new(cli.MockUi)
+	c := &ProvidersCommand{
+		Meta: Meta{
+			Ui: ui,
+		},
+	}
+
+	args := []string{"-json"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, ui.OutputWriter.String())
+	}
+	want := map[string]interface{}{
+		"format_version": "1.0",
+		"root_module": map[string]interface{}{
+			"providers": []interface{}{
+				map[string]interface{}{"source": "registry.opentofu.org/hashicorp/bar", "version_constraint": "2.0.0"},
+				map[string]interface{}{"source": "registry.opentofu.org/hashicorp/foo", "version_constraint": "1.0.0"},
+			},
+			"module_calls": map[string]interface{}{
+				"kiddo": map[string]interface{}{
+					"source": "./child",
+					"providers": []interface{}{
+						map[string]interface{}{"source": "registry.opentofu.org/hashicorp/baz"},
+					},
+				},
+			},
+		},
+		"state_providers": []interface{}{},
+		"installed_providers": []interface{}{
+			map[string]interface{}{"source": "registry.opentofu.org/hashicorp/bar", "version": "2.0.0"},
+			map[string]interface{}{"source": "registry.opentofu.org/hashicorp/baz", "version": "1.2.2"},
+			map[string]interface{}{"source": "registry.opentofu.org/hashicorp/foo", "version": "1.0.0"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong output\n%s", diff)
+	}
+}
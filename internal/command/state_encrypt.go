@@ -0,0 +1,276 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/opentofu/opentofu/internal/command/arguments"
+	"github.com/opentofu/opentofu/internal/command/clistate"
+	"github.com/opentofu/opentofu/internal/command/views"
+	"github.com/opentofu/opentofu/internal/encryption"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/opentofu/opentofu/internal/tofu"
+)
+
+// StateEncryptCommand is a Command implementation that encrypts the state of
+// the selected workspace with the configured state encryption.
+type StateEncryptCommand struct {
+	Meta
+}
+
+func (c *StateEncryptCommand) Run(args []string) int {
+	return c.convertState("state encrypt", args, true)
+}
+
+func (c *StateEncryptCommand) Help() string {
+	helpText := `
+Usage: tofu [global options] state encrypt [options]
+
+  Encrypt the state of the selected workspace.
+
+  This command reads the state, whether it's encrypted or not, and writes
+  it back encrypted with the method configured in the state block of the
+  encryption configuration. It can be used to encrypt an existing state
+  once encryption is configured, without waiting for the next apply.
+
+  The command refuses to write the state while another process holds its
+  lock unless the "-force" flag is given.
+
+Options:
+
+  -force              Write the state even if the state lock can't be
+                      acquired.
+
+  -lock=false         Don't hold a state lock during the operation. This is
+                      dangerous if others might concurrently run commands
+                      against the same workspace.
+
+  -lock-timeout=0s    Duration to retry a state lock.
+
+  -var 'foo=bar'      Set a value for one of the input variables in the root
+                      module of the configuration. Use this option more than
+                      once to set more than one variable.
+
+  -var-file=filename  Load variable values from the given file, in addition
+                      to the default files terraform.tfvars and *.auto.tfvars.
+                      Use this option more than once to include more than one
+                      variables file.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StateEncryptCommand) Synopsis() string {
+	return "Encrypt the state with the configured encryption"
+}
+
+// StateDecryptCommand is a Command implementation that writes the state of
+// the selected workspace without encryption.
+type StateDecryptCommand struct {
+	Meta
+}
+
+func (c *StateDecryptCommand) Run(args []string) int {
+	return c.convertState("state decrypt", args, false)
+}
+
+func (c *StateDecryptCommand) Help() string {
+	helpText := `
+Usage: tofu [global options] state decrypt [options]
+
+  Decrypt the state of the selected workspace.
+
+  This command reads the state, decrypting it with the configured encryption
+  and its fallbacks, and writes it back unencrypted. The decrypted state is
+  only written once it has been read as a valid state. It can be used to
+  roll back encryption in a single step.
+
+  The command refuses to write the state while another process holds its
+  lock unless the "-force" flag is given.
+
+Options:
+
+  -force              Write the state even if the state lock can't be
+                      acquired.
+
+  -lock=false         Don't hold a state lock during the operation. This is
+                      dangerous if others might concurrently run commands
+                      against the same workspace.
+
+  -lock-timeout=0s    Duration to retry a state lock.
+
+  -var 'foo=bar'      Set a value for one of the input variables in the root
+                      module of the configuration. Use this option more than
+                      once to set more than one variable.
+
+  -var-file=filename  Load variable values from the given file, in addition
+                      to the default files terraform.tfvars and *.auto.tfvars.
+                      Use this option more than once to include more than one
+                      variables file.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StateDecryptCommand) Synopsis() string {
+	return "Write the state without encryption"
+}
+
+// convertState rewrites the state of the selected workspace encrypted with the
+// configured state encryption, or unencrypted.
+func (m *Meta) convertState(name string, args []string, encrypt bool) int {
+	args = m.process(args)
+	var flagForce bool
+	cmdFlags := m.ignoreRemoteVersionFlagSet(name)
+	cmdFlags.BoolVar(&flagForce, "force", false, "")
+	cmdFlags.BoolVar(&m.stateLock, "lock", true, "lock state")
+	cmdFlags.DurationVar(&m.stateLockTimeout, "lock-timeout", 0, "lock timeout")
+	if err := cmdFlags.Parse(args); err != nil {
+		m.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return 1
+	}
+	if len(cmdFlags.Args()) != 0 {
+		m.Ui.Error("This command takes no arguments.\n")
+		return cli.RunResultHelp
+	}
+
+	if diags := m.checkRequiredVersion(); diags != nil {
+		m.showDiagnostics(diags)
+		return 1
+	}
+
+	// Load the encryption configuration
+	enc, encDiags := m.Encryption()
+	if encDiags.HasErrors() {
+		m.showDiagnostics(encDiags)
+		return 1
+	}
+
+	// Determine the workspace name
+	workspace, err := m.Workspace()
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error selecting workspace: %s", err))
+		return 1
+	}
+
+	stateEnc, err := encryption.StateEncryptionForWorkspace(enc.State(), workspace)
+	if err != nil {
+		m.Ui.Error(err.Error())
+		return 1
+	}
+
+	// Load the backend
+	b, backendDiags := m.Backend(nil, &stateConversionEncryption{enc: stateEnc, encrypt: encrypt})
+	if backendDiags.HasErrors() {
+		m.showDiagnostics(backendDiags)
+		return 1
+	}
+
+	// Check remote OpenTofu version is compatible
+	remoteVersionDiags := m.remoteVersionCheck(b, workspace)
+	m.showDiagnostics(remoteVersionDiags)
+	if remoteVersionDiags.HasErrors() {
+		return 1
+	}
+
+	// Get the state manager for the currently-selected workspace
+	stateMgr, err := b.StateMgr(workspace)
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf(errStateLoadingState, err))
+		return 1
+	}
+
+	if m.stateLock {
+		stateLocker := clistate.NewLocker(m.stateLockTimeout, views.NewStateLocker(arguments.ViewHuman, m.View))
+		if diags := stateLocker.Lock(stateMgr, strings.ReplaceAll(name, " ", "-")); diags.HasErrors() {
+			if !flagForce {
+				m.showDiagnostics(diags)
+				m.Ui.Error("The state is not written while it can't be locked. Use -force to write it anyway.")
+				return 1
+			}
+			m.Ui.Warn(fmt.Sprintf("Writing the state without a lock because of -force: %s", diags.Err()))
+		} else {
+			defer func() {
+				if diags := stateLocker.Unlock(); diags.HasErrors() {
+					m.showDiagnostics(diags)
+				}
+			}()
+		}
+	}
+
+	// The state is parsed when it's read, so a decrypted state that isn't
+	// valid is never written.
+	if err := stateMgr.RefreshState(); err != nil {
+		m.Ui.Error(fmt.Sprintf("Failed to read state: %s", err))
+		return 1
+	}
+	stateFile := statemgr.Export(stateMgr)
+	if stateFile.State == nil {
+		m.Ui.Error(fmt.Sprintf("No state found for workspace %q.", workspace))
+		return 1
+	}
+
+	// The state itself is unchanged, so the serial is incremented for the
+	// state managers to write it again.
+	stateFile.Serial++
+	if err := statemgr.Import(stateFile, stateMgr, false); err != nil {
+		m.Ui.Error(fmt.Sprintf("Failed to write state: %s", err))
+		return 1
+	}
+
+	// Get schemas, if possible, before writing state
+	var schemas *tofu.Schemas
+	var diags tfdiags.Diagnostics
+	if isCloudMode(b) {
+		schemas, diags = m.MaybeGetSchemas(stateFile.State, nil)
+	}
+
+	if err := stateMgr.PersistState(schemas); err != nil {
+		m.Ui.Error(fmt.Sprintf("Failed to persist state: %s", err))
+		return 1
+	}
+
+	m.showDiagnostics(diags)
+	if encrypt {
+		m.Ui.Output(fmt.Sprintf("Encrypted the state of workspace %q.", workspace))
+	} else {
+		m.Ui.Output(fmt.Sprintf("Decrypted the state of workspace %q.", workspace))
+	}
+	return 0
+}
+
+// stateConversionEncryption reads states whether they're encrypted or not,
+// and writes them encrypted with enc, or unencrypted.
+type stateConversionEncryption struct {
+	enc     encryption.StateEncryption
+	encrypt bool
+}
+
+func (s *stateConversionEncryption) DecryptState(data []byte) ([]byte, error) {
+	if encrypted, err := encryption.IsEncryptionPayload(data); err == nil && !encrypted {
+		return data, nil
+	}
+	return s.enc.DecryptState(data)
+}
+
+func (s *stateConversionEncryption) EncryptState(data []byte) ([]byte, error) {
+	if !s.encrypt {
+		return data, nil
+	}
+	encrypted, err := s.enc.EncryptState(data)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := encryption.IsEncryptionPayload(encrypted); err != nil || !ok {
+		return nil, fmt.Errorf("the encryption configuration doesn't encrypt the state, configure a state method other than unencrypted")
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/opentofu/opentofu/internal/encryption"
+)
+
+const testStateEncryptionConfig = `
+key_provider "pbkdf2" "test" {
+	passphrase = "correct-horse-battery-staple"
+	iterations = 200000
+}
+method "aes_gcm" "test" {
+	keys = key_provider.pbkdf2.test
+}
+state {
+	method = method.aes_gcm.test
+}
+`
+
+func TestStateEncryptDecrypt(t *testing.T) {
+	td := t.TempDir()
+	defer testChdir(t, td)()
+	t.Setenv(encryptionConfigEnvName, testStateEncryptionConfig)
+
+	state := testState()
+	testStateFileDefault(t, state)
+
+	isEncrypted := func(t *testing.T) bool {
+		t.Helper()
+		data, err := os.ReadFile(DefaultStateFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := encryption.IsEncryptionPayload(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encrypted
+	}
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	encryptCmd := &StateEncryptCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := encryptCmd.Run(nil); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !isEncrypted(t) {
+		t.Fatal("expected the state to be encrypted")
+	}
+
+	ui = new(cli.MockUi)
+	decryptCmd := &StateDecryptCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := decryptCmd.Run(nil); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if isEncrypted(t) {
+		t.Fatal("expected the state to be decrypted")
+	}
+	if actual := testStateRead(t, DefaultStateFilename); !actual.Equal(state) {
+		t.Fatalf("expected the state to be unchanged, got:\n%s", actual)
+	}
+}
+
+func TestStateEncrypt_noEncryption(t *testing.T) {
+	td := t.TempDir()
+	defer testChdir(t, td)()
+	testStateFileDefault(t, testState())
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	c := &StateEncryptCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("expected the command to fail, got %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "doesn't encrypt the state") {
+		t.Fatalf("expected an encryption configuration error, got: %s", ui.ErrorWriter.String())
+	}
+}
+
+func TestStateEncrypt_lockedState(t *testing.T) {
+	td := t.TempDir()
+	defer testChdir(t, td)()
+	t.Setenv(encryptionConfigEnvName, testStateEncryptionConfig)
+	testStateFileDefault(t, testState())
+
+	unlock, err := testLockState(t, testDataDir, DefaultStateFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	c := &StateEncryptCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("expected the command to fail, got %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "Use -force") {
+		t.Fatalf("expected a lock error suggesting -force, got: %s", ui.ErrorWriter.String())
+	}
+
+	ui = new(cli.MockUi)
+	c.Meta.Ui = ui
+	if code := c.Run([]string{"-force"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/opentofu/opentofu/internal/refactoring"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+// StateMovesCommand is a Command implementation that reports the address
+// changes the moved blocks of the configuration would make to the state,
+// without planning.
+type StateMovesCommand struct {
+	Meta
+}
+
+func (c *StateMovesCommand) Run(args []string) int {
+	args = c.Meta.process(args)
+	var statePath string
+	cmdFlags := c.Meta.defaultFlagSet("state moves")
+	c.Meta.varFlagSet(cmdFlags)
+	cmdFlags.StringVar(&statePath, "state", "", "path")
+	if err := cmdFlags.Parse(args); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
+		return cli.RunResultHelp
+	}
+	if len(cmdFlags.Args()) != 0 {
+		c.Ui.Error("This command takes no arguments.\n")
+		return cli.RunResultHelp
+	}
+
+	if statePath != "" {
+		c.Meta.statePath = statePath
+	}
+
+	var diags tfdiags.Diagnostics
+
+	config, configDiags := c.loadConfig(".")
+	diags = diags.Append(configDiags)
+	if configDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	// Load the encryption configuration
+	enc, encDiags := c.Encryption()
+	diags = diags.Append(encDiags)
+	if encDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	// Load the backend
+	b, backendDiags := c.Backend(&BackendOpts{
+		Config: config.Module.Backend,
+	}, enc.State())
+	diags = diags.Append(backendDiags)
+	if backendDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	// This is a read-only command
+	c.ignoreRemoteVersionConflict(b)
+
+	// Get the state
+	env, err := c.Workspace()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error selecting workspace: %s", err))
+		return 1
+	}
+	stateMgr, err := b.StateMgr(env)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(errStateLoadingState, err))
+		return 1
+	}
+	if err := stateMgr.RefreshState(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to load state: %s", err))
+		return 1
+	}
+	state := stateMgr.State()
+	if state == nil {
+		state = states.NewState()
+	}
+
+	explicitStmts := refactoring.FindMoveStatements(config)
+	stmts := append(explicitStmts, refactoring.ImpliedMoveStatements(config, state, explicitStmts)...)
+	report, reportDiags := refactoring.ReportMoves(stmts, state)
+	diags = diags.Append(reportDiags)
+	if reportDiags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
+
+	var buf strings.Builder
+	if len(report.Changes) == 0 {
+		buf.WriteString("The moved blocks of the configuration don't move any objects in the state.\n")
+	} else {
+		buf.WriteString("The moved blocks of the configuration would move the following objects in the state:\n\n")
+		for _, change := range report.Changes {
+			fmt.Fprintf(&buf, "  %s -> %s\n", change.From, change.To)
+		}
+	}
+	if len(report.Blocked) > 0 {
+		buf.WriteString("\nThe following objects can't move because another object already exists at the destination:\n\n")
+		for _, blocked := range report.Blocked {
+			fmt.Fprintf(&buf, "  %s -> %s\n", blocked.Actual, blocked.Wanted)
+		}
+	}
+	if len(report.NoOps) > 0 {
+		buf.WriteString("\nThe following moved blocks have no effect because their source isn't in the state:\n\n")
+		for _, stmt := range report.NoOps {
+			fmt.Fprintf(&buf, "  %s: %s -> %s\n", stmt.DeclRange.StartString(), stmt.From, stmt.To)
+		}
+	}
+	c.Ui.Output(strings.TrimSuffix(buf.String(), "\n"))
+
+	c.showDiagnostics(diags)
+
+	return 0
+}
+
+func (c *StateMovesCommand) Help() string {
+	helpText := `
+Usage: tofu [global options] state moves [options]
+
+  Report the moves the moved blocks of the configuration would make.
+
+  This command evaluates the moved blocks of the configuration against the
+  current state and lists the address changes that the next plan would make,
+  without creating a plan. Chains of moved blocks are summarized into a
+  single change for each object.
+
+  The command fails if the moved blocks form a cycle or conflict with one
+  another. It also lists the objects that can't move because their
+  destination is already taken, and the moved blocks that have no effect
+  because their source isn't in the state.
+
+  The state isn't modified by this command.
+
+Options:
+
+  -state=statefile    Path to a OpenTofu state file to use to look
+                      up OpenTofu-managed resources. By default, OpenTofu
+                      will consult the state of the currently-selected
+                      workspace.
+
+  -var 'foo=bar'      Set a value for one of the input variables in the root
+                      module of the configuration. Use this option more than
+                      once to set more than one variable.
+
+  -var-file=filename  Load variable values from the given file, in addition
+                      to the default files terraform.tfvars and *.auto.tfvars.
+                      Use this option more than once to include more than one
+                      variables file.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StateMovesCommand) Synopsis() string {
+	return "Report the moves the moved blocks would make"
+}
@@ -0,0 +1,104 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package command
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestStateMoves(t *testing.T) {
+	td := t.TempDir()
+	defer testChdir(t, td)()
+	testStateFileDefault(t, testState())
+
+	config := `
+resource "test_instance" "bar" {
+}
+
+moved {
+  from = test_instance.foo
+  to   = test_instance.bar
+}
+
+moved {
+  from = test_instance.gone
+  to   = test_instance.baz
+}
+`
+	if err := os.WriteFile("main.tf", []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	c := &StateMovesCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := c.Run(nil); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	output := ui.OutputWriter.String()
+	for _, want := range []string{
+		"test_instance.foo -> test_instance.bar",
+		"main.tf:10,1: test_instance.gone[*] -> test_instance.baz[*]",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("missing %q in output:\n%s", want, output)
+		}
+	}
+
+	// the state is unchanged
+	state := testStateRead(t, DefaultStateFilename)
+	if !state.Equal(testState()) {
+		t.Fatalf("expected the state to be unchanged, got:\n%s", state)
+	}
+}
+
+func TestStateMoves_cycle(t *testing.T) {
+	td := t.TempDir()
+	defer testChdir(t, td)()
+	testStateFileDefault(t, testState())
+
+	config := `
+moved {
+  from = test_instance.foo
+  to   = test_instance.bar
+}
+
+moved {
+  from = test_instance.bar
+  to   = test_instance.foo
+}
+`
+	if err := os.WriteFile("main.tf", []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := new(cli.MockUi)
+	view, _ := testView(t)
+	c := &StateMovesCommand{
+		Meta: Meta{
+			testingOverrides: metaOverridesForProvider(testProvider()),
+			Ui:               ui,
+			View:             view,
+		},
+	}
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("expected the command to fail, got %d", code)
+	}
+	if got := ui.ErrorWriter.String(); !strings.Contains(got, "Cyclic dependency in move statements") {
+		t.Fatalf("expected a cycle error, got: %s", got)
+	}
+}
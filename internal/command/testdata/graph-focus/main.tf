@@ -0,0 +1,17 @@
+resource "test_instance" "a" {
+  ami = test_instance.b.id
+}
+
+resource "test_instance" "b" {
+  ami = test_instance.c.id
+}
+
+resource "test_instance" "c" {
+  ami = test_instance.d.id
+}
+
+resource "test_instance" "d" {
+}
+
+resource "test_instance" "unrelated" {
+}
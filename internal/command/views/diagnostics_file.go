@@ -0,0 +1,59 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package views
+
+import (
+	encJson "encoding/json"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/opentofu/opentofu/internal/command/views/json"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+// DiagnosticsFile records every diagnostic rendered by a view as a stream of
+// newline-delimited JSON objects, using the same representation as the
+// "diagnostic" property of the machine-readable UI. It implements the global
+// -diagnostics-json-file option.
+type DiagnosticsFile struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewDiagnosticsFile returns a DiagnosticsFile that writes to the given
+// writer.
+func NewDiagnosticsFile(w io.Writer) *DiagnosticsFile {
+	return &DiagnosticsFile{w: w}
+}
+
+// Record writes one JSON object per diagnostic. A nil DiagnosticsFile
+// records nothing, so callers don't need to check whether the option is set.
+func (f *DiagnosticsFile) Record(diags tfdiags.Diagnostics, sources map[string]*hcl.File) {
+	if f == nil || len(diags) == 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, diag := range diags {
+		line, err := encJson.Marshal(json.NewDiagnostic(diag, sources))
+		if err != nil {
+			// Should never happen, because the diagnostic is made of plain
+			// strings and numbers.
+			log.Printf("[ERROR] Failed to encode diagnostic for the diagnostics file: %s", err)
+			continue
+		}
+		line = append(line, '\n')
+		if _, err := f.w.Write(line); err != nil {
+			log.Printf("[ERROR] Failed to write to the diagnostics file: %s", err)
+			return
+		}
+	}
+}
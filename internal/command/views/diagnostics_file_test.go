@@ -0,0 +1,97 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package views
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/opentofu/opentofu/internal/terminal"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+func TestView_diagnosticsFile(t *testing.T) {
+	streams, done := terminal.StreamsForTesting(t)
+	var buf bytes.Buffer
+	view := NewView(streams).SetDiagnosticsFile(NewDiagnosticsFile(&buf))
+
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(tfdiags.Sourceless(tfdiags.Warning, "Careful", "This might not work."))
+	diags = diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Broken",
+		Detail:   "This didn't work.",
+		Subject: &hcl.Range{
+			Filename: "main.tf",
+			Start:    hcl.Pos{Line: 2, Column: 3, Byte: 10},
+			End:      hcl.Pos{Line: 2, Column: 8, Byte: 15},
+		},
+	})
+	view.Diagnostics(diags)
+
+	output := done(t)
+	if !strings.Contains(output.Stderr(), "Broken") || !strings.Contains(output.Stdout(), "Careful") {
+		t.Errorf("the human-readable output is missing diagnostics\nstdout: %s\nstderr: %s", output.Stdout(), output.Stderr())
+	}
+
+	var got []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			t.Fatalf("invalid JSON line %q: %s", line, err)
+		}
+		got = append(got, obj)
+	}
+	want := []map[string]interface{}{
+		{
+			"severity": "warning",
+			"summary":  "Careful",
+			"detail":   "This might not work.",
+		},
+		{
+			"severity": "error",
+			"summary":  "Broken",
+			"detail":   "This didn't work.",
+			"range": map[string]interface{}{
+				"filename": "main.tf",
+				"start": map[string]interface{}{
+					"line":   float64(2),
+					"column": float64(3),
+					"byte":   float64(10),
+				},
+				"end": map[string]interface{}{
+					"line":   float64(2),
+					"column": float64(8),
+					"byte":   float64(15),
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong diagnostics file content\n%s", diff)
+	}
+}
+
+func TestJSONView_diagnosticsFile(t *testing.T) {
+	streams, done := terminal.StreamsForTesting(t)
+	var buf bytes.Buffer
+	jv := NewJSONView(NewView(streams).SetDiagnosticsFile(NewDiagnosticsFile(&buf)))
+
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(tfdiags.Sourceless(tfdiags.Error, "Broken", "This didn't work."))
+	jv.Diagnostics(diags)
+	done(t)
+
+	want := `{"severity":"error","summary":"Broken","detail":"This didn't work."}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("wrong diagnostics file content\ngot:  %s\nwant: %s", got, want)
+	}
+}
@@ -74,6 +74,8 @@ func (v *JSONView) StateDump(state string) {
 }
 
 func (v *JSONView) Diagnostics(diags tfdiags.Diagnostics, metadata ...interface{}) {
+	v.view.RecordDiagnostics(diags)
+
 	sources := v.view.configSources()
 	for _, diag := range diags {
 		diagnostic := json.NewDiagnostic(diag, sources)
@@ -104,6 +104,8 @@ func (v *ValidateJSON) Results(diags tfdiags.Diagnostics) int {
 		FormatVersion: FormatVersion,
 		Valid:         true, // until proven otherwise
 	}
+	v.view.RecordDiagnostics(diags)
+
 	configSources := v.view.configSources()
 	for _, diag := range diags {
 		output.Diagnostics = append(output.Diagnostics, viewsjson.NewDiagnostic(diag, configSources))
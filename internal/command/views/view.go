@@ -44,6 +44,10 @@ type View struct {
 	// will be dereferenced as late as possible when rendering diagnostics in
 	// order to access the config loader cache.
 	configSources func() map[string]*hcl.File
+
+	// diagnosticsFile, when set, records all of the diagnostics rendered
+	// through this view for the global -diagnostics-json-file option.
+	diagnosticsFile *DiagnosticsFile
 }
 
 // Initialize a View with the given streams, a disabled colorize object, and a
@@ -91,6 +95,26 @@ func (v *View) SetConfigSources(cb func() map[string]*hcl.File) {
 	v.configSources = cb
 }
 
+// SetDiagnosticsFile sets the file that records all of the diagnostics
+// rendered through this view, in addition to the usual output.
+//
+// For convenient use during initialization (in conjunction with NewView),
+// SetDiagnosticsFile returns the receiver after modifying it.
+func (v *View) SetDiagnosticsFile(f *DiagnosticsFile) *View {
+	v.diagnosticsFile = f
+	return v
+}
+
+// RecordDiagnostics writes the given diagnostics to the diagnostics file, if
+// any, without rendering them. Views call it automatically, so it's only
+// needed by callers that render diagnostics without the view.
+func (v *View) RecordDiagnostics(diags tfdiags.Diagnostics) {
+	if v.diagnosticsFile == nil {
+		return
+	}
+	v.diagnosticsFile.Record(diags, v.configSources())
+}
+
 // Diagnostics renders a set of warnings and errors in human-readable form.
 // Warnings are printed to stdout, and errors to stderr.
 func (v *View) Diagnostics(diags tfdiags.Diagnostics) {
@@ -100,6 +124,8 @@ func (v *View) Diagnostics(diags tfdiags.Diagnostics) {
 		return
 	}
 
+	v.RecordDiagnostics(diags)
+
 	if v.consolidateWarnings {
 		diags = diags.Consolidate(1, tfdiags.Warning)
 	}
@@ -8,6 +8,8 @@ package configs
 import (
 	"testing"
 
+	"github.com/zclconf/go-cty/cty"
+
 	"github.com/opentofu/opentofu/internal/addrs"
 )
 
@@ -32,10 +34,16 @@ func TestNewModule_provider_foreach(t *testing.T) {
 		t.Fatalf("incorrect number of providers: got %d, expected: %d", len(mod.ProviderConfigs), 3)
 	}
 
-	_, foundDev := mod.GetProviderConfig("foo-test", "dev")
+	dev, foundDev := mod.GetProviderConfig("foo-test", "dev")
 	if !foundDev {
 		t.Fatal("unable to find dev provider")
 	}
+	if got, want := dev.InstanceData.EachKey, cty.StringVal("dev"); !got.RawEquals(want) {
+		t.Errorf("wrong each.key for dev provider: got %#v, want %#v", got, want)
+	}
+	if got := dev.InstanceData.EachValue.GetAttr("filename"); !got.RawEquals(cty.StringVal("/tmp/dev")) {
+		t.Errorf("wrong each.value for dev provider: got %#v", got)
+	}
 
 	_, foundTest := mod.GetProviderConfig("foo-test", "test")
 	if !foundTest {
@@ -80,6 +80,22 @@ func NewStaticEvaluator(mod *Module, call StaticModuleCall) *StaticEvaluator {
 	}
 }
 
+// Workspace returns the name of the workspace terraform.workspace is evaluated as
+func (s *StaticEvaluator) Workspace() string {
+	return s.call.workspace
+}
+
+// WithWorkspace creates a static evaluator which evaluates terraform.workspace as the given workspace,
+// such as to access the state of a workspace other than the selected one
+func (s *StaticEvaluator) WithWorkspace(workspace string) *StaticEvaluator {
+	call := s.call
+	call.workspace = workspace
+	return &StaticEvaluator{
+		call: call,
+		cfg:  s.cfg,
+	}
+}
+
 func (s *StaticEvaluator) scope(ident StaticIdentifier) *lang.Scope {
 	return newStaticScope(s, ident)
 }
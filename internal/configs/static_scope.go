@@ -266,3 +266,7 @@ func (s staticScopeData) GetOutput(addrs.OutputValue, tfdiags.SourceRange) (cty.
 func (s staticScopeData) GetCheckBlock(addrs.Check, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics) {
 	panic("Not Available in Static Context")
 }
+
+func (s staticScopeData) GetPlanAttr(addrs.PlanAttr, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics) {
+	panic("Not Available in Static Context")
+}
@@ -8,6 +8,7 @@ package encryption
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 
 	"github.com/opentofu/opentofu/internal/configs"
 	"github.com/opentofu/opentofu/internal/encryption/config"
@@ -28,6 +29,7 @@ type baseEncryption struct {
 	enforced   bool
 	name       string
 	encMethods []method.Method
+	encAddrs   []method.Addr
 	encMeta    map[keyprovider.Addr][]byte
 	staticEval *configs.StaticEvaluator
 }
@@ -69,8 +71,9 @@ func newBaseEncryption(enc *encryption, target *config.TargetConfig, enforced bo
 	//   This performs a e2e validation run of the config -> methods flow. It serves as a validation step and allows us to return detailed
 	//   diagnostics here and simple errors in the decrypt function below.
 	//
-	methods, diags := base.buildTargetMethods(base.encMeta)
+	methods, addrs, diags := base.buildTargetMethods(base.encMeta)
 	base.encMethods = methods
+	base.encAddrs = addrs
 
 	return base, diags
 }
@@ -140,8 +143,9 @@ func (s *baseEncryption) decrypt(data []byte, validator func([]byte) error) ([]b
 		}
 
 		// Yep, it's already decrypted
-		for _, method := range s.encMethods {
+		for i, method := range s.encMethods {
 			if unencrypted.Is(method) {
+				log.Printf("[DEBUG] Read unencrypted data for %s with method %s", s.name, s.encAddrs[i])
 				return data, nil
 			}
 		}
@@ -153,7 +157,7 @@ func (s *baseEncryption) decrypt(data []byte, validator func([]byte) error) ([]b
 	}
 
 	// TODO Discuss if we should potentially cache this based on a json-encoded version of es.Meta and reduce overhead dramatically
-	methods, diags := s.buildTargetMethods(es.Meta)
+	methods, addrs, diags := s.buildTargetMethods(es.Meta)
 	if diags.HasErrors() {
 		// This cast to error here is safe as we know that at least one error exists
 		// This is also quite unlikely to happen as the constructor already has checked this code path
@@ -161,7 +165,7 @@ func (s *baseEncryption) decrypt(data []byte, validator func([]byte) error) ([]b
 	}
 
 	errs := make([]error, 0)
-	for _, method := range methods {
+	for i, method := range methods {
 		if unencrypted.Is(method) {
 			// Not applicable
 			continue
@@ -169,6 +173,11 @@ func (s *baseEncryption) decrypt(data []byte, validator func([]byte) error) ([]b
 		uncd, err := method.Decrypt(es.Data)
 		if err == nil {
 			// Success
+			if i > 0 {
+				// Let operators confirm the progress of a rollover, as the data is encrypted with the primary method when
+				// it's next written.
+				log.Printf("[DEBUG] Decrypted %s with fallback method %s instead of primary method %s", s.name, addrs[i], addrs[0])
+			}
 			return uncd, nil
 		}
 		// Record the failure
@@ -75,24 +75,27 @@ type RemoteConfig struct {
 
 // TargetConfig describes the target.encryption.state, target.encryption.plan, etc blocks.
 type TargetConfig struct {
-	Method   hcl.Expression `hcl:"method,optional"`
-	Fallback *TargetConfig  `hcl:"fallback,block"`
+	Method             hcl.Expression `hcl:"method,optional"`
+	DecryptionFallback hcl.Expression `hcl:"decryption_fallback,optional"`
+	Fallback           *TargetConfig  `hcl:"fallback,block"`
 }
 
 // EnforceableTargetConfig is an extension of the TargetConfig that supports the enforced form.
 //
 // Note: This struct is copied because gohcl does not support embedding.
 type EnforceableTargetConfig struct {
-	Enforced bool           `hcl:"enforced,optional"`
-	Method   hcl.Expression `hcl:"method,optional"`
-	Fallback *TargetConfig  `hcl:"fallback,block"`
+	Enforced           bool           `hcl:"enforced,optional"`
+	Method             hcl.Expression `hcl:"method,optional"`
+	DecryptionFallback hcl.Expression `hcl:"decryption_fallback,optional"`
+	Fallback           *TargetConfig  `hcl:"fallback,block"`
 }
 
 // AsTargetConfig converts the struct into its parent TargetConfig.
 func (e EnforceableTargetConfig) AsTargetConfig() *TargetConfig {
 	return &TargetConfig{
-		Method:   e.Method,
-		Fallback: e.Fallback,
+		Method:             e.Method,
+		DecryptionFallback: e.DecryptionFallback,
+		Fallback:           e.Fallback,
 	}
 }
 
@@ -101,15 +104,17 @@ func (e EnforceableTargetConfig) AsTargetConfig() *TargetConfig {
 //
 // Note: This struct is copied because gohcl does not support embedding.
 type NamedTargetConfig struct {
-	Name     string         `hcl:"name,label"`
-	Method   hcl.Expression `hcl:"method,optional"`
-	Fallback *TargetConfig  `hcl:"fallback,block"`
+	Name               string         `hcl:"name,label"`
+	Method             hcl.Expression `hcl:"method,optional"`
+	DecryptionFallback hcl.Expression `hcl:"decryption_fallback,optional"`
+	Fallback           *TargetConfig  `hcl:"fallback,block"`
 }
 
 // AsTargetConfig converts the struct into its parent TargetConfig.
 func (n NamedTargetConfig) AsTargetConfig() *TargetConfig {
 	return &TargetConfig{
-		Method:   n.Method,
-		Fallback: n.Fallback,
+		Method:             n.Method,
+		DecryptionFallback: n.DecryptionFallback,
+		Fallback:           n.Fallback,
 	}
 }
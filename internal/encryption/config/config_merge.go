@@ -96,6 +96,12 @@ func mergeTargetConfigs(cfg *TargetConfig, override *TargetConfig) *TargetConfig
 		merged.Method = cfg.Method
 	}
 
+	if override.DecryptionFallback != nil {
+		merged.DecryptionFallback = override.DecryptionFallback
+	} else {
+		merged.DecryptionFallback = cfg.DecryptionFallback
+	}
+
 	if override.Fallback != nil {
 		merged.Fallback = override.Fallback
 	} else {
@@ -115,9 +121,10 @@ func mergeEnforceableTargetConfigs(cfg *EnforceableTargetConfig, override *Enfor
 
 	mergeTarget := mergeTargetConfigs(cfg.AsTargetConfig(), override.AsTargetConfig())
 	return &EnforceableTargetConfig{
-		Enforced: cfg.Enforced || override.Enforced,
-		Method:   mergeTarget.Method,
-		Fallback: mergeTarget.Fallback,
+		Enforced:           cfg.Enforced || override.Enforced,
+		Method:             mergeTarget.Method,
+		DecryptionFallback: mergeTarget.DecryptionFallback,
+		Fallback:           mergeTarget.Fallback,
 	}
 }
 
@@ -143,9 +150,10 @@ func mergeRemoteConfigs(cfg *RemoteConfig, override *RemoteConfig) *RemoteConfig
 				// gohcl does not support struct embedding
 				mergeTarget := mergeTargetConfigs(t.AsTargetConfig(), overrideTarget.AsTargetConfig())
 				merged.Targets[i] = NamedTargetConfig{
-					Name:     t.Name,
-					Method:   mergeTarget.Method,
-					Fallback: mergeTarget.Fallback,
+					Name:               t.Name,
+					Method:             mergeTarget.Method,
+					DecryptionFallback: mergeTarget.DecryptionFallback,
+					Fallback:           mergeTarget.Fallback,
 				}
 				break
 			}
@@ -32,6 +32,10 @@ type Config struct {
 	KMSKeyID string `hcl:"kms_key_id"`
 	KeySpec  string `hcl:"key_spec"`
 
+	// EncryptionContext is passed to KMS when generating and decrypting the
+	// data keys, and must be the same for both.
+	EncryptionContext map[string]string `hcl:"encryption_context,optional"`
+
 	// Mirrored S3 Backend Config, mirror any changes
 	AccessKey                      string                     `hcl:"access_key,optional"`
 	Endpoints                      []ConfigEndpoints          `hcl:"endpoints,block"`
@@ -222,6 +226,14 @@ func (c Config) validate() (err error) {
 		}
 	}
 
+	for key, value := range c.EncryptionContext {
+		if key == "" || value == "" {
+			return &keyprovider.ErrInvalidConfiguration{
+				Message: fmt.Sprintf("invalid encryption_context: the keys and values must not be empty, got %q = %q", key, value),
+			}
+		}
+	}
+
 	spec := c.getKeySpecAsAWSType()
 	if spec == nil {
 		// This is to fetch a list of the values from the enum, because `spec` here can be nil, so we have to grab
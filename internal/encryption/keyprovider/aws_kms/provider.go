@@ -7,6 +7,11 @@ package aws_kms
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
@@ -16,6 +21,11 @@ import (
 
 type keyMeta struct {
 	CiphertextBlob []byte `json:"ciphertext_blob"`
+
+	// EncryptionContext records the encryption context the data key was
+	// generated with, so that decrypting it with another one can be told
+	// apart from other failures.
+	EncryptionContext map[string]string `json:"encryption_context,omitempty"`
 }
 
 func (m keyMeta) isPresent() bool {
@@ -49,8 +59,9 @@ func (p keyProvider) Provide(rawMeta keyprovider.KeyMeta) (keyprovider.Output, k
 	spec := types.DataKeySpec(p.KeySpec)
 
 	generatedKeyData, err := p.svc.GenerateDataKey(p.ctx, &kms.GenerateDataKeyInput{
-		KeyId:   aws.String(p.KMSKeyID),
-		KeySpec: spec,
+		KeyId:             aws.String(p.KMSKeyID),
+		KeySpec:           spec,
+		EncryptionContext: p.EncryptionContext,
 	})
 
 	if err != nil {
@@ -63,18 +74,34 @@ func (p keyProvider) Provide(rawMeta keyprovider.KeyMeta) (keyprovider.Output, k
 	// Set initial outputs that are always set
 	out.EncryptionKey = generatedKeyData.Plaintext
 	outMeta.CiphertextBlob = generatedKeyData.CiphertextBlob
+	outMeta.EncryptionContext = p.EncryptionContext
 
 	// We do not set the DecryptionKey here as we should only be setting the decryption key if we are decrypting
 	// and that is handled below when we check if the inMeta has a CiphertextBlob
 
 	if inMeta.isPresent() {
+		// KMS would refuse to decrypt the key with another encryption context, with an error that doesn't say why.
+		if !maps.Equal(inMeta.EncryptionContext, p.EncryptionContext) {
+			return out, outMeta, &keyprovider.ErrKeyProviderFailure{
+				Message: fmt.Sprintf("the encryption_context %s doesn't match the encryption context %s the key was encrypted with", formatEncryptionContext(p.EncryptionContext), formatEncryptionContext(inMeta.EncryptionContext)),
+			}
+		}
+
 		// We have an existing decryption key to decrypt, so we should now populate the DecryptionKey
 		decryptedKeyData, decryptErr := p.svc.Decrypt(p.ctx, &kms.DecryptInput{
-			KeyId:          aws.String(p.KMSKeyID),
-			CiphertextBlob: inMeta.CiphertextBlob,
+			KeyId:             aws.String(p.KMSKeyID),
+			CiphertextBlob:    inMeta.CiphertextBlob,
+			EncryptionContext: p.EncryptionContext,
 		})
 
 		if decryptErr != nil {
+			var invalidCiphertext *types.InvalidCiphertextException
+			if errors.As(decryptErr, &invalidCiphertext) {
+				return out, outMeta, &keyprovider.ErrKeyProviderFailure{
+					Message: "the key couldn't be decrypted with the encryption_context " + formatEncryptionContext(p.EncryptionContext) + ", it may have been encrypted with another encryption context or be corrupted",
+					Cause:   decryptErr,
+				}
+			}
 			return out, outMeta, &keyprovider.ErrKeyProviderFailure{Cause: decryptErr}
 		}
 
@@ -84,3 +111,21 @@ func (p keyProvider) Provide(rawMeta keyprovider.KeyMeta) (keyprovider.Output, k
 
 	return out, outMeta, nil
 }
+
+// formatEncryptionContext formats an encryption context for error messages,
+// with the keys sorted.
+func formatEncryptionContext(encryptionContext map[string]string) string {
+	if len(encryptionContext) == 0 {
+		return "(none)"
+	}
+	keys := make([]string, 0, len(encryptionContext))
+	for key := range encryptionContext {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", key, encryptionContext[key])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -6,8 +6,15 @@
 package aws_kms
 
 import (
+	"maps"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/opentofu/opentofu/internal/encryption/keyprovider"
 )
 
 func getKey(t *testing.T) string {
@@ -80,3 +87,92 @@ func TestKMSProvider_Simple(t *testing.T) {
 		t.Fatalf("No ciphertext blob provided")
 	}
 }
+
+func TestKMSProvider_EncryptionContext(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "accesskey")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secretkey")
+
+	var genContext, decryptContext map[string]string
+	injectMock(&mockKMS{
+		genkey: func(params *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+			genContext = params.EncryptionContext
+			// the ciphertext can only be decrypted with the same context
+			return &kms.GenerateDataKeyOutput{
+				CiphertextBlob: []byte(formatEncryptionContext(params.EncryptionContext)),
+				Plaintext:      []byte("plaintext"),
+			}, nil
+		},
+		decrypt: func(params *kms.DecryptInput) (*kms.DecryptOutput, error) {
+			decryptContext = params.EncryptionContext
+			if string(params.CiphertextBlob) != formatEncryptionContext(params.EncryptionContext) {
+				return nil, &types.InvalidCiphertextException{Message: aws.String("")}
+			}
+			return &kms.DecryptOutput{Plaintext: []byte("plaintext")}, nil
+		},
+	})
+
+	build := func(encryptionContext map[string]string) keyprovider.KeyProvider {
+		t.Helper()
+		provider, _, err := Config{
+			KMSKeyID:          "alias/my-mock-key",
+			KeySpec:           "AES_256",
+			EncryptionContext: encryptionContext,
+
+			SkipCredsValidation: true, // Required for mocking
+		}.Build()
+		if err != nil {
+			t.Fatalf("Error building provider: %s", err)
+		}
+		return provider
+	}
+
+	encryptionContext := map[string]string{"workspace": "blue"}
+	provider := build(encryptionContext)
+	_, meta, err := provider.Provide(&keyMeta{})
+	if err != nil {
+		t.Fatalf("Error providing keys: %s", err)
+	}
+	if !maps.Equal(genContext, encryptionContext) {
+		t.Fatalf("Expected the data key to be generated with the encryption context, got %v", genContext)
+	}
+
+	output, _, err := provider.Provide(meta)
+	if err != nil {
+		t.Fatalf("Error providing keys: %s", err)
+	}
+	if len(output.DecryptionKey) == 0 {
+		t.Fatalf("No decryption key provided")
+	}
+	if !maps.Equal(decryptContext, encryptionContext) {
+		t.Fatalf("Expected the data key to be decrypted with the encryption context, got %v", decryptContext)
+	}
+
+	// another encryption context is refused before asking KMS
+	decryptContext = nil
+	_, _, err = build(map[string]string{"workspace": "green"}).Provide(meta)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match the encryption context") {
+		t.Fatalf("Expected an encryption context mismatch, got %v", err)
+	}
+	if decryptContext != nil {
+		t.Fatalf("Expected KMS not to be asked to decrypt the key")
+	}
+
+	// as is KMS's failure to decrypt with the given one
+	meta.(*keyMeta).EncryptionContext = map[string]string{"workspace": "green"}
+	_, _, err = build(map[string]string{"workspace": "green"}).Provide(meta)
+	if err == nil || !strings.Contains(err.Error(), "may have been encrypted with another encryption context") {
+		t.Fatalf("Expected an encryption context mismatch, got %v", err)
+	}
+}
+
+func TestConfig_invalidEncryptionContext(t *testing.T) {
+	_, _, err := Config{
+		KMSKeyID:          "alias/my-mock-key",
+		KeySpec:           "AES_256",
+		EncryptionContext: map[string]string{"workspace": ""},
+	}.Build()
+	if err == nil || !strings.Contains(err.Error(), "invalid encryption_context") {
+		t.Fatalf("Expected an invalid encryption_context, got %v", err)
+	}
+}
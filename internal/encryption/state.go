@@ -8,6 +8,7 @@ package encryption
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/opentofu/opentofu/internal/configs"
@@ -56,11 +57,52 @@ type StateEncryption interface {
 
 type stateEncryption struct {
 	base *baseEncryption
+
+	// workspaces holds the state encryption of the workspaces other than the one the configuration was evaluated
+	// for, for configurations referencing terraform.workspace.
+	workspacesLock sync.Mutex
+	workspaces     map[string]StateEncryption
 }
 
 func newStateEncryption(enc *encryption, target *config.TargetConfig, enforced bool, name string, staticEval *configs.StaticEvaluator) (StateEncryption, hcl.Diagnostics) {
 	base, diags := newBaseEncryption(enc, target, enforced, name, staticEval)
-	return &stateEncryption{base}, diags
+	return &stateEncryption{base: base}, diags
+}
+
+// StateEncryptionForWorkspace returns the StateEncryption for the state of the given workspace. The encryption
+// configuration is evaluated for the selected workspace, but backends access the states of other workspaces too,
+// such as when migrating all workspaces or deleting one. The key providers and methods are set up again with
+// terraform.workspace evaluated as the given workspace, so that each workspace is encrypted and decrypted with its
+// own keys. Any other StateEncryption is returned as-is.
+func StateEncryptionForWorkspace(enc StateEncryption, workspace string) (StateEncryption, error) {
+	if s, ok := enc.(*stateEncryption); ok {
+		return s.forWorkspace(workspace)
+	}
+	return enc, nil
+}
+
+func (s *stateEncryption) forWorkspace(workspace string) (StateEncryption, error) {
+	if s.base.staticEval == nil || workspace == s.base.staticEval.Workspace() {
+		return s, nil
+	}
+
+	s.workspacesLock.Lock()
+	defer s.workspacesLock.Unlock()
+
+	if enc, ok := s.workspaces[workspace]; ok {
+		return enc, nil
+	}
+
+	base, diags := newBaseEncryption(s.base.enc, s.base.target, s.base.enforced, s.base.name, s.base.staticEval.WithWorkspace(workspace))
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("unable to set up the state encryption for workspace %q: %w", workspace, diags)
+	}
+	enc := &stateEncryption{base: base}
+	if s.workspaces == nil {
+		s.workspaces = make(map[string]StateEncryption)
+	}
+	s.workspaces[workspace] = enc
+	return enc, nil
 }
 
 type statedata struct {
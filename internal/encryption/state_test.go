@@ -0,0 +1,225 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package encryption
+
+import (
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/configs"
+	"github.com/opentofu/opentofu/internal/encryption/config"
+	"github.com/opentofu/opentofu/internal/encryption/keyprovider/static"
+	"github.com/opentofu/opentofu/internal/encryption/method/aesgcm"
+	"github.com/opentofu/opentofu/internal/encryption/registry/lockingencryptionregistry"
+)
+
+func TestStateEncryptionForWorkspace(t *testing.T) {
+	t.Parallel()
+
+	reg := lockingencryptionregistry.New()
+	if err := reg.RegisterKeyProvider(static.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterMethod(aesgcm.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	setup := func(t *testing.T, rawConfig string) StateEncryption {
+		cfg, diags := config.LoadConfigFromString("Test Config Source", rawConfig)
+		if diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		staticEval := configs.NewStaticEvaluator(nil, configs.NewStaticModuleCall(addrs.RootModule, nil, "<testing>", "default"))
+		enc, diags := New(reg, cfg, staticEval)
+		if diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		return enc.State()
+	}
+	forWorkspace := func(t *testing.T, enc StateEncryption, workspace string) StateEncryption {
+		wsEnc, err := StateEncryptionForWorkspace(enc, workspace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wsEnc
+	}
+	encrypt := func(t *testing.T, enc StateEncryption) []byte {
+		data, err := enc.EncryptState([]byte(`{"serial": 1, "lineage": "magic"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	t.Run("per-workspace", func(t *testing.T) {
+		enc := setup(t, `
+			key_provider "static" "workspace" {
+				key = sha256("secret-${terraform.workspace}")
+			}
+			method "aes_gcm" "workspace" {
+				keys = key_provider.static.workspace
+			}
+			state {
+				method = method.aes_gcm.workspace
+			}
+		`)
+
+		if forWorkspace(t, enc, "default") != enc {
+			t.Fatal("expected the selected workspace to use the state encryption as-is")
+		}
+		blue := forWorkspace(t, enc, "blue")
+		if forWorkspace(t, enc, "blue") != blue {
+			t.Fatal("expected the state encryption of the workspace to be reused")
+		}
+
+		defaultState := encrypt(t, enc)
+		blueState := encrypt(t, blue)
+		if _, err := blue.DecryptState(blueState); err != nil {
+			t.Fatalf("expected the workspace to decrypt its own state, got %v", err)
+		}
+		if _, err := blue.DecryptState(defaultState); err == nil {
+			t.Fatal("expected the state of another workspace not to decrypt with the key of the workspace")
+		}
+		if _, err := enc.DecryptState(blueState); err == nil {
+			t.Fatal("expected the state of the workspace not to decrypt with the key of the selected workspace")
+		}
+	})
+
+	t.Run("migration", func(t *testing.T) {
+		// the states were encrypted with a single key before the key became per-workspace
+		global := setup(t, `
+			key_provider "static" "global" {
+				key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653169"
+			}
+			method "aes_gcm" "global" {
+				keys = key_provider.static.global
+			}
+			state {
+				method = method.aes_gcm.global
+			}
+		`)
+		oldState := encrypt(t, forWorkspace(t, global, "blue"))
+
+		enc := setup(t, `
+			key_provider "static" "global" {
+				key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653169"
+			}
+			key_provider "static" "workspace" {
+				key = sha256("secret-${terraform.workspace}")
+			}
+			method "aes_gcm" "global" {
+				keys = key_provider.static.global
+			}
+			method "aes_gcm" "workspace" {
+				keys = key_provider.static.workspace
+			}
+			state {
+				method = method.aes_gcm.workspace
+				fallback {
+					method = method.aes_gcm.global
+				}
+			}
+		`)
+		blue := forWorkspace(t, enc, "blue")
+		if _, err := blue.DecryptState(oldState); err != nil {
+			t.Fatalf("expected the state to decrypt with the fallback, got %v", err)
+		}
+		if _, err := global.DecryptState(encrypt(t, blue)); err == nil {
+			t.Fatal("expected the state to be encrypted with the key of the workspace")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		enc := StateEncryptionDisabled()
+		if forWorkspace(t, enc, "blue") != enc {
+			t.Fatal("expected the disabled state encryption to be returned as-is")
+		}
+	})
+}
+
+func TestStateEncryptionDecryptionFallback(t *testing.T) {
+	t.Parallel()
+
+	reg := lockingencryptionregistry.New()
+	if err := reg.RegisterKeyProvider(static.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterMethod(aesgcm.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	setup := func(t *testing.T, rawConfig string) StateEncryption {
+		cfg, diags := config.LoadConfigFromString("Test Config Source", rawConfig)
+		if diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		enc, diags := New(reg, cfg, configs.NewStaticEvaluator(nil, configs.RootModuleCallForTesting()))
+		if diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		return enc.State()
+	}
+	keys := `
+		key_provider "static" "oldest" {
+			key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653169"
+		}
+		key_provider "static" "old" {
+			key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653170"
+		}
+		key_provider "static" "new" {
+			key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653171"
+		}
+		method "aes_gcm" "oldest" {
+			keys = key_provider.static.oldest
+		}
+		method "aes_gcm" "old" {
+			keys = key_provider.static.old
+		}
+		method "aes_gcm" "new" {
+			keys = key_provider.static.new
+		}
+	`
+	oldest := setup(t, keys+`
+		state {
+			method = method.aes_gcm.oldest
+		}
+	`)
+	old := setup(t, keys+`
+		state {
+			method = method.aes_gcm.old
+		}
+	`)
+	enc := setup(t, keys+`
+		state {
+			method              = method.aes_gcm.new
+			decryption_fallback = [method.aes_gcm.old, method.aes_gcm.oldest]
+		}
+	`)
+
+	plain := []byte(`{"serial": 1, "lineage": "magic"}`)
+	for name, prev := range map[string]StateEncryption{"old": old, "oldest": oldest} {
+		encrypted, err := prev.EncryptState(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := enc.DecryptState(encrypted)
+		if err != nil {
+			t.Fatalf("expected the state encrypted with %s to decrypt with the fallback, got %v", name, err)
+		}
+		if string(decrypted) != string(plain) {
+			t.Fatalf("unexpected decrypted state %s", decrypted)
+		}
+	}
+
+	// writes always use the primary method
+	encrypted, err := enc.EncryptState(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.DecryptState(encrypted); err == nil {
+		t.Fatal("expected the state to be encrypted with the primary method")
+	}
+}
@@ -35,7 +35,9 @@ type targetBuilder struct {
 	staticEval   *configs.StaticEvaluator
 }
 
-func (base *baseEncryption) buildTargetMethods(meta map[keyprovider.Addr][]byte) ([]method.Method, hcl.Diagnostics) {
+// buildTargetMethods returns the primary and fallback methods of the target, in the order they are tried in to decrypt,
+// along with their addresses.
+func (base *baseEncryption) buildTargetMethods(meta map[keyprovider.Addr][]byte) ([]method.Method, []method.Addr, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 
 	builder := &targetBuilder{
@@ -53,21 +55,21 @@ func (base *baseEncryption) buildTargetMethods(meta map[keyprovider.Addr][]byte)
 	keyDiags := append(diags, builder.setupKeyProviders()...)
 	diags = append(diags, keyDiags...)
 	if diags.HasErrors() {
-		return nil, diags
+		return nil, nil, diags
 	}
 	methodDiags := append(diags, builder.setupMethods()...)
 	diags = append(diags, methodDiags...)
 	if diags.HasErrors() {
-		return nil, diags
+		return nil, nil, diags
 	}
 
-	methods, targetDiags := builder.build(base.target, base.name)
+	methods, addrs, targetDiags := builder.build(base.target, base.name)
 	diags = append(diags, targetDiags...)
 
 	if base.enforced {
 		for _, m := range methods {
 			if unencrypted.Is(m) {
-				return nil, append(diags, &hcl.Diagnostic{
+				return nil, nil, append(diags, &hcl.Diagnostic{
 					Severity: hcl.DiagError,
 					Summary:  "Unencrypted method is forbidden",
 					Detail:   "Unable to use `unencrypted` method since the `enforced` flag is used.",
@@ -76,13 +78,14 @@ func (base *baseEncryption) buildTargetMethods(meta map[keyprovider.Addr][]byte)
 		}
 	}
 
-	return methods, diags
+	return methods, addrs, diags
 }
 
-// build sets up a single target for encryption. It returns the primary and fallback methods for the target, as well
-// as a list of diagnostics if the target is invalid.
+// build sets up a single target for encryption. It returns the primary method for the target followed by the methods
+// of its decryption_fallback list and of its fallback block, along with their addresses, as well as a list of
+// diagnostics if the target is invalid.
 // The targetName parameter is used for error messages only.
-func (e *targetBuilder) build(target *config.TargetConfig, targetName string) (methods []method.Method, diags hcl.Diagnostics) {
+func (e *targetBuilder) build(target *config.TargetConfig, targetName string) (methods []method.Method, addrs []method.Addr, diags hcl.Diagnostics) {
 
 	// gohcl has some weirdness around attributes that are not provided, but are hcl.Expressions
 	// They will set the attribute field to a static null expression
@@ -96,8 +99,10 @@ func (e *targetBuilder) build(target *config.TargetConfig, targetName string) (m
 	// Only attempt to fetch the method if the decoding was successful
 	if !decodeDiags.HasErrors() {
 		if methodIdent != nil {
-			if method, ok := e.methods[method.Addr(*methodIdent)]; ok {
+			addr := method.Addr(*methodIdent)
+			if method, ok := e.methods[addr]; ok {
 				methods = append(methods, method)
+				addrs = append(addrs, addr)
 			} else {
 				// We can't continue if the method is not found
 				diags = append(diags, &hcl.Diagnostic{
@@ -117,12 +122,34 @@ func (e *targetBuilder) build(target *config.TargetConfig, targetName string) (m
 		}
 	}
 
+	// Attempt to fetch the decryption fallback methods, in order, if they've been configured
+	if target.DecryptionFallback != nil {
+		var fallbackIdents []string
+		fallbackDiags := gohcl.DecodeExpression(target.DecryptionFallback, e.ctx, &fallbackIdents)
+		diags = append(diags, fallbackDiags...)
+		for _, ident := range fallbackIdents {
+			addr := method.Addr(ident)
+			if fallback, ok := e.methods[addr]; ok {
+				methods = append(methods, fallback)
+				addrs = append(addrs, addr)
+			} else {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Undefined encryption method",
+					Detail:   fmt.Sprintf("Can not find %q for %q", ident, targetName+".decryption_fallback"),
+					Subject:  target.DecryptionFallback.Range().Ptr(),
+				})
+			}
+		}
+	}
+
 	// Attempt to fetch the fallback method if it's been configured
 	if target.Fallback != nil {
-		fallback, fallbackDiags := e.build(target.Fallback, targetName+".fallback")
+		fallback, fallbackAddrs, fallbackDiags := e.build(target.Fallback, targetName+".fallback")
 		diags = append(diags, fallbackDiags...)
 		methods = append(methods, fallback...)
+		addrs = append(addrs, fallbackAddrs...)
 	}
 
-	return methods, diags
+	return methods, addrs, diags
 }
@@ -76,6 +76,48 @@ func TestBaseEncryption_buildTargetMethods(t *testing.T) {
 				unencrypted.Is,
 			},
 		},
+		"decryption-fallback": {
+			rawConfig: `
+				key_provider "static" "basic" {
+					key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653169"
+				}
+				method "aes_gcm" "new" {
+					keys = key_provider.static.basic
+				}
+				method "aes_gcm" "old" {
+					keys = key_provider.static.basic
+				}
+				method "unencrypted" "example" {
+				}
+				state {
+					method              = method.aes_gcm.new
+					decryption_fallback = [method.aes_gcm.old, method.unencrypted.example]
+				}
+			`,
+			wantMethods: []func(method.Method) bool{
+				aesgcm.Is,
+				aesgcm.Is,
+				unencrypted.Is,
+			},
+		},
+		"undefined-decryption-fallback": {
+			rawConfig: `
+				key_provider "static" "basic" {
+					key = "6f6f706830656f67686f6834616872756f3751756165686565796f6f72653169"
+				}
+				method "aes_gcm" "example" {
+					keys = key_provider.static.basic
+				}
+				state {
+					method              = method.aes_gcm.example
+					decryption_fallback = ["aes_gcm.undefined"]
+				}
+			`,
+			wantMethods: []func(method.Method) bool{
+				aesgcm.Is,
+			},
+			wantErr: `Test Config Source:10,28-49: Undefined encryption method; Can not find "aes_gcm.undefined" for "test.decryption_fallback"`,
+		},
 		"enforced": {
 			rawConfig: `
 				key_provider "static" "basic" {
@@ -242,7 +284,7 @@ func (testCase btmTestCase) newTestRun(reg registry.Registry, staticEval *config
 			staticEval: staticEval,
 		}
 
-		methods, diags := base.buildTargetMethods(base.encMeta)
+		methods, _, diags := base.buildTargetMethods(base.encMeta)
 
 		if diags.HasErrors() {
 			if !hasDiagWithMsg(diags, testCase.wantErr) {
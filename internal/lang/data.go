@@ -38,4 +38,5 @@ type Data interface {
 	GetInputVariable(addrs.InputVariable, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics)
 	GetOutput(addrs.OutputValue, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics)
 	GetCheckBlock(addrs.Check, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics)
+	GetPlanAttr(addrs.PlanAttr, tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics)
 }
@@ -23,6 +23,7 @@ type dataForTests struct {
 	TerraformAttrs map[string]cty.Value
 	InputVariables map[string]cty.Value
 	CheckBlocks    map[string]cty.Value
+	PlanAttrs      map[string]cty.Value
 }
 
 var _ Data = &dataForTests{}
@@ -76,3 +77,7 @@ func (d *dataForTests) GetOutput(addr addrs.OutputValue, rng tfdiags.SourceRange
 func (d *dataForTests) GetCheckBlock(addr addrs.Check, rng tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics) {
 	return d.CheckBlocks[addr.Name], nil
 }
+
+func (d *dataForTests) GetPlanAttr(addr addrs.PlanAttr, rng tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics) {
+	return d.PlanAttrs[addr.Name], nil
+}
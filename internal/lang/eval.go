@@ -385,6 +385,7 @@ type evalVarBuilder struct {
 	countAttrs       map[string]cty.Value
 	forEachAttrs     map[string]cty.Value
 	checkBlocks      map[string]cty.Value
+	planAttrs        map[string]cty.Value
 	self             cty.Value
 }
 
@@ -403,6 +404,7 @@ func (s *Scope) newEvalVarBuilder() *evalVarBuilder {
 		countAttrs:       map[string]cty.Value{},
 		forEachAttrs:     map[string]cty.Value{},
 		checkBlocks:      map[string]cty.Value{},
+		planAttrs:        map[string]cty.Value{},
 	}
 }
 
@@ -507,6 +509,9 @@ func (b *evalVarBuilder) putValueBySubject(ref *addrs.Reference) tfdiags.Diagnos
 	case addrs.Check:
 		b.outputValues[subj.Name], normDiags = normalizeRefValue(b.s.Data.GetCheckBlock(subj, rng))
 
+	case addrs.PlanAttr:
+		b.planAttrs[subj.Name], normDiags = normalizeRefValue(b.s.Data.GetPlanAttr(subj, rng))
+
 	default:
 		// Should never happen
 		panic(fmt.Errorf("Scope.buildEvalContext cannot handle address type %T", rawSubj))
@@ -562,8 +567,9 @@ func (b *evalVarBuilder) buildAllVariablesInto(vals map[string]cty.Value) {
 	vals["count"] = cty.ObjectVal(b.countAttrs)
 	vals["each"] = cty.ObjectVal(b.forEachAttrs)
 
-	// Checks and outputs are conditionally included in the available scope, so
-	// we'll only write out their values if we actually have something for them.
+	// Checks, outputs and the plan are conditionally included in the available
+	// scope, so we'll only write out their values if we actually have
+	// something for them.
 	if len(b.checkBlocks) > 0 {
 		vals["check"] = cty.ObjectVal(b.checkBlocks)
 	}
@@ -572,6 +578,10 @@ func (b *evalVarBuilder) buildAllVariablesInto(vals map[string]cty.Value) {
 		vals["output"] = cty.ObjectVal(b.outputValues)
 	}
 
+	if len(b.planAttrs) > 0 {
+		vals["plan"] = cty.ObjectVal(b.planAttrs)
+	}
+
 	if b.self != cty.NilVal {
 		vals["self"] = b.self
 	}
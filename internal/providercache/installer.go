@@ -48,6 +48,12 @@ type Installer struct {
 	// file.
 	globalCacheDirMayBreakDependencyLockFile bool
 
+	// verifyPlugins forces the checksums of the packages in globalCacheDir to
+	// be verified against the dependency lock file before they are linked
+	// into targetDir, overriding globalCacheDirMayBreakDependencyLockFile,
+	// and verifies the linked packages again once in targetDir.
+	verifyPlugins bool
+
 	// builtInProviderTypes is an optional set of types that should be
 	// considered valid to appear in the special terraform.io/builtin/...
 	// namespace, which we use for providers that are built in to OpenTofu
@@ -128,6 +134,19 @@ func (i *Installer) SetGlobalCacheDirMayBreakDependencyLockFile(mayBreak bool) {
 	i.globalCacheDirMayBreakDependencyLockFile = mayBreak
 }
 
+// SetVerifyPlugins activates or deactivates the full verification of the
+// packages linked from the global cache directory.
+//
+// If this is set then a package in the global cache directory is used only if
+// it matches one of the checksums recorded in the dependency lock file, even
+// if SetGlobalCacheDirMayBreakDependencyLockFile allows otherwise, and the
+// package linked into the target directory is checked against the same
+// checksums. A package that doesn't match is installed again from the
+// provider source.
+func (i *Installer) SetVerifyPlugins(verify bool) {
+	i.verifyPlugins = verify
+}
+
 // HasGlobalCacheDir returns true if someone has previously called
 // SetGlobalCacheDir to configure a global cache directory for this installer.
 func (i *Installer) HasGlobalCacheDir() bool {
@@ -400,7 +419,7 @@ NeedProvider:
 					}
 				}
 
-				if !acceptablePackage && i.globalCacheDirMayBreakDependencyLockFile {
+				if !acceptablePackage && i.globalCacheDirMayBreakDependencyLockFile && !i.verifyPlugins {
 					// The "may break dependency lock file" setting effectively
 					// means that we'll accept any matching package that's
 					// already in the cache, regardless of whether it matches
@@ -439,7 +458,13 @@ NeedProvider:
 				// for "there was an entry in the cache but we ignored it
 				// because the checksum didn't match"? We can't use
 				// LinkFromCacheFailure in that case because this isn't a
-				// failure. For now we'll just be quiet about it.
+				// failure. For now we'll just log it.
+				if !acceptablePackage && len(preferredHashes) != 0 {
+					log.Printf(
+						"[WARN] Global cache dir package for %s v%s doesn't match this configuration's dependency lock file, so it will be installed again from its source",
+						provider.String(), version.String(),
+					)
+				}
 
 				if acceptablePackage {
 					if cb := evts.LinkFromCacheBegin; cb != nil {
@@ -473,6 +498,16 @@ NeedProvider:
 						}
 						continue
 					}
+					if i.verifyPlugins && len(preferredHashes) != 0 {
+						if matches, err := new.MatchesAnyHash(preferredHashes); err != nil || !matches {
+							err := fmt.Errorf("after linking %s from provider cache at %s the package in the target directory doesn't match any of the checksums previously recorded in the dependency lock file", provider, i.globalCacheDir.baseDir)
+							errs[provider] = err
+							if cb := evts.LinkFromCacheFailure; cb != nil {
+								cb(provider, version, err)
+							}
+							continue
+						}
+					}
 
 					// The LinkFromOtherCache call above should've verified that
 					// the package matches one of the hashes previously recorded,
@@ -31,6 +31,13 @@ import (
 // ApplyMoves expects exclusive access to the given state while it's running.
 // Don't read or write any part of the state structure until ApplyMoves returns.
 func ApplyMoves(stmts []MoveStatement, state *states.State) MoveResults {
+	return applyMoves(stmts, state, func(*MoveStatement) {})
+}
+
+// applyMoves is the implementation of ApplyMoves, which also calls matched
+// for each statement whose "from" address matches an object in the state,
+// including when the move is blocked.
+func applyMoves(stmts []MoveStatement, state *states.State, matched func(stmt *MoveStatement)) MoveResults {
 	ret := makeMoveResults()
 
 	if len(stmts) == 0 {
@@ -105,6 +112,7 @@ func ApplyMoves(stmts []MoveStatement, state *states.State) MoveResults {
 				// For a module endpoint we just try the module address
 				// directly, and execute the moves if it matches.
 				if newAddr, matches := modAddr.MoveDestination(stmt.From, stmt.To); matches {
+					matched(stmt)
 					log.Printf("[TRACE] refactoring.ApplyMoves: %s has moved to %s", modAddr, newAddr)
 
 					// If we already have a module at the new address then
@@ -143,6 +151,7 @@ func ApplyMoves(stmts []MoveStatement, state *states.State) MoveResults {
 				for _, rs := range ms.Resources {
 					rAddr := rs.Addr
 					if newAddr, matches := rAddr.MoveDestination(stmt.From, stmt.To); matches {
+						matched(stmt)
 						log.Printf("[TRACE] refactoring.ApplyMoves: resource %s has moved to %s", rAddr, newAddr)
 
 						// If we already have a resource at the new address then
@@ -165,6 +174,7 @@ func ApplyMoves(stmts []MoveStatement, state *states.State) MoveResults {
 					for key := range rs.Instances {
 						iAddr := rAddr.Instance(key)
 						if newAddr, matches := iAddr.MoveDestination(stmt.From, stmt.To); matches {
+							matched(stmt)
 							log.Printf("[TRACE] refactoring.ApplyMoves: resource instance %s has moved to %s", iAddr, newAddr)
 
 							// If we already have a resource instance at the new
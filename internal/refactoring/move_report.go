@@ -0,0 +1,88 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package refactoring
+
+import (
+	"sort"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+// MoveReport describes the address changes that a set of move statements
+// would make to a state, as returned by ReportMoves.
+type MoveReport struct {
+	// Changes are the resource instances that would move, sorted by their
+	// new addresses. Chains of moves are summarized into a single change.
+	Changes []MoveSuccess
+
+	// Blocked are the objects that couldn't move because another object
+	// already exists at their destination, sorted by their addresses.
+	Blocked []MoveBlocked
+
+	// NoOps are the explicit move statements whose "from" address doesn't
+	// match any object in the state, in the order they were given.
+	NoOps []MoveStatement
+}
+
+// ReportMoves evaluates the given move statements against the given state
+// and reports the address changes they would cause, without modifying the
+// state and without planning.
+//
+// Unlike ValidateMoves, ReportMoves doesn't know which instances the
+// configuration declares and so it only reports the problems that can be
+// found from the statements themselves: cycles and statements that conflict
+// with one another. The full validation still happens during planning.
+func ReportMoves(stmts []MoveStatement, state *states.State) (MoveReport, tfdiags.Diagnostics) {
+	var report MoveReport
+	diags := validateMoveStatementConflicts(stmts)
+	if !diags.HasErrors() {
+		diags = diags.Append(validateMoveStatementGraph(buildMoveStatementGraph(stmts)))
+	}
+	if diags.HasErrors() {
+		return report, diags
+	}
+
+	matched := make(map[*MoveStatement]bool, len(stmts))
+	results := applyMoves(stmts, state.DeepCopy(), func(stmt *MoveStatement) {
+		matched[stmt] = true
+	})
+
+	report.Changes = results.Changes.Values()
+	sort.Slice(report.Changes, func(i, j int) bool {
+		return report.Changes[i].To.Less(report.Changes[j].To)
+	})
+	report.Blocked = results.Blocked.Values()
+	sort.Slice(report.Blocked, func(i, j int) bool {
+		return report.Blocked[i].Actual.String() < report.Blocked[j].Actual.String()
+	})
+	for i := range stmts {
+		if stmt := &stmts[i]; !stmt.Implied && !matched[stmt] {
+			report.NoOps = append(report.NoOps, *stmt)
+		}
+	}
+	return report, diags
+}
+
+// validateMoveStatementConflicts checks that no two of the given statements
+// declare different moves for the same source or destination address of the
+// same module.
+func validateMoveStatementConflicts(stmts []MoveStatement) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	conflicts := newMoveConflicts(func(endpoint *addrs.MoveEndpointInModule) string {
+		return endpoint.String()
+	})
+	for _, stmt := range stmts {
+		if redundant := conflicts.checkRedundant(stmt.From, stmt.To, stmt.DeclRange); redundant.HasErrors() {
+			diags = diags.Append(redundant)
+			continue
+		}
+		noun, shortNoun := moveableNouns(stmt.From.InModuleInstance(stmt.From.Module().UnkeyedInstanceShim()))
+		diags = diags.Append(conflicts.checkAmbiguous(stmt.From, stmt.To, stmt.DeclRange, noun, shortNoun))
+	}
+	return diags
+}
@@ -0,0 +1,138 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package refactoring
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/states"
+)
+
+func TestReportMoves(t *testing.T) {
+	providerAddr := addrs.AbsProviderConfig{
+		Module:   addrs.RootModule,
+		Provider: addrs.MustParseProviderSourceString("example.com/foo/bar"),
+	}
+	mustParseInstAddr := func(s string) addrs.AbsResourceInstance {
+		addr, err := addrs.ParseAbsResourceInstanceStr(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	state := states.BuildState(func(s *states.SyncState) {
+		for _, addr := range []string{"foo.a", "foo.b", "foo.blocker"} {
+			s.SetResourceInstanceCurrent(
+				mustParseInstAddr(addr),
+				&states.ResourceInstanceObjectSrc{
+					Status:    states.ObjectReady,
+					AttrsJSON: []byte(`{}`),
+				},
+				providerAddr,
+			)
+		}
+	})
+
+	tests := map[string]struct {
+		Stmts []MoveStatement
+
+		WantChanges []string
+		WantBlocked []string
+		WantNoOps   []string
+		WantError   string
+	}{
+		"no moves": {
+			Stmts: nil,
+		},
+		"chained moves": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.a", "foo.intermediate"),
+				testMoveStatement(t, "", "foo.intermediate", "foo.final"),
+			},
+			WantChanges: []string{"foo.a -> foo.final"},
+		},
+		"blocked move": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.b", "foo.blocker"),
+			},
+			WantBlocked: []string{"foo.b -> foo.blocker"},
+		},
+		"no-op move": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.a", "foo.c"),
+				testMoveStatement(t, "", "foo.gone", "foo.new"),
+			},
+			WantChanges: []string{"foo.a -> foo.c"},
+			WantNoOps:   []string{"foo.gone[*] -> foo.new[*]"},
+		},
+		"cycle": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.a", "foo.c"),
+				testMoveStatement(t, "", "foo.c", "foo.a"),
+			},
+			WantError: "Cyclic dependency in move statements",
+		},
+		"conflicting destinations": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.a", "foo.c"),
+				testMoveStatement(t, "", "foo.a", "foo.d"),
+			},
+			WantError: "Each resource can move to only one destination resource.",
+		},
+		"conflicting sources": {
+			Stmts: []MoveStatement{
+				testMoveStatement(t, "", "foo.a", "foo.c"),
+				testMoveStatement(t, "", "foo.b", "foo.c"),
+			},
+			WantError: "Ambiguous move statements",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, diags := ReportMoves(test.Stmts, state)
+			if test.WantError != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantError)
+				}
+				if got := diags.Err().Error(); !strings.Contains(got, test.WantError) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, test.WantError)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diags.Err())
+			}
+
+			var gotChanges, gotBlocked, gotNoOps []string
+			for _, change := range report.Changes {
+				gotChanges = append(gotChanges, change.From.String()+" -> "+change.To.String())
+			}
+			for _, blocked := range report.Blocked {
+				gotBlocked = append(gotBlocked, blocked.Actual.String()+" -> "+blocked.Wanted.String())
+			}
+			for _, stmt := range report.NoOps {
+				gotNoOps = append(gotNoOps, stmt.From.String()+" -> "+stmt.To.String())
+			}
+			if diff := cmp.Diff(test.WantChanges, gotChanges); diff != "" {
+				t.Errorf("wrong changes\n%s", diff)
+			}
+			if diff := cmp.Diff(test.WantBlocked, gotBlocked); diff != "" {
+				t.Errorf("wrong blocked moves\n%s", diff)
+			}
+			if diff := cmp.Diff(test.WantNoOps, gotNoOps); diff != "" {
+				t.Errorf("wrong no-op statements\n%s", diff)
+			}
+			if state.ResourceInstance(mustParseInstAddr("foo.a")) == nil {
+				t.Errorf("the state was modified")
+			}
+		})
+	}
+}
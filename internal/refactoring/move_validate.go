@@ -46,12 +46,9 @@ func ValidateMoves(stmts []MoveStatement, rootCfg *configs.Config, declaredInsts
 
 	// We need to track the absolute versions of our endpoint addresses in
 	// order to detect when there are ambiguous moves.
-	type AbsMoveEndpoint struct {
-		Other     addrs.AbsMoveable
-		StmtRange tfdiags.SourceRange
-	}
-	stmtFrom := addrs.MakeMap[addrs.AbsMoveable, AbsMoveEndpoint]()
-	stmtTo := addrs.MakeMap[addrs.AbsMoveable, AbsMoveEndpoint]()
+	conflicts := newMoveConflicts(func(addr addrs.AbsMoveable) addrs.UniqueKey {
+		return addr.UniqueKey()
+	})
 
 	for _, stmt := range stmts {
 		// Earlier code that constructs MoveStatement values should ensure that
@@ -63,38 +60,12 @@ func ValidateMoves(stmts []MoveStatement, rootCfg *configs.Config, declaredInsts
 
 			absTo := stmt.To.InModuleInstance(fromModInst)
 
-			if addrs.Equivalent(absFrom, absTo) {
-				diags = diags.Append(&hcl.Diagnostic{
-					Severity: hcl.DiagError,
-					Summary:  "Redundant move statement",
-					Detail: fmt.Sprintf(
-						"This statement declares a move from %s to the same address, which is the same as not declaring this move at all.",
-						absFrom,
-					),
-					Subject: stmt.DeclRange.ToHCL().Ptr(),
-				})
+			if redundant := conflicts.checkRedundant(absFrom, absTo, stmt.DeclRange); redundant.HasErrors() {
+				diags = diags.Append(redundant)
 				continue
 			}
 
-			var noun string
-			var shortNoun string
-			switch absFrom.(type) {
-			case addrs.ModuleInstance:
-				noun = "module instance"
-				shortNoun = "instance"
-			case addrs.AbsModuleCall:
-				noun = "module call"
-				shortNoun = "call"
-			case addrs.AbsResourceInstance:
-				noun = "resource instance"
-				shortNoun = "instance"
-			case addrs.AbsResource:
-				noun = "resource"
-				shortNoun = "resource"
-			default:
-				// The above cases should cover all of the AbsMoveable types
-				panic("unsupported AbsMoveable address type")
-			}
+			noun, shortNoun := moveableNouns(absFrom)
 
 			// It's invalid to have a move statement whose "from" address
 			// refers to something that is still declared in the configuration.
@@ -119,47 +90,9 @@ func ValidateMoves(stmts []MoveStatement, rootCfg *configs.Config, declaredInsts
 				})
 			}
 
-			// There can only be one destination for each source address.
-			if existing, exists := stmtFrom.GetOk(absFrom); exists {
-				if !addrs.Equivalent(existing.Other, absTo) {
-					diags = diags.Append(&hcl.Diagnostic{
-						Severity: hcl.DiagError,
-						Summary:  "Ambiguous move statements",
-						Detail: fmt.Sprintf(
-							"A statement at %s declared that %s moved to %s, but this statement instead declares that it moved to %s.\n\nEach %s can move to only one destination %s.",
-							existing.StmtRange.StartString(), absFrom, existing.Other, absTo,
-							noun, shortNoun,
-						),
-						Subject: stmt.DeclRange.ToHCL().Ptr(),
-					})
-				}
-			} else {
-				stmtFrom.Put(absFrom, AbsMoveEndpoint{
-					Other:     absTo,
-					StmtRange: stmt.DeclRange,
-				})
-			}
-
-			// There can only be one source for each destination address.
-			if existing, exists := stmtTo.GetOk(absTo); exists {
-				if !addrs.Equivalent(existing.Other, absFrom) {
-					diags = diags.Append(&hcl.Diagnostic{
-						Severity: hcl.DiagError,
-						Summary:  "Ambiguous move statements",
-						Detail: fmt.Sprintf(
-							"A statement at %s declared that %s moved to %s, but this statement instead declares that %s moved there.\n\nEach %s can have moved from only one source %s.",
-							existing.StmtRange.StartString(), existing.Other, absTo, absFrom,
-							noun, shortNoun,
-						),
-						Subject: stmt.DeclRange.ToHCL().Ptr(),
-					})
-				}
-			} else {
-				stmtTo.Put(absTo, AbsMoveEndpoint{
-					Other:     absFrom,
-					StmtRange: stmt.DeclRange,
-				})
-			}
+			// There can only be one destination for each source address, and
+			// one source for each destination address.
+			diags = diags.Append(conflicts.checkAmbiguous(absFrom, absTo, stmt.DeclRange, noun, shortNoun))
 
 			// Resource types must match.
 			if resourceTypesDiffer(absFrom, absTo) {
@@ -190,6 +123,122 @@ func ValidateMoves(stmts []MoveStatement, rootCfg *configs.Config, declaredInsts
 	return diags
 }
 
+// moveableNouns returns the nouns that describe the kind of object the given
+// address refers to in diagnostic messages: a full noun such as "module
+// instance", and a short one such as "instance" to use once the full one
+// was given.
+func moveableNouns(addr addrs.AbsMoveable) (noun, shortNoun string) {
+	switch addr.(type) {
+	case addrs.ModuleInstance:
+		return "module instance", "instance"
+	case addrs.AbsModuleCall:
+		return "module call", "call"
+	case addrs.AbsResourceInstance:
+		return "resource instance", "instance"
+	case addrs.AbsResource:
+		return "resource", "resource"
+	default:
+		// The above cases should cover all of the AbsMoveable types
+		panic("unsupported AbsMoveable address type")
+	}
+}
+
+// moveConflicts detects the move statements that contradict the statements
+// checked before them, comparing the move endpoints by the key the given
+// function returns for them. ValidateMoves checks the absolute addresses of
+// the moves in each module instance, and ReportMoves the statements as
+// declared.
+type moveConflicts[T fmt.Stringer, K comparable] struct {
+	key func(T) K
+
+	// from and to record the first statement seen for each source and
+	// destination address, with the other end of its move.
+	from map[K]moveConflictEndpoint[T]
+	to   map[K]moveConflictEndpoint[T]
+}
+
+type moveConflictEndpoint[T any] struct {
+	Other     T
+	StmtRange tfdiags.SourceRange
+}
+
+func newMoveConflicts[T fmt.Stringer, K comparable](key func(T) K) *moveConflicts[T, K] {
+	return &moveConflicts[T, K]{
+		key:  key,
+		from: make(map[K]moveConflictEndpoint[T]),
+		to:   make(map[K]moveConflictEndpoint[T]),
+	}
+}
+
+// checkRedundant returns an error if the statement declared at stmtRange
+// moves an object to its own address.
+func (c *moveConflicts[T, K]) checkRedundant(from, to T, stmtRange tfdiags.SourceRange) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if c.key(from) == c.key(to) {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Redundant move statement",
+			Detail: fmt.Sprintf(
+				"This statement declares a move from %s to the same address, which is the same as not declaring this move at all.",
+				from,
+			),
+			Subject: stmtRange.ToHCL().Ptr(),
+		})
+	}
+	return diags
+}
+
+// checkAmbiguous returns an error if an earlier statement moves the same
+// source to another destination, or another source to the same destination,
+// as the statement declared at stmtRange. The nouns describe the kind of
+// object that moves, as returned by moveableNouns.
+func (c *moveConflicts[T, K]) checkAmbiguous(from, to T, stmtRange tfdiags.SourceRange, noun, shortNoun string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	fromKey, toKey := c.key(from), c.key(to)
+
+	if existing, exists := c.from[fromKey]; exists {
+		if c.key(existing.Other) != toKey {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Ambiguous move statements",
+				Detail: fmt.Sprintf(
+					"A statement at %s declared that %s moved to %s, but this statement instead declares that it moved to %s.\n\nEach %s can move to only one destination %s.",
+					existing.StmtRange.StartString(), from, existing.Other, to,
+					noun, shortNoun,
+				),
+				Subject: stmtRange.ToHCL().Ptr(),
+			})
+		}
+	} else {
+		c.from[fromKey] = moveConflictEndpoint[T]{
+			Other:     to,
+			StmtRange: stmtRange,
+		}
+	}
+
+	if existing, exists := c.to[toKey]; exists {
+		if c.key(existing.Other) != fromKey {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Ambiguous move statements",
+				Detail: fmt.Sprintf(
+					"A statement at %s declared that %s moved to %s, but this statement instead declares that %s moved there.\n\nEach %s can have moved from only one source %s.",
+					existing.StmtRange.StartString(), existing.Other, to, from,
+					noun, shortNoun,
+				),
+				Subject: stmtRange.ToHCL().Ptr(),
+			})
+		}
+	} else {
+		c.to[toKey] = moveConflictEndpoint[T]{
+			Other:     from,
+			StmtRange: stmtRange,
+		}
+	}
+
+	return diags
+}
+
 func validateMoveStatementGraph(g *dag.AcyclicGraph) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	for _, cycle := range g.Cycles() {
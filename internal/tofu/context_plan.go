@@ -187,13 +187,23 @@ func (c *Context) Plan(config *configs.Config, prevRunState *states.State, opts
 	diags = diags.Append(varDiags)
 
 	if len(opts.Targets) > 0 {
-		diags = diags.Append(tfdiags.Sourceless(
-			tfdiags.Warning,
-			"Resource targeting is in effect",
-			`You are creating a plan with the -target option, which means that the result of this plan may not represent all of the changes requested by the current configuration.
+		if opts.Mode == plans.RefreshOnlyMode {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Resource targeting is in effect",
+				`You are creating a refresh-only plan with the -target option, so this is a partial refresh: only the targeted resources and the resources and data sources they depend on were refreshed. All other resources retain their existing state, which may not reflect changes made outside of OpenTofu.
 
 The -target option is not for routine use, and is provided only for exceptional situations such as recovering from errors or mistakes, or when OpenTofu specifically suggests to use it as part of an error message.`,
-		))
+			))
+		} else {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Resource targeting is in effect",
+				`You are creating a plan with the -target option, which means that the result of this plan may not represent all of the changes requested by the current configuration.
+
+The -target option is not for routine use, and is provided only for exceptional situations such as recovering from errors or mistakes, or when OpenTofu specifically suggests to use it as part of an error message.`,
+			))
+		}
 	}
 
 	var plan *plans.Plan
@@ -1841,6 +1841,84 @@ func TestContext2Plan_movedResourceRefreshOnly(t *testing.T) {
 	})
 }
 
+func TestContext2Plan_providerForEach(t *testing.T) {
+	m := testModuleInline(t, map[string]string{
+		"main.tf": `
+			locals {
+				regions = {
+					east = "us-east-1"
+					west = "us-west-2"
+				}
+			}
+
+			provider "test" {
+				for_each    = local.regions
+				test_string = "${each.key}:${each.value}"
+			}
+
+			resource "test_object" "east" {
+				provider    = test.east
+				test_string = "east"
+			}
+
+			resource "test_object" "west" {
+				provider    = test.west
+				test_string = "west"
+			}
+		`,
+	})
+
+	// Each provider configuration gets its own provider instance, so that we
+	// can check which configuration planned each resource.
+	var lock sync.Mutex
+	planned := map[string]string{}
+	factory := func() (providers.Interface, error) {
+		p := simpleMockProvider()
+		var configured string
+		p.ConfigureProviderFn = func(req providers.ConfigureProviderRequest) providers.ConfigureProviderResponse {
+			configured = req.Config.GetAttr("test_string").AsString()
+			return providers.ConfigureProviderResponse{}
+		}
+		p.PlanResourceChangeFn = func(req providers.PlanResourceChangeRequest) providers.PlanResourceChangeResponse {
+			lock.Lock()
+			defer lock.Unlock()
+			planned[req.Config.GetAttr("test_string").AsString()] = configured
+			return providers.PlanResourceChangeResponse{
+				PlannedState: req.ProposedNewState,
+			}
+		}
+		return p, nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Providers: map[addrs.Provider]providers.Factory{
+			addrs.NewDefaultProvider("test"): factory,
+		},
+	})
+
+	plan, diags := ctx.Plan(m, states.NewState(), DefaultPlanOpts)
+	assertNoErrors(t, diags)
+
+	want := map[string]string{
+		"east": "east:us-east-1",
+		"west": "west:us-west-2",
+	}
+	if diff := cmp.Diff(want, planned); diff != "" {
+		t.Errorf("resources planned with the wrong provider configurations\n%s", diff)
+	}
+
+	for _, name := range []string{"east", "west"} {
+		addr := mustResourceInstanceAddr("test_object." + name)
+		change := plan.Changes.ResourceInstance(addr)
+		if change == nil {
+			t.Fatalf("no change planned for %s", addr)
+		}
+		if got, want := change.ProviderAddr.String(), `provider["registry.opentofu.org/hashicorp/test"].`+name; got != want {
+			t.Errorf("wrong provider for %s\ngot:  %s\nwant: %s", addr, got, want)
+		}
+	}
+}
+
 func TestContext2Plan_refreshOnlyMode(t *testing.T) {
 	addr := mustResourceInstanceAddr("test_object.a")
 
@@ -1972,6 +2050,103 @@ func TestContext2Plan_refreshOnlyMode(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_refreshOnlyMode_targeted(t *testing.T) {
+	addrA := mustResourceInstanceAddr("test_object.a")
+	addrB := mustResourceInstanceAddr("test_object.b")
+
+	m := testModuleInline(t, map[string]string{
+		"main.tf": `
+			data "test_object" "d" {
+				test_string = "data"
+			}
+
+			resource "test_object" "a" {
+				test_string = data.test_object.d.test_string
+			}
+
+			resource "test_object" "b" {
+				test_string = "b"
+			}
+		`,
+	})
+	state := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(addrA, &states.ResourceInstanceObjectSrc{
+			AttrsJSON: []byte(`{"test_string":"before"}`),
+			Status:    states.ObjectReady,
+		}, mustProviderConfig(`provider["registry.opentofu.org/hashicorp/test"]`))
+		s.SetResourceInstanceCurrent(addrB, &states.ResourceInstanceObjectSrc{
+			AttrsJSON: []byte(`{"test_string":"before"}`),
+			Status:    states.ObjectReady,
+		}, mustProviderConfig(`provider["registry.opentofu.org/hashicorp/test"]`))
+	})
+
+	p := simpleMockProvider()
+	p.ReadDataSourceFn = func(req providers.ReadDataSourceRequest) providers.ReadDataSourceResponse {
+		return providers.ReadDataSourceResponse{
+			State: req.Config,
+		}
+	}
+	var readLock sync.Mutex
+	var read []string
+	p.ReadResourceFn = func(req providers.ReadResourceRequest) providers.ReadResourceResponse {
+		readLock.Lock()
+		defer readLock.Unlock()
+		read = append(read, req.TypeName)
+		return providers.ReadResourceResponse{
+			NewState: cty.ObjectVal(map[string]cty.Value{
+				"test_string": cty.StringVal("current"),
+				"test_number": cty.NullVal(cty.Number),
+				"test_bool":   cty.NullVal(cty.Bool),
+				"test_list":   cty.NullVal(cty.List(cty.String)),
+				"test_map":    cty.NullVal(cty.Map(cty.String)),
+			}),
+		}
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Providers: map[addrs.Provider]providers.Factory{
+			addrs.NewDefaultProvider("test"): testProviderFuncFixed(p),
+		},
+	})
+
+	plan, diags := ctx.Plan(m, state, &PlanOpts{
+		Mode: plans.RefreshOnlyMode,
+		Targets: []addrs.Targetable{
+			addrA,
+		},
+	})
+	assertNoErrors(t, diags)
+
+	if len(read) != 1 {
+		t.Errorf("expected only the targeted resource to be refreshed, got %d reads", len(read))
+	}
+	if !p.ReadDataSourceCalled {
+		t.Errorf("Provider's ReadDataSource wasn't called; the data source the target depends on should've been read")
+	}
+
+	if instState := plan.PriorState.ResourceInstance(addrA); instState == nil || instState.Current == nil {
+		t.Errorf("%s has no current object after plan", addrA)
+	} else if got, want := instState.Current.AttrsJSON, `"current"`; !bytes.Contains(got, []byte(want)) {
+		t.Errorf("%s wasn't refreshed\ngot:\n%s\n\nwant substring: %s", addrA, got, want)
+	}
+	if instState := plan.PriorState.ResourceInstance(addrB); instState == nil || instState.Current == nil {
+		t.Errorf("%s has no current object after plan", addrB)
+	} else if got, want := instState.Current.AttrsJSON, `"before"`; !bytes.Contains(got, []byte(want)) {
+		t.Errorf("%s should have retained its existing state\ngot:\n%s\n\nwant substring: %s", addrB, got, want)
+	}
+
+	var found bool
+	for _, diag := range diags {
+		desc := diag.Description()
+		if desc.Summary == "Resource targeting is in effect" && strings.Contains(desc.Detail, "partial refresh") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing the partial refresh warning\n%s", diags.ErrWithWarnings())
+	}
+}
+
 func TestContext2Plan_refreshOnlyMode_deposed(t *testing.T) {
 	addr := mustResourceInstanceAddr("test_object.a")
 	deposedKey := states.DeposedKey("byebye")
@@ -67,6 +67,10 @@ type Evaluator struct {
 	// ensures they can be safely accessed and modified concurrently.
 	Changes *plans.ChangesSync
 
+	// PlanChanges are the changes summarized by the "plan" object in the
+	// assertions of testing "run" blocks, nil outside of them.
+	PlanChanges *plans.Changes
+
 	PlanTimestamp time.Time
 }
 
@@ -1017,6 +1021,31 @@ func (d *evaluationStateData) GetCheckBlock(addr addrs.Check, rng tfdiags.Source
 	return cty.NilVal, diags
 }
 
+func (d *evaluationStateData) GetPlanAttr(addr addrs.PlanAttr, rng tfdiags.SourceRange) (cty.Value, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	if d.Evaluator.PlanChanges == nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to \"plan\" in invalid context",
+			Detail:   "The \"plan\" object can only be referenced from the assertions of a OpenTofu testing \"run\" block.",
+			Subject:  rng.ToHCL().Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+
+	val, ok := planChangesSummary(d.Evaluator.PlanChanges)[addr.Name]
+	if !ok {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid \"plan\" attribute",
+			Detail:   fmt.Sprintf(`The "plan" object does not have an attribute named %q. The supported attributes are plan.add, plan.change, plan.destroy, plan.import and plan.resource_changes.`, addr.Name),
+			Subject:  rng.ToHCL().Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+	return val, diags
+}
+
 // moduleDisplayAddr returns a string describing the given module instance
 // address that is appropriate for returning to users in situations where the
 // root module is possible. Specifically, it returns "the root module" if the
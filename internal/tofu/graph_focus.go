@@ -0,0 +1,71 @@
+// Copyright (c) The OpenTofu Authors
+// SPDX-License-Identifier: MPL-2.0
+// Copyright (c) 2023 HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tofu
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/opentofu/opentofu/internal/addrs"
+	"github.com/opentofu/opentofu/internal/dag"
+)
+
+// FocusGraph reduces the given graph to the neighborhood of the resources
+// matching the given addresses: the resource nodes themselves, the nodes they
+// depend on and the nodes that depend on them, up to the given number of
+// edges away. A negative depth includes all of the dependencies and
+// dependents, however indirect.
+//
+// The addresses are matched the same way as the -target option. FocusGraph
+// returns an error if none of the nodes of the graph match.
+func FocusGraph(g *Graph, focus []addrs.Targetable, depth int) error {
+	targets := &TargetsTransformer{}
+	var focused []dag.Vertex
+	for _, v := range g.Vertices() {
+		if targets.nodeIsTarget(v, focus) {
+			focused = append(focused, v)
+		}
+	}
+	if len(focused) == 0 {
+		return fmt.Errorf("none of the resources in the graph match the given addresses")
+	}
+
+	keep := make(dag.Set)
+	for _, v := range focused {
+		keep.Add(v)
+	}
+
+	// We walk the dependencies and the dependents separately, so that the
+	// other dependents of a dependency aren't included.
+	walk := func(next func(dag.Vertex) dag.Set) {
+		visited := make(dag.Set)
+		current := focused
+		for level := 0; len(current) > 0 && (depth < 0 || level < depth); level++ {
+			var nextLevel []dag.Vertex
+			for _, v := range current {
+				for _, n := range next(v) {
+					if visited.Include(n) {
+						continue
+					}
+					visited.Add(n)
+					keep.Add(n)
+					nextLevel = append(nextLevel, n)
+				}
+			}
+			current = nextLevel
+		}
+	}
+	walk(g.DownEdges)
+	walk(g.UpEdges)
+
+	for _, v := range g.Vertices() {
+		if !keep.Include(v) {
+			log.Printf("[TRACE] FocusGraph: removing %q", dag.VertexName(v))
+			g.Remove(v)
+		}
+	}
+	return nil
+}
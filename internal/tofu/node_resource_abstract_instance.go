@@ -1396,6 +1396,23 @@ func processIgnoreChangesIndividual(prior, config cty.Value, ignoreChangesPath [
 			}
 
 			key := ignored.key.AsString()
+			if prefix, ok := ignoreChangesKeyPrefix(key); ok {
+				// A trailing wildcard ignores all of the keys with the given
+				// prefix, leaving the other keys of the map untouched.
+				for k := range configMap {
+					if _, exists := priorMap[k]; strings.HasPrefix(k, prefix) && !exists {
+						delete(configMap, k)
+					}
+				}
+				for k, priorElem := range priorMap {
+					if strings.HasPrefix(k, prefix) {
+						configMap[k] = priorElem
+					}
+				}
+				continue
+			}
+			key = unescapeIgnoreChangesKey(key)
+
 			priorElem, keep := priorMap[key]
 
 			switch {
@@ -1429,6 +1446,27 @@ func processIgnoreChangesIndividual(prior, config cty.Value, ignoreChangesPath [
 	return ret, nil
 }
 
+// ignoreChangesKeyPrefix returns the prefix of a map key from ignore_changes
+// that ends with the "*" wildcard, which ignores all of the keys of the map
+// starting with that prefix. A trailing "*" escaped with a backslash isn't a
+// wildcard, see unescapeIgnoreChangesKey.
+func ignoreChangesKeyPrefix(key string) (string, bool) {
+	if strings.HasSuffix(key, `\*`) {
+		return "", false
+	}
+	return strings.CutSuffix(key, "*")
+}
+
+// unescapeIgnoreChangesKey returns the map key that a key from ignore_changes
+// without a wildcard ignores, which is the key itself unless it ends with an
+// escaped "*" that stands for a literal one.
+func unescapeIgnoreChangesKey(key string) string {
+	if prefix, ok := strings.CutSuffix(key, `\*`); ok {
+		return prefix + "*"
+	}
+	return key
+}
+
 type ProviderWithEncryption interface {
 	ReadDataSourceEncrypted(req providers.ReadDataSourceRequest, path addrs.AbsResourceInstance, enc encryption.Encryption) providers.ReadDataSourceResponse
 }
@@ -213,6 +213,107 @@ func TestProcessIgnoreChangesIndividual(t *testing.T) {
 				"b": cty.StringVal("b value"),
 			}),
 		},
+		"map_index_prefix": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"kubernetes.io/a": cty.StringVal("a value"),
+					"kubernetes.io/b": cty.StringVal("b value"),
+					"kubernetes.io":   cty.StringVal("sibling value"),
+					"other":           cty.StringVal("other value"),
+				}),
+				"b": cty.StringVal("b value"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"kubernetes.io/a": cty.StringVal("new a value"),
+					"kubernetes.io/c": cty.StringVal("new c value"),
+					"kubernetes.io":   cty.StringVal("new sibling value"),
+					"other":           cty.StringVal("new other value"),
+				}),
+				"b": cty.StringVal("new b value"),
+			}),
+			[]string{`a["kubernetes.io/*"]`},
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"kubernetes.io/a": cty.StringVal("a value"),
+					"kubernetes.io/b": cty.StringVal("b value"),
+					"kubernetes.io":   cty.StringVal("new sibling value"),
+					"other":           cty.StringVal("new other value"),
+				}),
+				"b": cty.StringVal("new b value"),
+			}),
+		},
+		"map_index_prefix_with_key": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a0":   cty.StringVal("a0 value"),
+					"b0":   cty.StringVal("b0 value"),
+					"keep": cty.StringVal("keep value"),
+				}),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a1":   cty.StringVal("new a1 value"),
+					"b0":   cty.StringVal("new b0 value"),
+					"keep": cty.StringVal("new keep value"),
+				}),
+			}),
+			[]string{`a["a*"]`, `a["b0"]`},
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a0":   cty.StringVal("a0 value"),
+					"b0":   cty.StringVal("b0 value"),
+					"keep": cty.StringVal("new keep value"),
+				}),
+			}),
+		},
+		"map_index_literal_wildcard_key": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("a* value"),
+					"ab": cty.StringVal("ab value"),
+				}),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("new a* value"),
+					"ab": cty.StringVal("new ab value"),
+					"ac": cty.StringVal("new ac value"),
+				}),
+			}),
+			[]string{`a["a\\*"]`},
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("a* value"),
+					"ab": cty.StringVal("new ab value"),
+					"ac": cty.StringVal("new ac value"),
+				}),
+			}),
+		},
+		"map_index_prefix_matches_wildcard_key": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("a* value"),
+					"ab": cty.StringVal("ab value"),
+					"b":  cty.StringVal("b value"),
+				}),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("new a* value"),
+					"ab": cty.StringVal("new ab value"),
+					"b":  cty.StringVal("new b value"),
+				}),
+			}),
+			[]string{`a["a*"]`},
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.MapVal(map[string]cty.Value{
+					"a*": cty.StringVal("a* value"),
+					"ab": cty.StringVal("ab value"),
+					"b":  cty.StringVal("new b value"),
+				}),
+			}),
+		},
 		"map_index_redundant": {
 			cty.ObjectVal(map[string]cty.Value{
 				"a": cty.MapVal(map[string]cty.Value{
@@ -95,6 +95,7 @@ func (ctx *TestContext) evaluate(state *states.SyncState, changes *plans.Changes
 				return variables
 			}(),
 			VariableValuesLock: new(sync.Mutex),
+			PlanChanges:        ctx.Plan.Changes,
 			PlanTimestamp:      ctx.Plan.Timestamp,
 		},
 		ModulePath:      nil, // nil for the root module
@@ -236,6 +237,69 @@ func (ctx *TestContext) evaluate(state *states.SyncState, changes *plans.Changes
 	}
 }
 
+// planChangesSummary returns the attributes of the "plan" object that test
+// assertions can reference to check the planned changes: the number of
+// resource instances to add, change, destroy and import, like in the summary
+// of the human-readable plan, and the action planned for each resource
+// instance by its address.
+func planChangesSummary(changes *plans.Changes) map[string]cty.Value {
+	var add, change, destroy, imports int64
+	actions := make(map[string]cty.Value)
+	for _, rc := range changes.Resources {
+		if rc.DeposedKey == states.NotDeposed {
+			actions[rc.Addr.String()] = cty.StringVal(planActionName(rc.Action))
+		}
+		if rc.Addr.Resource.Resource.Mode != addrs.ManagedResourceMode {
+			continue
+		}
+		if rc.Importing != nil {
+			imports++
+		}
+		switch rc.Action {
+		case plans.Create:
+			add++
+		case plans.Update:
+			change++
+		case plans.Delete:
+			destroy++
+		case plans.DeleteThenCreate, plans.CreateThenDelete:
+			add++
+			destroy++
+		}
+	}
+
+	resourceChanges := cty.MapValEmpty(cty.String)
+	if len(actions) > 0 {
+		resourceChanges = cty.MapVal(actions)
+	}
+	return map[string]cty.Value{
+		"add":              cty.NumberIntVal(add),
+		"change":           cty.NumberIntVal(change),
+		"destroy":          cty.NumberIntVal(destroy),
+		"import":           cty.NumberIntVal(imports),
+		"resource_changes": resourceChanges,
+	}
+}
+
+func planActionName(action plans.Action) string {
+	switch action {
+	case plans.Create:
+		return "create"
+	case plans.Read:
+		return "read"
+	case plans.Update:
+		return "update"
+	case plans.DeleteThenCreate, plans.CreateThenDelete:
+		return "replace"
+	case plans.Delete:
+		return "delete"
+	case plans.Forget:
+		return "forget"
+	default:
+		return "no-op"
+	}
+}
+
 // synchronizeStates compares the planned state to the current state and incorporates any missing modules
 // from the planned state into the current state.
 //
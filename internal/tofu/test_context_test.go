@@ -529,6 +529,168 @@ run "test_case" {
 				},
 			},
 		},
+		"plan_changes_passing": {
+			configs: map[string]string{
+				"main.tf": `
+resource "test_resource" "a" {
+	value = "Hello, world!"
+}
+`,
+				"main.tftest.hcl": `
+run "test_case" {
+	assert {
+		condition = plan.add == 1 && plan.change == 0 && plan.destroy == 0
+		error_message = "unexpected change counts"
+	}
+	assert {
+		condition = plan.resource_changes["test_resource.a"] == "create"
+		error_message = "unexpected resource action"
+	}
+}
+`,
+			},
+			state: states.BuildState(func(state *states.SyncState) {
+				state.SetResourceInstanceCurrent(
+					addrs.Resource{
+						Mode: addrs.ManagedResourceMode,
+						Type: "test_resource",
+						Name: "a",
+					}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+					&states.ResourceInstanceObjectSrc{
+						Status: states.ObjectPlanned,
+						AttrsJSON: encodeCtyValue(t, cty.NullVal(cty.Object(map[string]cty.Type{
+							"value": cty.String,
+						}))),
+					},
+					addrs.AbsProviderConfig{
+						Module:   addrs.RootModule,
+						Provider: addrs.NewDefaultProvider("test"),
+					})
+			}),
+			plan: &plans.Plan{
+				Changes: &plans.Changes{
+					Resources: []*plans.ResourceInstanceChangeSrc{
+						{
+							Addr: addrs.Resource{
+								Mode: addrs.ManagedResourceMode,
+								Type: "test_resource",
+								Name: "a",
+							}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+							ProviderAddr: addrs.AbsProviderConfig{
+								Module:   addrs.RootModule,
+								Provider: addrs.NewDefaultProvider("test"),
+							},
+							ChangeSrc: plans.ChangeSrc{
+								Action: plans.Create,
+								Before: nil,
+								After: encodeDynamicValue(t, cty.ObjectVal(map[string]cty.Value{
+									"value": cty.StringVal("Hello, world!"),
+								})),
+							},
+						},
+					},
+				},
+			},
+			provider: &MockProvider{
+				GetProviderSchemaResponse: &providers.GetProviderSchemaResponse{
+					ResourceTypes: map[string]providers.Schema{
+						"test_resource": {
+							Block: &configschema.Block{
+								Attributes: map[string]*configschema.Attribute{
+									"value": {
+										Type:     cty.String,
+										Required: true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedStatus: moduletest.Pass,
+		},
+		"plan_changes_failing": {
+			configs: map[string]string{
+				"main.tf": `
+resource "test_resource" "a" {
+	value = "Hello, world!"
+}
+`,
+				"main.tftest.hcl": `
+run "test_case" {
+	assert {
+		condition = plan.destroy == 1
+		error_message = "expected a destroy"
+	}
+}
+`,
+			},
+			state: states.BuildState(func(state *states.SyncState) {
+				state.SetResourceInstanceCurrent(
+					addrs.Resource{
+						Mode: addrs.ManagedResourceMode,
+						Type: "test_resource",
+						Name: "a",
+					}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+					&states.ResourceInstanceObjectSrc{
+						Status: states.ObjectPlanned,
+						AttrsJSON: encodeCtyValue(t, cty.NullVal(cty.Object(map[string]cty.Type{
+							"value": cty.String,
+						}))),
+					},
+					addrs.AbsProviderConfig{
+						Module:   addrs.RootModule,
+						Provider: addrs.NewDefaultProvider("test"),
+					})
+			}),
+			plan: &plans.Plan{
+				Changes: &plans.Changes{
+					Resources: []*plans.ResourceInstanceChangeSrc{
+						{
+							Addr: addrs.Resource{
+								Mode: addrs.ManagedResourceMode,
+								Type: "test_resource",
+								Name: "a",
+							}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+							ProviderAddr: addrs.AbsProviderConfig{
+								Module:   addrs.RootModule,
+								Provider: addrs.NewDefaultProvider("test"),
+							},
+							ChangeSrc: plans.ChangeSrc{
+								Action: plans.Create,
+								Before: nil,
+								After: encodeDynamicValue(t, cty.ObjectVal(map[string]cty.Value{
+									"value": cty.StringVal("Hello, world!"),
+								})),
+							},
+						},
+					},
+				},
+			},
+			provider: &MockProvider{
+				GetProviderSchemaResponse: &providers.GetProviderSchemaResponse{
+					ResourceTypes: map[string]providers.Schema{
+						"test_resource": {
+							Block: &configschema.Block{
+								Attributes: map[string]*configschema.Attribute{
+									"value": {
+										Type:     cty.String,
+										Required: true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedStatus: moduletest.Fail,
+			expectedDiags: []tfdiags.Description{
+				{
+					Summary: "Test assertion failed",
+					Detail:  "expected a destroy",
+				},
+			},
+		},
 	}
 	for name, tc := range tcs {
 		t.Run(name, func(t *testing.T) {
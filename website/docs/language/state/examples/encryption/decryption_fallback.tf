@@ -0,0 +1,13 @@
+terraform {
+  encryption {
+    # Methods and key providers here.
+
+    state {
+      method = method.some_method.new_method
+      decryption_fallback = [
+        method.some_method.old_method,
+        method.some_method.oldest_method,
+      ]
+    }
+  }
+}
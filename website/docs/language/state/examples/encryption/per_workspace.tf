@@ -0,0 +1,25 @@
+terraform {
+  encryption {
+    # The key provider that encrypted the state before the keys became per-workspace
+    key_provider "pbkdf2" "shared" {
+      passphrase = var.shared_passphrase
+    }
+    key_provider "aws_kms" "workspace" {
+      kms_key_id = "alias/tofu-state-${terraform.workspace}"
+      region     = "us-east-1"
+      key_spec   = "AES_256"
+    }
+    method "aes_gcm" "shared" {
+      keys = key_provider.pbkdf2.shared
+    }
+    method "aes_gcm" "workspace" {
+      keys = key_provider.aws_kms.workspace
+    }
+    state {
+      method = method.aes_gcm.workspace
+      fallback {
+        method = method.aes_gcm.shared
+      }
+    }
+  }
+}